@@ -0,0 +1,177 @@
+package actions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"agent/config"
+	"agent/metrics"
+)
+
+// maxOutput caps the script output reported back to the server
+const maxOutput = 4096
+
+// Result is the outcome of a script run, reported as a command_result message
+type Result struct {
+	Script     string    `json:"script"`
+	AlertType  string    `json:"alert_type"`
+	AlertLevel string    `json:"alert_level"`
+	ExitCode   int       `json:"exit_code"`
+	Output     string    `json:"output"`
+	Error      string    `json:"error,omitempty"`
+	TimedOut   bool      `json:"timed_out"`
+	Duration   float64   `json:"duration"` // seconds
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// Runner runs the local scripts configured for alerts. A rule doesn't start
+// again while its script is still running or within the cooldown after it.
+type Runner struct {
+	rules    []config.AlertAction
+	allowed  map[string]bool
+	timeout  time.Duration
+	cooldown time.Duration
+	report   func(Result)
+
+	mu      sync.Mutex
+	running map[int]bool
+	lastRun map[int]time.Time
+}
+
+// NewRunner returns a runner for the configured rules, or nil when alert
+// actions are disabled. report is called with each script's result.
+func NewRunner(cfg config.AlertActionsConfig, report func(Result)) *Runner {
+	if !cfg.Enabled || len(cfg.Rules) == 0 {
+		return nil
+	}
+
+	allowed := make(map[string]bool, len(cfg.AllowedScripts))
+	for _, script := range cfg.AllowedScripts {
+		allowed[filepath.Clean(script)] = true
+	}
+
+	return &Runner{
+		rules:    cfg.Rules,
+		allowed:  allowed,
+		timeout:  time.Duration(cfg.Timeout) * time.Second,
+		cooldown: time.Duration(cfg.Cooldown) * time.Second,
+		report:   report,
+		running:  make(map[int]bool),
+		lastRun:  make(map[int]time.Time),
+	}
+}
+
+// Handle starts the script of every rule matching the alert in the background
+func (r *Runner) Handle(alert metrics.Alert) {
+	if r == nil {
+		return
+	}
+
+	for i, rule := range r.rules {
+		if rule.Type != alert.Type || (rule.Level != "" && rule.Level != alert.Level) {
+			continue
+		}
+		if !r.start(i) {
+			continue
+		}
+		go r.run(i, rule, alert)
+	}
+}
+
+// start claims rule i for a run unless it is running or cooling down
+func (r *Runner) start(i int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running[i] || time.Since(r.lastRun[i]) < r.cooldown {
+		return false
+	}
+	r.running[i] = true
+	r.lastRun[i] = time.Now()
+	return true
+}
+
+func (r *Runner) run(i int, rule config.AlertAction, alert metrics.Alert) {
+	defer func() {
+		r.mu.Lock()
+		r.running[i] = false
+		r.mu.Unlock()
+	}()
+
+	result := r.execute(rule.Script, alert)
+	if result.Error != "" {
+		log.Printf("Alert action %s for %s alert failed: %s", rule.Script, alert.Type, result.Error)
+	} else {
+		log.Printf("Alert action %s for %s alert finished in %.1fs", rule.Script, alert.Type, result.Duration)
+	}
+
+	if r.report != nil {
+		r.report(result)
+	}
+}
+
+// execute runs an allowlisted script with the alert passed in its
+// environment, killing it after the timeout
+func (r *Runner) execute(script string, alert metrics.Alert) Result {
+	result := Result{
+		Script:     script,
+		AlertType:  alert.Type,
+		AlertLevel: alert.Level,
+		ExitCode:   -1,
+		Timestamp:  time.Now(),
+	}
+
+	// Config validation already enforces this; check again right before exec
+	if !r.allowed[filepath.Clean(script)] {
+		result.Error = "script is not allowlisted"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, script)
+	cmd.Env = append(os.Environ(),
+		"MONITAUR_ALERT_TYPE="+alert.Type,
+		"MONITAUR_ALERT_LEVEL="+alert.Level,
+		"MONITAUR_ALERT_MESSAGE="+alert.Message,
+		fmt.Sprintf("MONITAUR_ALERT_VALUE=%g", alert.Value),
+		fmt.Sprintf("MONITAUR_ALERT_THRESHOLD=%g", alert.Threshold),
+	)
+	// Don't wait on children that inherited the output pipe after a kill
+	cmd.WaitDelay = time.Second
+
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	result.Duration = time.Since(start).Seconds()
+
+	if len(output) > maxOutput {
+		output = output[len(output)-maxOutput:]
+	}
+	result.Output = string(output)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		result.TimedOut = true
+		result.Error = fmt.Sprintf("timed out after %s", r.timeout)
+		return result
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.ExitCode = 0
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		result.Error = err.Error()
+	default:
+		result.Error = err.Error()
+	}
+	return result
+}
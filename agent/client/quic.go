@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// quicProtocol is the ALPN protocol of the backend's QUIC listener
+const quicProtocol = "monitaur-agent"
+
+// quicNormalClosure is the application error code of an orderly close
+const quicNormalClosure quic.ApplicationErrorCode = 0
+
+var quicConfig = &quic.Config{
+	HandshakeIdleTimeout: 10 * time.Second,
+	MaxIdleTimeout:       60 * time.Second,
+	KeepAlivePeriod:      15 * time.Second,
+}
+
+// quicHandshake opens the agent's stream, with what the WebSocket handshake
+// passes as query parameters
+type quicHandshake struct {
+	Token        string `json:"token"`
+	ServerName   string `json:"server_name"`
+	AgentVersion string `json:"agent_version"`
+}
+
+// quicHandshakeReply accepts the agent with status 200 or rejects it with
+// the status the WebSocket handshake would fail with
+type quicHandshakeReply struct {
+	Status int    `json:"status"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// quicRejectedError is returned when the server turns the agent away, as
+// opposed to QUIC not getting through
+type quicRejectedError struct {
+	reply quicHandshakeReply
+}
+
+func (e *quicRejectedError) Error() string {
+	return fmt.Sprintf("connection failed with status %d: %s", e.reply.Status, e.reply.Error)
+}
+
+// dialQUIC connects to the QUIC listener and authenticates on a new stream
+func (c *Client) dialQUIC() (*quicConnection, error) {
+	tlsConfig := &tls.Config{}
+	if c.tlsConfig != nil {
+		tlsConfig = c.tlsConfig.Clone()
+	}
+	tlsConfig.NextProtos = []string{quicProtocol}
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(c.quicAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid QUIC address: %w", err)
+		}
+		tlsConfig.ServerName = host
+	}
+
+	log.Printf("Connecting to %s over QUIC", c.quicAddress)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, c.quicAddress, tlsConfig, quicConfig)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		conn.CloseWithError(quicNormalClosure, "")
+		return nil, err
+	}
+	qc := &quicConnection{
+		conn:    conn,
+		stream:  stream,
+		encoder: json.NewEncoder(stream),
+		decoder: json.NewDecoder(stream),
+	}
+
+	deadline, _ := ctx.Deadline()
+	stream.SetDeadline(deadline)
+	var reply quicHandshakeReply
+	err = qc.WriteJSON(quicHandshake{Token: c.token, ServerName: c.serverName, AgentVersion: c.version})
+	if err == nil {
+		err = qc.ReadJSON(&reply)
+	}
+	if err != nil {
+		conn.CloseWithError(quicNormalClosure, "")
+		return nil, fmt.Errorf("QUIC handshake failed: %w", err)
+	}
+	stream.SetDeadline(time.Time{})
+
+	if reply.Status != http.StatusOK {
+		conn.CloseWithError(quicNormalClosure, "")
+		return nil, &quicRejectedError{reply: reply}
+	}
+	return qc, nil
+}
+
+// quicConnection carries messages as lines of JSON on a single QUIC stream
+type quicConnection struct {
+	conn    *quic.Conn
+	stream  *quic.Stream
+	encoder *json.Encoder
+	decoder *json.Decoder
+}
+
+// WriteJSON writes v followed by a newline, which ends the message
+func (c *quicConnection) WriteJSON(v interface{}) error {
+	return c.encoder.Encode(v)
+}
+
+func (c *quicConnection) ReadJSON(v interface{}) error {
+	return c.decoder.Decode(v)
+}
+
+// Ping reports whether the connection is still open; QUIC keep-alives probe
+// the server and close the connection when it stops answering
+func (c *quicConnection) Ping() error {
+	return context.Cause(c.conn.Context())
+}
+
+func (c *quicConnection) Close() error {
+	c.stream.Close()
+	return c.conn.CloseWithError(quicNormalClosure, "")
+}
+
+// CloseAndWait ends the agent's side of the stream and waits for the server
+// to end its own, which it does once it has handled every message
+func (c *quicConnection) CloseAndWait(timeout time.Duration) error {
+	defer c.conn.CloseWithError(quicNormalClosure, "")
+
+	if err := c.stream.Close(); err != nil {
+		return fmt.Errorf("failed to send close message: %w", err)
+	}
+
+	c.stream.SetReadDeadline(time.Now().Add(timeout))
+	_, err := io.Copy(io.Discard, c.stream)
+	var appErr *quic.ApplicationError
+	if err == nil || errors.As(err, &appErr) && appErr.Remote && appErr.ErrorCode == quicNormalClosure {
+		return nil
+	}
+	return fmt.Errorf("server did not acknowledge close: %w", err)
+}
@@ -0,0 +1,209 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/quic-go/quic-go"
+)
+
+// testTLS returns a server config with a self-signed certificate for
+// localhost speaking protocol, and a client config trusting it
+func testTLS(t *testing.T, protocol string) (*tls.Config, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	server := &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{protocol},
+	}
+	return server, &tls.Config{RootCAs: roots}
+}
+
+// quicServer accepts one agent connection, answers its handshake with
+// status and passes the messages that follow to messages
+func quicServer(t *testing.T, status int, messages chan<- Message) (string, *tls.Config) {
+	t.Helper()
+	serverTLS, clientTLS := testTLS(t, quicProtocol)
+	listener, err := quic.ListenAddr("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		stream, err := conn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		reader := bufio.NewReader(stream)
+
+		var handshake quicHandshake
+		line, err := reader.ReadBytes('\n')
+		if err != nil || json.Unmarshal(line, &handshake) != nil || handshake.Token != "token" {
+			conn.CloseWithError(1, "bad handshake")
+			return
+		}
+		json.NewEncoder(stream).Encode(quicHandshakeReply{Status: status, Error: http.StatusText(status)})
+		if status != http.StatusOK {
+			stream.Close()
+			return
+		}
+
+		// Answer the agent closing its side by closing ours
+		defer stream.Close()
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var message Message
+			if json.Unmarshal(line, &message) == nil {
+				messages <- message
+			}
+		}
+	}()
+
+	return listener.Addr().String(), clientTLS
+}
+
+// countingEndpoint is a WebSocket endpoint counting the agents connecting
+func countingEndpoint(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	var connections atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		connections.Add(1)
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), &connections
+}
+
+func newQUICClient(endpoint, address string, tlsConfig *tls.Config) *Client {
+	c := NewClient(endpoint, "token", "quic-test")
+	tlsConfig.ServerName = "localhost"
+	c.SetTLSConfig(tlsConfig)
+	c.SetQUICAddress(address)
+	return c
+}
+
+func TestConnectOverQUIC(t *testing.T) {
+	messages := make(chan Message, 1)
+	address, clientTLS := quicServer(t, http.StatusOK, messages)
+	endpoint, connections := countingEndpoint(t)
+
+	c := newQUICClient(endpoint, address, clientTLS)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.conn.(*quicConnection); !ok {
+		t.Fatalf("connected over %T, want QUIC", c.conn)
+	}
+
+	if err := c.SendAlert(map[string]string{"type": "cpu"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case message := <-messages:
+		if message.Type != "alert" || message.ServerName != "quic-test" {
+			t.Errorf("got %+v, want an alert from quic-test", message)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert never arrived")
+	}
+
+	if err := c.CloseAndWait(5 * time.Second); err != nil {
+		t.Errorf("CloseAndWait: %v", err)
+	}
+	if n := connections.Load(); n != 0 {
+		t.Errorf("%d WebSocket connections, want none", n)
+	}
+}
+
+func TestQUICRejectionDoesNotFallBack(t *testing.T) {
+	address, clientTLS := quicServer(t, http.StatusUnauthorized, nil)
+	endpoint, connections := countingEndpoint(t)
+
+	c := newQUICClient(endpoint, address, clientTLS)
+	err := c.Connect()
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("got %v, want a 401 rejection", err)
+	}
+	if n := connections.Load(); n != 0 {
+		t.Errorf("%d WebSocket connections after a rejection, want none", n)
+	}
+}
+
+func TestQUICFallsBackToWebSocket(t *testing.T) {
+	// A listener speaking another protocol fails the QUIC handshake
+	serverTLS, clientTLS := testTLS(t, "h3")
+	listener, err := quic.ListenAddr("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	endpoint, connections := countingEndpoint(t)
+
+	c := newQUICClient(endpoint, listener.Addr().String(), clientTLS)
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, ok := c.conn.(wsConnection); !ok {
+		t.Fatalf("connected over %T, want the WebSocket fallback", c.conn)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for connections.Load() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("WebSocket endpoint never reached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
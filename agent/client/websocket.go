@@ -1,32 +1,105 @@
 package client
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 type Client struct {
-	conn       *websocket.Conn
+	conn       connection
 	token      string
 	endpoint   string
 	serverName string
 
+	// version is the agent release reported on the handshake
+	version string
+
+	// signingSecret, when set, is used to sign every message
+	signingSecret string
+
+	// headers are added to the WebSocket handshake request
+	headers http.Header
+
+	// proxy selects the proxy for the handshake request
+	proxy func(*http.Request) (*url.URL, error)
+
+	// tlsConfig, when set, is used for wss:// endpoints and QUIC
+	tlsConfig *tls.Config
+
+	// quicAddress, when set, is tried over QUIC before the WebSocket endpoint
+	quicAddress string
+
+	// configReport is sent as a config_report message after every connect
+	configReport interface{}
+
+	// capabilities is announced in a capabilities message after every connect
+	capabilities interface{}
+
+	// configUpdateHandler applies config_update messages and returns the
+	// config_ack to send, or nil for none
+	configUpdateHandler func(data interface{}) interface{}
+
+	// writeMutex serializes writes, which may come from the main loop and a
+	// reconnect resending buffered metrics at the same time
+	writeMutex sync.Mutex
+
+	// Metrics samples not yet acknowledged by the server, oldest first,
+	// resent after reconnecting. bufferSize 0 disables buffering.
+	bufferMutex sync.Mutex
+	buffer      []bufferedSample
+	bufferSize  int
+
+	// Samples waiting to be sent together in one metrics_batch message once
+	// there are batchSize of them. batchSize 1 sends every sample on its own.
+	batchMutex sync.Mutex
+	batch      []json.RawMessage
+	batchSize  int
+
 	// Reconnection
 	reconnectInterval time.Duration
 	maxReconnectDelay time.Duration
 	reconnectAttempts int
 }
 
+// bufferedSample is a metrics payload waiting for the server's ack
+type bufferedSample struct {
+	timestamp time.Time
+	payload   json.RawMessage
+}
+
+// connection carries messages between the agent and the server, over a
+// WebSocket or a QUIC stream
+type connection interface {
+	WriteJSON(v interface{}) error
+	ReadJSON(v interface{}) error
+	// Ping checks the connection is still alive
+	Ping() error
+	// Close tells the server the agent is leaving and closes the connection
+	Close() error
+	// CloseAndWait closes the connection once the server has processed
+	// everything sent before
+	CloseAndWait(timeout time.Duration) error
+}
+
 type Message struct {
 	Type       string      `json:"type"`
 	Token      string      `json:"token"`
 	ServerName string      `json:"server_name"`
 	Data       interface{} `json:"data"`
 	Timestamp  time.Time   `json:"timestamp"`
+	Signature  string      `json:"signature,omitempty"`
 }
 
 func NewClient(endpoint, token, serverName string) *Client {
@@ -36,10 +109,26 @@ func NewClient(endpoint, token, serverName string) *Client {
 		serverName:        serverName,
 		reconnectInterval: 5 * time.Second,
 		maxReconnectDelay: 60 * time.Second,
+		proxy:             http.ProxyFromEnvironment,
+		batchSize:         1,
 	}
 }
 
 func (c *Client) Connect() error {
+	if c.quicAddress != "" {
+		conn, err := c.dialQUIC()
+		if err == nil {
+			c.connected(conn)
+			return nil
+		}
+		// The WebSocket endpoint would turn the agent away just the same
+		var rejected *quicRejectedError
+		if errors.As(err, &rejected) {
+			return err
+		}
+		log.Printf("QUIC connection to %s failed, falling back to WebSocket: %v", c.quicAddress, err)
+	}
+
 	u, err := url.Parse(c.endpoint)
 	if err != nil {
 		return fmt.Errorf("invalid endpoint URL: %w", err)
@@ -49,14 +138,25 @@ func (c *Client) Connect() error {
 	q := u.Query()
 	q.Set("token", c.token)
 	q.Set("server_name", c.serverName)
+	if c.version != "" {
+		q.Set("agent_version", c.version)
+	}
 	u.RawQuery = q.Encode()
 
 	log.Printf("Connecting to %s", u.String())
 
-	dialer := websocket.DefaultDialer
-	dialer.HandshakeTimeout = 10 * time.Second
+	dialer := &websocket.Dialer{
+		Proxy:            c.proxy,
+		HandshakeTimeout: 10 * time.Second,
+		// Ask for permessage-deflate; servers that don't support it answer
+		// without the extension and messages are sent uncompressed
+		EnableCompression: true,
+	}
+	if u.Scheme == "wss" {
+		dialer.TLSClientConfig = c.tlsConfig
+	}
 
-	conn, resp, err := dialer.Dial(u.String(), nil)
+	conn, resp, err := dialer.Dial(u.String(), c.headers)
 	if err != nil {
 		if resp != nil {
 			return fmt.Errorf("connection failed with status %d: %w", resp.StatusCode, err)
@@ -64,57 +164,294 @@ func (c *Client) Connect() error {
 		return fmt.Errorf("connection failed: %w", err)
 	}
 
+	c.connected(wsConnection{conn})
+	return nil
+}
+
+// connected starts using a newly established connection, announcing the
+// agent and resending what the server hasn't acknowledged
+func (c *Client) connected(conn connection) {
 	c.conn = conn
 	c.reconnectAttempts = 0
 
 	log.Printf("Connected to monitoring server")
-	return nil
+
+	c.sendCapabilities()
+	c.sendConfigReport()
+	if c.bufferSize > 0 {
+		// The pending batch is in the resend buffer as well
+		c.batchMutex.Lock()
+		c.batch = nil
+		c.batchMutex.Unlock()
+	}
+	c.resendBuffered()
 }
 
-func (c *Client) SendMetrics(metrics interface{}) error {
-	if c.conn == nil {
-		return fmt.Errorf("not connected")
+// SetCapabilities sets what the agent announces it can do on every connect,
+// so the server can adapt to the agent's feature set
+func (c *Client) SetCapabilities(capabilities interface{}) {
+	c.capabilities = capabilities
+}
+
+func (c *Client) sendCapabilities() {
+	if c.capabilities == nil {
+		return
+	}
+	if err := c.send("capabilities", c.capabilities); err != nil {
+		log.Printf("Error sending capabilities: %v", err)
 	}
+}
 
-	message := Message{
-		Type:       "metrics",
-		Token:      c.token,
-		ServerName: c.serverName,
-		Data:       metrics,
-		Timestamp:  time.Now(),
+// SetConfigReport sets the effective configuration reported to the server on
+// every connect and after config updates. It must not contain secrets.
+func (c *Client) SetConfigReport(report interface{}) {
+	c.configReport = report
+}
+
+func (c *Client) sendConfigReport() {
+	if c.configReport == nil {
+		return
+	}
+	if err := c.send("config_report", c.configReport); err != nil {
+		log.Printf("Error sending config report: %v", err)
 	}
+}
 
-	return c.conn.WriteJSON(message)
+// SetConfigUpdateHandler sets the function applying config updates pushed by
+// the server. A non-nil result is sent back as a config_ack message.
+func (c *Client) SetConfigUpdateHandler(handler func(data interface{}) interface{}) {
+	c.configUpdateHandler = handler
+}
+
+// SetVersion sets the agent release reported when connecting, which the
+// server may refuse if it is too old
+func (c *Client) SetVersion(version string) {
+	c.version = version
+}
+
+// SetSigningSecret enables HMAC signing of outgoing messages
+func (c *Client) SetSigningSecret(secret string) {
+	c.signingSecret = secret
+}
+
+// SetProxy connects through proxyURL (http or socks5) instead of the proxy
+// from the environment
+func (c *Client) SetProxy(proxyURL *url.URL) {
+	c.proxy = http.ProxyURL(proxyURL)
+}
+
+// SetTLSConfig sets the TLS configuration used for wss:// endpoints and
+// QUIC; plain ws:// endpoints ignore it
+func (c *Client) SetTLSConfig(tlsConfig *tls.Config) {
+	c.tlsConfig = tlsConfig
+}
+
+// SetQUICAddress connects over QUIC to address (host:port) first, falling
+// back to the WebSocket endpoint whenever QUIC can't be negotiated. Proxies
+// and extra headers only apply to the WebSocket.
+func (c *Client) SetQUICAddress(address string) {
+	c.quicAddress = address
+}
+
+// SetHeaders sets extra HTTP headers sent on every handshake, for gateways
+// and authenticating proxies in front of the server
+func (c *Client) SetHeaders(headers map[string]string) {
+	c.headers = make(http.Header, len(headers))
+	for name, value := range headers {
+		c.headers.Set(name, value)
+	}
+}
+
+// SetBufferSize keeps up to size unacknowledged metrics samples to resend
+// after a reconnect, so backend restarts don't leave gaps
+func (c *Client) SetBufferSize(size int) {
+	c.bufferSize = size
+}
+
+// SetBatchSize sends metrics samples size at a time in a single
+// metrics_batch message, which the server must support
+func (c *Client) SetBatchSize(size int) {
+	c.batchSize = max(size, 1)
+}
+
+// SendMetrics sends a metrics sample taken at timestamp. With buffering
+// enabled the sample is held until the server acknowledges it, and while
+// disconnected it is only buffered. With batching, samples are sent once a
+// batch is complete.
+func (c *Client) SendMetrics(timestamp time.Time, metrics interface{}) error {
+	payload, err := json.Marshal(metrics)
+	if err != nil {
+		return err
+	}
+
+	if c.bufferSize > 0 {
+		c.bufferSample(bufferedSample{timestamp: timestamp, payload: payload})
+		if c.conn == nil {
+			return nil
+		}
+	}
+	if c.batchSize <= 1 {
+		return c.send("metrics", json.RawMessage(payload))
+	}
+
+	c.batchMutex.Lock()
+	c.batch = append(c.batch, payload)
+	if len(c.batch) < c.batchSize {
+		c.batchMutex.Unlock()
+		return nil
+	}
+	batch := c.batch
+	c.batch = nil
+	c.batchMutex.Unlock()
+
+	return c.send("metrics_batch", batch)
+}
+
+// FlushMetrics sends the samples of an incomplete batch, e.g. on shutdown
+func (c *Client) FlushMetrics() error {
+	c.batchMutex.Lock()
+	batch := c.batch
+	c.batch = nil
+	c.batchMutex.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return c.send("metrics_batch", batch)
+}
+
+func (c *Client) bufferSample(sample bufferedSample) {
+	c.bufferMutex.Lock()
+	defer c.bufferMutex.Unlock()
+
+	if len(c.buffer) >= c.bufferSize {
+		// Drop the oldest sample to make room
+		c.buffer = c.buffer[1:]
+	}
+	c.buffer = append(c.buffer, sample)
+}
+
+// acknowledge drops buffered samples up to and including timestamp
+func (c *Client) acknowledge(timestamp time.Time) {
+	c.bufferMutex.Lock()
+	defer c.bufferMutex.Unlock()
+
+	kept := 0
+	for kept < len(c.buffer) && !c.buffer[kept].timestamp.After(timestamp) {
+		kept++
+	}
+	c.buffer = append([]bufferedSample(nil), c.buffer[kept:]...)
+}
+
+// resendBuffered sends every unacknowledged sample after (re)connecting
+func (c *Client) resendBuffered() {
+	c.bufferMutex.Lock()
+	pending := append([]bufferedSample(nil), c.buffer...)
+	c.bufferMutex.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	log.Printf("Resending %d buffered metrics samples", len(pending))
+
+	if c.batchSize <= 1 {
+		for _, sample := range pending {
+			if err := c.send("metrics", sample.payload); err != nil {
+				log.Printf("Error resending buffered metrics: %v", err)
+				return
+			}
+		}
+		return
+	}
+
+	for start := 0; start < len(pending); start += c.batchSize {
+		end := min(start+c.batchSize, len(pending))
+		batch := make([]json.RawMessage, 0, end-start)
+		for _, sample := range pending[start:end] {
+			batch = append(batch, sample.payload)
+		}
+		if err := c.send("metrics_batch", batch); err != nil {
+			log.Printf("Error resending buffered metrics: %v", err)
+			return
+		}
+	}
 }
 
 func (c *Client) SendAlert(alert interface{}) error {
+	return c.send("alert", alert)
+}
+
+// SendAgentError reports a non-fatal collection failure
+func (c *Client) SendAgentError(collectionError interface{}) error {
+	return c.send("agent_error", collectionError)
+}
+
+// SendLogs ships a batch of log lines
+func (c *Client) SendLogs(batch interface{}) error {
+	return c.send("logs", batch)
+}
+
+// SendCommandResult reports the outcome of a locally run command
+func (c *Client) SendCommandResult(result interface{}) error {
+	return c.send("command_result", result)
+}
+
+func (c *Client) send(messageType string, data interface{}) error {
 	if c.conn == nil {
 		return fmt.Errorf("not connected")
 	}
 
+	// Encode the data up front so the signature covers the exact bytes sent
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
 	message := Message{
-		Type:       "alert",
+		Type:       messageType,
 		Token:      c.token,
 		ServerName: c.serverName,
-		Data:       alert,
+		Data:       json.RawMessage(payload),
 		Timestamp:  time.Now(),
 	}
+	if c.signingSecret != "" {
+		message.Signature = signMessage(c.signingSecret, messageType, message.Timestamp, payload)
+	}
 
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
 	return c.conn.WriteJSON(message)
 }
 
+// signMessage computes the HMAC-SHA256 signature the backend verifies, over
+// the message type, timestamp and raw JSON data
+func signMessage(secret, messageType string, timestamp time.Time, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(messageType))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(timestamp.UTC().Format(time.RFC3339Nano)))
+	mac.Write([]byte("\n"))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func (c *Client) Close() error {
 	if c.conn == nil {
 		return nil
 	}
-
-	// Send close message
-	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
-	c.conn.WriteMessage(websocket.CloseMessage, closeMessage)
-
 	return c.conn.Close()
 }
 
+// CloseAndWait performs a close handshake and waits up to timeout for the
+// server to answer it. Since the server handles messages in order, its close
+// reply confirms everything sent before has been processed.
+func (c *Client) CloseAndWait(timeout time.Duration) error {
+	if c.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+	return c.conn.CloseAndWait(timeout)
+}
+
 func (c *Client) StartHeartbeat() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
@@ -125,7 +462,7 @@ func (c *Client) StartHeartbeat() {
 		}
 
 		// Send ping
-		if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+		if err := c.conn.Ping(); err != nil {
 			log.Printf("Heartbeat failed: %v", err)
 			c.handleDisconnection()
 			return
@@ -174,7 +511,12 @@ func (c *Client) ListenForMessages() {
 		if err != nil {
 			log.Printf("Read error: %v", err)
 			c.handleDisconnection()
-			return
+
+			// Keep listening on the new connection so acks keep arriving
+			for !c.IsConnected() {
+				time.Sleep(c.reconnectInterval)
+			}
+			continue
 		}
 
 		// Handle different message types
@@ -184,8 +526,24 @@ func (c *Client) ListenForMessages() {
 		}
 
 		switch msgType {
+		case "ack":
+			if data, ok := message["data"].(map[string]interface{}); ok {
+				if value, ok := data["timestamp"].(string); ok {
+					if timestamp, err := time.Parse(time.RFC3339Nano, value); err == nil {
+						c.acknowledge(timestamp)
+					}
+				}
+			}
 		case "config_update":
 			log.Printf("Received config update: %v", message["data"])
+			if c.configUpdateHandler != nil {
+				if ack := c.configUpdateHandler(message["data"]); ack != nil {
+					if err := c.send("config_ack", ack); err != nil {
+						log.Printf("Error sending config ack: %v", err)
+					}
+				}
+			}
+			c.sendConfigReport()
 		case "command":
 			log.Printf("Received command: %v", message["data"])
 		default:
@@ -193,3 +551,39 @@ func (c *Client) ListenForMessages() {
 		}
 	}
 }
+
+// wsConnection carries messages as WebSocket text messages
+type wsConnection struct {
+	*websocket.Conn
+}
+
+func (c wsConnection) Ping() error {
+	return c.WriteMessage(websocket.PingMessage, nil)
+}
+
+func (c wsConnection) Close() error {
+	// Send close message
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	c.WriteMessage(websocket.CloseMessage, closeMessage)
+
+	return c.Conn.Close()
+}
+
+func (c wsConnection) CloseAndWait(timeout time.Duration) error {
+	defer c.Conn.Close()
+
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := c.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(timeout)); err != nil {
+		return fmt.Errorf("failed to send close message: %w", err)
+	}
+
+	c.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		if _, _, err := c.ReadMessage(); err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				return nil
+			}
+			return fmt.Errorf("server did not acknowledge close: %w", err)
+		}
+	}
+}
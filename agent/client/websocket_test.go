@@ -0,0 +1,157 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"agent/metrics"
+
+	"github.com/gorilla/websocket"
+)
+
+// countingListener counts the bytes the server reads off the wire
+type countingListener struct {
+	net.Listener
+	read *atomic.Int64
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	return countingConn{conn, l.read}, err
+}
+
+type countingConn struct {
+	net.Conn
+	read *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// sinkServer accepts agent connections, negotiating compression when
+// compress is set, and discards every message
+func sinkServer(b *testing.B, compress bool) (string, *atomic.Int64, chan struct{}) {
+	b.Helper()
+	upgrader := websocket.Upgrader{EnableCompression: compress}
+	received := make(chan struct{}, 1024)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			received <- struct{}{}
+		}
+	}))
+	read := &atomic.Int64{}
+	srv.Listener = countingListener{srv.Listener, read}
+	srv.Start()
+	b.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), read, received
+}
+
+// benchmarkSample is a metrics sample of a 32 core server with 8 disks
+func benchmarkSample() *metrics.SystemMetrics {
+	sample := &metrics.SystemMetrics{
+		Timestamp:  time.Now(),
+		ServerName: "bench",
+		CPU:        metrics.CPUInfo{Usage: 37.5, Cores: 32},
+		Uptime:     86400,
+	}
+	for i := 0; i < 32; i++ {
+		sample.CPU.PerCore = append(sample.CPU.PerCore, float64(i*3%100)+0.25)
+	}
+	for i := 0; i < 8; i++ {
+		sample.Disks = append(sample.Disks, metrics.DiskInfo{
+			Path:        fmt.Sprintf("/mnt/data%d", i),
+			Total:       1 << 40,
+			Used:        uint64(i+1) << 36,
+			Free:        1<<40 - uint64(i+1)<<36,
+			UsedPercent: float64(i+1) * 6.25,
+		})
+	}
+	sample.Disk = sample.Disks[0]
+	return sample
+}
+
+func BenchmarkSendMetrics(b *testing.B) {
+	for _, bc := range []struct {
+		name     string
+		compress bool
+	}{
+		{"compressed", true},
+		{"plain", false},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			endpoint, read, received := sinkServer(b, bc.compress)
+			c := NewClient(endpoint, "token", "bench")
+			if err := c.Connect(); err != nil {
+				b.Fatal(err)
+			}
+			defer c.Close()
+
+			sample := benchmarkSample()
+			read.Store(0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := c.SendMetrics(sample.Timestamp, sample); err != nil {
+					b.Fatal(err)
+				}
+				<-received
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(read.Load())/float64(b.N), "wire-B/op")
+		})
+	}
+}
+
+func TestConnectSendsCustomHeaders(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient("ws"+strings.TrimPrefix(srv.URL, "http"), "token", "headers-test")
+	c.SetHeaders(map[string]string{"X-Gateway-Key": "secret", "cf-access-client-id": "client"})
+	if err := c.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	got := <-headers
+	for name, want := range map[string]string{"X-Gateway-Key": "secret", "Cf-Access-Client-Id": "client"} {
+		if value := got.Get(name); value != want {
+			t.Errorf("upgrade request header %s = %q, want %q", name, value, want)
+		}
+	}
+	if got.Get("Upgrade") != "websocket" {
+		t.Errorf("custom headers replaced the upgrade headers: %v", got)
+	}
+}
@@ -1,9 +1,16 @@
 package config
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/viper"
 )
@@ -11,15 +18,261 @@ import (
 type Config struct {
 	Token              string          `json:"token" mapstructure:"token"`
 	APIEndpoint        string          `json:"api_endpoint" mapstructure:"api_endpoint"`
+	SigningSecret      string          `json:"signing_secret,omitempty" mapstructure:"signing_secret"` // optional HMAC key from the dashboard
 	CollectionInterval int             `json:"collection_interval" mapstructure:"collection_interval"`
+	DiskInterval       int             `json:"disk_interval" mapstructure:"disk_interval"` // 0 = every collection
+	BufferSize         int             `json:"buffer_size" mapstructure:"buffer_size"`     // unacknowledged samples kept for resending, 0 disables
+	BatchSize          int             `json:"batch_size" mapstructure:"batch_size"`       // samples sent per message, 1 sends each on its own
 	ServerName         string          `json:"server_name" mapstructure:"server_name"`
 	AlertThresholds    AlertThresholds `json:"alert_thresholds" mapstructure:"alert_thresholds"`
+
+	// Local TCP ports that must be listening; a port_down alert is raised otherwise
+	WatchedPorts []int `json:"watched_ports" mapstructure:"watched_ports"`
+
+	// Extra HTTP headers sent on the WebSocket handshake, e.g. for an
+	// authenticating proxy: {"X-Api-Key": "..."}
+	Headers map[string]string `json:"headers,omitempty" mapstructure:"headers"`
+
+	// Outbound proxy; HTTP_PROXY/HTTPS_PROXY are used when unset
+	Proxy ProxyConfig `json:"proxy" mapstructure:"proxy"`
+
+	// Transport is "websocket" or the experimental "quic" for lossy,
+	// high-latency links, which falls back to the WebSocket when QUIC
+	// can't be negotiated
+	Transport string `json:"transport" mapstructure:"transport"`
+	// QUICAddress is the backend's QUIC listener (host:port); empty uses the
+	// api_endpoint host on port 8443
+	QUICAddress string `json:"quic_address,omitempty" mapstructure:"quic_address"`
+
+	// TLS settings for wss:// endpoints behind a private CA or requiring
+	// client certificates; ignored for ws://
+	TLS TLSConfig `json:"tls" mapstructure:"tls"`
+
+	// Log file shipped to the server, off unless log_tail.path is set
+	LogTail LogTailConfig `json:"log_tail" mapstructure:"log_tail"`
+
+	// Local scripts run when alerts fire, off unless alert_actions.enabled
+	AlertActions AlertActionsConfig `json:"alert_actions" mapstructure:"alert_actions"`
+
+	// Optional collectors
+	CollectContextSwitches bool `json:"collect_context_switches" mapstructure:"collect_context_switches"`
+	CollectDiskIO          bool `json:"collect_disk_io" mapstructure:"collect_disk_io"`
+	CollectMemoryPressure  bool `json:"collect_memory_pressure" mapstructure:"collect_memory_pressure"`
+
+	// Interface network counters are reported for, e.g. "eth0"; empty uses
+	// the default route's interface (Linux) or the totals of all interfaces
+	PrimaryInterface string `json:"primary_interface" mapstructure:"primary_interface"`
+
+	// Mount points whose usage is reported and alerted on, e.g. ["/", "/var",
+	// "/data"]. The first one is also reported as the server's disk usage.
+	DiskPaths []string `json:"disk_paths" mapstructure:"disk_paths"`
+
+	// Block devices reported when collect_disk_io is set, e.g. ["sda", "nvme0n1"]; empty for all
+	DiskDevices []string `json:"disk_devices" mapstructure:"disk_devices"`
+
+	// NTP server to measure clock drift against, e.g. "pool.ntp.org"; empty disables
+	NTPServer   string `json:"ntp_server" mapstructure:"ntp_server"`
+	NTPInterval int    `json:"ntp_interval" mapstructure:"ntp_interval"` // seconds between queries
+
+	// Mode is "full" or "lite"; lite trades optional metrics for a smaller
+	// footprint on ARM/embedded devices (Linux only)
+	Mode string `json:"mode" mapstructure:"mode"`
+	// Soft memory ceiling for the agent process in MB, 0 for no limit
+	MemoryLimitMB int `json:"memory_limit_mb" mapstructure:"memory_limit_mb"`
+}
+
+// Collection modes
+const (
+	ModeFull = "full"
+	ModeLite = "lite"
+)
+
+// Transports the agent connects with
+const (
+	TransportWebSocket = "websocket"
+	TransportQUIC      = "quic"
+)
+
+// defaultQUICPort is the backend's default quic.port
+const defaultQUICPort = "8443"
+
+// QUICEndpoint returns the host:port of the backend's QUIC listener
+func (c *Config) QUICEndpoint() (string, error) {
+	if c.QUICAddress != "" {
+		if _, _, err := net.SplitHostPort(c.QUICAddress); err != nil {
+			return "", fmt.Errorf("invalid quic_address: %w", err)
+		}
+		return c.QUICAddress, nil
+	}
+
+	endpoint, err := url.Parse(c.APIEndpoint)
+	if err != nil || endpoint.Hostname() == "" {
+		return "", fmt.Errorf("can't derive quic_address from api_endpoint %q", c.APIEndpoint)
+	}
+	return net.JoinHostPort(endpoint.Hostname(), defaultQUICPort), nil
+}
+
+// MaxBatchSize is the most samples the backend accepts in one metrics_batch
+const MaxBatchSize = 100
+
+// ProxyConfig configures the proxy the agent connects through
+type ProxyConfig struct {
+	URL      string `json:"url" mapstructure:"url"` // http://host:port or socks5://host:port
+	Username string `json:"username,omitempty" mapstructure:"username"`
+	Password string `json:"password,omitempty" mapstructure:"password"`
 }
 
+// ProxyURL returns the proxy URL including credentials, or nil when no proxy
+// is configured
+func (p ProxyConfig) ProxyURL() (*url.URL, error) {
+	if p.URL == "" {
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy.url: %w", err)
+	}
+	if proxyURL.Scheme != "http" && proxyURL.Scheme != "socks5" {
+		return nil, fmt.Errorf("unsupported proxy.url scheme %q (supported: http, socks5)", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy.url must include a host")
+	}
+
+	if p.Username != "" {
+		proxyURL.User = url.UserPassword(p.Username, p.Password)
+	}
+	return proxyURL, nil
+}
+
+// TLSConfig customizes how the agent verifies the server's certificate and
+// which certificate it presents
+type TLSConfig struct {
+	CACert             string `json:"ca_cert,omitempty" mapstructure:"ca_cert"` // PEM file trusted in addition to the system roots
+	InsecureSkipVerify bool   `json:"insecure_skip_verify" mapstructure:"insecure_skip_verify"`
+	ClientCert         string `json:"client_cert,omitempty" mapstructure:"client_cert"` // PEM files for mutual TLS
+	ClientKey          string `json:"client_key,omitempty" mapstructure:"client_key"`
+}
+
+// ClientConfig builds the TLS configuration for the connection, or returns
+// nil when nothing is customized
+func (t TLSConfig) ClientConfig() (*tls.Config, error) {
+	if t.CACert == "" && !t.InsecureSkipVerify && t.ClientCert == "" && t.ClientKey == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CACert != "" {
+		pem, err := os.ReadFile(t.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("reading tls.ca_cert: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls.ca_cert %s contains no PEM certificates", t.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return nil, fmt.Errorf("tls.client_cert and tls.client_key must be set together")
+	}
+	if t.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(t.ClientCert, t.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading tls.client_cert: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// LogTailConfig follows a local log file and ships new lines to the server
+type LogTailConfig struct {
+	Path              string `json:"path" mapstructure:"path"`
+	Interval          int    `json:"interval" mapstructure:"interval"`                         // seconds between polls
+	MaxLinesPerMinute int    `json:"max_lines_per_minute" mapstructure:"max_lines_per_minute"` // further lines are dropped
+	MaxLineBytes      int    `json:"max_line_bytes" mapstructure:"max_line_bytes"`             // longer lines are truncated
+}
+
+// AlertActionsConfig maps alerts to local remediation scripts. Only scripts
+// listed in AllowedScripts may be run.
+type AlertActionsConfig struct {
+	Enabled        bool          `json:"enabled" mapstructure:"enabled"`
+	AllowedScripts []string      `json:"allowed_scripts" mapstructure:"allowed_scripts"` // absolute paths
+	Timeout        int           `json:"timeout" mapstructure:"timeout"`                 // seconds before a script is killed
+	Cooldown       int           `json:"cooldown" mapstructure:"cooldown"`               // seconds before a rule runs again
+	Rules          []AlertAction `json:"rules" mapstructure:"rules"`
+}
+
+// AlertAction runs Script when an alert of Type (and Level, if set) fires
+type AlertAction struct {
+	Type   string `json:"type" mapstructure:"type"`
+	Level  string `json:"level,omitempty" mapstructure:"level"` // empty matches any level
+	Script string `json:"script" mapstructure:"script"`
+}
+
+// Validate checks every rule runs an allowlisted script
+func (a AlertActionsConfig) Validate() error {
+	if !a.Enabled {
+		return nil
+	}
+	if a.Timeout <= 0 {
+		return fmt.Errorf("alert_actions.timeout must be positive")
+	}
+	if a.Cooldown < 0 {
+		return fmt.Errorf("alert_actions.cooldown must not be negative")
+	}
+
+	allowed := make(map[string]bool, len(a.AllowedScripts))
+	for _, script := range a.AllowedScripts {
+		if !filepath.IsAbs(script) {
+			return fmt.Errorf("allowed script %q must be an absolute path", script)
+		}
+		allowed[filepath.Clean(script)] = true
+	}
+
+	for _, rule := range a.Rules {
+		if rule.Type == "" {
+			return fmt.Errorf("alert action for %q needs an alert type", rule.Script)
+		}
+		if !allowed[filepath.Clean(rule.Script)] {
+			return fmt.Errorf("alert action script %q is not in alert_actions.allowed_scripts", rule.Script)
+		}
+	}
+	return nil
+}
+
+// AlertThresholds configures when alerts are raised. CPU, memory and disk
+// usage have a warning and a critical threshold; the single cpu, memory and
+// disk thresholds of older configs are used as the warning threshold when no
+// *_warning value is set.
 type AlertThresholds struct {
-	CPU    float64 `json:"cpu" mapstructure:"cpu"`
-	Memory float64 `json:"memory" mapstructure:"memory"`
-	Disk   float64 `json:"disk" mapstructure:"disk"`
+	CPU            float64 `json:"cpu,omitempty" mapstructure:"cpu"`
+	CPUWarning     float64 `json:"cpu_warning" mapstructure:"cpu_warning"`
+	CPUCritical    float64 `json:"cpu_critical" mapstructure:"cpu_critical"`   // 0 disables
+	LoadPerCore    float64 `json:"load_per_core" mapstructure:"load_per_core"` // 1-minute load per core, 0 disables
+	Memory         float64 `json:"memory,omitempty" mapstructure:"memory"`
+	MemoryWarning  float64 `json:"memory_warning" mapstructure:"memory_warning"`
+	MemoryCritical float64 `json:"memory_critical" mapstructure:"memory_critical"` // 0 disables
+	Swap           float64 `json:"swap" mapstructure:"swap"`                       // percent, 0 disables
+	Disk           float64 `json:"disk,omitempty" mapstructure:"disk"`
+	DiskWarning    float64 `json:"disk_warning" mapstructure:"disk_warning"`
+	DiskCritical   float64 `json:"disk_critical" mapstructure:"disk_critical"` // 0 disables
+	DiskLatency    float64 `json:"disk_latency" mapstructure:"disk_latency"`   // ms, requires collect_disk_io
+	ClockDrift     float64 `json:"clock_drift" mapstructure:"clock_drift"`     // seconds, requires ntp_server
+
+	// PSI "some" avg10 percentage, requires collect_memory_pressure
+	MemoryPressure float64 `json:"memory_pressure" mapstructure:"memory_pressure"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -32,10 +285,38 @@ func LoadConfig() (*Config, error) {
 	// Set defaults
 	viper.SetDefault("api_endpoint", "ws://localhost:8080/agent/connect")
 	viper.SetDefault("collection_interval", 5)
+	viper.SetDefault("disk_interval", 0)
+	viper.SetDefault("disk_paths", []string{"/"})
+	viper.SetDefault("buffer_size", 1000)
+	viper.SetDefault("batch_size", 1)
+	viper.SetDefault("transport", TransportWebSocket)
 	viper.SetDefault("server_name", getHostname())
 	viper.SetDefault("alert_thresholds.cpu", 80.0)
+	viper.SetDefault("alert_thresholds.cpu_critical", 95.0)
+	viper.SetDefault("alert_thresholds.load_per_core", 1.5)
 	viper.SetDefault("alert_thresholds.memory", 85.0)
+	viper.SetDefault("alert_thresholds.memory_critical", 95.0)
+	viper.SetDefault("alert_thresholds.swap", 0.0)
 	viper.SetDefault("alert_thresholds.disk", 90.0)
+	viper.SetDefault("alert_thresholds.disk_critical", 95.0)
+	viper.SetDefault("alert_thresholds.disk_latency", 100.0)
+	viper.SetDefault("collect_context_switches", false)
+	viper.SetDefault("collect_disk_io", false)
+	viper.SetDefault("collect_memory_pressure", false)
+	viper.SetDefault("alert_thresholds.memory_pressure", 20.0)
+	viper.SetDefault("primary_interface", "")
+	viper.SetDefault("ntp_server", "")
+	viper.SetDefault("ntp_interval", 300)
+	viper.SetDefault("alert_thresholds.clock_drift", 1.0)
+	viper.SetDefault("mode", ModeFull)
+	viper.SetDefault("memory_limit_mb", 0)
+	viper.SetDefault("log_tail.path", "")
+	viper.SetDefault("log_tail.interval", 5)
+	viper.SetDefault("log_tail.max_lines_per_minute", 300)
+	viper.SetDefault("log_tail.max_line_bytes", 2048)
+	viper.SetDefault("alert_actions.enabled", false)
+	viper.SetDefault("alert_actions.timeout", 30)
+	viper.SetDefault("alert_actions.cooldown", 300)
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
@@ -53,6 +334,71 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("token is required in config.json")
 	}
 
+	if config.Mode != ModeFull && config.Mode != ModeLite {
+		return nil, fmt.Errorf("invalid mode %q (expected %q or %q)", config.Mode, ModeFull, ModeLite)
+	}
+	if config.BufferSize < 0 {
+		return nil, fmt.Errorf("buffer_size must not be negative")
+	}
+	if config.BatchSize < 1 || config.BatchSize > MaxBatchSize {
+		return nil, fmt.Errorf("batch_size must be between 1 and %d", MaxBatchSize)
+	}
+	if config.MemoryLimitMB < 0 {
+		return nil, fmt.Errorf("memory_limit_mb must not be negative")
+	}
+
+	if _, err := config.Proxy.ProxyURL(); err != nil {
+		return nil, err
+	}
+
+	switch config.Transport {
+	case TransportWebSocket:
+	case TransportQUIC:
+		if config.Proxy.URL != "" {
+			return nil, fmt.Errorf("transport %q can't go through proxy.url", TransportQUIC)
+		}
+		if _, err := config.QUICEndpoint(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid transport %q (expected %q or %q)", config.Transport, TransportWebSocket, TransportQUIC)
+	}
+	if _, err := config.TLS.ClientConfig(); err != nil {
+		return nil, err
+	}
+
+	if config.LogTail.Path != "" &&
+		(config.LogTail.Interval < 1 || config.LogTail.MaxLinesPerMinute < 1 || config.LogTail.MaxLineBytes < 1) {
+		return nil, fmt.Errorf("log_tail.interval, max_lines_per_minute and max_line_bytes must be positive")
+	}
+
+	if err := config.AlertActions.Validate(); err != nil {
+		return nil, err
+	}
+
+	if len(config.DiskPaths) == 0 {
+		return nil, fmt.Errorf("disk_paths must list at least one mount point")
+	}
+	seenPaths := make(map[string]bool)
+	for _, path := range config.DiskPaths {
+		if path == "" || seenPaths[path] {
+			return nil, fmt.Errorf("disk_paths must not contain empty or duplicate entries")
+		}
+		seenPaths[path] = true
+	}
+
+	for name := range config.Headers {
+		if err := validateHeaderName(name); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, port := range config.WatchedPorts {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid watched port %d", port)
+		}
+	}
+
 	// Use hostname as server name if not specified
 	if config.ServerName == "" {
 		config.ServerName = getHostname()
@@ -61,6 +407,34 @@ func LoadConfig() (*Config, error) {
 	return &config, nil
 }
 
+// reservedHeaders are set by the WebSocket handshake itself
+var reservedHeaders = map[string]bool{
+	"Upgrade":                  true,
+	"Connection":               true,
+	"Sec-Websocket-Key":        true,
+	"Sec-Websocket-Version":    true,
+	"Sec-Websocket-Extensions": true,
+	"Sec-Websocket-Protocol":   true,
+}
+
+// validateHeaderName checks a custom handshake header is a valid HTTP field
+// name that doesn't clash with the handshake
+func validateHeaderName(name string) error {
+	if name == "" {
+		return fmt.Errorf("invalid header name %q", name)
+	}
+	for _, r := range name {
+		// RFC 7230 token characters
+		if r > 0x7e || r <= 0x20 || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+	}
+	if reservedHeaders[http.CanonicalHeaderKey(name)] {
+		return fmt.Errorf("header %q is set by the WebSocket handshake and can't be overridden", name)
+	}
+	return nil
+}
+
 func getHostname() string {
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -69,17 +443,65 @@ func getHostname() string {
 	return hostname
 }
 
+// Redacted returns a copy of the config safe to report to the server, with
+// the token and signing secret masked
+func (c *Config) Redacted() Config {
+	redacted := *c
+	if redacted.Token != "" {
+		redacted.Token = "[redacted]"
+	}
+	if redacted.SigningSecret != "" {
+		redacted.SigningSecret = "[redacted]"
+	}
+	if redacted.Proxy.Password != "" {
+		redacted.Proxy.Password = "[redacted]"
+	}
+	if proxyURL, err := url.Parse(redacted.Proxy.URL); err == nil && proxyURL.User != nil {
+		redacted.Proxy.URL = proxyURL.Redacted()
+	}
+	// Header values are usually credentials
+	if len(redacted.Headers) > 0 {
+		redacted.Headers = make(map[string]string, len(c.Headers))
+		for name := range c.Headers {
+			redacted.Headers[name] = "[redacted]"
+		}
+	}
+	return redacted
+}
+
 // CreateSampleConfig creates a sample configuration file
 func CreateSampleConfig() error {
 	config := Config{
 		Token:              "your-server-token-here",
 		APIEndpoint:        "ws://localhost:8080/agent/connect",
 		CollectionInterval: 5,
+		BufferSize:         1000,
+		BatchSize:          1,
+		Transport:          TransportWebSocket,
+		DiskPaths:          []string{"/"},
 		ServerName:         getHostname(),
 		AlertThresholds: AlertThresholds{
-			CPU:    80.0,
-			Memory: 85.0,
-			Disk:   90.0,
+			CPUWarning:     80.0,
+			CPUCritical:    95.0,
+			LoadPerCore:    1.5,
+			MemoryWarning:  85.0,
+			MemoryCritical: 95.0,
+			DiskWarning:    90.0,
+			DiskCritical:   95.0,
+			DiskLatency:    100.0,
+			ClockDrift:     1.0,
+			MemoryPressure: 20.0,
+		},
+		NTPInterval: 300,
+		Mode:        ModeFull,
+		LogTail: LogTailConfig{
+			Interval:          5,
+			MaxLinesPerMinute: 300,
+			MaxLineBytes:      2048,
+		},
+		AlertActions: AlertActionsConfig{
+			Timeout:  30,
+			Cooldown: 300,
 		},
 	}
 
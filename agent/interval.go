@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// maxPushedInterval bounds a collection interval pushed by the backend
+const maxPushedInterval = 3600
+
+// intervalUpdate is a config_update pushing the server's resolution as the
+// collection interval. 0 restores the interval from the local config.
+type intervalUpdate struct {
+	CollectionInterval *int `json:"collection_interval"`
+}
+
+// intervalControl hands collection intervals pushed by the backend to the
+// main loop, which resets its ticker
+type intervalControl struct {
+	local   time.Duration
+	changes chan time.Duration
+}
+
+func newIntervalControl(localSeconds int) *intervalControl {
+	return &intervalControl{
+		local:   time.Duration(localSeconds) * time.Second,
+		changes: make(chan time.Duration, 1),
+	}
+}
+
+// Changes delivers the interval to collect at whenever it changes
+func (c *intervalControl) Changes() <-chan time.Duration {
+	return c.changes
+}
+
+// HandleConfigUpdate applies the collection interval in a config_update, if
+// any. Intervals aren't versioned, so there is nothing to acknowledge.
+func (c *intervalControl) HandleConfigUpdate(data interface{}) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	var update intervalUpdate
+	if err := json.Unmarshal(jsonData, &update); err != nil || update.CollectionInterval == nil {
+		return
+	}
+
+	seconds := *update.CollectionInterval
+	if seconds < 0 || seconds > maxPushedInterval {
+		log.Printf("Ignoring invalid collection interval %d from server", seconds)
+		return
+	}
+
+	interval := c.local
+	if seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	// Only the latest interval matters if the loop hasn't taken the last one
+	select {
+	case <-c.changes:
+	default:
+	}
+	c.changes <- interval
+}
@@ -0,0 +1,163 @@
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// maxReadPerPoll bounds how much of the file a single poll reads, so a burst
+// of writes is shipped over several polls instead of all at once
+const maxReadPerPoll = 1 << 20
+
+// Line is a complete line read from the log file
+type Line struct {
+	Time time.Time `json:"time"`
+	Line string    `json:"line"`
+}
+
+// Batch is the lines read by a poll, sent as a logs message. Dropped counts
+// lines skipped to stay within the rate limit.
+type Batch struct {
+	File    string `json:"file"`
+	Lines   []Line `json:"lines"`
+	Dropped int    `json:"dropped"`
+}
+
+// Tailer follows a log file like tail -F: it starts at the end of the file,
+// reopens it when it is rotated and starts over when it is truncated
+type Tailer struct {
+	path              string
+	maxLineBytes      int
+	maxLinesPerMinute int
+
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+
+	windowStart time.Time
+	windowLines int
+}
+
+// NewTailer follows path, truncating lines to maxLineBytes and shipping at
+// most maxLinesPerMinute lines
+func NewTailer(path string, maxLinesPerMinute, maxLineBytes int) *Tailer {
+	t := &Tailer{
+		path:              path,
+		maxLineBytes:      maxLineBytes,
+		maxLinesPerMinute: maxLinesPerMinute,
+	}
+	// Only new lines are shipped; the file may not exist yet
+	if err := t.open(); err == nil {
+		t.offset = t.info.Size()
+	}
+	return t
+}
+
+func (t *Tailer) open() error {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	t.file = file
+	t.info = info
+	t.offset = 0
+	t.partial = nil
+	return nil
+}
+
+// Close closes the followed file
+func (t *Tailer) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
+
+// Poll returns the lines appended since the last poll
+func (t *Tailer) Poll() (Batch, error) {
+	batch := Batch{File: t.path, Lines: []Line{}}
+
+	if t.file == nil {
+		if err := t.open(); err != nil {
+			return batch, fmt.Errorf("opening %s: %w", t.path, err)
+		}
+	}
+
+	// A different file at the path means the log was rotated: finish the old
+	// file, then follow the new one from its start
+	if info, err := os.Stat(t.path); err == nil && !os.SameFile(info, t.info) {
+		if err := t.read(&batch); err != nil {
+			return batch, err
+		}
+		t.file.Close()
+		if err := t.open(); err != nil {
+			t.file = nil
+			return batch, fmt.Errorf("reopening %s: %w", t.path, err)
+		}
+	}
+
+	// A file shorter than what was read has been truncated in place
+	if info, err := t.file.Stat(); err == nil && info.Size() < t.offset {
+		t.offset = 0
+		t.partial = nil
+	}
+
+	err := t.read(&batch)
+	return batch, err
+}
+
+// read reads complete lines from the current offset into the batch
+func (t *Tailer) read(batch *Batch) error {
+	data, err := io.ReadAll(io.NewSectionReader(t.file, t.offset, maxReadPerPoll))
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", t.path, err)
+	}
+	t.offset += int64(len(data))
+
+	data = append(t.partial, data...)
+	now := time.Now()
+	for {
+		end := bytes.IndexByte(data, '\n')
+		if end < 0 {
+			break
+		}
+		t.addLine(batch, bytes.TrimRight(data[:end], "\r"), now)
+		data = data[end+1:]
+	}
+
+	// Keep the unfinished last line for the next poll, unless it is already
+	// too long to ship whole
+	if len(data) > t.maxLineBytes {
+		t.addLine(batch, data, now)
+		data = nil
+	}
+	t.partial = append([]byte(nil), data...)
+	return nil
+}
+
+func (t *Tailer) addLine(batch *Batch, line []byte, now time.Time) {
+	if now.Sub(t.windowStart) >= time.Minute {
+		t.windowStart = now
+		t.windowLines = 0
+	}
+	if t.windowLines >= t.maxLinesPerMinute {
+		batch.Dropped++
+		return
+	}
+	t.windowLines++
+
+	if len(line) > t.maxLineBytes {
+		line = line[:t.maxLineBytes]
+	}
+	batch.Lines = append(batch.Lines, Line{Time: now, Line: string(line)})
+}
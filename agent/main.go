@@ -6,11 +6,16 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"strings"
 	"syscall"
 	"time"
 
+	"agent/actions"
 	"agent/client"
 	"agent/config"
+	"agent/logs"
 	"agent/metrics"
 )
 
@@ -18,11 +23,16 @@ var (
 	Version = "dev" // Set during build
 )
 
+// schemaVersion is the version of the message formats this agent sends,
+// bumped whenever they change incompatibly
+const schemaVersion = 1
+
 func main() {
 	var (
 		createConfig = flag.Bool("init", false, "Create sample config.json file")
 		version      = flag.Bool("version", false, "Show version information")
 		showHelp     = flag.Bool("help", false, "Show help information")
+		once         = flag.Bool("once", false, "Collect and send a single sample, then exit (for cron)")
 	)
 	flag.Parse()
 
@@ -40,6 +50,7 @@ func main() {
 		fmt.Println("")
 		fmt.Println("Options:")
 		fmt.Println("  -init           Create sample config.json file")
+		fmt.Println("  -once           Send a single sample and exit (for cron)")
 		fmt.Println("  -config string  Path to config file")
 		fmt.Println("  -version        Show version information")
 		fmt.Println("  -help           Show this help message")
@@ -71,12 +82,101 @@ func main() {
 
 	log.Printf("Starting Monitaur Agent v%s for: %s", Version, cfg.ServerName)
 	log.Printf("Collection interval: %d seconds", cfg.CollectionInterval)
+	if cfg.DiskInterval > 0 {
+		log.Printf("Disk interval: %d seconds", cfg.DiskInterval)
+	}
+
+	if cfg.MemoryLimitMB > 0 {
+		debug.SetMemoryLimit(int64(cfg.MemoryLimitMB) << 20)
+		log.Printf("Memory limit: %d MB", cfg.MemoryLimitMB)
+	}
+
+	applyLiteMode(cfg)
 
 	// Initialize metrics collector
-	collector := metrics.NewCollector(cfg.ServerName)
+	collector := metrics.NewCollector(cfg.ServerName, metrics.Options{
+		ContextSwitches:  cfg.CollectContextSwitches,
+		DiskIO:           cfg.CollectDiskIO,
+		MemoryPressure:   cfg.CollectMemoryPressure,
+		DiskPaths:        cfg.DiskPaths,
+		DiskDevices:      cfg.DiskDevices,
+		PrimaryInterface: cfg.PrimaryInterface,
+		NTPServer:        cfg.NTPServer,
+		NTPInterval:      time.Duration(cfg.NTPInterval) * time.Second,
+		CachedDisk:       cfg.DiskInterval > 0,
+		Lite:             cfg.Mode == config.ModeLite,
+	})
 
 	// Initialize WebSocket client
 	wsClient := client.NewClient(cfg.APIEndpoint, cfg.Token, cfg.ServerName)
+	wsClient.SetVersion(Version)
+	if cfg.SigningSecret != "" {
+		wsClient.SetSigningSecret(cfg.SigningSecret)
+	}
+	if len(cfg.Headers) > 0 {
+		wsClient.SetHeaders(cfg.Headers)
+	}
+	wsClient.SetBufferSize(cfg.BufferSize)
+
+	proxyURL, err := cfg.Proxy.ProxyURL()
+	if err != nil {
+		log.Fatalf("Invalid proxy configuration: %v", err)
+	}
+	if proxyURL != nil {
+		wsClient.SetProxy(proxyURL)
+		log.Printf("Connecting through proxy %s", proxyURL.Redacted())
+	}
+
+	tlsConfig, err := cfg.TLS.ClientConfig()
+	if err != nil {
+		log.Fatalf("Invalid TLS configuration: %v", err)
+	}
+	if tlsConfig != nil {
+		// QUIC always uses TLS
+		if !strings.HasPrefix(cfg.APIEndpoint, "wss://") && cfg.Transport != config.TransportQUIC {
+			log.Printf("Ignoring tls settings for non-TLS endpoint %s", cfg.APIEndpoint)
+		} else if tlsConfig.InsecureSkipVerify {
+			log.Println("WARNING: tls.insecure_skip_verify is set, the server's certificate is not verified")
+		}
+		wsClient.SetTLSConfig(tlsConfig)
+	}
+	if cfg.Transport == config.TransportQUIC {
+		quicAddress, err := cfg.QUICEndpoint()
+		if err != nil {
+			log.Fatalf("Invalid QUIC configuration: %v", err)
+		}
+		wsClient.SetQUICAddress(quicAddress)
+		log.Printf("Using the experimental QUIC transport via %s", quicAddress)
+	}
+	wsClient.SetCapabilities(agentCapabilities(cfg))
+	wsClient.SetConfigReport(configReport{
+		AgentVersion: Version,
+		Platform:     runtime.GOOS + "/" + runtime.GOARCH,
+		Config:       cfg.Redacted(),
+	})
+
+	if *once {
+		if err := runOnce(cfg, collector, wsClient); err != nil {
+			log.Printf("One-shot collection failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Thresholds and the collection interval pushed by the backend replace
+	// the local ones
+	thresholds := newThresholdStore(cfg)
+	intervals := newIntervalControl(cfg.CollectionInterval)
+	wsClient.SetConfigUpdateHandler(func(data interface{}) interface{} {
+		intervals.HandleConfigUpdate(data)
+		return thresholds.HandleConfigUpdate(data)
+	})
+
+	// Batching only applies here; a one-shot run sends its sample on its own
+	wsClient.SetBatchSize(cfg.BatchSize)
+	if cfg.BatchSize > 1 {
+		log.Printf("Sending metrics in batches of %d samples", cfg.BatchSize)
+	}
 
 	// Connect to server
 	if err := wsClient.Connect(); err != nil {
@@ -84,20 +184,47 @@ func main() {
 	}
 	defer wsClient.Close()
 
+	// Run local remediation scripts for alerts, reporting back how they went
+	actionRunner := actions.NewRunner(cfg.AlertActions, func(result actions.Result) {
+		if wsClient.IsConnected() {
+			if err := wsClient.SendCommandResult(result); err != nil {
+				log.Printf("Error sending command result: %v", err)
+			}
+		}
+	})
+	if actionRunner != nil {
+		log.Printf("Alert actions enabled: %d rule(s)", len(cfg.AlertActions.Rules))
+	}
+
 	// Start heartbeat in background
 	go wsClient.StartHeartbeat()
 
 	// Start message listener
 	go wsClient.ListenForMessages()
 
+	// Ship new lines of the configured log file
+	if cfg.LogTail.Path != "" {
+		go tailLogs(cfg.LogTail, wsClient)
+		log.Printf("Shipping log lines from %s", cfg.LogTail.Path)
+	}
+
 	// Set up graceful shutdown
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
 
 	// Main monitoring loop
-	ticker := time.NewTicker(time.Duration(cfg.CollectionInterval) * time.Second)
+	interval := time.Duration(cfg.CollectionInterval) * time.Second
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	// Disk is optionally sampled on its own, slower cadence
+	var diskTick <-chan time.Time
+	if cfg.DiskInterval > 0 {
+		diskTicker := time.NewTicker(time.Duration(cfg.DiskInterval) * time.Second)
+		defer diskTicker.Stop()
+		diskTick = diskTicker.C
+	}
+
 	log.Println("Agent started successfully. Press Ctrl+C to stop.")
 
 	for {
@@ -105,24 +232,22 @@ func main() {
 		case <-ticker.C:
 			// Collect metrics
 			systemMetrics, err := collector.CollectMetrics()
+			sendCollectionErrors(collector, wsClient)
 			if err != nil {
 				log.Printf("Error collecting metrics: %v", err)
 				continue
 			}
 
-			// Send metrics to server
-			if wsClient.IsConnected() {
-				if err := wsClient.SendMetrics(systemMetrics); err != nil {
+			// Send metrics to server; while disconnected they are only buffered
+			if wsClient.IsConnected() || cfg.BufferSize > 0 {
+				if err := wsClient.SendMetrics(systemMetrics.Timestamp, systemMetrics); err != nil {
 					log.Printf("Error sending metrics: %v", err)
 				}
 			}
 
 			// Check for alerts
-			alerts := collector.CheckAlerts(systemMetrics, metrics.AlertThresholds{
-				CPU:    cfg.AlertThresholds.CPU,
-				Memory: cfg.AlertThresholds.Memory,
-				Disk:   cfg.AlertThresholds.Disk,
-			})
+			alerts := collector.CheckAlerts(systemMetrics, thresholds.Load())
+			alerts = append(alerts, collector.CheckPorts(cfg.WatchedPorts)...)
 
 			// Send alerts
 			for _, alert := range alerts {
@@ -132,6 +257,7 @@ func main() {
 						log.Printf("Error sending alert: %v", err)
 					}
 				}
+				actionRunner.Handle(alert)
 			}
 
 			// Log basic stats periodically
@@ -140,9 +266,173 @@ func main() {
 				systemMetrics.Memory.UsedPercent,
 				systemMetrics.Disk.UsedPercent)
 
+		case next := <-intervals.Changes():
+			if next != interval {
+				log.Printf("Collection interval changed from %s to %s", interval, next)
+				interval = next
+				ticker.Reset(interval)
+			}
+
+		case <-diskTick:
+			if err := collector.RefreshDisk(); err != nil {
+				log.Printf("Error collecting disk metrics: %v", err)
+			}
+			sendCollectionErrors(collector, wsClient)
+
 		case <-interrupt:
 			log.Println("Shutdown signal received, stopping agent...")
+			if err := wsClient.FlushMetrics(); err != nil {
+				log.Printf("Error sending the last metrics batch: %v", err)
+			}
 			return
 		}
 	}
 }
+
+// runOnce collects a single sample, sends it along with any alerts and waits
+// for the server to acknowledge before returning
+func runOnce(cfg *config.Config, collector *metrics.Collector, wsClient *client.Client) error {
+	systemMetrics, err := collector.CollectMetrics()
+	if err != nil {
+		return fmt.Errorf("collecting metrics: %w", err)
+	}
+
+	alerts := collector.CheckAlerts(systemMetrics, localThresholds(cfg))
+	alerts = append(alerts, collector.CheckPorts(cfg.WatchedPorts)...)
+
+	if err := wsClient.Connect(); err != nil {
+		return err
+	}
+
+	if err := wsClient.SendMetrics(systemMetrics.Timestamp, systemMetrics); err != nil {
+		wsClient.Close()
+		return fmt.Errorf("sending metrics: %w", err)
+	}
+
+	for _, alert := range alerts {
+		log.Printf("ALERT: %s", alert.Message)
+		if err := wsClient.SendAlert(alert); err != nil {
+			wsClient.Close()
+			return fmt.Errorf("sending alert: %w", err)
+		}
+	}
+
+	sendCollectionErrors(collector, wsClient)
+
+	if err := wsClient.CloseAndWait(10 * time.Second); err != nil {
+		return err
+	}
+
+	log.Printf("Sent 1 sample and %d alert(s)", len(alerts))
+	return nil
+}
+
+// applyLiteMode turns off the optional collectors in lite mode, which reports
+// only CPU, memory, disk usage and network totals. Lite collection reads /proc
+// and falls back to full mode on other platforms.
+func applyLiteMode(cfg *config.Config) {
+	if cfg.Mode != config.ModeLite {
+		return
+	}
+
+	if runtime.GOOS != "linux" {
+		log.Printf("Lite mode is only supported on Linux, using full collection")
+		cfg.Mode = config.ModeFull
+		return
+	}
+
+	if cfg.CollectContextSwitches || cfg.CollectDiskIO || cfg.CollectMemoryPressure || cfg.NTPServer != "" {
+		log.Println("Lite mode: disabling context switch, disk I/O, memory pressure and clock drift collection")
+	}
+	cfg.CollectContextSwitches = false
+	cfg.CollectDiskIO = false
+	cfg.CollectMemoryPressure = false
+	cfg.NTPServer = ""
+	log.Println("Running in lite mode")
+}
+
+// configReport describes the agent's effective running configuration, so
+// support can see what an agent is actually doing
+type configReport struct {
+	AgentVersion string        `json:"agent_version"`
+	Platform     string        `json:"platform"`
+	Config       config.Config `json:"config"`
+}
+
+// capabilities announces the agent's schema version and the collectors and
+// features it has enabled
+type capabilities struct {
+	SchemaVersion int      `json:"schema_version"`
+	Collectors    []string `json:"collectors"`
+}
+
+// agentCapabilities lists what the agent reports with its configuration
+func agentCapabilities(cfg *config.Config) capabilities {
+	collectors := []string{"cpu", "memory", "disk", "network", "remote_thresholds", "remote_interval"}
+	if cfg.CollectContextSwitches {
+		collectors = append(collectors, "context_switches")
+	}
+	if cfg.CollectDiskIO {
+		collectors = append(collectors, "disk_io")
+	}
+	if cfg.CollectMemoryPressure {
+		collectors = append(collectors, "memory_pressure")
+	}
+	if cfg.NTPServer != "" {
+		collectors = append(collectors, "clock_drift")
+	}
+	if len(cfg.WatchedPorts) > 0 {
+		collectors = append(collectors, "ports")
+	}
+	if cfg.LogTail.Path != "" {
+		collectors = append(collectors, "logs")
+	}
+	if cfg.AlertActions.Enabled {
+		collectors = append(collectors, "alert_actions")
+	}
+	return capabilities{SchemaVersion: schemaVersion, Collectors: collectors}
+}
+
+// tailLogs polls the log file and ships new lines while connected. Lines
+// read while disconnected are not buffered.
+func tailLogs(cfg config.LogTailConfig, wsClient *client.Client) {
+	tailer := logs.NewTailer(cfg.Path, cfg.MaxLinesPerMinute, cfg.MaxLineBytes)
+	defer tailer.Close()
+
+	ticker := time.NewTicker(time.Duration(cfg.Interval) * time.Second)
+	defer ticker.Stop()
+
+	var lastErr string
+	for range ticker.C {
+		batch, err := tailer.Poll()
+		if err != nil {
+			// Log each distinct failure once, e.g. while the file is missing
+			if err.Error() != lastErr {
+				log.Printf("Error tailing log file: %v", err)
+				lastErr = err.Error()
+			}
+		} else {
+			lastErr = ""
+		}
+
+		if (len(batch.Lines) == 0 && batch.Dropped == 0) || !wsClient.IsConnected() {
+			continue
+		}
+		if err := wsClient.SendLogs(batch); err != nil {
+			log.Printf("Error sending log lines: %v", err)
+		}
+	}
+}
+
+// sendCollectionErrors reports queued non-fatal collector failures to the
+// server so missing metrics can be explained on the dashboard
+func sendCollectionErrors(collector *metrics.Collector, wsClient *client.Client) {
+	for _, collectionError := range collector.PendingErrors() {
+		log.Printf("Collection error (%s): %s", collectionError.Subsystem, collectionError.Message)
+		if wsClient.IsConnected() {
+			if err := wsClient.SendAgentError(collectionError); err != nil {
+				log.Printf("Error sending collection error: %v", err)
+			}
+		}
+	}
+}
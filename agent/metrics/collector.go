@@ -1,29 +1,61 @@
 package metrics
 
 import (
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"runtime"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
 )
 
 type SystemMetrics struct {
-	Timestamp  time.Time `json:"timestamp"`
-	ServerName string    `json:"server_name"`
-	CPU        CPUInfo   `json:"cpu"`
-	Memory     MemInfo   `json:"memory"`
-	Disk       DiskInfo  `json:"disk"`
-	Network    NetInfo   `json:"network"`
-	Uptime     int64     `json:"uptime"`
+	Timestamp  time.Time    `json:"timestamp"`
+	ServerName string       `json:"server_name"`
+	CPU        CPUInfo      `json:"cpu"`
+	Load       *LoadInfo    `json:"load,omitempty"`
+	Memory     MemInfo      `json:"memory"`
+	Swap       SwapInfo     `json:"swap"`
+	Disk       DiskInfo     `json:"disk"`
+	Disks      []DiskInfo   `json:"disks,omitempty"`
+	Network    NetInfo      `json:"network"`
+	Kernel     *KernelInfo  `json:"kernel,omitempty"`
+	DiskIO     []DiskIOInfo `json:"disk_io,omitempty"`
+
+	// DiskThroughput is the read and write rate summed over whole disks (Linux only)
+	DiskThroughput *DiskThroughputInfo `json:"disk_throughput,omitempty"`
+
+	// MemoryPressure holds stall and OOM kill indicators (Linux only)
+	MemoryPressure *MemoryPressureInfo `json:"memory_pressure,omitempty"`
+
+	// ClockOffset is how far the local clock is ahead of the NTP server, in seconds
+	ClockOffset *float64 `json:"clock_offset,omitempty"`
+	Uptime      int64    `json:"uptime"`
 }
 
 type CPUInfo struct {
 	Usage float64 `json:"usage"`
 	Cores int     `json:"cores"`
+
+	// PerCore is the usage of each logical core (not in lite mode)
+	PerCore []float64 `json:"per_core,omitempty"`
+}
+
+// LoadInfo holds the load averages and the 1-minute load divided by the
+// number of cores, which is comparable across machines (not on Windows)
+type LoadInfo struct {
+	Load1       float64 `json:"load1"`
+	Load5       float64 `json:"load5"`
+	Load15      float64 `json:"load15"`
+	LoadPerCore float64 `json:"load_per_core"`
 }
 
 type MemInfo struct {
@@ -33,30 +65,177 @@ type MemInfo struct {
 	UsedPercent float64 `json:"used_percent"`
 }
 
+// SwapInfo is the swap space in use; all zeros when there is no swap
+type SwapInfo struct {
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// DiskInfo is the usage of the filesystem mounted at Path
 type DiskInfo struct {
+	Path        string  `json:"path"`
 	Total       uint64  `json:"total"`
 	Free        uint64  `json:"free"`
 	Used        uint64  `json:"used"`
 	UsedPercent float64 `json:"used_percent"`
 }
 
+// NetInfo holds the counters of the primary interface, or the totals of all
+// interfaces when Interface is empty, along with the bytes per second since
+// the previous sample. The rates are nil on the first sample and after the
+// interface changes, and zero across a counter reset.
 type NetInfo struct {
+	Interface   string `json:"interface,omitempty"`
 	BytesSent   uint64 `json:"bytes_sent"`
 	BytesRecv   uint64 `json:"bytes_recv"`
 	PacketsSent uint64 `json:"packets_sent"`
 	PacketsRecv uint64 `json:"packets_recv"`
+
+	SentBytesPerSec *float64 `json:"sent_bytes_per_sec,omitempty"`
+	RecvBytesPerSec *float64 `json:"recv_bytes_per_sec,omitempty"`
+}
+
+// KernelInfo holds scheduler activity rates (Linux only)
+type KernelInfo struct {
+	ContextSwitchesPerSec float64 `json:"context_switches_per_sec"`
+	InterruptsPerSec      float64 `json:"interrupts_per_sec"`
+}
+
+// MemoryPressureInfo holds the share of time tasks stalled waiting for memory
+// over the last 10 seconds, from PSI, and the OOM kills since boot. The stall
+// averages are nil on kernels without PSI.
+type MemoryPressureInfo struct {
+	SomeAvg10 *float64 `json:"some_avg10,omitempty"` // % of time at least one task stalled
+	FullAvg10 *float64 `json:"full_avg10,omitempty"` // % of time all non-idle tasks stalled
+	OOMKills  uint64   `json:"oom_kills"`
+}
+
+// DiskIOInfo holds per-device I/O latency and queue depth (Linux only)
+type DiskIOInfo struct {
+	Device     string  `json:"device"`
+	AwaitMs    float64 `json:"await_ms"`    // average time per completed I/O
+	QueueDepth float64 `json:"queue_depth"` // average number of in-flight I/Os
+
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+}
+
+// DiskThroughputInfo holds the bytes read and written per second
+type DiskThroughputInfo struct {
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+}
+
+// diskIOCounters are the cumulative /proc/diskstats counters for a device
+type diskIOCounters struct {
+	ops        uint64 // completed reads + writes
+	ioTimeMs   uint64 // time spent on reads + writes
+	weightedMs uint64 // weighted time spent doing I/O
+	readBytes  uint64
+	writeBytes uint64
+	physical   bool // a whole disk, counted in throughput totals
+}
+
+// diskIOSample holds the previous counter readings of a device
+type diskIOSample struct {
+	ops      counterSample
+	ioTime   counterSample
+	weighted counterSample
+	read     counterSample
+	write    counterSample
+}
+
+// diskLatencySustainedSamples is how many consecutive samples a device must
+// exceed the latency threshold before a disk_latency alert is raised
+const diskLatencySustainedSamples = 3
+
+// memoryPressureSustainedSamples is how many consecutive samples memory
+// pressure must exceed its threshold before a memory_pressure alert is raised
+const memoryPressureSustainedSamples = 3
+
+// Options toggles optional collectors
+type Options struct {
+	ContextSwitches bool // collect context switch and interrupt rates
+
+	DiskPaths []string // mount points to report, the first as Disk; empty for "/"
+
+	DiskIO      bool     // collect per-device I/O latency and queue depth
+	DiskDevices []string // devices to report, empty for all
+
+	MemoryPressure bool // collect PSI memory stall averages and OOM kills
+
+	// PrimaryInterface is the interface network counters are reported for.
+	// When empty, the default route's interface is used (Linux only), and
+	// the totals of all interfaces elsewhere.
+	PrimaryInterface string
+
+	NTPServer   string        // measure clock offset against this server, empty to disable
+	NTPInterval time.Duration // minimum time between NTP queries
+
+	// CachedDisk makes CollectMetrics reuse the latest reading taken by
+	// RefreshDisk instead of calling disk.Usage on every sample
+	CachedDisk bool
+
+	// Lite reads CPU and memory straight from /proc instead of through
+	// gopsutil, and CPU usage is averaged over the collection interval rather
+	// than a blocking 1-second sample (Linux only)
+	Lite bool
 }
 
 type Collector struct {
 	serverName string
 	startTime  time.Time
+	options    Options
+
+	// Latest disk readings when disk is sampled on its own cadence
+	lastDisks []DiskInfo
+
+	// Previous /proc/stat CPU times in lite mode
+	prevCPUTotal uint64
+	prevCPUIdle  uint64
+
+	// Previous counter readings for rate computation
+	prevCtxt   counterSample
+	prevIntr   counterSample
+	prevSent   counterSample
+	prevRecv   counterSample
+	prevDiskIO map[string]diskIOSample
+
+	// Consecutive samples each device has been above the latency threshold
+	latencyStreak map[string]int
+
+	// Consecutive samples memory pressure has been above its threshold
+	pressureStreak int
+
+	// Interface network counters were last reported for, to log changes
+	netInterface string
+	netReported  bool
+
+	// Latest clock offset measurement, reused between NTP queries
+	lastNTPCheck time.Time
+	clockOffset  *float64
+
+	// Last error per subsystem and errors waiting to be sent
+	lastErrors    map[string]string
+	pendingErrors []CollectionError
 }
 
-func NewCollector(serverName string) *Collector {
-	return &Collector{
-		serverName: serverName,
-		startTime:  time.Now(),
+func NewCollector(serverName string, options Options) *Collector {
+	c := &Collector{
+		serverName:    serverName,
+		startTime:     time.Now(),
+		options:       options,
+		prevDiskIO:    make(map[string]diskIOSample),
+		latencyStreak: make(map[string]int),
+		lastErrors:    make(map[string]string),
 	}
+
+	// Prime the CPU counters so the first lite sample has a baseline
+	if options.Lite {
+		c.prevCPUTotal, c.prevCPUIdle, _ = readCPUTimes()
+	}
+	return c
 }
 
 func (c *Collector) CollectMetrics() (*SystemMetrics, error) {
@@ -67,89 +246,544 @@ func (c *Collector) CollectMetrics() (*SystemMetrics, error) {
 	}
 
 	// CPU metrics
-	cpuPercent, err := cpu.Percent(time.Second, false)
+	cpuUsage, perCore, err := c.cpuUsage()
 	if err != nil {
+		c.ReportError("cpu", err)
 		return nil, err
 	}
+	c.clearError("cpu")
 	metrics.CPU = CPUInfo{
-		Usage: cpuPercent[0],
-		Cores: runtime.NumCPU(),
+		Usage:   cpuUsage,
+		Cores:   runtime.NumCPU(),
+		PerCore: perCore,
+	}
+
+	// Load averages have no Windows equivalent, so they are reported as zero
+	if runtime.GOOS == "windows" {
+		metrics.Load = &LoadInfo{}
+	} else {
+		metrics.Load = c.collectLoad(metrics.CPU.Cores)
 	}
 
 	// Memory metrics
-	memInfo, err := mem.VirtualMemory()
+	memInfo, err := c.memory()
 	if err != nil {
+		c.ReportError("memory", err)
 		return nil, err
 	}
-	metrics.Memory = MemInfo{
-		Total:       memInfo.Total,
-		Available:   memInfo.Available,
-		Used:        memInfo.Used,
-		UsedPercent: memInfo.UsedPercent,
+	c.clearError("memory")
+	metrics.Memory = *memInfo
+	metrics.Swap = c.swap()
+
+	// Disk metrics of every configured mount point
+	if !c.options.CachedDisk || c.lastDisks == nil {
+		if err := c.RefreshDisk(); err != nil {
+			return nil, err
+		}
 	}
+	metrics.Disk = c.lastDisks[0]
+	metrics.Disks = c.lastDisks
 
-	// Disk metrics (root partition)
-	diskInfo, err := disk.Usage("/")
+	// Network metrics
+	netInfo, err := c.network()
 	if err != nil {
+		c.ReportError("network", err)
 		return nil, err
 	}
-	metrics.Disk = DiskInfo{
-		Total:       diskInfo.Total,
-		Free:        diskInfo.Free,
-		Used:        diskInfo.Used,
-		UsedPercent: diskInfo.UsedPercent,
+	metrics.Network = *netInfo
+
+	if c.options.ContextSwitches {
+		metrics.Kernel = c.collectKernelRates(metrics.Timestamp)
 	}
 
-	// Network metrics
-	netStats, err := net.IOCounters(false)
+	if c.options.DiskIO {
+		metrics.DiskIO, metrics.DiskThroughput = c.collectDiskIO(metrics.Timestamp)
+	}
+
+	if c.options.MemoryPressure {
+		metrics.MemoryPressure = c.collectMemoryPressure()
+	}
+
+	if c.options.NTPServer != "" {
+		metrics.ClockOffset = c.collectClockOffset(metrics.Timestamp)
+	}
+
+	return metrics, nil
+}
+
+// network returns the counters of the primary interface, falling back to the
+// totals of all interfaces when there is none
+func (c *Collector) network() (*NetInfo, error) {
+	stats, err := net.IOCounters(true)
 	if err != nil {
 		return nil, err
 	}
-	if len(netStats) > 0 {
-		metrics.Network = NetInfo{
-			BytesSent:   netStats[0].BytesSent,
-			BytesRecv:   netStats[0].BytesRecv,
-			PacketsSent: netStats[0].PacketsSent,
-			PacketsRecv: netStats[0].PacketsRecv,
+
+	name := c.options.PrimaryInterface
+	if name == "" {
+		// No default route (or not Linux) leaves the totals
+		name, _ = defaultRouteInterface()
+	}
+
+	info, found := sumInterfaces(stats, name)
+	if !found {
+		if c.options.PrimaryInterface != "" {
+			c.ReportError("network", fmt.Errorf("primary interface %s not found, reporting all interfaces", name))
+		}
+		name = ""
+		info, _ = sumInterfaces(stats, "")
+	}
+	if found || c.options.PrimaryInterface == "" {
+		c.clearError("network")
+	}
+
+	if !c.netReported || name != c.netInterface {
+		if name == "" {
+			log.Printf("Reporting network totals of all interfaces")
+		} else {
+			log.Printf("Reporting network counters of interface %s", name)
 		}
+		c.netInterface = name
+		c.netReported = true
+		// Counters of another interface are no baseline for a rate
+		c.prevSent, c.prevRecv = counterSample{}, counterSample{}
 	}
+	info.Interface = name
+	c.networkRates(info, time.Now())
+	return info, nil
+}
 
-	return metrics, nil
+// networkRates sets the bytes per second since the previous sample. The first
+// sample only primes the counters.
+func (c *Collector) networkRates(info *NetInfo, now time.Time) {
+	curSent := counterSample{value: info.BytesSent, at: now}
+	curRecv := counterSample{value: info.BytesRecv, at: now}
+	if !c.prevSent.at.IsZero() {
+		sent := counterRate(c.prevSent, curSent)
+		recv := counterRate(c.prevRecv, curRecv)
+		info.SentBytesPerSec = &sent
+		info.RecvBytesPerSec = &recv
+	}
+	c.prevSent = curSent
+	c.prevRecv = curRecv
+}
+
+// sumInterfaces adds up the counters of the named interface, or of all
+// interfaces when name is empty, and reports whether any matched
+func sumInterfaces(stats []net.IOCountersStat, name string) (*NetInfo, bool) {
+	info := &NetInfo{}
+	found := false
+	for _, stat := range stats {
+		if name != "" && stat.Name != name {
+			continue
+		}
+		info.BytesSent += stat.BytesSent
+		info.BytesRecv += stat.BytesRecv
+		info.PacketsSent += stat.PacketsSent
+		info.PacketsRecv += stat.PacketsRecv
+		found = true
+	}
+	return info, found
+}
+
+// collectLoad reads the load averages, returning nil when they can't be read
+func (c *Collector) collectLoad(cores int) *LoadInfo {
+	avg, err := load.Avg()
+	if err != nil {
+		c.ReportError("load", err)
+		return nil
+	}
+	c.clearError("load")
+
+	info := &LoadInfo{Load1: avg.Load1, Load5: avg.Load5, Load15: avg.Load15}
+	if cores > 0 {
+		info.LoadPerCore = avg.Load1 / float64(cores)
+	}
+	return info
+}
+
+// cpuUsage returns the overall CPU usage percentage and that of each core.
+// The overall usage is the average of the cores, so a single sampling second
+// yields both. In lite mode only the overall usage is returned, averaged since
+// the previous sample from /proc/stat without blocking.
+func (c *Collector) cpuUsage() (float64, []float64, error) {
+	if !c.options.Lite {
+		perCore, err := cpu.Percent(time.Second, true)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(perCore) == 0 {
+			return 0, nil, fmt.Errorf("no CPU usage reported")
+		}
+		var sum float64
+		for _, usage := range perCore {
+			sum += usage
+		}
+		return sum / float64(len(perCore)), perCore, nil
+	}
+
+	total, idle, err := readCPUTimes()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	deltaTotal := total - c.prevCPUTotal
+	deltaIdle := idle - c.prevCPUIdle
+	primed := c.prevCPUTotal != 0 && total > c.prevCPUTotal && idle >= c.prevCPUIdle
+	c.prevCPUTotal, c.prevCPUIdle = total, idle
+
+	if !primed || deltaIdle > deltaTotal {
+		return 0, nil, nil
+	}
+	return 100 * float64(deltaTotal-deltaIdle) / float64(deltaTotal), nil, nil
+}
+
+// memory returns memory usage, read from /proc/meminfo in lite mode
+func (c *Collector) memory() (*MemInfo, error) {
+	if !c.options.Lite {
+		memInfo, err := mem.VirtualMemory()
+		if err != nil {
+			return nil, err
+		}
+		return &MemInfo{
+			Total:       memInfo.Total,
+			Available:   memInfo.Available,
+			Used:        memInfo.Used,
+			UsedPercent: memInfo.UsedPercent,
+		}, nil
+	}
+
+	total, available, err := readMemInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &MemInfo{Total: total, Available: available}
+	if available <= total {
+		info.Used = total - available
+	}
+	if total > 0 {
+		info.UsedPercent = 100 * float64(info.Used) / float64(total)
+	}
+	return info, nil
+}
+
+// swap returns the swap space in use. Swap is optional, so a failed reading
+// is reported and counted as no swap rather than failing the sample.
+func (c *Collector) swap() SwapInfo {
+	var info SwapInfo
+	if !c.options.Lite {
+		swapInfo, err := mem.SwapMemory()
+		if err != nil {
+			c.ReportError("swap", err)
+			return info
+		}
+		info = SwapInfo{Total: swapInfo.Total, Used: swapInfo.Used, UsedPercent: swapInfo.UsedPercent}
+	} else {
+		total, free, err := readSwapInfo()
+		if err != nil {
+			c.ReportError("swap", err)
+			return info
+		}
+		info.Total = total
+		if free <= total {
+			info.Used = total - free
+		}
+		if total > 0 {
+			info.UsedPercent = 100 * float64(info.Used) / float64(total)
+		}
+	}
+	c.clearError("swap")
+	return info
+}
+
+// RefreshDisk takes a new reading of every mount point. With CachedDisk
+// enabled it is called on a slower ticker and its result is merged into each
+// metrics sample. Mount points that can't be read are left out and reported;
+// it only fails when none can be read.
+func (c *Collector) RefreshDisk() error {
+	paths := c.options.DiskPaths
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+
+	disks := make([]DiskInfo, 0, len(paths))
+	var failures []string
+	for _, path := range paths {
+		diskInfo, err := disk.Usage(path)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		disks = append(disks, DiskInfo{
+			Path:        path,
+			Total:       diskInfo.Total,
+			Free:        diskInfo.Free,
+			Used:        diskInfo.Used,
+			UsedPercent: diskInfo.UsedPercent,
+		})
+	}
+
+	if len(failures) > 0 {
+		err := errors.New(strings.Join(failures, "; "))
+		c.ReportError("disk", err)
+		if len(disks) == 0 {
+			return err
+		}
+	} else {
+		c.clearError("disk")
+	}
+	c.lastDisks = disks
+	return nil
+}
+
+// collectKernelRates returns context switch and interrupt rates since the
+// previous sample. The first sample only primes the counters and reports nil.
+func (c *Collector) collectKernelRates(now time.Time) *KernelInfo {
+	ctxt, intr, err := readKernelCounters()
+	if err != nil {
+		c.ReportError("kernel", err)
+		return nil
+	}
+	c.clearError("kernel")
+
+	curCtxt := counterSample{value: ctxt, at: now}
+	curIntr := counterSample{value: intr, at: now}
+	primed := !c.prevCtxt.at.IsZero()
+
+	info := &KernelInfo{
+		ContextSwitchesPerSec: counterRate(c.prevCtxt, curCtxt),
+		InterruptsPerSec:      counterRate(c.prevIntr, curIntr),
+	}
+	c.prevCtxt = curCtxt
+	c.prevIntr = curIntr
+
+	if !primed {
+		return nil
+	}
+	return info
+}
+
+// collectDiskIO returns per-device latency, queue depth and throughput since
+// the previous sample, along with the throughput of all whole disks. Devices
+// seen for the first time only prime their counters.
+func (c *Collector) collectDiskIO(now time.Time) ([]DiskIOInfo, *DiskThroughputInfo) {
+	counters, err := readDiskIOCounters(c.options.DiskDevices)
+	if err != nil {
+		c.ReportError("disk_io", err)
+		return nil, nil
+	}
+	c.clearError("disk_io")
+
+	var devices []DiskIOInfo
+	var throughput *DiskThroughputInfo
+	for name, cur := range counters {
+		sample := diskIOSample{
+			ops:      counterSample{value: cur.ops, at: now},
+			ioTime:   counterSample{value: cur.ioTimeMs, at: now},
+			weighted: counterSample{value: cur.weightedMs, at: now},
+			read:     counterSample{value: cur.readBytes, at: now},
+			write:    counterSample{value: cur.writeBytes, at: now},
+		}
+		prev, primed := c.prevDiskIO[name]
+		c.prevDiskIO[name] = sample
+		if !primed {
+			continue
+		}
+
+		info := DiskIOInfo{
+			Device: name,
+			// Weighted milliseconds per second of wall time is the average queue length
+			QueueDepth:       counterRate(prev.weighted, sample.weighted) / 1000,
+			ReadBytesPerSec:  counterRate(prev.read, sample.read),
+			WriteBytesPerSec: counterRate(prev.write, sample.write),
+		}
+		// Both rates share the same interval, so their ratio is ms per I/O
+		if opsRate := counterRate(prev.ops, sample.ops); opsRate > 0 {
+			info.AwaitMs = counterRate(prev.ioTime, sample.ioTime) / opsRate
+		}
+		devices = append(devices, info)
+
+		if cur.physical {
+			if throughput == nil {
+				throughput = &DiskThroughputInfo{}
+			}
+			throughput.ReadBytesPerSec += info.ReadBytesPerSec
+			throughput.WriteBytesPerSec += info.WriteBytesPerSec
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Device < devices[j].Device })
+	return devices, throughput
+}
+
+// collectMemoryPressure returns the memory stall averages and OOM kill count.
+// Kernels without PSI still report OOM kills.
+func (c *Collector) collectMemoryPressure() *MemoryPressureInfo {
+	kills, err := readOOMKills()
+	if err != nil {
+		c.ReportError("memory_pressure", err)
+		return nil
+	}
+
+	info := &MemoryPressureInfo{OOMKills: kills}
+	some, full, err := readMemoryPressure()
+	if err != nil {
+		c.ReportError("memory_pressure", err)
+		return info
+	}
+	c.clearError("memory_pressure")
+
+	info.SomeAvg10 = &some
+	info.FullAvg10 = &full
+	return info
+}
+
+// collectClockOffset returns the clock offset against the configured NTP
+// server, querying it at most once per NTPInterval. An unreachable server is
+// reported as a collection error and the offset omitted.
+func (c *Collector) collectClockOffset(now time.Time) *float64 {
+	if !c.lastNTPCheck.IsZero() && now.Sub(c.lastNTPCheck) < c.options.NTPInterval {
+		return c.clockOffset
+	}
+	c.lastNTPCheck = now
+
+	offset, err := queryClockOffset(c.options.NTPServer)
+	if err != nil {
+		c.ReportError("ntp", err)
+		c.clockOffset = nil
+		return nil
+	}
+	c.clearError("ntp")
+
+	seconds := offset.Seconds()
+	c.clockOffset = &seconds
+	return c.clockOffset
 }
 
 // CheckAlerts checks if any metrics exceed thresholds
 func (c *Collector) CheckAlerts(metrics *SystemMetrics, thresholds AlertThresholds) []Alert {
 	var alerts []Alert
 
-	if metrics.CPU.Usage > thresholds.CPU {
+	if level, threshold, ok := thresholdLevel(metrics.CPU.Usage, thresholds.CPUWarning, thresholds.CPUCritical); ok {
 		alerts = append(alerts, Alert{
 			Type:      "cpu",
-			Level:     "warning",
-			Message:   fmt.Sprintf("CPU usage is %.1f%% (threshold: %.1f%%)", metrics.CPU.Usage, thresholds.CPU),
+			Level:     level,
+			Message:   fmt.Sprintf("CPU usage is %.1f%% (threshold: %.1f%%)", metrics.CPU.Usage, threshold),
 			Value:     metrics.CPU.Usage,
-			Threshold: thresholds.CPU,
+			Threshold: threshold,
 			Timestamp: metrics.Timestamp,
 		})
 	}
 
-	if metrics.Memory.UsedPercent > thresholds.Memory {
+	if thresholds.LoadPerCore > 0 && metrics.Load != nil && metrics.Load.LoadPerCore > thresholds.LoadPerCore {
 		alerts = append(alerts, Alert{
-			Type:      "memory",
+			Type:  "load",
+			Level: "warning",
+			Message: fmt.Sprintf("Load per core is %.2f (load %.2f on %d cores, threshold: %.2f)",
+				metrics.Load.LoadPerCore, metrics.Load.Load1, metrics.CPU.Cores, thresholds.LoadPerCore),
+			Value:     metrics.Load.LoadPerCore,
+			Threshold: thresholds.LoadPerCore,
+			Timestamp: metrics.Timestamp,
+		})
+	}
+
+	if thresholds.Swap > 0 && metrics.Swap.UsedPercent > thresholds.Swap {
+		alerts = append(alerts, Alert{
+			Type:      "swap",
 			Level:     "warning",
-			Message:   fmt.Sprintf("Memory usage is %.1f%% (threshold: %.1f%%)", metrics.Memory.UsedPercent, thresholds.Memory),
+			Message:   fmt.Sprintf("Swap usage is %.1f%% (threshold: %.1f%%)", metrics.Swap.UsedPercent, thresholds.Swap),
+			Value:     metrics.Swap.UsedPercent,
+			Threshold: thresholds.Swap,
+			Timestamp: metrics.Timestamp,
+		})
+	}
+
+	if level, threshold, ok := thresholdLevel(metrics.Memory.UsedPercent, thresholds.MemoryWarning, thresholds.MemoryCritical); ok {
+		alerts = append(alerts, Alert{
+			Type:      "memory",
+			Level:     level,
+			Message:   fmt.Sprintf("Memory usage is %.1f%% (threshold: %.1f%%)", metrics.Memory.UsedPercent, threshold),
 			Value:     metrics.Memory.UsedPercent,
-			Threshold: thresholds.Memory,
+			Threshold: threshold,
 			Timestamp: metrics.Timestamp,
 		})
 	}
 
-	if metrics.Disk.UsedPercent > thresholds.Disk {
+	for _, usage := range metrics.Disks {
+		if level, threshold, ok := thresholdLevel(usage.UsedPercent, thresholds.DiskWarning, thresholds.DiskCritical); ok {
+			alerts = append(alerts, Alert{
+				Type:      "disk",
+				Level:     level,
+				Message:   fmt.Sprintf("Disk usage on %s is %.1f%% (threshold: %.1f%%)", usage.Path, usage.UsedPercent, threshold),
+				Value:     usage.UsedPercent,
+				Threshold: threshold,
+				Labels:    map[string]string{"mount": usage.Path},
+				Timestamp: metrics.Timestamp,
+			})
+		}
+	}
+
+	if thresholds.ClockDrift > 0 && metrics.ClockOffset != nil && math.Abs(*metrics.ClockOffset) > thresholds.ClockDrift {
+		alerts = append(alerts, Alert{
+			Type:      "clock_drift",
+			Level:     "warning",
+			Message:   fmt.Sprintf("Clock is off by %.3fs (threshold: %.1fs)", *metrics.ClockOffset, thresholds.ClockDrift),
+			Value:     *metrics.ClockOffset,
+			Threshold: thresholds.ClockDrift,
+			Timestamp: metrics.Timestamp,
+		})
+	}
+
+	if thresholds.DiskLatency > 0 {
+		alerts = append(alerts, c.checkDiskLatency(metrics, thresholds.DiskLatency)...)
+	}
+
+	if thresholds.MemoryPressure > 0 {
+		if alert := c.checkMemoryPressure(metrics, thresholds.MemoryPressure); alert != nil {
+			alerts = append(alerts, *alert)
+		}
+	}
+
+	return alerts
+}
+
+// thresholdLevel returns the level and threshold of an alert for value, or
+// false when it is within the warning threshold. The critical threshold only
+// applies when it is above the warning threshold.
+func thresholdLevel(value, warning, critical float64) (string, float64, bool) {
+	if critical > warning && value > critical {
+		return "critical", critical, true
+	}
+	if value > warning {
+		return "warning", warning, true
+	}
+	return "", 0, false
+}
+
+// checkDiskLatency alerts once a device's average I/O wait has stayed above
+// the threshold for diskLatencySustainedSamples consecutive samples
+func (c *Collector) checkDiskLatency(metrics *SystemMetrics, threshold float64) []Alert {
+	var alerts []Alert
+
+	for _, device := range metrics.DiskIO {
+		if device.AwaitMs <= threshold {
+			c.latencyStreak[device.Device] = 0
+			continue
+		}
+
+		c.latencyStreak[device.Device]++
+		if c.latencyStreak[device.Device] < diskLatencySustainedSamples {
+			continue
+		}
+
 		alerts = append(alerts, Alert{
-			Type:      "disk",
+			Type:      "disk_latency",
 			Level:     "warning",
-			Message:   fmt.Sprintf("Disk usage is %.1f%% (threshold: %.1f%%)", metrics.Disk.UsedPercent, thresholds.Disk),
-			Value:     metrics.Disk.UsedPercent,
-			Threshold: thresholds.Disk,
+			Message:   fmt.Sprintf("Disk %s I/O wait is %.1fms (threshold: %.1fms)", device.Device, device.AwaitMs, threshold),
+			Value:     device.AwaitMs,
+			Threshold: threshold,
+			Labels:    map[string]string{"device": device.Device},
 			Timestamp: metrics.Timestamp,
 		})
 	}
@@ -157,10 +791,49 @@ func (c *Collector) CheckAlerts(metrics *SystemMetrics, thresholds AlertThreshol
 	return alerts
 }
 
+// checkMemoryPressure alerts once the share of time some task stalled on
+// memory has stayed above the threshold for memoryPressureSustainedSamples
+// consecutive samples
+func (c *Collector) checkMemoryPressure(metrics *SystemMetrics, threshold float64) *Alert {
+	pressure := metrics.MemoryPressure
+	if pressure == nil || pressure.SomeAvg10 == nil || *pressure.SomeAvg10 <= threshold {
+		c.pressureStreak = 0
+		return nil
+	}
+
+	c.pressureStreak++
+	if c.pressureStreak < memoryPressureSustainedSamples {
+		return nil
+	}
+
+	return &Alert{
+		Type:  "memory_pressure",
+		Level: "warning",
+		Message: fmt.Sprintf("Tasks stalled on memory %.1f%% of the time (threshold: %.1f%%, %d OOM kills since boot)",
+			*pressure.SomeAvg10, threshold, pressure.OOMKills),
+		Value:     *pressure.SomeAvg10,
+		Threshold: threshold,
+		Timestamp: metrics.Timestamp,
+	}
+}
+
+// AlertThresholds are the values alerts are raised above. CPU, memory and
+// disk usage raise a warning above the warning threshold and a critical
+// alert above the critical one; a critical threshold of 0 disables it.
 type AlertThresholds struct {
-	CPU    float64 `json:"cpu"`
-	Memory float64 `json:"memory"`
-	Disk   float64 `json:"disk"`
+	CPUWarning     float64 `json:"cpu_warning"`
+	CPUCritical    float64 `json:"cpu_critical"`
+	LoadPerCore    float64 `json:"load_per_core"` // 1-minute load per core, 0 disables
+	MemoryWarning  float64 `json:"memory_warning"`
+	MemoryCritical float64 `json:"memory_critical"`
+	Swap           float64 `json:"swap"` // percent, 0 disables
+	DiskWarning    float64 `json:"disk_warning"`
+	DiskCritical   float64 `json:"disk_critical"`
+	DiskLatency    float64 `json:"disk_latency"` // milliseconds, 0 disables
+	ClockDrift     float64 `json:"clock_drift"`  // seconds, 0 disables
+
+	// MemoryPressure is the PSI "some" avg10 percentage, 0 disables
+	MemoryPressure float64 `json:"memory_pressure"`
 }
 
 type Alert struct {
@@ -170,4 +843,7 @@ type Alert struct {
 	Value     float64   `json:"value"`
 	Threshold float64   `json:"threshold"`
 	Timestamp time.Time `json:"timestamp"`
+
+	// Labels identify what the alert is about, e.g. {"device": "sda"}
+	Labels map[string]string `json:"labels,omitempty"`
 }
@@ -0,0 +1,53 @@
+package metrics
+
+import "testing"
+
+func TestCheckAlertsLevels(t *testing.T) {
+	thresholds := AlertThresholds{
+		CPUWarning:     80,
+		CPUCritical:    95,
+		MemoryWarning:  85,
+		MemoryCritical: 95,
+		DiskWarning:    90,
+		DiskCritical:   0,
+	}
+
+	cases := []struct {
+		name  string
+		cpu   float64
+		level string
+		limit float64
+	}{
+		{"below warning", 50, "", 0},
+		{"warning", 85, "warning", 80},
+		{"critical", 97, "critical", 95},
+	}
+	c := &Collector{}
+	for _, tc := range cases {
+		m := &SystemMetrics{CPU: CPUInfo{Usage: tc.cpu}}
+		alerts := c.CheckAlerts(m, thresholds)
+		if tc.level == "" {
+			if len(alerts) != 0 {
+				t.Errorf("%s: got %d alerts, want none", tc.name, len(alerts))
+			}
+			continue
+		}
+		if len(alerts) != 1 || alerts[0].Level != tc.level || alerts[0].Threshold != tc.limit {
+			t.Errorf("%s: got %+v, want one %s alert at %g", tc.name, alerts, tc.level, tc.limit)
+		}
+	}
+
+	// A disabled critical threshold keeps every breach a warning
+	m := &SystemMetrics{Disks: []DiskInfo{{Path: "/", UsedPercent: 99}}}
+	alerts := c.CheckAlerts(m, thresholds)
+	if len(alerts) != 1 || alerts[0].Level != "warning" {
+		t.Errorf("disk: got %+v, want one warning", alerts)
+	}
+}
+
+func TestThresholdLevelIgnoresCriticalBelowWarning(t *testing.T) {
+	level, threshold, ok := thresholdLevel(99, 90, 80)
+	if !ok || level != "warning" || threshold != 90 {
+		t.Errorf("got %s %g %v, want warning 90", level, threshold, ok)
+	}
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"os"
+	"strings"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// readDiskIOCounters reads cumulative per-device I/O counters from
+// /proc/diskstats. With no devices given, loop and ram devices are skipped.
+func readDiskIOCounters(devices []string) (map[string]diskIOCounters, error) {
+	stats, err := disk.IOCounters(devices...)
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make(map[string]diskIOCounters, len(stats))
+	for name, stat := range stats {
+		if len(devices) == 0 && (strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram")) {
+			continue
+		}
+		counters[name] = diskIOCounters{
+			ops:        stat.ReadCount + stat.WriteCount,
+			ioTimeMs:   stat.ReadTime + stat.WriteTime,
+			weightedMs: stat.WeightedIO,
+			readBytes:  stat.ReadBytes,
+			writeBytes: stat.WriteBytes,
+			physical:   isPhysicalDisk(name),
+		}
+	}
+	return counters, nil
+}
+
+// isPhysicalDisk reports whether a device is a whole disk rather than a
+// partition (which has no /sys/block entry) or a device-mapper or RAID
+// device stacked on other disks, so throughput totals count each byte once
+func isPhysicalDisk(name string) bool {
+	if strings.HasPrefix(name, "dm-") || strings.HasPrefix(name, "md") {
+		return false
+	}
+	_, err := os.Stat("/sys/block/" + name)
+	return err == nil
+}
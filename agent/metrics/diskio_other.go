@@ -0,0 +1,10 @@
+//go:build !linux
+
+package metrics
+
+import "errors"
+
+// readDiskIOCounters is only implemented on Linux
+func readDiskIOCounters(devices []string) (map[string]diskIOCounters, error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+)
+
+// CollectionError describes a non-fatal failure of one collector subsystem
+type CollectionError struct {
+	Subsystem string    `json:"subsystem"` // cpu, memory, disk, network, disk_io, kernel, ntp
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ReportError records a subsystem failure. A failure is only queued for
+// reporting when it differs from the last one seen for that subsystem, so a
+// persistently broken collector doesn't send the same error every sample.
+func (c *Collector) ReportError(subsystem string, err error) {
+	if errors.Is(err, errors.ErrUnsupported) {
+		return
+	}
+
+	message := err.Error()
+	if c.lastErrors[subsystem] == message {
+		return
+	}
+	c.lastErrors[subsystem] = message
+
+	c.pendingErrors = append(c.pendingErrors, CollectionError{
+		Subsystem: subsystem,
+		Message:   message,
+		Timestamp: time.Now(),
+	})
+}
+
+// clearError marks a subsystem as healthy again so its next failure is reported
+func (c *Collector) clearError(subsystem string) {
+	delete(c.lastErrors, subsystem)
+}
+
+// PendingErrors returns and clears the errors queued since the last call
+func (c *Collector) PendingErrors() []CollectionError {
+	pending := c.pendingErrors
+	c.pendingErrors = nil
+	return pending
+}
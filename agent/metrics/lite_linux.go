@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readCPUTimes reads the aggregate CPU time counters from the first line of
+// /proc/stat, returning total and idle (idle + iowait) jiffies
+func readCPUTimes() (total, idle uint64, err error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return 0, 0, err
+		}
+		return 0, 0, fmt.Errorf("/proc/stat is empty")
+	}
+
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("unexpected /proc/stat cpu line")
+	}
+
+	// user nice system idle iowait irq softirq steal; guest time is already
+	// included in user and nice
+	for i, field := range fields[1:] {
+		if i >= 8 {
+			break
+		}
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += value
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+	return total, idle, nil
+}
+
+// readSwapInfo reads total and free swap in bytes from /proc/meminfo
+func readSwapInfo() (total, free uint64, err error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	var foundTotal, foundFree bool
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() && !(foundTotal && foundFree) {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "SwapTotal:":
+			total, err = strconv.ParseUint(fields[1], 10, 64)
+			foundTotal = err == nil
+		case "SwapFree:":
+			free, err = strconv.ParseUint(fields[1], 10, 64)
+			foundFree = err == nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	if !foundTotal || !foundFree {
+		return 0, 0, fmt.Errorf("SwapTotal/SwapFree not found in /proc/meminfo")
+	}
+	// Values are reported in kB
+	return total * 1024, free * 1024, nil
+}
+
+// readMemInfo reads total and available memory in bytes from /proc/meminfo
+func readMemInfo() (total, available uint64, err error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	var foundTotal, foundAvailable bool
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() && !(foundTotal && foundAvailable) {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "MemTotal:":
+			total, err = strconv.ParseUint(fields[1], 10, 64)
+			foundTotal = err == nil
+		case "MemAvailable:":
+			available, err = strconv.ParseUint(fields[1], 10, 64)
+			foundAvailable = err == nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	if !foundTotal || !foundAvailable {
+		return 0, 0, fmt.Errorf("MemTotal/MemAvailable not found in /proc/meminfo")
+	}
+	// Values are reported in kB
+	return total * 1024, available * 1024, nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+
+package metrics
+
+import "errors"
+
+// readCPUTimes is only implemented on Linux
+func readCPUTimes() (total, idle uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
+
+// readSwapInfo is only implemented on Linux
+func readSwapInfo() (total, free uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
+
+// readMemInfo is only implemented on Linux
+func readMemInfo() (total, available uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
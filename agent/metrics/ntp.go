@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ntpEpochOffset is the number of seconds between the NTP epoch (1900) and
+// the Unix epoch (1970)
+const ntpEpochOffset = 2208988800
+
+// ntpTimeout bounds a single NTP query
+const ntpTimeout = 5 * time.Second
+
+// queryClockOffset asks an NTP server for the time using a minimal SNTP
+// request and returns how far the local clock is ahead (positive) or behind
+// (negative) the server
+func queryClockOffset(server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+
+	conn, err := net.DialTimeout("udp", server, ntpTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(ntpTimeout))
+
+	// LI = 0, version = 4, mode = 3 (client)
+	request := make([]byte, 48)
+	request[0] = 0x23
+
+	sent := time.Now()
+	if _, err := conn.Write(request); err != nil {
+		return 0, err
+	}
+
+	response := make([]byte, 48)
+	n, err := conn.Read(response)
+	if err != nil {
+		return 0, err
+	}
+	received := time.Now()
+
+	if n < 48 {
+		return 0, fmt.Errorf("short NTP response (%d bytes)", n)
+	}
+	if mode := response[0] & 0x07; mode != 4 {
+		return 0, fmt.Errorf("unexpected NTP mode %d", mode)
+	}
+	if stratum := response[1]; stratum == 0 || stratum > 15 {
+		return 0, fmt.Errorf("NTP server unsynchronised (stratum %d)", stratum)
+	}
+
+	serverReceive := ntpTime(response[32:40])
+	serverTransmit := ntpTime(response[40:48])
+
+	// Standard SNTP offset: ((t2 - t1) + (t3 - t4)) / 2, negated so a
+	// positive result means the local clock is ahead
+	offset := (serverReceive.Sub(sent) + serverTransmit.Sub(received)) / 2
+	return -offset, nil
+}
+
+// ntpTime decodes a 64-bit NTP timestamp
+func ntpTime(b []byte) time.Time {
+	seconds := binary.BigEndian.Uint32(b[0:4])
+	fraction := binary.BigEndian.Uint32(b[4:8])
+	nanos := (uint64(fraction) * 1e9) >> 32
+	return time.Unix(int64(seconds)-ntpEpochOffset, int64(nanos))
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// portDialTimeout bounds how long a single port check may take
+const portDialTimeout = 2 * time.Second
+
+// CheckPorts returns a port_down alert for each watched local TCP port that
+// is not accepting connections
+func (c *Collector) CheckPorts(ports []int) []Alert {
+	var alerts []Alert
+
+	for _, port := range ports {
+		if isPortListening(port) {
+			continue
+		}
+		alerts = append(alerts, Alert{
+			Type:      "port_down",
+			Level:     "critical",
+			Message:   fmt.Sprintf("TCP port %d is not listening", port),
+			Value:     float64(port),
+			Labels:    map[string]string{"port": strconv.Itoa(port)},
+			Timestamp: time.Now(),
+		})
+	}
+
+	return alerts
+}
+
+// isPortListening dials the port on loopback, which works on every platform
+// without needing permission to enumerate sockets
+func isPortListening(port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), portDialTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
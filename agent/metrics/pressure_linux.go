@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readMemoryPressure reads the 10-second "some" and "full" stall averages
+// from /proc/pressure/memory. Kernels without PSI (before 4.20, or built or
+// booted without it) have no such file and report errors.ErrUnsupported.
+func readMemoryPressure() (some, full float64, err error) {
+	file, err := os.Open("/proc/pressure/memory")
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, 0, errors.ErrUnsupported
+	} else if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	var foundSome, foundFull bool
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[1], "avg10=") {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimPrefix(fields[1], "avg10="), 64)
+		if err != nil {
+			continue
+		}
+
+		switch fields[0] {
+		case "some":
+			some, foundSome = value, true
+		case "full":
+			full, foundFull = value, true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	if !foundSome || !foundFull {
+		return 0, 0, fmt.Errorf("some/full averages not found in /proc/pressure/memory")
+	}
+	return some, full, nil
+}
+
+// readOOMKills reads the number of processes killed by the OOM killer since
+// boot from /proc/vmstat
+func readOOMKills() (uint64, error) {
+	file, err := os.Open("/proc/vmstat")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	// The counter was added in Linux 4.13
+	return 0, errors.ErrUnsupported
+}
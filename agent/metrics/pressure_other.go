@@ -0,0 +1,15 @@
+//go:build !linux
+
+package metrics
+
+import "errors"
+
+// readMemoryPressure is only implemented on Linux
+func readMemoryPressure() (some, full float64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
+
+// readOOMKills is only implemented on Linux
+func readOOMKills() (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
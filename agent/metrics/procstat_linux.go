@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readKernelCounters reads the cumulative context switch and interrupt
+// counters from /proc/stat
+func readKernelCounters() (ctxt, intr uint64, err error) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	var foundCtxt, foundIntr bool
+	scanner := bufio.NewScanner(file)
+	// The intr line lists every IRQ and can exceed the default buffer size
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "ctxt":
+			ctxt, err = strconv.ParseUint(fields[1], 10, 64)
+			foundCtxt = err == nil
+		case "intr":
+			// First value is the total across all interrupts
+			intr, err = strconv.ParseUint(fields[1], 10, 64)
+			foundIntr = err == nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	if !foundCtxt || !foundIntr {
+		return 0, 0, fmt.Errorf("ctxt/intr counters not found in /proc/stat")
+	}
+	return ctxt, intr, nil
+}
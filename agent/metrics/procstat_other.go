@@ -0,0 +1,10 @@
+//go:build !linux
+
+package metrics
+
+import "errors"
+
+// readKernelCounters is only implemented on Linux
+func readKernelCounters() (ctxt, intr uint64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
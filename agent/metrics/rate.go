@@ -0,0 +1,20 @@
+package metrics
+
+import "time"
+
+// counterSample is a reading of a monotonically increasing counter
+type counterSample struct {
+	value uint64
+	at    time.Time
+}
+
+// counterRate returns the per-second rate between two counter readings.
+// A counter that went backwards (e.g. after a reboot or wrap) yields zero
+// rather than a huge bogus rate.
+func counterRate(prev, cur counterSample) float64 {
+	elapsed := cur.at.Sub(prev.at).Seconds()
+	if prev.at.IsZero() || elapsed <= 0 || cur.value < prev.value {
+		return 0
+	}
+	return float64(cur.value-prev.value) / elapsed
+}
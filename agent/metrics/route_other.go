@@ -0,0 +1,10 @@
+//go:build !linux
+
+package metrics
+
+import "errors"
+
+// defaultRouteInterface is only implemented on Linux
+func defaultRouteInterface() (string, error) {
+	return "", errors.ErrUnsupported
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"agent/config"
+	"agent/metrics"
+)
+
+// thresholdsUpdate is a config_update pushing alert thresholds from the
+// backend. A nil threshold keeps the value from the local config; pushed cpu,
+// memory and disk values replace the warning thresholds.
+type thresholdsUpdate struct {
+	Version         int `json:"version"`
+	AlertThresholds *struct {
+		CPU         *float64 `json:"cpu"`
+		LoadPerCore *float64 `json:"load_per_core"`
+		Memory      *float64 `json:"memory"`
+		Swap        *float64 `json:"swap"`
+		Disk        *float64 `json:"disk"`
+		DiskLatency *float64 `json:"disk_latency"`
+		ClockDrift  *float64 `json:"clock_drift"`
+
+		MemoryPressure *float64 `json:"memory_pressure"`
+	} `json:"alert_thresholds"`
+}
+
+// configAck answers a config_update
+type configAck struct {
+	Version int    `json:"version"`
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+// thresholdStore holds the alert thresholds in effect. Pushed thresholds
+// replace the whole set at once, so a check never mixes old and new values.
+type thresholdStore struct {
+	local   metrics.AlertThresholds
+	current atomic.Pointer[metrics.AlertThresholds]
+}
+
+func newThresholdStore(cfg *config.Config) *thresholdStore {
+	s := &thresholdStore{local: localThresholds(cfg)}
+	s.current.Store(&s.local)
+	return s
+}
+
+// Load returns the thresholds alerts are checked against
+func (s *thresholdStore) Load() metrics.AlertThresholds {
+	return *s.current.Load()
+}
+
+// HandleConfigUpdate applies the thresholds in a config_update and returns
+// the ack to send, or nil when the update carries no thresholds
+func (s *thresholdStore) HandleConfigUpdate(data interface{}) interface{} {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return configAck{Error: err.Error()}
+	}
+
+	var update thresholdsUpdate
+	if err := json.Unmarshal(jsonData, &update); err != nil {
+		return configAck{Error: fmt.Sprintf("invalid config update: %v", err)}
+	}
+	if update.AlertThresholds == nil {
+		return nil
+	}
+
+	pushed := update.AlertThresholds
+	thresholds := s.local
+	for _, t := range []struct {
+		name    string
+		value   *float64
+		target  *float64
+		percent bool
+	}{
+		{"cpu", pushed.CPU, &thresholds.CPUWarning, true},
+		{"load_per_core", pushed.LoadPerCore, &thresholds.LoadPerCore, false},
+		{"memory", pushed.Memory, &thresholds.MemoryWarning, true},
+		{"swap", pushed.Swap, &thresholds.Swap, false},
+		{"disk", pushed.Disk, &thresholds.DiskWarning, true},
+		{"disk_latency", pushed.DiskLatency, &thresholds.DiskLatency, false},
+		{"clock_drift", pushed.ClockDrift, &thresholds.ClockDrift, false},
+		{"memory_pressure", pushed.MemoryPressure, &thresholds.MemoryPressure, false},
+	} {
+		if t.value == nil {
+			continue
+		}
+		if *t.value < 0 || (t.percent && (*t.value == 0 || *t.value > 100)) {
+			log.Printf("Rejected alert thresholds v%d: invalid %s threshold %g", update.Version, t.name, *t.value)
+			return configAck{Version: update.Version, Error: fmt.Sprintf("invalid %s threshold %g", t.name, *t.value)}
+		}
+		*t.target = *t.value
+	}
+
+	s.current.Store(&thresholds)
+	log.Printf("Applied alert thresholds v%d: CPU=%g%% Memory=%g%% Disk=%g%%",
+		update.Version, thresholds.CPUWarning, thresholds.MemoryWarning, thresholds.DiskWarning)
+	return configAck{Version: update.Version, Applied: true}
+}
+
+// localThresholds returns the alert thresholds from the local config
+func localThresholds(cfg *config.Config) metrics.AlertThresholds {
+	t := cfg.AlertThresholds
+	return metrics.AlertThresholds{
+		CPUWarning:     warningThreshold(t.CPUWarning, t.CPU),
+		CPUCritical:    t.CPUCritical,
+		LoadPerCore:    t.LoadPerCore,
+		MemoryWarning:  warningThreshold(t.MemoryWarning, t.Memory),
+		MemoryCritical: t.MemoryCritical,
+		Swap:           t.Swap,
+		DiskWarning:    warningThreshold(t.DiskWarning, t.Disk),
+		DiskCritical:   t.DiskCritical,
+		DiskLatency:    t.DiskLatency,
+		ClockDrift:     t.ClockDrift,
+
+		MemoryPressure: t.MemoryPressure,
+	}
+}
+
+// warningThreshold falls back to the single threshold of older configs when
+// no warning threshold is set
+func warningThreshold(warning, legacy float64) float64 {
+	if warning > 0 {
+		return warning
+	}
+	return legacy
+}
@@ -0,0 +1,51 @@
+// Package agentversion parses and compares agent release versions
+package agentversion
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dev is the version reported by agents built without a release version
+const Dev = "dev"
+
+// Version is a major.minor.patch release version
+type Version [3]int
+
+// Parse parses versions such as "1.4.2" or "v1.4". Missing minor and patch
+// parts are zero and any pre-release suffix ("1.4.2-rc1") is ignored.
+func Parse(s string) (Version, error) {
+	var v Version
+	trimmed := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexAny(trimmed, "-+"); i >= 0 {
+		trimmed = trimmed[:i]
+	}
+
+	parts := strings.Split(trimmed, ".")
+	if trimmed == "" || len(parts) > len(v) {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// Less reports whether v is an older release than other
+func (v Version) Less(other Version) bool {
+	for i := range v {
+		if v[i] != other[i] {
+			return v[i] < other[i]
+		}
+	}
+	return false
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
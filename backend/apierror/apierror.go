@@ -0,0 +1,91 @@
+package apierror
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Machine-readable error codes returned by the API
+const (
+	CodeUnauthenticated = "unauthenticated"
+	CodeForbidden       = "forbidden"
+	CodeInvalidRequest  = "invalid_request"
+	CodeNotFound        = "not_found"
+	CodeConflict        = "conflict"
+	CodeQuotaExceeded   = "quota_exceeded"
+	CodeAgentOutdated   = "agent_outdated"
+	CodeTooLarge        = "payload_too_large"
+	CodeRateLimited     = "rate_limited"
+	CodeTimeout         = "timeout"
+	CodeDatabase        = "database_error"
+	CodeInternal        = "internal_error"
+)
+
+// CodeForStatus returns the default error code for an HTTP status
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return CodeTimeout
+	default:
+		return CodeInternal
+	}
+}
+
+// Response is the body of every API error. Error duplicates Message so
+// existing clients reading the "error" field keep working.
+type Response struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Error   string      `json:"error"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// New builds an error response
+func New(code, message string) Response {
+	return Response{
+		Code:    code,
+		Message: message,
+		Error:   message,
+	}
+}
+
+// WithDetails returns a copy of the response carrying extra details
+func (r Response) WithDetails(details interface{}) Response {
+	r.Details = details
+	return r
+}
+
+// Respond writes an error response
+func Respond(c *gin.Context, status int, code, message string) {
+	c.JSON(status, New(code, message))
+}
+
+// RespondWithDetails writes an error response with additional details
+func RespondWithDetails(c *gin.Context, status int, code, message string, details interface{}) {
+	c.JSON(status, New(code, message).WithDetails(details))
+}
+
+// Abort writes an error response and stops the handler chain
+func Abort(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, New(code, message))
+}
+
+// AbortWithDetails writes an error response with details and stops the handler chain
+func AbortWithDetails(c *gin.Context, status int, code, message string, details interface{}) {
+	c.AbortWithStatusJSON(status, New(code, message).WithDetails(details))
+}
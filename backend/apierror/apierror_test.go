@@ -0,0 +1,76 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCodeForStatus(t *testing.T) {
+	for status, want := range map[int]string{
+		http.StatusBadRequest:          CodeInvalidRequest,
+		http.StatusUnauthorized:        CodeUnauthenticated,
+		http.StatusForbidden:           CodeForbidden,
+		http.StatusNotFound:            CodeNotFound,
+		http.StatusConflict:            CodeConflict,
+		http.StatusTooManyRequests:     CodeRateLimited,
+		http.StatusGatewayTimeout:      CodeTimeout,
+		http.StatusInternalServerError: CodeInternal,
+	} {
+		if got := CodeForStatus(status); got != want {
+			t.Errorf("CodeForStatus(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestAbortWithDetails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	AbortWithDetails(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body", "name is required")
+
+	if !c.IsAborted() {
+		t.Error("handler chain not aborted")
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"code":    CodeInvalidRequest,
+		"message": "Invalid request body",
+		"error":   "Invalid request body",
+		"details": "name is required",
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("%s = %v, want %v", key, body[key], value)
+		}
+	}
+}
+
+func TestRespondOmitsEmptyDetails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	Respond(c, http.StatusNotFound, CodeNotFound, "Server not found")
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := body["details"]; ok {
+		t.Errorf("unexpected details in %v", body)
+	}
+	if body["code"] != CodeNotFound {
+		t.Errorf("code = %v, want %s", body["code"], CodeNotFound)
+	}
+}
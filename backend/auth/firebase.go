@@ -2,9 +2,12 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
+	"backend/apierror"
 	"backend/config"
 	"backend/models"
 
@@ -15,14 +18,20 @@ import (
 )
 
 type FirebaseAuth struct {
-	client *auth.Client
+	client               *auth.Client
+	requireVerifiedEmail bool
 }
 
 type UserClaims struct {
-	UID   string `json:"uid"`
-	Email string `json:"email"`
+	UID           string `json:"uid"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
 }
 
+// ErrEmailNotVerified is returned for tokens whose email address isn't
+// verified when firebase.require_verified_email is set
+var ErrEmailNotVerified = errors.New("email address is not verified")
+
 func NewFirebaseAuth(cfg *config.FirebaseConfig) (*FirebaseAuth, error) {
 	ctx := context.Background()
 
@@ -51,7 +60,7 @@ func NewFirebaseAuth(cfg *config.FirebaseConfig) (*FirebaseAuth, error) {
 		return nil, fmt.Errorf("failed to initialize Firebase Auth client: %w", err)
 	}
 
-	return &FirebaseAuth{client: client}, nil
+	return &FirebaseAuth{client: client, requireVerifiedEmail: cfg.RequireVerifiedEmail}, nil
 }
 
 // VerifyIDToken verifies a Firebase ID token and returns user claims
@@ -61,11 +70,20 @@ func (f *FirebaseAuth) VerifyIDToken(ctx context.Context, idToken string) (*User
 		return nil, fmt.Errorf("failed to verify ID token: %w", err)
 	}
 
-	claims := &UserClaims{
-		UID:   token.UID,
-		Email: token.Claims["email"].(string),
-	}
+	return claimsFromToken(token, f.requireVerifiedEmail)
+}
+
+// claimsFromToken reads the user claims of a verified token. Tokens without
+// an email, e.g. from phone sign-in, have an empty Email, and a missing
+// email_verified claim counts as unverified.
+func claimsFromToken(token *auth.Token, requireVerifiedEmail bool) (*UserClaims, error) {
+	claims := &UserClaims{UID: token.UID}
+	claims.Email, _ = token.Claims["email"].(string)
+	claims.EmailVerified, _ = token.Claims["email_verified"].(bool)
 
+	if requireVerifiedEmail && !claims.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
 	return claims, nil
 }
 
@@ -75,16 +93,14 @@ func (f *FirebaseAuth) AuthMiddleware() gin.HandlerFunc {
 		// Get token from Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(401, gin.H{"error": "Authorization header required"})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "Authorization header required")
 			return
 		}
 
 		// Extract token from "Bearer <token>"
 		tokenParts := strings.Split(authHeader, " ")
 		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			c.JSON(401, gin.H{"error": "Invalid authorization header format"})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "Invalid authorization header format")
 			return
 		}
 
@@ -92,15 +108,18 @@ func (f *FirebaseAuth) AuthMiddleware() gin.HandlerFunc {
 
 		// Verify token
 		claims, err := f.VerifyIDToken(c.Request.Context(), idToken)
-		if err != nil {
-			c.JSON(401, gin.H{"error": "Invalid token", "details": err.Error()})
-			c.Abort()
+		if errors.Is(err, ErrEmailNotVerified) {
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeForbidden, "Email address must be verified")
+			return
+		} else if err != nil {
+			apierror.AbortWithDetails(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "Invalid token", err.Error())
 			return
 		}
 
 		// Set user info in context
 		c.Set("user_uid", claims.UID)
 		c.Set("user_email", claims.Email)
+		c.Set("user_email_verified", claims.EmailVerified)
 		c.Next()
 	}
 }
@@ -111,8 +130,7 @@ func (f *FirebaseAuth) EnsureUserExists(db interface{}) gin.HandlerFunc {
 		// Get user info from context (set by AuthMiddleware)
 		userClaims, exists := GetUserFromContext(c)
 		if !exists {
-			c.JSON(500, gin.H{"error": "User context not found"})
-			c.Abort()
+			apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "User context not found")
 			return
 		}
 
@@ -123,16 +141,14 @@ func (f *FirebaseAuth) EnsureUserExists(db interface{}) gin.HandlerFunc {
 
 		database, ok := db.(DatabaseInterface)
 		if !ok {
-			c.JSON(500, gin.H{"error": "Database interface error"})
-			c.Abort()
+			apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Database interface error")
 			return
 		}
 
 		// Create or get user in database
 		_, err := database.GetOrCreateUser(userClaims.UID, userClaims.Email)
 		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to create user record", "details": err.Error()})
-			c.Abort()
+			apierror.AbortWithDetails(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to create user record", err.Error())
 			return
 		}
 
@@ -162,6 +178,7 @@ func (f *FirebaseAuth) OptionalAuthMiddleware() gin.HandlerFunc {
 
 		c.Set("user_uid", claims.UID)
 		c.Set("user_email", claims.Email)
+		c.Set("user_email_verified", claims.EmailVerified)
 		c.Next()
 	}
 }
@@ -178,9 +195,13 @@ func GetUserFromContext(c *gin.Context) (*UserClaims, bool) {
 		return nil, false
 	}
 
+	verified, _ := c.Get("user_email_verified")
+	emailVerified, _ := verified.(bool)
+
 	return &UserClaims{
-		UID:   uid.(string),
-		Email: email.(string),
+		UID:           uid.(string),
+		Email:         email.(string),
+		EmailVerified: emailVerified,
 	}, true
 }
 
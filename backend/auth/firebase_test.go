@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"firebase.google.com/go/v4/auth"
+)
+
+func TestClaimsFromTokenEmailVerification(t *testing.T) {
+	verified := map[string]interface{}{"email": "user@example.com", "email_verified": true}
+	unverified := map[string]interface{}{"email": "user@example.com", "email_verified": false}
+	missing := map[string]interface{}{"email": "user@example.com"}
+
+	tests := []struct {
+		name     string
+		claims   map[string]interface{}
+		require  bool
+		verified bool
+		err      error
+	}{
+		{"verified", verified, true, true, nil},
+		{"unverified", unverified, true, false, ErrEmailNotVerified},
+		{"missing claim", missing, true, false, ErrEmailNotVerified},
+		{"unverified, not required", unverified, false, false, nil},
+		{"missing claim, not required", missing, false, false, nil},
+	}
+	for _, test := range tests {
+		claims, err := claimsFromToken(&auth.Token{UID: "uid", Claims: test.claims}, test.require)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if claims.UID != "uid" || claims.Email != "user@example.com" || claims.EmailVerified != test.verified {
+			t.Errorf("%s: got %+v, want uid, email and verified %v", test.name, claims, test.verified)
+		}
+	}
+}
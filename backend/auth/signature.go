@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// GenerateSigningSecret returns a new random per-server signing secret
+func GenerateSigningSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// SignAgentMessage computes the HMAC-SHA256 signature of an agent message
+// over its type, timestamp and raw JSON data. Agents compute the same value.
+func SignAgentMessage(secret, messageType string, timestamp time.Time, data []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(messageType))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(timestamp.UTC().Format(time.RFC3339Nano)))
+	mac.Write([]byte("\n"))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyAgentMessage reports whether signature is valid for the message
+func VerifyAgentMessage(secret, messageType string, timestamp time.Time, data []byte, signature string) bool {
+	expected := SignAgentMessage(secret, messageType, timestamp, data)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -1,22 +1,71 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"strings"
+
+	"backend/agentversion"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Firebase FirebaseConfig `mapstructure:"firebase"`
-	SMTP     SMTPConfig     `mapstructure:"smtp"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Firebase  FirebaseConfig  `mapstructure:"firebase"`
+	SMTP      SMTPConfig      `mapstructure:"smtp"`
+	Slack     SlackConfig     `mapstructure:"slack"`
+	Webhook   WebhookConfig   `mapstructure:"webhook"`
+	Agents    AgentsConfig    `mapstructure:"agents"`
+	Forwarder ForwarderConfig `mapstructure:"forwarder"`
+	Dashboard DashboardConfig `mapstructure:"dashboard"`
+	QUIC      QUICConfig      `mapstructure:"quic"`
+
+	AlertRetention AlertRetentionConfig `mapstructure:"alert_retention"`
+	StaleServers   StaleServersConfig   `mapstructure:"stale_servers"`
+	Quotas         QuotasConfig         `mapstructure:"quotas"`
+	Badges         BadgesConfig         `mapstructure:"badges"`
+	CustomMetrics  CustomMetricsConfig  `mapstructure:"custom_metrics"`
+	Logs           LogsConfig           `mapstructure:"logs"`
+
+	Notifications NotificationsConfig `mapstructure:"notifications"`
+	TLS           TLSConfig           `mapstructure:"tls"`
 }
 
 type ServerConfig struct {
 	Port         string `mapstructure:"port"`
 	Host         string `mapstructure:"host"`
 	AllowOrigins string `mapstructure:"allow_origins"`
+
+	// Request limits for the REST API
+	MaxBodyBytes       int64    `mapstructure:"max_body_bytes"`
+	RequestTimeout     int      `mapstructure:"request_timeout"` // seconds, 0 disables
+	TimeoutExemptPaths []string `mapstructure:"timeout_exempt_paths"`
+
+	// Serve HTTPS with this certificate and key instead of plain HTTP
+	TLSCertFile string `mapstructure:"tls_cert_file"`
+	TLSKeyFile  string `mapstructure:"tls_key_file"`
+}
+
+// QUICConfig enables the experimental QUIC listener for agents on lossy,
+// high-latency links, next to the WebSocket endpoint
+type QUICConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Port    string `mapstructure:"port"` // UDP port, on server.host
+
+	// QUIC always uses TLS. Without these the server.tls_* files are used.
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+}
+
+// Certificate returns the certificate and key files of the QUIC listener
+func (c QUICConfig) Certificate(server ServerConfig) (certFile, keyFile string) {
+	if c.CertFile != "" {
+		return c.CertFile, c.KeyFile
+	}
+	return server.TLSCertFile, server.TLSKeyFile
 }
 
 type DatabaseConfig struct {
@@ -26,11 +75,24 @@ type DatabaseConfig struct {
 	Password string `mapstructure:"password"`
 	DBName   string `mapstructure:"dbname"`
 	SSLMode  string `mapstructure:"sslmode"`
+
+	// PasswordFile reads the password from a file instead, e.g. a mounted secret
+	PasswordFile string `mapstructure:"password_file"`
+
+	// RetentionDays deletes metrics older than this many days (0 keeps them
+	// forever); alerts have their own, longer retention in alert_retention
+	RetentionDays int `mapstructure:"retention_days"`
+	// PruneInterval is the number of hours between metric pruning runs
+	PruneInterval int `mapstructure:"prune_interval"`
 }
 
 type FirebaseConfig struct {
 	ServiceAccountPath string `mapstructure:"service_account_path"`
 	ProjectID          string `mapstructure:"project_id"`
+
+	// RequireVerifiedEmail rejects users whose email address isn't verified,
+	// since alert emails are sent to it
+	RequireVerifiedEmail bool `mapstructure:"require_verified_email"`
 }
 
 type SMTPConfig struct {
@@ -39,8 +101,217 @@ type SMTPConfig struct {
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
 	From     string `mapstructure:"from"`
+
+	// PasswordFile reads the password from a file instead, e.g. a mounted secret
+	PasswordFile string `mapstructure:"password_file"`
+
+	// Default sender name and branding of alert emails, overridable per server
+	FromName    string `mapstructure:"from_name"`
+	ProductName string `mapstructure:"product_name"`
+	LogoURL     string `mapstructure:"logo_url"`
+
+	// AllowedFromDomains lists the domains per-server sender addresses may
+	// use. When empty only the domain of From is allowed.
+	AllowedFromDomains []string `mapstructure:"allowed_from_domains"`
+
+	// Fallbacks are tried in order when the server above can't be reached
+	// or rejects the login. They send with the same sender and branding.
+	Fallbacks []SMTPProvider `mapstructure:"fallbacks"`
+}
+
+// SlackConfig posts alerts to a Slack incoming webhook
+type SlackConfig struct {
+	WebhookURL string `mapstructure:"webhook_url"` // empty disables Slack notifications
+	// Channel overrides the webhook's default channel, e.g. #alerts
+	Channel string `mapstructure:"channel"`
+}
+
+// WebhookConfig posts every alert as JSON to an endpoint of the user's own
+type WebhookConfig struct {
+	URL string `mapstructure:"url"` // empty disables webhook notifications
+	// Secret signs each request with HMAC-SHA256 in X-Monitaur-Signature
+	Secret     string `mapstructure:"secret"`
+	SecretFile string `mapstructure:"secret_file"`
+	// MaxRetries is how many times a request failing with a 5xx or network
+	// error is retried, with doubling backoff
+	MaxRetries int `mapstructure:"max_retries"`
+}
+
+// SMTPProvider is the connection and login of one SMTP server
+type SMTPProvider struct {
+	Host         string `mapstructure:"host"`
+	Port         string `mapstructure:"port"`
+	Username     string `mapstructure:"username"`
+	Password     string `mapstructure:"password"`
+	PasswordFile string `mapstructure:"password_file"`
+}
+
+// Configured reports whether the provider has a host and a login to send with
+func (p SMTPProvider) Configured() bool {
+	return p.Host != "" && p.Username != "" && p.Password != ""
+}
+
+// Providers returns the primary SMTP server followed by the fallbacks, in
+// the order they are tried, leaving out any that aren't configured
+func (c SMTPConfig) Providers() []SMTPProvider {
+	primary := SMTPProvider{
+		Host:         c.Host,
+		Port:         c.Port,
+		Username:     c.Username,
+		Password:     c.Password,
+		PasswordFile: c.PasswordFile,
+	}
+
+	var providers []SMTPProvider
+	for _, provider := range append([]SMTPProvider{primary}, c.Fallbacks...) {
+		if provider.Configured() {
+			providers = append(providers, provider)
+		}
+	}
+	return providers
+}
+
+type AgentsConfig struct {
+	// DuplicatePolicy decides what happens when an agent connects with a token
+	// that already has a live connection: "replace" closes the old connection,
+	// "reject" refuses the new one
+	DuplicatePolicy string `mapstructure:"duplicate_policy"`
+
+	// ClockSkewWarning logs a warning when an agent's clock differs from the
+	// backend's by more than this many seconds (0 disables)
+	ClockSkewWarning int `mapstructure:"clock_skew_warning"`
+	// CorrectClockSkew shifts stored metric timestamps by the measured skew
+	CorrectClockSkew bool `mapstructure:"correct_clock_skew"`
+
+	// MinVersion logs a warning for agents older than this release;
+	// RequiredVersion rejects them. Empty disables either check.
+	MinVersion      string `mapstructure:"min_version"`
+	RequiredVersion string `mapstructure:"required_version"`
+
+	// VerifyRateLimit caps token verification requests per client IP per
+	// minute (0 disables the limit)
+	VerifyRateLimit int `mapstructure:"verify_rate_limit"`
+}
+
+type NotificationsConfig struct {
+	// RoutingMode is "first_match" (only the first matching alert route is
+	// used) or "all_match" (channels of every matching route are combined)
+	RoutingMode string `mapstructure:"routing_mode"`
+	// MaxConcurrent bounds notifications being sent at once across all
+	// channels; further notifications wait for a free slot
+	MaxConcurrent int `mapstructure:"max_concurrent"`
+	// StatusDebounce is how many seconds a new server status must hold
+	// before a status_change alert is raised, so flapping doesn't notify
+	StatusDebounce int `mapstructure:"status_debounce"`
+	// OfflineGrace is how many seconds a server may go without reporting
+	// before an offline alert is raised (0 disables offline alerts)
+	OfflineGrace int `mapstructure:"offline_grace"`
+	// AlertCooldown is how many seconds a repeat of an open alert, with the
+	// same type, level and labels, updates it instead of raising a new one
+	// (0 disables deduplication)
+	AlertCooldown int `mapstructure:"alert_cooldown"`
+}
+
+type DashboardConfig struct {
+	// CacheTTL is how long a user's dashboard response is reused, in seconds (0 disables)
+	CacheTTL int `mapstructure:"cache_ttl"`
+	// CacheMaxEntries bounds the number of cached user dashboards
+	CacheMaxEntries int `mapstructure:"cache_max_entries"`
+}
+
+// AlertRetentionConfig controls pruning of old alerts, independently of metrics
+type AlertRetentionConfig struct {
+	ResolvedDays  int `mapstructure:"resolved_days"`  // delete resolved alerts older than this, 0 keeps them
+	OpenDays      int `mapstructure:"open_days"`      // delete unresolved alerts older than this, 0 keeps them
+	PruneInterval int `mapstructure:"prune_interval"` // hours between pruning runs
+}
+
+// Actions taken on servers whose agent never connected
+const (
+	StaleServerActionNone   = "none"
+	StaleServerActionFlag   = "flag"
+	StaleServerActionDelete = "delete"
+)
+
+// StaleServersConfig cleans up servers that were created but whose agent
+// never connected
+type StaleServersConfig struct {
+	// Action is "none" (the default), "flag" to mark them stale or "delete"
+	Action        string `mapstructure:"action"`
+	Days          int    `mapstructure:"days"`           // days after creation before acting
+	WarnDays      int    `mapstructure:"warn_days"`      // days before acting to start logging what would happen
+	CheckInterval int    `mapstructure:"check_interval"` // hours between checks
+}
+
+// QuotasConfig defines per-plan resource limits. Users are on DefaultPlan
+// unless their account names another plan.
+type QuotasConfig struct {
+	DefaultPlan string               `mapstructure:"default_plan"`
+	Plans       map[string]PlanQuota `mapstructure:"plans"`
+}
+
+// PlanQuota limits what an account may use; 0 means unlimited
+type PlanQuota struct {
+	MaxServers          int `mapstructure:"max_servers"`
+	MaxMetricsPerMinute int `mapstructure:"max_metrics_per_minute"` // across all of the user's servers
+}
+
+// BadgesConfig controls the public uptime badges
+type BadgesConfig struct {
+	// MaxGap is the longest gap between metric samples, in seconds, that still
+	// counts as up; longer gaps count as downtime
+	MaxGap int `mapstructure:"max_gap"`
+	// CacheTTL is how long a computed badge is reused, in seconds
+	CacheTTL int `mapstructure:"cache_ttl"`
+}
+
+// CustomMetricsConfig limits the cardinality of custom metrics
+type CustomMetricsConfig struct {
+	MaxDimensions int `mapstructure:"max_dimensions"` // dimensions per value
+	MaxSeries     int `mapstructure:"max_series"`     // distinct dimension sets per metric name and server
+}
+
+// LogsConfig bounds the agent log lines kept in memory per server
+type LogsConfig struct {
+	BufferLines  int `mapstructure:"buffer_lines"`   // most recent lines kept per server
+	MaxLineBytes int `mapstructure:"max_line_bytes"` // longer lines are truncated
+}
+
+// Alert routing modes
+const (
+	RoutingFirstMatch = "first_match"
+	RoutingAllMatch   = "all_match"
+)
+
+// ForwarderConfig configures forwarding of ingested metrics to an external TSDB
+type ForwarderConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	Format        string `mapstructure:"format"` // influxdb (line protocol) or prometheus (remote write)
+	URL           string `mapstructure:"url"`    // e.g. http://influx:8086/api/v2/write?org=o&bucket=b&precision=ns
+	Token         string `mapstructure:"token"`
+	TokenFile     string `mapstructure:"token_file"` // read the token from a file instead
+	BatchSize     int    `mapstructure:"batch_size"`
+	FlushInterval int    `mapstructure:"flush_interval"` // seconds
+	MaxRetries    int    `mapstructure:"max_retries"`
+	QueueSize     int    `mapstructure:"queue_size"`
 }
 
+// Metric forwarding formats
+const (
+	ForwardInfluxDB   = "influxdb"
+	ForwardPrometheus = "prometheus"
+)
+
+// Duplicate agent connection policies
+const (
+	DuplicatePolicyReplace = "replace"
+	DuplicatePolicyReject  = "reject"
+)
+
+// defaultTimeoutExemptPaths are the agent connections and the streamed report
+// download, which outlive the request timeout
+var defaultTimeoutExemptPaths = []string{"/agent/", "/api/v1/servers/*/report"}
+
 func LoadConfig() (*Config, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
@@ -51,17 +322,70 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("server.port", "8080")
 	viper.SetDefault("server.host", "localhost")
 	viper.SetDefault("server.allow_origins", "*")
+	viper.SetDefault("server.max_body_bytes", 1<<20)
+	viper.SetDefault("server.request_timeout", 30)
+	viper.SetDefault("server.timeout_exempt_paths", defaultTimeoutExemptPaths)
+	viper.SetDefault("server.tls_cert_file", "")
+	viper.SetDefault("server.tls_key_file", "")
+	viper.SetDefault("tls.min_version", "1.2")
+	viper.SetDefault("quic.enabled", false)
+	viper.SetDefault("quic.port", "8443")
 	viper.SetDefault("database.host", "localhost")
 	viper.SetDefault("database.port", "5432")
 	viper.SetDefault("database.user", "postgres")
 	viper.SetDefault("database.dbname", "monitaur")
 	viper.SetDefault("database.sslmode", "disable")
+	viper.SetDefault("database.retention_days", 30)
+	viper.SetDefault("database.prune_interval", 1)
+	viper.SetDefault("firebase.require_verified_email", false)
 	viper.SetDefault("smtp.host", "email-smtp.ap-south-1.amazonaws.com")
 	viper.SetDefault("smtp.port", "587")
 	viper.SetDefault("smtp.from", "rowan@ideamagix.in")
+	viper.SetDefault("smtp.product_name", "Monitaur")
+	viper.SetDefault("agents.duplicate_policy", DuplicatePolicyReplace)
+	viper.SetDefault("agents.clock_skew_warning", 30)
+	viper.SetDefault("agents.correct_clock_skew", false)
+	viper.SetDefault("agents.min_version", "")
+	viper.SetDefault("agents.required_version", "")
+	viper.SetDefault("agents.verify_rate_limit", 10)
+	viper.SetDefault("slack.webhook_url", "")
+	viper.SetDefault("slack.channel", "")
+	viper.SetDefault("webhook.url", "")
+	viper.SetDefault("webhook.max_retries", 3)
+	viper.SetDefault("notifications.routing_mode", RoutingFirstMatch)
+	viper.SetDefault("notifications.max_concurrent", 10)
+	viper.SetDefault("notifications.status_debounce", 60)
+	viper.SetDefault("notifications.offline_grace", 300)
+	viper.SetDefault("notifications.alert_cooldown", 600)
+	viper.SetDefault("dashboard.cache_ttl", 10)
+	viper.SetDefault("dashboard.cache_max_entries", 1000)
+	viper.SetDefault("alert_retention.resolved_days", 90)
+	viper.SetDefault("alert_retention.open_days", 0)
+	viper.SetDefault("alert_retention.prune_interval", 24)
+	viper.SetDefault("stale_servers.action", StaleServerActionNone)
+	viper.SetDefault("stale_servers.days", 30)
+	viper.SetDefault("stale_servers.warn_days", 7)
+	viper.SetDefault("stale_servers.check_interval", 24)
+	viper.SetDefault("quotas.default_plan", "free")
+	viper.SetDefault("badges.max_gap", 60)
+	viper.SetDefault("badges.cache_ttl", 300)
+	viper.SetDefault("custom_metrics.max_dimensions", 5)
+	viper.SetDefault("custom_metrics.max_series", 50)
+	viper.SetDefault("logs.buffer_lines", 1000)
+	viper.SetDefault("logs.max_line_bytes", 2048)
+	viper.SetDefault("forwarder.enabled", false)
+	viper.SetDefault("forwarder.format", ForwardInfluxDB)
+	viper.SetDefault("forwarder.batch_size", 500)
+	viper.SetDefault("forwarder.flush_interval", 10)
+	viper.SetDefault("forwarder.max_retries", 3)
+	viper.SetDefault("forwarder.queue_size", 10000)
 
-	// Allow environment variables
+	// Allow environment variables, e.g. DATABASE_PASSWORD for database.password
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
+	for _, key := range secretKeys {
+		viper.SetDefault(key, "")
+	}
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
@@ -76,14 +400,191 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	if err := config.readSecretFiles(); err != nil {
+		return nil, err
+	}
+
+	if err := config.TLS.parse(); err != nil {
+		return nil, err
+	}
+	if (config.Server.TLSCertFile == "") != (config.Server.TLSKeyFile == "") {
+		return nil, fmt.Errorf("server.tls_cert_file and server.tls_key_file must be set together")
+	}
+	if (config.QUIC.CertFile == "") != (config.QUIC.KeyFile == "") {
+		return nil, fmt.Errorf("quic.cert_file and quic.key_file must be set together")
+	}
+	if certFile, _ := config.QUIC.Certificate(config.Server); config.QUIC.Enabled && certFile == "" {
+		return nil, fmt.Errorf("quic.enabled requires quic.cert_file and key_file, or server.tls_cert_file and tls_key_file")
+	}
+
+	switch config.Agents.DuplicatePolicy {
+	case DuplicatePolicyReplace, DuplicatePolicyReject:
+	default:
+		return nil, fmt.Errorf("invalid agents.duplicate_policy %q (expected %q or %q)",
+			config.Agents.DuplicatePolicy, DuplicatePolicyReplace, DuplicatePolicyReject)
+	}
+
+	if config.Agents.VerifyRateLimit < 0 {
+		return nil, fmt.Errorf("agents.verify_rate_limit must not be negative")
+	}
+
+	for key, version := range map[string]string{
+		"agents.min_version":      config.Agents.MinVersion,
+		"agents.required_version": config.Agents.RequiredVersion,
+	} {
+		if version == "" {
+			continue
+		}
+		if _, err := agentversion.Parse(version); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+	}
+
+	switch config.Notifications.RoutingMode {
+	case RoutingFirstMatch, RoutingAllMatch:
+	default:
+		return nil, fmt.Errorf("invalid notifications.routing_mode %q (expected %q or %q)",
+			config.Notifications.RoutingMode, RoutingFirstMatch, RoutingAllMatch)
+	}
+
+	if config.Notifications.MaxConcurrent < 1 {
+		return nil, fmt.Errorf("notifications.max_concurrent must be positive")
+	}
+	if config.Notifications.StatusDebounce < 0 || config.Notifications.OfflineGrace < 0 || config.Notifications.AlertCooldown < 0 {
+		return nil, fmt.Errorf("notifications.status_debounce, offline_grace and alert_cooldown must not be negative")
+	}
+
+	if config.Database.RetentionDays < 0 {
+		return nil, fmt.Errorf("database.retention_days must not be negative")
+	}
+	if config.Database.PruneInterval < 1 {
+		return nil, fmt.Errorf("database.prune_interval must be positive")
+	}
+
+	if config.AlertRetention.ResolvedDays < 0 || config.AlertRetention.OpenDays < 0 {
+		return nil, fmt.Errorf("alert_retention days must not be negative")
+	}
+	if config.AlertRetention.PruneInterval < 1 {
+		return nil, fmt.Errorf("alert_retention.prune_interval must be positive")
+	}
+
+	switch config.StaleServers.Action {
+	case StaleServerActionNone, StaleServerActionFlag, StaleServerActionDelete:
+	default:
+		return nil, fmt.Errorf("invalid stale_servers.action %q (expected %q, %q or %q)",
+			config.StaleServers.Action, StaleServerActionNone, StaleServerActionFlag, StaleServerActionDelete)
+	}
+	if config.StaleServers.Days < 1 || config.StaleServers.WarnDays < 0 || config.StaleServers.CheckInterval < 1 {
+		return nil, fmt.Errorf("stale_servers.days and check_interval must be positive and warn_days must not be negative")
+	}
+
+	if config.Logs.BufferLines < 1 || config.Logs.MaxLineBytes < 1 {
+		return nil, fmt.Errorf("logs.buffer_lines and logs.max_line_bytes must be positive")
+	}
+
+	if config.CustomMetrics.MaxDimensions < 0 || config.CustomMetrics.MaxSeries < 1 {
+		return nil, fmt.Errorf("custom_metrics.max_dimensions must not be negative and max_series must be positive")
+	}
+
+	if config.Badges.MaxGap < 1 {
+		return nil, fmt.Errorf("badges.max_gap must be positive")
+	}
+
+	if _, ok := config.Quotas.Plans[config.Quotas.DefaultPlan]; !ok && len(config.Quotas.Plans) > 0 {
+		return nil, fmt.Errorf("quotas.default_plan %q is not defined in quotas.plans; set it to one of the plans", config.Quotas.DefaultPlan)
+	}
+
+	if config.Forwarder.Enabled {
+		switch config.Forwarder.Format {
+		case ForwardInfluxDB, ForwardPrometheus:
+		default:
+			return nil, fmt.Errorf("unsupported forwarder.format %q (supported: %s, %s)",
+				config.Forwarder.Format, ForwardInfluxDB, ForwardPrometheus)
+		}
+		if config.Forwarder.URL == "" {
+			return nil, fmt.Errorf("forwarder.url is required when forwarding is enabled")
+		}
+		if config.Forwarder.BatchSize < 1 || config.Forwarder.FlushInterval < 1 || config.Forwarder.QueueSize < 1 {
+			return nil, fmt.Errorf("forwarder batch_size, flush_interval and queue_size must be positive")
+		}
+		if config.Forwarder.MaxRetries < 0 {
+			return nil, fmt.Errorf("forwarder.max_retries must not be negative")
+		}
+	}
+
+	if url := config.Slack.WebhookURL; url != "" && !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return nil, fmt.Errorf("slack.webhook_url must be an http(s) URL")
+	}
+
+	if url := config.Webhook.URL; url != "" && !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return nil, fmt.Errorf("webhook.url must be an http(s) URL")
+	}
+	if config.Webhook.MaxRetries < 0 {
+		return nil, fmt.Errorf("webhook.max_retries can't be negative")
+	}
+
 	return &config, nil
 }
 
+// secretKeys are registered with viper so they can be set from the
+// environment even when they are missing from config.yaml
+var secretKeys = []string{
+	"database.password", "database.password_file",
+	"smtp.password", "smtp.password_file",
+	"forwarder.token", "forwarder.token_file",
+	"slack.webhook_url",
+	"webhook.secret", "webhook.secret_file",
+	"firebase.service_account_path",
+}
+
+// readSecretFiles replaces secrets with the contents of their *_file
+// settings. A file setting takes precedence over an inline value.
+func (c *Config) readSecretFiles() error {
+	type secretFile struct {
+		key   string
+		path  string
+		value *string
+	}
+	secrets := []secretFile{
+		{"database.password_file", c.Database.PasswordFile, &c.Database.Password},
+		{"smtp.password_file", c.SMTP.PasswordFile, &c.SMTP.Password},
+		{"forwarder.token_file", c.Forwarder.TokenFile, &c.Forwarder.Token},
+		{"webhook.secret_file", c.Webhook.SecretFile, &c.Webhook.Secret},
+	}
+	for i := range c.SMTP.Fallbacks {
+		fallback := &c.SMTP.Fallbacks[i]
+		secrets = append(secrets, secretFile{
+			fmt.Sprintf("smtp.fallbacks[%d].password_file", i), fallback.PasswordFile, &fallback.Password})
+	}
+
+	for _, secret := range secrets {
+		if secret.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(secret.path)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", secret.key, err)
+		}
+		// Files written by editors and secret managers usually end in a newline
+		*secret.value = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if path := c.Firebase.ServiceAccountPath; path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("reading firebase.service_account_path: %w", err)
+		}
+	}
+	return nil
+}
+
 // CreateSampleConfig creates a sample configuration file
 func CreateSampleConfig() error {
 	viper.Set("server.port", "8080")
 	viper.Set("server.host", "localhost")
 	viper.Set("server.allow_origins", "*")
+	viper.Set("server.max_body_bytes", 1<<20)
+	viper.Set("server.request_timeout", 30)
+	viper.Set("server.timeout_exempt_paths", defaultTimeoutExemptPaths)
 
 	viper.Set("database.host", "localhost")
 	viper.Set("database.port", "5432")
@@ -91,6 +592,8 @@ func CreateSampleConfig() error {
 	viper.Set("database.password", "your_password_here")
 	viper.Set("database.dbname", "monitaur")
 	viper.Set("database.sslmode", "disable")
+	viper.Set("database.retention_days", 30)
+	viper.Set("database.prune_interval", 1)
 
 	viper.Set("firebase.service_account_path", "./firebase-service-account.json")
 	viper.Set("firebase.project_id", "your-firebase-project-id")
@@ -100,6 +603,64 @@ func CreateSampleConfig() error {
 	viper.Set("smtp.username", "your_smtp_username_here")
 	viper.Set("smtp.password", "your_smtp_password_here")
 	viper.Set("smtp.from", "your_smtp_from_here")
+	viper.Set("smtp.from_name", "Monitaur")
+	viper.Set("smtp.product_name", "Monitaur")
+	viper.Set("smtp.logo_url", "")
+	viper.Set("smtp.allowed_from_domains", []string{})
+	viper.Set("smtp.fallbacks", []map[string]string{})
+	viper.Set("slack.webhook_url", "")
+	viper.Set("slack.channel", "")
+	viper.Set("webhook.url", "")
+	viper.Set("webhook.secret", "")
+	viper.Set("webhook.max_retries", 3)
+
+	viper.Set("agents.duplicate_policy", DuplicatePolicyReplace)
+	viper.Set("agents.clock_skew_warning", 30)
+	viper.Set("agents.correct_clock_skew", false)
+	viper.Set("agents.min_version", "")
+	viper.Set("agents.required_version", "")
+	viper.Set("agents.verify_rate_limit", 10)
+
+	viper.Set("notifications.routing_mode", RoutingFirstMatch)
+	viper.Set("notifications.max_concurrent", 10)
+	viper.Set("notifications.status_debounce", 60)
+	viper.Set("notifications.offline_grace", 300)
+	viper.Set("notifications.alert_cooldown", 600)
+	viper.Set("tls.min_version", "1.2")
+	viper.Set("quic.enabled", false)
+	viper.Set("quic.port", "8443")
+
+	viper.Set("dashboard.cache_ttl", 10)
+	viper.Set("dashboard.cache_max_entries", 1000)
+
+	viper.Set("alert_retention.resolved_days", 90)
+	viper.Set("alert_retention.open_days", 0)
+	viper.Set("alert_retention.prune_interval", 24)
+
+	viper.Set("stale_servers.action", StaleServerActionNone)
+	viper.Set("stale_servers.days", 30)
+	viper.Set("stale_servers.warn_days", 7)
+	viper.Set("stale_servers.check_interval", 24)
+
+	viper.Set("quotas.default_plan", "free")
+	viper.Set("quotas.plans.free.max_servers", 3)
+	viper.Set("quotas.plans.free.max_metrics_per_minute", 60)
+	viper.Set("quotas.plans.pro.max_servers", 50)
+	viper.Set("quotas.plans.pro.max_metrics_per_minute", 1000)
+
+	viper.Set("badges.max_gap", 60)
+	viper.Set("badges.cache_ttl", 300)
+
+	viper.Set("custom_metrics.max_dimensions", 5)
+	viper.Set("custom_metrics.max_series", 50)
+
+	viper.Set("logs.buffer_lines", 1000)
+	viper.Set("logs.max_line_bytes", 2048)
+
+	viper.Set("forwarder.enabled", false)
+	viper.Set("forwarder.format", ForwardInfluxDB)
+	viper.Set("forwarder.url", "http://localhost:8086/api/v2/write?org=your_org&bucket=monitaur&precision=ns")
+	viper.Set("forwarder.token", "your_influxdb_token_here")
 
 	return viper.WriteConfigAs("config.yaml")
 }
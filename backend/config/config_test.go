@@ -0,0 +1,39 @@
+package config
+
+import "testing"
+
+func TestSMTPProvidersSkipsUnconfigured(t *testing.T) {
+	fallback := SMTPProvider{Host: "smtp-2", Port: "587", Username: "alerts", Password: "secret"}
+
+	tests := []struct {
+		name  string
+		smtp  SMTPConfig
+		hosts []string
+	}{
+		{"none", SMTPConfig{}, nil},
+		{"primary only", SMTPConfig{Host: "smtp-1", Username: "alerts", Password: "secret"}, []string{"smtp-1"}},
+		{"primary without login", SMTPConfig{Host: "smtp-1", Fallbacks: []SMTPProvider{fallback}}, []string{"smtp-2"}},
+		{"both", SMTPConfig{Host: "smtp-1", Username: "alerts", Password: "secret", Fallbacks: []SMTPProvider{fallback}}, []string{"smtp-1", "smtp-2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			providers := tt.smtp.Providers()
+			if len(providers) != len(tt.hosts) {
+				t.Fatalf("got %d providers, want %v", len(providers), tt.hosts)
+			}
+			for i, provider := range providers {
+				if provider.Host != tt.hosts[i] {
+					t.Errorf("provider %d is %s, want %s", i, provider.Host, tt.hosts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSMTPProvidersKeepsPrimaryPasswordFile(t *testing.T) {
+	smtp := SMTPConfig{Host: "smtp-1", Username: "alerts", Password: "secret", PasswordFile: "/run/secrets/smtp"}
+	if got := smtp.Providers()[0].PasswordFile; got != smtp.PasswordFile {
+		t.Errorf("primary PasswordFile = %q, want %q", got, smtp.PasswordFile)
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// TLSConfig sets the TLS versions and cipher suites used by the backend's
+// HTTPS listener and its SMTP connections
+type TLSConfig struct {
+	// MinVersion is the oldest accepted version: "1.0", "1.1", "1.2" or "1.3"
+	MinVersion string `mapstructure:"min_version"`
+	// CipherSuites restricts the TLS 1.0-1.2 cipher suites, by Go name (e.g.
+	// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256). Empty uses Go's defaults; TLS
+	// 1.3 suites are not configurable.
+	CipherSuites []string `mapstructure:"cipher_suites"`
+
+	minVersion   uint16
+	cipherSuites []uint16
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parse validates the configured version and cipher suites. Only suites Go
+// considers secure are accepted.
+func (c *TLSConfig) parse() error {
+	version, ok := tlsVersions[c.MinVersion]
+	if !ok {
+		return fmt.Errorf("invalid tls.min_version %q (expected 1.0, 1.1, 1.2 or 1.3)", c.MinVersion)
+	}
+	c.minVersion = version
+
+	secure := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		secure[suite.Name] = suite.ID
+	}
+	c.cipherSuites = nil
+	for _, name := range c.CipherSuites {
+		id, ok := secure[name]
+		if !ok {
+			return fmt.Errorf("unsupported or insecure tls.cipher_suites entry %q", name)
+		}
+		c.cipherSuites = append(c.cipherSuites, id)
+	}
+	return nil
+}
+
+// ServerConfig returns the TLS settings for the HTTPS listener
+func (c TLSConfig) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:   c.minVersion,
+		CipherSuites: c.cipherSuites,
+	}
+}
+
+// ClientConfig returns the TLS settings for connecting to serverName
+func (c TLSConfig) ClientConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		ServerName:   serverName,
+		MinVersion:   c.minVersion,
+		CipherSuites: c.cipherSuites,
+	}
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// migrationModels lists the models in migration order, referenced tables first
+var migrationModels = []interface{}{
+	&models.User{},
+	&models.Server{},
+	&models.Metric{},
+	&models.Alert{},
+	&models.ServerTrend{},
+	&models.AlertRoute{},
+	&models.AlertRecipient{},
+	&models.AgentEvent{},
+	&models.AlertPruneCount{},
+	&models.CustomMetric{},
+}
+
+// Outcomes of migrating a table
+const (
+	MigrationApplied = "applied"
+	MigrationFailed  = "failed"
+	MigrationSkipped = "skipped"
+)
+
+// MigrationResult is the outcome of migrating one table. Statements lists
+// the schema changes run for it, or that would run in a dry run; none means
+// the table was already up to date.
+type MigrationResult struct {
+	Table      string
+	Status     string
+	Statements []string
+	Err        error
+}
+
+// errDryRun rolls back the dry run transaction
+var errDryRun = errors.New("dry run")
+
+// Migrate migrates each model in order and reports what happened to every
+// table. It stops at the first failure, skipping the remaining tables, since
+// they may reference the one that failed. With dryRun the migration runs in a
+// transaction that is rolled back, so the statements are reported but nothing
+// is changed.
+func (d *Database) Migrate(dryRun bool) ([]MigrationResult, error) {
+	if !dryRun {
+		return d.migrateModels(d.DB)
+	}
+
+	var results []MigrationResult
+	var migrateErr error
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		results, migrateErr = d.migrateModels(tx)
+		return errDryRun
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return results, fmt.Errorf("failed to roll back dry run: %w", err)
+	}
+	return results, migrateErr
+}
+
+func (d *Database) migrateModels(db *gorm.DB) ([]MigrationResult, error) {
+	results := make([]MigrationResult, len(migrationModels))
+	var failed error
+
+	for i, model := range migrationModels {
+		results[i].Table = tableName(db, model)
+		if failed != nil {
+			results[i].Status = MigrationSkipped
+			continue
+		}
+
+		recorder := &ddlRecorder{Interface: db.Logger}
+		session := db.Session(&gorm.Session{Logger: recorder})
+
+		err := migrateModel(session, model)
+		results[i].Statements = recorder.statements
+		if err != nil {
+			results[i].Status = MigrationFailed
+			results[i].Err = err
+			failed = fmt.Errorf("failed to migrate %s: %w", results[i].Table, err)
+			continue
+		}
+		results[i].Status = MigrationApplied
+	}
+
+	return results, failed
+}
+
+func migrateModel(db *gorm.DB, model interface{}) error {
+	if _, ok := model.(*models.Metric); ok {
+		if err := dedupeMetrics(db); err != nil {
+			return fmt.Errorf("failed to deduplicate metrics: %w", err)
+		}
+	}
+	if err := db.AutoMigrate(model); err != nil {
+		return err
+	}
+	if _, ok := model.(*models.AlertRecipient); ok {
+		if err := moveNotificationEmails(db); err != nil {
+			return fmt.Errorf("failed to move notification emails: %w", err)
+		}
+	}
+	return nil
+}
+
+// moveNotificationEmails turns the per-server notification_emails of older
+// schemas into alert recipients, which replaced them, and drops the column
+func moveNotificationEmails(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Server{}, "notification_emails") {
+		return nil
+	}
+
+	err := db.Exec(`
+		INSERT INTO alert_recipients (server_id, email, created_at)
+		SELECT servers.id, emails.email, NOW()
+		FROM servers, jsonb_array_elements_text(servers.notification_emails) AS emails(email)
+		WHERE jsonb_typeof(servers.notification_emails) = 'array'
+		ON CONFLICT DO NOTHING`).Error
+	if err != nil {
+		return err
+	}
+	return db.Migrator().DropColumn(&models.Server{}, "notification_emails")
+}
+
+func tableName(db *gorm.DB, model interface{}) string {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return fmt.Sprintf("%T", model)
+	}
+	return stmt.Schema.Table
+}
+
+// LogMigrationResults logs the outcome of every table, with the statements
+// run for it
+func LogMigrationResults(results []MigrationResult, dryRun bool) {
+	for _, result := range results {
+		switch {
+		case result.Status == MigrationFailed:
+			log.Printf("FAILED   %s: %v", result.Table, result.Err)
+		case result.Status == MigrationSkipped:
+			log.Printf("skipped  %s", result.Table)
+		case len(result.Statements) == 0:
+			log.Printf("ok       %s (up to date)", result.Table)
+		case dryRun:
+			log.Printf("pending  %s", result.Table)
+		default:
+			log.Printf("migrated %s", result.Table)
+		}
+		for _, statement := range result.Statements {
+			log.Printf("           %s;", statement)
+		}
+	}
+}
+
+// ddlRecorder passes log output through while recording the schema changing
+// statements run in its session
+type ddlRecorder struct {
+	logger.Interface
+
+	mu         sync.Mutex
+	statements []string
+}
+
+func (r *ddlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	r.Interface.Trace(ctx, begin, fc, err)
+
+	sql, _ := fc()
+	sql = strings.TrimSpace(sql)
+	keyword, _, _ := strings.Cut(sql, " ")
+	switch strings.ToUpper(keyword) {
+	case "CREATE", "ALTER", "DROP", "DELETE", "COMMENT":
+		r.mu.Lock()
+		r.statements = append(r.statements, sql)
+		r.mu.Unlock()
+	}
+}
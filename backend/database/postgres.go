@@ -3,6 +3,8 @@ package database
 import (
 	"fmt"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"backend/config"
@@ -10,11 +12,18 @@ import (
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
 type Database struct {
 	DB *gorm.DB
+
+	// droppedMetrics counts metric rows discarded after a failed batch insert
+	droppedMetrics atomic.Uint64
+
+	timescaleOnce sync.Once
+	timescale     bool
 }
 
 func NewDatabase(cfg *config.DatabaseConfig) (*Database, error) {
@@ -54,19 +63,21 @@ func NewDatabase(cfg *config.DatabaseConfig) (*Database, error) {
 	return &Database{DB: db}, nil
 }
 
-// AutoMigrate runs database migrations
+// NewDatabaseFromGorm wraps an already opened GORM connection, e.g. one
+// pointing at a disposable database in integration tests
+func NewDatabaseFromGorm(db *gorm.DB) *Database {
+	return &Database{DB: db}
+}
+
+// AutoMigrate runs database migrations, table by table, logging the outcome
+// of each
 func (d *Database) AutoMigrate() error {
 	log.Println("Running database migrations...")
 
-	// Migrate tables in order to handle foreign key dependencies
-	err := d.DB.AutoMigrate(
-		&models.User{},
-		&models.Server{},
-		&models.Metric{},
-		&models.Alert{},
-	)
+	results, err := d.Migrate(false)
+	LogMigrationResults(results, false)
 	if err != nil {
-		return fmt.Errorf("failed to run migrations: %w", err)
+		return err
 	}
 
 	// Create TimescaleDB hypertable for metrics (if TimescaleDB is available)
@@ -79,11 +90,33 @@ func (d *Database) AutoMigrate() error {
 	return nil
 }
 
+// dedupeMetrics prepares a metrics table created before samples were unique
+// per (server_id, time): it deletes duplicate rows, keeping the first stored,
+// and drops the old non-unique index so AutoMigrate can create the unique one
+func dedupeMetrics(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&models.Metric{}) || !migrator.HasIndex(&models.Metric{}, "idx_metrics_server_time") {
+		return nil
+	}
+
+	result := db.Exec(`
+		DELETE FROM metrics m
+		USING metrics keep
+		WHERE m.server_id = keep.server_id AND m.time = keep.time AND m.id > keep.id`)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Deleted %d duplicate metric rows", result.RowsAffected)
+	}
+
+	return migrator.DropIndex(&models.Metric{}, "idx_metrics_server_time")
+}
+
 // createHypertable creates a TimescaleDB hypertable for metrics
 func (d *Database) createHypertable() error {
 	// Check if TimescaleDB extension is available
-	var extensionExists bool
-	err := d.DB.Raw("SELECT EXISTS(SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')").Scan(&extensionExists).Error
+	extensionExists, err := d.hasTimescale()
 	if err != nil {
 		return err
 	}
@@ -93,8 +126,7 @@ func (d *Database) createHypertable() error {
 	}
 
 	// Check if hypertable already exists
-	var hypertableExists bool
-	err = d.DB.Raw("SELECT EXISTS(SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = 'metrics')").Scan(&hypertableExists).Error
+	hypertableExists, err := d.metricsIsHypertable()
 	if err != nil {
 		return err
 	}
@@ -111,6 +143,21 @@ func (d *Database) createHypertable() error {
 	return nil
 }
 
+// hasTimescale reports whether the TimescaleDB extension is installed
+func (d *Database) hasTimescale() (bool, error) {
+	var exists bool
+	err := d.DB.Raw("SELECT EXISTS(SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')").Scan(&exists).Error
+	return exists, err
+}
+
+// metricsIsHypertable reports whether the metrics table is a TimescaleDB
+// hypertable. The extension must be installed.
+func (d *Database) metricsIsHypertable() (bool, error) {
+	var exists bool
+	err := d.DB.Raw("SELECT EXISTS(SELECT 1 FROM timescaledb_information.hypertables WHERE hypertable_name = 'metrics')").Scan(&exists).Error
+	return exists, err
+}
+
 // User operations
 func (d *Database) CreateUser(user *models.User) error {
 	return d.DB.Create(user).Error
@@ -186,21 +233,406 @@ func (d *Database) GetUserServers(userUID string) ([]models.Server, error) {
 	return servers, err
 }
 
+// SetReadAPIKey replaces the user's remote read API key; nil disables it
+func (d *Database) SetReadAPIKey(userID uint, key *string) error {
+	return d.DB.Model(&models.User{}).Where("id = ?", userID).Update("read_api_key", key).Error
+}
+
+// GetUserByReadAPIKey returns the user owning a remote read API key
+func (d *Database) GetUserByReadAPIKey(key string) (*models.User, error) {
+	var user models.User
+	err := d.DB.Where("read_api_key = ?", key).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetServersByUserID returns all servers of a user, by internal user ID
+func (d *Database) GetServersByUserID(userID uint) ([]models.Server, error) {
+	var servers []models.Server
+	err := d.DB.Where("user_id = ?", userID).Order("id").Find(&servers).Error
+	return servers, err
+}
+
+// CountUserServers returns how many servers a user owns
+func (d *Database) CountUserServers(userID uint) (int64, error) {
+	var count int64
+	err := d.DB.Model(&models.Server{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// DeleteServer deletes a server along with all of its data
+func (d *Database) DeleteServer(server *models.Server) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		for _, related := range []interface{}{
+			&models.Metric{},
+			&models.Alert{},
+			&models.CustomMetric{},
+			&models.AgentEvent{},
+			&models.AlertPruneCount{},
+			&models.ServerTrend{},
+			&models.AlertRecipient{},
+		} {
+			if err := tx.Where("server_id = ?", server.ID).Delete(related).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(server).Error
+	})
+}
+
+// GetNeverSeenServers returns servers created before a time whose agent has
+// never connected
+func (d *Database) GetNeverSeenServers(createdBefore time.Time) ([]models.Server, error) {
+	var servers []models.Server
+	err := d.DB.Where("last_seen IS NULL AND created_at < ?", createdBefore).
+		Order("created_at").
+		Find(&servers).Error
+	return servers, err
+}
+
+// FlagServerStale marks a never-connected server as stale unless it already is
+func (d *Database) FlagServerStale(serverID uint, at time.Time) error {
+	return d.DB.Model(&models.Server{}).
+		Where("id = ? AND stale_since IS NULL", serverID).
+		Update("stale_since", at).Error
+}
+
+func (d *Database) UpdateServer(serverID uint, updates map[string]interface{}) error {
+	return d.DB.Model(&models.Server{}).Where("id = ?", serverID).Updates(updates).Error
+}
+
+func (d *Database) SetIngestionPaused(serverID uint, paused bool) error {
+	return d.DB.Model(&models.Server{}).Where("id = ?", serverID).Update("paused_ingestion", paused).Error
+}
+
+func (d *Database) SetLogsEnabled(serverID uint, enabled bool) error {
+	return d.DB.Model(&models.Server{}).Where("id = ?", serverID).Update("logs_enabled", enabled).Error
+}
+
+// SetAlertThresholds stores a server's alert thresholds and returns the new
+// thresholds version
+func (d *Database) SetAlertThresholds(serverID uint, thresholds models.AlertThresholds) (int, error) {
+	var server models.Server
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Server{}).Where("id = ?", serverID).Updates(map[string]interface{}{
+			"threshold_cpu":             thresholds.CPU,
+			"threshold_load_per_core":   thresholds.LoadPerCore,
+			"threshold_memory":          thresholds.Memory,
+			"threshold_swap":            thresholds.Swap,
+			"threshold_disk":            thresholds.Disk,
+			"threshold_disk_latency":    thresholds.DiskLatency,
+			"threshold_clock_drift":     thresholds.ClockDrift,
+			"threshold_memory_pressure": thresholds.MemoryPressure,
+			"thresholds_version":        gorm.Expr("thresholds_version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Select("thresholds_version").First(&server, serverID).Error
+	})
+	return server.ThresholdsVersion, err
+}
+
+// AckAlertThresholds records the thresholds version an agent applied. An
+// out of order ack for an older version is ignored.
+func (d *Database) AckAlertThresholds(serverID uint, version int) error {
+	return d.DB.Model(&models.Server{}).
+		Where("id = ? AND thresholds_acked_version < ?", serverID, version).
+		Update("thresholds_acked_version", version).Error
+}
+
+// SetMaintenanceMode turns maintenance mode on or off. Turning it off restores
+// the status from whether the agent is connected.
+func (d *Database) SetMaintenanceMode(serverID uint, enabled, connected bool) error {
+	status := "maintenance"
+	if !enabled {
+		status = "offline"
+		if connected {
+			status = "online"
+		}
+	}
+	return d.DB.Model(&models.Server{}).Where("id = ?", serverID).Updates(map[string]interface{}{
+		"maintenance_mode": enabled,
+		"status":           status,
+	}).Error
+}
+
+// UpdateServerLastSeen marks a server online as its agent connects, clearing
+// any stale flag. A server in maintenance keeps its status.
 func (d *Database) UpdateServerLastSeen(serverID uint) error {
+	now := time.Now()
+	return d.DB.Model(&models.Server{}).Where("id = ?", serverID).Updates(map[string]interface{}{
+		"last_seen":   &now,
+		"status":      gorm.Expr("CASE WHEN maintenance_mode THEN status ELSE 'online' END"),
+		"stale_since": nil,
+	}).Error
+}
+
+// TouchServerLastSeen records agent activity without overriding the status
+// derived from metrics: only an offline server is brought back online, so a
+// warning set by the latest metrics is kept
+func (d *Database) TouchServerLastSeen(serverID uint) error {
 	now := time.Now()
 	return d.DB.Model(&models.Server{}).Where("id = ?", serverID).Updates(map[string]interface{}{
 		"last_seen": &now,
-		"status":    "online",
+		"status":    gorm.Expr("CASE WHEN status = 'offline' AND NOT maintenance_mode THEN 'online' ELSE status END"),
 	}).Error
 }
 
-func (d *Database) UpdateServerStatus(serverID uint, status string) error {
-	return d.DB.Model(&models.Server{}).Where("id = ?", serverID).Update("status", status).Error
+// UpdateServerStatus sets the status derived from the agent's connection and
+// metrics, returning the status it replaced. It leaves servers in maintenance
+// alone, returning an empty status for them.
+func (d *Database) UpdateServerStatus(serverID uint, status string) (string, error) {
+	var previous string
+	err := d.DB.Raw(`UPDATE servers AS s SET status = ?
+		FROM (SELECT id, status FROM servers WHERE id = ? FOR UPDATE) AS old
+		WHERE s.id = old.id AND NOT s.maintenance_mode
+		RETURNING old.status`, status, serverID).Scan(&previous).Error
+	return previous, err
+}
+
+// metricConflict skips a metric whose (server_id, time) is already stored.
+// Resent samples are identical to the stored ones, so the first write wins.
+var metricConflict = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "server_id"}, {Name: "time"}},
+	DoNothing: true,
 }
 
 // Metric operations
-func (d *Database) CreateMetric(metric *models.Metric) error {
-	return d.DB.Create(metric).Error
+
+// CreateMetric stores a metric unless the server already has one at the same
+// time, reporting whether a row was inserted
+func (d *Database) CreateMetric(metric *models.Metric) (bool, error) {
+	result := d.DB.Clauses(metricConflict).Create(metric)
+	return result.RowsAffected > 0, result.Error
+}
+
+// CreateCustomMetrics stores a sample's custom metric values
+func (d *Database) CreateCustomMetrics(metrics []models.CustomMetric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	return d.DB.Create(&metrics).Error
+}
+
+// GetCustomMetricSeries returns up to limit distinct dimension sets stored
+// for a server's custom metric
+func (d *Database) GetCustomMetricSeries(serverID uint, name string, limit int) ([]models.Dimensions, error) {
+	var series []models.Dimensions
+	err := d.DB.Model(&models.CustomMetric{}).
+		Where("server_id = ? AND name = ?", serverID, name).
+		Distinct("dimensions").
+		Limit(limit).
+		Pluck("dimensions", &series).Error
+	return series, err
+}
+
+// GetCustomMetricNames lists the custom metric names a server has reported since a time
+func (d *Database) GetCustomMetricNames(serverID uint, since time.Time) ([]string, error) {
+	var names []string
+	err := d.DB.Model(&models.CustomMetric{}).
+		Where("server_id = ? AND time >= ?", serverID, since).
+		Distinct("name").
+		Order("name").
+		Pluck("name", &names).Error
+	return names, err
+}
+
+// GetCustomMetricPoints returns a custom metric since a time, summed per
+// timestamp within each value of the groupBy dimension. With no groupBy all
+// series are summed into one group named "".
+func (d *Database) GetCustomMetricPoints(serverID uint, name, groupBy string, since time.Time) ([]models.CustomMetricPoint, error) {
+	var points []models.CustomMetricPoint
+	err := d.DB.Raw(`
+		SELECT COALESCE(dimensions->>?, '') AS "group", time, SUM(value) AS value
+		FROM custom_metrics
+		WHERE server_id = ? AND name = ? AND time >= ?
+		GROUP BY 1, time
+		ORDER BY 1, time`, groupBy, serverID, name, since).
+		Scan(&points).Error
+	return points, err
+}
+
+// metricBatchSize is the number of rows per INSERT when writing metric batches
+const metricBatchSize = 500
+
+// MetricKey identifies a stored metric; a server has at most one per time
+type MetricKey struct {
+	ServerID uint
+	Time     time.Time
+}
+
+// CreateMetrics inserts metrics in batches, skipping any the server already
+// has at the same time, and returns the keys of the rows it inserted. Times
+// are rounded to the microsecond Postgres stores, so the keys compare equal
+// to the metrics they came from. If a batch fails, for example on a
+// constraint violation, the metrics are retried row by row so that only the
+// offending rows are dropped; the error then reports how many were.
+func (d *Database) CreateMetrics(metrics []*models.Metric) ([]MetricKey, error) {
+	if len(metrics) == 0 {
+		return nil, nil
+	}
+	for _, metric := range metrics {
+		metric.Time = metric.Time.Round(time.Microsecond)
+	}
+
+	var keys []MetricKey
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		for start := 0; start < len(metrics); start += metricBatchSize {
+			end := min(start+metricBatchSize, len(metrics))
+			inserted, err := insertMetrics(tx, metrics[start:end])
+			if err != nil {
+				return err
+			}
+			keys = append(keys, inserted...)
+		}
+		return nil
+	})
+	if err == nil {
+		return keys, nil
+	}
+	log.Printf("Metric batch of %d rows failed, retrying row by row: %v", len(metrics), err)
+
+	keys = keys[:0]
+	dropped := 0
+	var lastErr error
+	for _, metric := range metrics {
+		inserted, err := insertMetrics(d.DB, []*models.Metric{metric})
+		if err != nil {
+			dropped++
+			lastErr = err
+			log.Printf("Dropping metric for server %d at %s: %v",
+				metric.ServerID, metric.Time.Format(time.RFC3339), err)
+			continue
+		}
+		keys = append(keys, inserted...)
+	}
+	if dropped == 0 {
+		return keys, nil
+	}
+	d.droppedMetrics.Add(uint64(dropped))
+	return keys, fmt.Errorf("dropped %d of %d metrics: %w", dropped, len(metrics), lastErr)
+}
+
+// insertMetrics runs one multi-row INSERT and returns the keys Postgres
+// reports as inserted. Rows skipped by the conflict clause return nothing,
+// so unlike the IDs GORM scans back the keys can't be assigned to the wrong
+// metric.
+func insertMetrics(tx *gorm.DB, metrics []*models.Metric) ([]MetricKey, error) {
+	dry := tx.Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true}).
+		Clauses(metricConflict, clause.Returning{Columns: []clause.Column{{Name: "server_id"}, {Name: "time"}}}).
+		Create(&metrics)
+	if dry.Error != nil {
+		return nil, dry.Error
+	}
+
+	var keys []MetricKey
+	err := tx.Raw(dry.Statement.SQL.String(), dry.Statement.Vars...).Scan(&keys).Error
+	return keys, err
+}
+
+// DroppedMetrics returns how many metric rows have been dropped by
+// CreateMetrics since startup
+func (d *Database) DroppedMetrics() uint64 {
+	return d.droppedMetrics.Load()
+}
+
+// GetMetricBuckets returns a server's metrics from from up to but not
+// including to, averaged into buckets of the given width and newest first, for
+// charting long periods. Cumulative counters keep their latest value and
+// per-device and per-mount lists are left empty. Buckets use TimescaleDB's
+// time_bucket when the extension is installed.
+func (d *Database) GetMetricBuckets(serverID uint, from, to time.Time, bucket time.Duration) ([]models.Metric, error) {
+	width := bucket.Seconds()
+	bucketExpr, args := "to_timestamp(floor(EXTRACT(EPOCH FROM time) / ?) * ?)", []interface{}{width, width}
+	if d.timescaleInstalled() {
+		bucketExpr, args = "time_bucket(make_interval(secs => ?), time)", []interface{}{width}
+	}
+
+	var buckets []models.Metric
+	err := d.DB.Raw(`
+		SELECT `+bucketExpr+` AS time,
+			AVG(cpu_usage) AS cpu_usage, MAX(cpu_usage) AS cpu_usage_max,
+			AVG(memory_percent) AS memory_percent, MAX(memory_percent) AS memory_percent_max,
+			AVG(memory_used) AS memory_used, AVG(memory_available) AS memory_available,
+			AVG(swap_percent) AS swap_percent,
+			AVG(disk_percent) AS disk_percent, MAX(disk_percent) AS disk_percent_max,
+			AVG(disk_used) AS disk_used, AVG(disk_free) AS disk_free,
+			MAX(network_bytes_in) AS network_bytes_in, MAX(network_bytes_out) AS network_bytes_out,
+			AVG(network_rate_in) AS network_rate_in, AVG(network_rate_out) AS network_rate_out,
+			AVG(load1) AS load1, AVG(load5) AS load5, AVG(load15) AS load15, AVG(load_per_core) AS load_per_core,
+			AVG(context_switch_rate) AS context_switch_rate, AVG(interrupt_rate) AS interrupt_rate,
+			AVG(disk_read_bytes) AS disk_read_bytes, AVG(disk_write_bytes) AS disk_write_bytes,
+			AVG(memory_pressure_some) AS memory_pressure_some, AVG(memory_pressure_full) AS memory_pressure_full,
+			MAX(oom_kills) AS oom_kills,
+			SUM(sample_count) AS sample_count
+		FROM metrics
+		WHERE server_id = ? AND time >= ? AND time < ?
+		GROUP BY 1
+		ORDER BY 1 DESC`, append(args, serverID, from, to)...).
+		Scan(&buckets).Error
+	return buckets, err
+}
+
+// timescaleInstalled reports whether the TimescaleDB extension is installed,
+// checking once per connection
+func (d *Database) timescaleInstalled() bool {
+	d.timescaleOnce.Do(func() {
+		installed, err := d.hasTimescale()
+		if err != nil {
+			log.Printf("Warning: Could not check for TimescaleDB: %v", err)
+		}
+		d.timescale = installed
+	})
+	return d.timescale
+}
+
+// GetMetricStats returns the average, maximum and minimum CPU, memory and
+// disk usage of a server since a time, keyed by resource, and the number of
+// samples they cover
+func (d *Database) GetMetricStats(serverID uint, since time.Time) (map[string]models.ResourceStats, int64, error) {
+	var row struct {
+		Samples                         int64
+		CPUAvg, CPUMax, CPUMin          float64
+		MemoryAvg, MemoryMax, MemoryMin float64
+		DiskAvg, DiskMax, DiskMin       float64
+	}
+	err := d.DB.Raw(`
+		SELECT COUNT(*) AS samples,
+			COALESCE(AVG(cpu_usage), 0) AS cpu_avg, COALESCE(MAX(cpu_usage), 0) AS cpu_max, COALESCE(MIN(cpu_usage), 0) AS cpu_min,
+			COALESCE(AVG(memory_percent), 0) AS memory_avg, COALESCE(MAX(memory_percent), 0) AS memory_max, COALESCE(MIN(memory_percent), 0) AS memory_min,
+			COALESCE(AVG(disk_percent), 0) AS disk_avg, COALESCE(MAX(disk_percent), 0) AS disk_max, COALESCE(MIN(disk_percent), 0) AS disk_min
+		FROM metrics
+		WHERE server_id = ? AND time >= ?`, serverID, since).
+		Scan(&row).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return map[string]models.ResourceStats{
+		"cpu":    {Average: row.CPUAvg, Max: row.CPUMax, Min: row.CPUMin},
+		"memory": {Average: row.MemoryAvg, Max: row.MemoryMax, Min: row.MemoryMin},
+		"disk":   {Average: row.DiskAvg, Max: row.DiskMax, Min: row.DiskMin},
+	}, row.Samples, nil
+}
+
+// GetServerAlertsSince returns a server's non-test alerts raised since a
+// time, newest first
+func (d *Database) GetServerAlertsSince(serverID uint, since time.Time) ([]models.Alert, error) {
+	var alerts []models.Alert
+	err := d.DB.Where("server_id = ? AND created_at >= ? AND NOT test", serverID, since).
+		Order("created_at DESC").
+		Find(&alerts).Error
+	return alerts, err
+}
+
+// MetricExists reports whether a server already has a metric at exactly this time
+func (d *Database) MetricExists(serverID uint, at time.Time) (bool, error) {
+	var count int64
+	err := d.DB.Model(&models.Metric{}).Where("server_id = ? AND time = ?", serverID, at).Limit(1).Count(&count).Error
+	return count > 0, err
 }
 
 func (d *Database) GetServerMetrics(serverID uint, since time.Time) ([]models.Metric, error) {
@@ -211,6 +643,32 @@ func (d *Database) GetServerMetrics(serverID uint, since time.Time) ([]models.Me
 	return metrics, err
 }
 
+// GetServerMetricsPage returns one page of a server's metrics from from up to
+// but not including to, newest first, along with the number of metrics in
+// the whole range
+func (d *Database) GetServerMetricsPage(serverID uint, from, to time.Time, limit, offset int) ([]models.Metric, int64, error) {
+	query := d.DB.Model(&models.Metric{}).Where("server_id = ? AND time >= ? AND time < ?", serverID, from, to)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var metrics []models.Metric
+	err := query.Order("time DESC").Limit(limit).Offset(offset).Find(&metrics).Error
+	return metrics, total, err
+}
+
+// GetServerMetricsBetween returns a server's metrics from from up to but not
+// including to, newest first
+func (d *Database) GetServerMetricsBetween(serverID uint, from, to time.Time) ([]models.Metric, error) {
+	var metrics []models.Metric
+	err := d.DB.Where("server_id = ? AND time >= ? AND time < ?", serverID, from, to).
+		Order("time DESC").
+		Find(&metrics).Error
+	return metrics, err
+}
+
 func (d *Database) GetLatestMetrics(serverID uint) (*models.Metric, error) {
 	var metric models.Metric
 	err := d.DB.Where("server_id = ?", serverID).
@@ -222,14 +680,479 @@ func (d *Database) GetLatestMetrics(serverID uint) (*models.Metric, error) {
 	return &metric, nil
 }
 
+// GetLatestMetricsForUser returns the most recent metric of each of the
+// user's servers, keyed by server ID, in a single query
+func (d *Database) GetLatestMetricsForUser(userID uint) (map[uint]*models.Metric, error) {
+	var metrics []models.Metric
+	err := d.DB.Raw(`
+		SELECT DISTINCT ON (metrics.server_id) metrics.*
+		FROM metrics
+		JOIN servers ON servers.id = metrics.server_id
+		WHERE servers.user_id = ?
+		ORDER BY metrics.server_id, metrics.time DESC`, userID).
+		Scan(&metrics).Error
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[uint]*models.Metric, len(metrics))
+	for i := range metrics {
+		latest[metrics[i].ServerID] = &metrics[i]
+	}
+	return latest, nil
+}
+
+// GetServerRankings ranks the user's servers by an aggregate of a metrics
+// column since the given time. column and aggregate must come from a fixed
+// whitelist as they are interpolated into the query.
+func (d *Database) GetServerRankings(userID uint, column, aggregate string, since time.Time, ascending bool, limit int) ([]models.ServerRanking, error) {
+	var expr string
+	switch aggregate {
+	case "p95":
+		expr = fmt.Sprintf("percentile_cont(0.95) WITHIN GROUP (ORDER BY metrics.%s)", column)
+	default:
+		expr = fmt.Sprintf("AVG(metrics.%s)", column)
+	}
+
+	var rankings []models.ServerRanking
+	err := d.DB.Raw(fmt.Sprintf(`
+		SELECT servers.id AS server_id, servers.name AS server_name,
+			%s AS value, COUNT(*) AS samples
+		FROM servers
+		JOIN metrics ON metrics.server_id = servers.id AND metrics.time >= ?
+		WHERE servers.user_id = ?
+		GROUP BY servers.id, servers.name
+		ORDER BY value %s, servers.id
+		LIMIT ?`, expr, sortDirection(ascending)), since, userID, limit).
+		Scan(&rankings).Error
+	return rankings, err
+}
+
+// GetAlertCountRankings ranks the user's servers by the number of alerts
+// raised since the given time, including servers without alerts
+func (d *Database) GetAlertCountRankings(userID uint, since time.Time, ascending bool, limit int) ([]models.ServerRanking, error) {
+	var rankings []models.ServerRanking
+	err := d.DB.Raw(fmt.Sprintf(`
+		SELECT servers.id AS server_id, servers.name AS server_name,
+			COUNT(alerts.id) AS value, COUNT(alerts.id) AS samples
+		FROM servers
+		LEFT JOIN alerts ON alerts.server_id = servers.id AND alerts.created_at >= ? AND NOT alerts.test
+		WHERE servers.user_id = ?
+		GROUP BY servers.id, servers.name
+		ORDER BY value %s, servers.id
+		LIMIT ?`, sortDirection(ascending)), since, userID, limit).
+		Scan(&rankings).Error
+	return rankings, err
+}
+
+// GetAlertStats aggregates the user's non-test alerts raised since a time.
+// Resolution time is measured to the alert's last update, which is when it
+// was resolved. Daily counts only include days with alerts.
+func (d *Database) GetAlertStats(userID uint, since time.Time, topServers int) (*models.AlertStats, error) {
+	stats := &models.AlertStats{
+		ByLevel: make(map[string]int64),
+		ByType:  make(map[string]int64),
+	}
+
+	userAlerts := func() *gorm.DB {
+		return d.DB.Model(&models.Alert{}).
+			Joins("JOIN servers ON servers.id = alerts.server_id").
+			Where("servers.user_id = ? AND alerts.created_at >= ? AND NOT alerts.test", userID, since)
+	}
+
+	var totals struct {
+		Total       int64
+		Resolved    int64
+		MeanResolve *float64
+	}
+	err := userAlerts().Select(`COUNT(*) AS total,
+		COUNT(*) FILTER (WHERE alerts.resolved) AS resolved,
+		AVG(EXTRACT(EPOCH FROM (COALESCE(alerts.resolved_at, alerts.updated_at) - alerts.created_at))) FILTER (WHERE alerts.resolved) AS mean_resolve`).
+		Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+	stats.Total = totals.Total
+	stats.Resolved = totals.Resolved
+	stats.MeanTimeToResolve = totals.MeanResolve
+
+	var groups []struct {
+		Key   string
+		Count int64
+	}
+	if err := userAlerts().Select("alerts.level AS key, COUNT(*) AS count").Group("alerts.level").Scan(&groups).Error; err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		stats.ByLevel[group.Key] = group.Count
+	}
+
+	groups = nil
+	if err := userAlerts().Select("alerts.type AS key, COUNT(*) AS count").Group("alerts.type").Scan(&groups).Error; err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		stats.ByType[group.Key] = group.Count
+	}
+
+	err = userAlerts().
+		Select("servers.id AS server_id, servers.name AS server_name, COUNT(*) AS value, COUNT(*) AS samples").
+		Group("servers.id, servers.name").
+		Order("value DESC, servers.id").
+		Limit(topServers).
+		Scan(&stats.TopServers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = userAlerts().
+		Select("date_trunc('day', alerts.created_at AT TIME ZONE 'UTC') AS day, COUNT(*) AS count").
+		Group("day").
+		Order("day").
+		Scan(&stats.Daily).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func sortDirection(ascending bool) string {
+	if ascending {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+// GetServerByBadgeToken returns the server shared under an uptime badge token
+func (d *Database) GetServerByBadgeToken(token string) (*models.Server, error) {
+	var server models.Server
+	err := d.DB.Where("badge_token = ?", token).First(&server).Error
+	if err != nil {
+		return nil, err
+	}
+	return &server, nil
+}
+
+// GetDowntime estimates how long a server was down between since and until
+// from gaps in its metrics: every gap between consecutive samples (or the
+// window edges) longer than maxGap counts as downtime.
+func (d *Database) GetDowntime(serverID uint, since, until time.Time, maxGap time.Duration) (time.Duration, error) {
+	var seconds float64
+	err := d.DB.Raw(`
+		SELECT COALESCE(SUM(gap), 0) FROM (
+			SELECT EXTRACT(EPOCH FROM (t - LAG(t) OVER (ORDER BY t))) AS gap
+			FROM (
+				SELECT time AS t FROM metrics WHERE server_id = ? AND time > ? AND time < ?
+				UNION ALL SELECT CAST(? AS timestamptz)
+				UNION ALL SELECT CAST(? AS timestamptz)
+			) samples
+		) gaps
+		WHERE gap > ?`, serverID, since, until, since, until, maxGap.Seconds()).
+		Scan(&seconds).Error
+	return time.Duration(seconds * float64(time.Second)), err
+}
+
+// GetMetricNearest returns the metric closest in time to at, looking no
+// further than maxDistance either side. Returns gorm.ErrRecordNotFound if
+// there is no sample in that window.
+func (d *Database) GetMetricNearest(serverID uint, at time.Time, maxDistance time.Duration) (*models.Metric, error) {
+	var metric models.Metric
+	err := d.DB.Where("server_id = ? AND time BETWEEN ? AND ?", serverID, at.Add(-maxDistance), at.Add(maxDistance)).
+		Order(gorm.Expr("ABS(EXTRACT(EPOCH FROM (time - ?)))", at)).
+		First(&metric).Error
+	if err != nil {
+		return nil, err
+	}
+	return &metric, nil
+}
+
+// Alert route operations
+func (d *Database) GetUserAlertRoutes(userID uint) ([]models.AlertRoute, error) {
+	var routes []models.AlertRoute
+	err := d.DB.Where("user_id = ?", userID).Order("position ASC, id ASC").Find(&routes).Error
+	return routes, err
+}
+
+func (d *Database) GetAlertRoute(routeID, userID uint) (*models.AlertRoute, error) {
+	var route models.AlertRoute
+	err := d.DB.Where("id = ? AND user_id = ?", routeID, userID).First(&route).Error
+	if err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+func (d *Database) CreateAlertRoute(route *models.AlertRoute) error {
+	return d.DB.Create(route).Error
+}
+
+func (d *Database) SaveAlertRoute(route *models.AlertRoute) error {
+	return d.DB.Save(route).Error
+}
+
+func (d *Database) DeleteAlertRoute(routeID, userID uint) error {
+	return d.DB.Where("id = ? AND user_id = ?", routeID, userID).Delete(&models.AlertRoute{}).Error
+}
+
+// Alert recipient operations
+
+func (d *Database) GetAlertRecipients(serverID uint) ([]models.AlertRecipient, error) {
+	var recipients []models.AlertRecipient
+	err := d.DB.Where("server_id = ?", serverID).Order("created_at ASC, id ASC").Find(&recipients).Error
+	return recipients, err
+}
+
+func (d *Database) CreateAlertRecipient(recipient *models.AlertRecipient) error {
+	return d.DB.Create(recipient).Error
+}
+
+// DeleteAlertRecipient removes a recipient of a server's alerts, returning
+// false when the server has no such recipient
+func (d *Database) DeleteAlertRecipient(recipientID, serverID uint) (bool, error) {
+	result := d.DB.Where("id = ? AND server_id = ?", recipientID, serverID).Delete(&models.AlertRecipient{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReplaceAlertRecipients makes emails the recipients of a server's alerts,
+// keeping the ones already added
+func (d *Database) ReplaceAlertRecipients(serverID uint, emails []string) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		stale := tx.Where("server_id = ?", serverID)
+		if len(emails) > 0 {
+			stale = stale.Where("email NOT IN ?", emails)
+		}
+		if err := stale.Delete(&models.AlertRecipient{}).Error; err != nil {
+			return err
+		}
+		if len(emails) == 0 {
+			return nil
+		}
+
+		recipients := make([]models.AlertRecipient, len(emails))
+		for i, email := range emails {
+			recipients[i] = models.AlertRecipient{ServerID: serverID, Email: email}
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&recipients).Error
+	})
+}
+
+// Trend operations
+
+// UpdateServerTrend folds a disk usage sample into the server's trend state
+func (d *Database) UpdateServerTrend(serverID uint, at time.Time, diskPercent float64) error {
+	trend, err := d.GetServerTrend(serverID)
+	if err == gorm.ErrRecordNotFound {
+		trend = &models.ServerTrend{ServerID: serverID}
+	} else if err != nil {
+		return err
+	}
+
+	trend.Observe(at, diskPercent)
+	return d.DB.Save(trend).Error
+}
+
+func (d *Database) GetServerTrend(serverID uint) (*models.ServerTrend, error) {
+	var trend models.ServerTrend
+	err := d.DB.Where("server_id = ?", serverID).First(&trend).Error
+	if err != nil {
+		return nil, err
+	}
+	return &trend, nil
+}
+
+// Agent event operations
+
+// maxAgentEventsPerServer bounds the agent_events table; older events are
+// pruned as new ones arrive
+const maxAgentEventsPerServer = 100
+
+// CreateAgentEvent stores an agent event and prunes the server's oldest events
+func (d *Database) CreateAgentEvent(event *models.AgentEvent) error {
+	if err := d.DB.Create(event).Error; err != nil {
+		return err
+	}
+
+	return d.DB.Exec(`
+		DELETE FROM agent_events
+		WHERE server_id = ? AND id NOT IN (
+			SELECT id FROM agent_events WHERE server_id = ? ORDER BY created_at DESC, id DESC LIMIT ?
+		)`, event.ServerID, event.ServerID, maxAgentEventsPerServer).Error
+}
+
+// GetRecentAgentEvents returns a server's agent events since the given time, newest first
+func (d *Database) GetRecentAgentEvents(serverID uint, since time.Time, limit int) ([]models.AgentEvent, error) {
+	var events []models.AgentEvent
+	err := d.DB.Where("server_id = ? AND created_at >= ?", serverID, since).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// pruneBatchSize bounds the rows removed per statement when pruning old
+// metrics row by row, so no single statement holds locks for long
+const pruneBatchSize = 10000
+
+// PruneMetrics deletes metrics older than before. When metrics is a
+// TimescaleDB hypertable it drops the chunks entirely older than before, which
+// is far cheaper than deleting rows but keeps a chunk straddling the cutoff
+// until a later run; it then returns the number of chunks dropped and
+// chunks is true. Otherwise it deletes rows in batches and returns how many.
+func (d *Database) PruneMetrics(before time.Time) (removed int64, chunks bool, err error) {
+	hypertable, err := d.hasTimescale()
+	if err == nil && hypertable {
+		hypertable, err = d.metricsIsHypertable()
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	if hypertable {
+		err = d.DB.Raw("SELECT COUNT(*) FROM drop_chunks('metrics', older_than => ?::timestamptz)", before).
+			Scan(&removed).Error
+		return removed, true, err
+	}
+
+	removed, err = d.deleteBefore("metrics", before)
+	return removed, false, err
+}
+
+// PruneCustomMetrics deletes custom metric values older than before and
+// returns how many were deleted
+func (d *Database) PruneCustomMetrics(before time.Time) (int64, error) {
+	return d.deleteBefore("custom_metrics", before)
+}
+
+// deleteBefore deletes the rows of a table with a time column older than
+// before, in batches of pruneBatchSize, and returns how many were deleted
+func (d *Database) deleteBefore(table string, before time.Time) (int64, error) {
+	var deleted int64
+	for {
+		result := d.DB.Exec(fmt.Sprintf(`
+			DELETE FROM %[1]s WHERE id IN (
+				SELECT id FROM %[1]s WHERE time < ? LIMIT ?
+			)`, table), before, pruneBatchSize)
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+		deleted += result.RowsAffected
+		if result.RowsAffected < pruneBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// PruneAlerts deletes resolved alerts last updated before resolvedBefore and
+// unresolved alerts created before openBefore (nil cutoffs keep everything),
+// adding the deleted counts to each server's prune total. It returns the
+// number of alerts deleted.
+func (d *Database) PruneAlerts(resolvedBefore, openBefore *time.Time) (int64, error) {
+	if resolvedBefore == nil && openBefore == nil {
+		return 0, nil
+	}
+
+	var pruned int64
+	err := d.DB.Raw(`
+		WITH deleted AS (
+			DELETE FROM alerts
+			WHERE (resolved AND ?::timestamptz IS NOT NULL AND updated_at < ?)
+				OR (NOT resolved AND ?::timestamptz IS NOT NULL AND created_at < ?)
+			RETURNING server_id
+		), counts AS (
+			SELECT server_id, COUNT(*) AS n FROM deleted GROUP BY server_id
+		), totals AS (
+			INSERT INTO alert_prune_counts (server_id, pruned, last_pruned_at)
+			SELECT server_id, n, NOW() FROM counts
+			ON CONFLICT (server_id) DO UPDATE
+			SET pruned = alert_prune_counts.pruned + EXCLUDED.pruned,
+				last_pruned_at = EXCLUDED.last_pruned_at
+		)
+		SELECT COALESCE(SUM(n), 0) FROM counts`,
+		resolvedBefore, resolvedBefore, openBefore, openBefore).
+		Scan(&pruned).Error
+	return pruned, err
+}
+
+// GetAlertPruneCount returns the number of a server's alerts removed by retention
+func (d *Database) GetAlertPruneCount(serverID uint) (int64, error) {
+	var count models.AlertPruneCount
+	err := d.DB.Where("server_id = ?", serverID).Limit(1).Find(&count).Error
+	return count.Pruned, err
+}
+
 // Alert operations
 func (d *Database) CreateAlert(alert *models.Alert) error {
 	return d.DB.Create(alert).Error
 }
 
-func (d *Database) GetServerAlerts(serverID uint, limit int) ([]models.Alert, error) {
+// GetRepeatedAlert returns the server's open alert with the same type, level
+// and labels as alert that was last raised at or after since, or nil if
+// there is none
+func (d *Database) GetRepeatedAlert(alert *models.Alert, since time.Time) (*models.Alert, error) {
+	var existing models.Alert
+	err := d.DB.
+		Where("server_id = ? AND type = ? AND level = ? AND labels = ?::jsonb", alert.ServerID, alert.Type, alert.Level, alert.Labels).
+		Where("resolved = false AND test = false AND updated_at >= ?", since).
+		Order("updated_at DESC").
+		First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// RepeatAlert records a repeat occurrence of an open alert, keeping its
+// latest value, threshold and message
+func (d *Database) RepeatAlert(alertID uint, repeat *models.Alert) error {
+	return d.DB.Model(&models.Alert{}).Where("id = ?", alertID).Updates(map[string]interface{}{
+		"value":     repeat.Value,
+		"threshold": repeat.Threshold,
+		"message":   repeat.Message,
+	}).Error
+}
+
+// AlertFilter narrows down a server's alerts; zero fields match anything
+type AlertFilter struct {
+	Type     string
+	Level    string
+	Resolved *bool
+	From     time.Time // created at or after
+	To       time.Time // created before
+	Labels   models.Dimensions
+}
+
+// GetServerAlerts returns a server's newest alerts. With labels, only alerts
+// carrying all of them are returned.
+func (d *Database) GetServerAlerts(serverID uint, limit int, labels models.Dimensions) ([]models.Alert, error) {
+	return d.FilterServerAlerts(serverID, AlertFilter{Labels: labels}, limit)
+}
+
+// FilterServerAlerts returns a server's newest alerts matching the filter
+func (d *Database) FilterServerAlerts(serverID uint, filter AlertFilter, limit int) ([]models.Alert, error) {
 	var alerts []models.Alert
 	query := d.DB.Where("server_id = ?", serverID).Order("created_at DESC")
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Level != "" {
+		query = query.Where("level = ?", filter.Level)
+	}
+	if filter.Resolved != nil {
+		query = query.Where("resolved = ?", *filter.Resolved)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if len(filter.Labels) > 0 {
+		query = query.Where("labels @> ?::jsonb", filter.Labels)
+	}
 	if limit > 0 {
 		query = query.Limit(limit)
 	}
@@ -245,6 +1168,89 @@ func (d *Database) GetUnresolvedAlerts(serverID uint) ([]models.Alert, error) {
 	return alerts, err
 }
 
+// GetUnreportedServers returns servers last seen before a time that have no
+// open offline alert yet. Servers in maintenance, disabled servers and
+// servers whose agent never connected are left out.
+func (d *Database) GetUnreportedServers(seenBefore time.Time) ([]models.Server, error) {
+	var servers []models.Server
+	err := d.DB.Where("last_seen < ? AND NOT maintenance_mode AND NOT disabled", seenBefore).
+		Where("NOT EXISTS (SELECT 1 FROM alerts WHERE alerts.server_id = servers.id AND alerts.type = 'offline' AND NOT alerts.resolved)").
+		Find(&servers).Error
+	return servers, err
+}
+
+// GetReportingOfflineServers returns servers with an open offline alert that
+// have been seen since a time, so the alert can be resolved
+func (d *Database) GetReportingOfflineServers(seenSince time.Time) ([]models.Server, error) {
+	var servers []models.Server
+	err := d.DB.Where("last_seen >= ?", seenSince).
+		Where("EXISTS (SELECT 1 FROM alerts WHERE alerts.server_id = servers.id AND alerts.type = 'offline' AND NOT alerts.resolved)").
+		Find(&servers).Error
+	return servers, err
+}
+
+// resolvedNow are the column updates resolving an alert
+func resolvedNow() map[string]interface{} {
+	return map[string]interface{}{"resolved": true, "resolved_at": time.Now()}
+}
+
+// ResolveServerAlertsOfType resolves a server's open alerts of one type
+func (d *Database) ResolveServerAlertsOfType(serverID uint, alertType string) error {
+	return d.DB.Model(&models.Alert{}).
+		Where("server_id = ? AND type = ? AND resolved = false", serverID, alertType).
+		Updates(resolvedNow()).Error
+}
+
+// ResolveAlerts resolves the given open alerts and returns how many were
+// still open
+func (d *Database) ResolveAlerts(alertIDs []uint) (int64, error) {
+	result := d.DB.Model(&models.Alert{}).
+		Where("id IN ? AND resolved = false", alertIDs).
+		Updates(resolvedNow())
+	return result.RowsAffected, result.Error
+}
+
 func (d *Database) ResolveAlert(alertID uint) error {
-	return d.DB.Model(&models.Alert{}).Where("id = ?", alertID).Update("resolved", true).Error
+	return d.DB.Model(&models.Alert{}).Where("id = ? AND resolved = false", alertID).Updates(resolvedNow()).Error
+}
+
+// AcknowledgeServerAlerts acknowledges every open, unacknowledged alert of a
+// server and returns how many were acknowledged
+func (d *Database) AcknowledgeServerAlerts(serverID uint) (int64, error) {
+	result := d.DB.Model(&models.Alert{}).
+		Where("server_id = ? AND resolved = false AND acknowledged = false", serverID).
+		Updates(map[string]interface{}{"acknowledged": true, "acknowledged_at": time.Now()})
+	return result.RowsAffected, result.Error
+}
+
+// alertDeleteBatchSize bounds the rows removed per statement when deleting
+// alerts on demand
+const alertDeleteBatchSize = 1000
+
+// DeleteResolvedAlerts deletes a server's resolved alerts created before a
+// time, in batches within one transaction, and returns how many were deleted.
+// Unresolved alerts are never touched.
+func (d *Database) DeleteResolvedAlerts(serverID uint, before time.Time) (int64, error) {
+	var deleted int64
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		for {
+			result := tx.Exec(`
+				DELETE FROM alerts WHERE id IN (
+					SELECT id FROM alerts
+					WHERE server_id = ? AND resolved AND created_at < ?
+					LIMIT ?
+				)`, serverID, before, alertDeleteBatchSize)
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted += result.RowsAffected
+			if result.RowsAffected < alertDeleteBatchSize {
+				return nil
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
 }
@@ -0,0 +1,241 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"backend/database"
+	"backend/models"
+	"backend/testdb"
+)
+
+func TestCreateMetricsBulk(t *testing.T) {
+	d := testdb.Open(t)
+	server := testdb.Server(t, d, testdb.User(t, d), "test")
+
+	// Nanosecond times must still match the keys Postgres returns
+	start := time.Now().Add(-time.Hour).Truncate(time.Second).Add(123456789)
+	newMetrics := func(from, n int) []*models.Metric {
+		metrics := make([]*models.Metric, n)
+		for i := range metrics {
+			metrics[i] = &models.Metric{
+				ServerID: server.ID,
+				Time:     start.Add(time.Duration(from+i) * time.Second),
+				CPUUsage: float64(i % 100),
+			}
+		}
+		return metrics
+	}
+
+	const rows = 3000
+	keys, err := d.CreateMetrics(newMetrics(0, rows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != rows {
+		t.Fatalf("got %d inserted keys, want %d", len(keys), rows)
+	}
+
+	var stored int64
+	d.DB.Model(&models.Metric{}).Where("server_id = ?", server.ID).Count(&stored)
+	if stored != rows {
+		t.Fatalf("stored %d rows, want %d", stored, rows)
+	}
+
+	// Resending overlapping samples only inserts, and reports, the new ones
+	overlap := newMetrics(rows-500, 1000)
+	keys, err = d.CreateMetrics(overlap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 500 {
+		t.Fatalf("got %d inserted keys, want 500", len(keys))
+	}
+	inserted := make(map[int64]bool, len(keys))
+	for _, key := range keys {
+		if key.ServerID != server.ID {
+			t.Errorf("key for server %d, want %d", key.ServerID, server.ID)
+		}
+		inserted[key.Time.UnixMicro()] = true
+	}
+	for i, metric := range overlap {
+		if want := i >= 500; inserted[metric.Time.UnixMicro()] != want {
+			t.Errorf("metric %d at %s: inserted = %v, want %v", i, metric.Time, !want, want)
+		}
+	}
+}
+
+func TestCreateMetricSkipsDuplicateTime(t *testing.T) {
+	d := testdb.Open(t)
+	server := testdb.Server(t, d, testdb.User(t, d), "test")
+
+	at := time.Now().Truncate(time.Second)
+	for i, want := range []bool{true, false} {
+		inserted, err := d.CreateMetric(&models.Metric{ServerID: server.ID, Time: at, CPUUsage: float64(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inserted != want {
+			t.Errorf("insert %d: inserted = %v, want %v", i+1, inserted, want)
+		}
+	}
+
+	var stored []models.Metric
+	d.DB.Where("server_id = ?", server.ID).Find(&stored)
+	if len(stored) != 1 {
+		t.Fatalf("stored %d rows, want 1", len(stored))
+	}
+	if stored[0].CPUUsage != 0 {
+		t.Errorf("stored cpu_usage %v, want the first sample's 0", stored[0].CPUUsage)
+	}
+}
+
+func TestCreateMetricsDropsOnlyInvalidRows(t *testing.T) {
+	d := testdb.Open(t)
+	server := testdb.Server(t, d, testdb.User(t, d), "test")
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	metrics := make([]*models.Metric, 10)
+	for i := range metrics {
+		metrics[i] = &models.Metric{ServerID: server.ID, Time: start.Add(time.Duration(i) * time.Second)}
+	}
+	// No such server, so the row violates the foreign key
+	metrics[4].ServerID = server.ID + 1_000_000
+
+	droppedBefore := d.DroppedMetrics()
+	keys, err := d.CreateMetrics(metrics)
+	if err == nil {
+		t.Error("expected an error reporting the dropped row")
+	}
+	if len(keys) != 9 {
+		t.Errorf("got %d inserted keys, want 9", len(keys))
+	}
+	if dropped := d.DroppedMetrics() - droppedBefore; dropped != 1 {
+		t.Errorf("dropped %d rows, want 1", dropped)
+	}
+
+	var stored int64
+	d.DB.Model(&models.Metric{}).Where("server_id = ?", server.ID).Count(&stored)
+	if stored != 9 {
+		t.Errorf("stored %d rows, want 9", stored)
+	}
+}
+
+func TestMaintenanceStatusSurvivesMetrics(t *testing.T) {
+	d := testdb.Open(t)
+	server := testdb.Server(t, d, testdb.User(t, d), "test")
+
+	if err := d.SetMaintenanceMode(server.ID, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	previous, err := d.UpdateServerStatus(server.ID, "online")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous != "" {
+		t.Errorf("UpdateServerStatus returned %q for a server in maintenance, want \"\"", previous)
+	}
+	if err := d.UpdateServerLastSeen(server.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.TouchServerLastSeen(server.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := d.GetServerByID(server.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "maintenance" {
+		t.Errorf("status = %q, want maintenance", stored.Status)
+	}
+	if stored.LastSeen == nil {
+		t.Error("last_seen not recorded while in maintenance")
+	}
+
+	if err := d.SetMaintenanceMode(server.ID, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ = d.GetServerByID(server.ID); stored.Status != "online" {
+		t.Errorf("status after maintenance = %q, want online", stored.Status)
+	}
+}
+
+// alert creates an alert on a server, created at the given time
+func alert(t *testing.T, d *database.Database, serverID uint, resolved bool, createdAt time.Time) *models.Alert {
+	t.Helper()
+	a := &models.Alert{ServerID: serverID, Type: "cpu", Level: "warning", Message: "test", Resolved: resolved, CreatedAt: createdAt}
+	if err := d.CreateAlert(a); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestDeleteResolvedAlerts(t *testing.T) {
+	d := testdb.Open(t)
+	server := testdb.Server(t, d, testdb.User(t, d), "test")
+
+	cutoff := time.Now().Add(-24 * time.Hour)
+	open := alert(t, d, server.ID, false, cutoff.Add(-time.Hour))
+	old := alert(t, d, server.ID, true, cutoff.Add(-time.Hour))
+	recent := alert(t, d, server.ID, true, cutoff.Add(time.Hour))
+
+	deleted, err := d.DeleteResolvedAlerts(server.ID, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 {
+		t.Errorf("deleted %d alerts, want 1", deleted)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		alert *models.Alert
+		kept  bool
+	}{
+		{"open before the cutoff", open, true},
+		{"resolved before the cutoff", old, false},
+		{"resolved after the cutoff", recent, true},
+	} {
+		var count int64
+		d.DB.Model(&models.Alert{}).Where("id = ?", tc.alert.ID).Count(&count)
+		if kept := count == 1; kept != tc.kept {
+			t.Errorf("%s alert: kept = %v, want %v", tc.name, kept, tc.kept)
+		}
+	}
+}
+
+func TestAcknowledgeServerAlerts(t *testing.T) {
+	d := testdb.Open(t)
+	server := testdb.Server(t, d, testdb.User(t, d), "test")
+
+	now := time.Now()
+	open := []*models.Alert{alert(t, d, server.ID, false, now), alert(t, d, server.ID, false, now)}
+	resolved := alert(t, d, server.ID, true, now)
+
+	acknowledged, err := d.AcknowledgeServerAlerts(server.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acknowledged != 2 {
+		t.Errorf("acknowledged %d alerts, want 2", acknowledged)
+	}
+	for _, a := range open {
+		var stored models.Alert
+		d.DB.First(&stored, a.ID)
+		if !stored.Acknowledged || stored.AcknowledgedAt == nil {
+			t.Errorf("open alert %d not acknowledged", a.ID)
+		}
+	}
+	var stored models.Alert
+	d.DB.First(&stored, resolved.ID)
+	if stored.Acknowledged {
+		t.Error("resolved alert acknowledged")
+	}
+
+	// Already acknowledged alerts are not counted again
+	if acknowledged, err = d.AcknowledgeServerAlerts(server.ID); err != nil || acknowledged != 0 {
+		t.Errorf("second acknowledge: %d alerts, err %v, want 0 and no error", acknowledged, err)
+	}
+}
@@ -0,0 +1,228 @@
+// Package fakeagent provides a scriptable stand-in for the monitoring agent.
+//
+// It speaks the same WebSocket protocol as the real agent, so it can be
+// pointed at a backend started with httptest (or a local instance) to replay
+// canned metric and alert sequences and then inspect the resulting database
+// state:
+//
+//	srv := httptest.NewServer(router)
+//	agent, err := fakeagent.Dial(srv.URL, server.Token, "fake-server")
+//	...
+//	err = agent.Replay([]fakeagent.Step{
+//		fakeagent.Metrics(fakeagent.SampleMetrics(42, 60, 70)),
+//		fakeagent.Alert(fakeagent.SampleAlert("cpu", "warning", 95, 80)),
+//	})
+//	agent.Close()
+package fakeagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend/auth"
+	"backend/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// Agent is a fake monitoring agent connected to a backend
+type Agent struct {
+	conn       *websocket.Conn
+	token      string
+	serverName string
+
+	// signingSecret, when set, signs every message like a configured agent
+	signingSecret string
+}
+
+// Step is a single action in a replayed sequence
+type Step struct {
+	Type  string        // message type, e.g. "metrics", "metrics_batch", "alert" or "agent_error"
+	Data  interface{}   // message payload
+	Delay time.Duration // pause after sending
+}
+
+// Dial connects to the agent endpoint of the backend at baseURL. baseURL may
+// use the http(s) scheme as returned by httptest.Server.URL.
+func Dial(baseURL, token, serverName string) (*Agent, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	if !strings.HasSuffix(u.Path, "/agent/connect") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/agent/connect"
+	}
+
+	q := u.Query()
+	q.Set("token", token)
+	q.Set("server_name", serverName)
+	u.RawQuery = q.Encode()
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	if err != nil {
+		if resp != nil {
+			return nil, &HandshakeError{StatusCode: resp.StatusCode, Err: err}
+		}
+		return nil, fmt.Errorf("connection failed: %w", err)
+	}
+
+	return &Agent{
+		conn:       conn,
+		token:      token,
+		serverName: serverName,
+	}, nil
+}
+
+// HandshakeError is returned by Dial when the backend rejects the upgrade
+type HandshakeError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("connection failed with status %d (%s): %v",
+		e.StatusCode, http.StatusText(e.StatusCode), e.Err)
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+// SetSigningSecret makes the agent sign subsequent messages with secret
+func (a *Agent) SetSigningSecret(secret string) {
+	a.signingSecret = secret
+}
+
+// Send writes a single message of the given type
+func (a *Agent) Send(messageType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	message := models.AgentMessage{
+		Type:       messageType,
+		Token:      a.token,
+		ServerName: a.serverName,
+		Data:       json.RawMessage(payload),
+		Timestamp:  time.Now(),
+	}
+	if a.signingSecret != "" {
+		message.Signature = auth.SignAgentMessage(a.signingSecret, messageType, message.Timestamp, payload)
+	}
+
+	return a.conn.WriteJSON(message)
+}
+
+// SendMetrics sends a metrics message
+func (a *Agent) SendMetrics(data models.MetricData) error {
+	return a.Send("metrics", data)
+}
+
+// SendMetricsBatch sends samples together in a metrics_batch message
+func (a *Agent) SendMetricsBatch(batch []models.MetricData) error {
+	return a.Send("metrics_batch", batch)
+}
+
+// SendAlert sends an alert message
+func (a *Agent) SendAlert(data models.AlertData) error {
+	return a.Send("alert", data)
+}
+
+// SendAgentError sends an agent_error message
+func (a *Agent) SendAgentError(data models.AgentErrorData) error {
+	return a.Send("agent_error", data)
+}
+
+// Replay sends each step in order, stopping at the first error
+func (a *Agent) Replay(steps []Step) error {
+	for i, step := range steps {
+		if err := a.Send(step.Type, step.Data); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i, step.Type, err)
+		}
+		if step.Delay > 0 {
+			time.Sleep(step.Delay)
+		}
+	}
+	return nil
+}
+
+// ReadMessage waits up to timeout for the next message pushed by the backend
+func (a *Agent) ReadMessage(timeout time.Duration) (map[string]interface{}, error) {
+	a.conn.SetReadDeadline(time.Now().Add(timeout))
+	defer a.conn.SetReadDeadline(time.Time{})
+
+	var message map[string]interface{}
+	if err := a.conn.ReadJSON(&message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// Close performs a clean WebSocket close handshake
+func (a *Agent) Close() error {
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	a.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+	return a.conn.Close()
+}
+
+// Metrics returns a replay step sending a metrics message
+func Metrics(data models.MetricData) Step {
+	return Step{Type: "metrics", Data: data}
+}
+
+// MetricsBatch returns a replay step sending a metrics_batch message
+func MetricsBatch(batch []models.MetricData) Step {
+	return Step{Type: "metrics_batch", Data: batch}
+}
+
+// Alert returns a replay step sending an alert message
+func Alert(data models.AlertData) Step {
+	return Step{Type: "alert", Data: data}
+}
+
+// AgentError returns a replay step sending an agent_error message
+func AgentError(data models.AgentErrorData) Step {
+	return Step{Type: "agent_error", Data: data}
+}
+
+// SampleMetrics builds a metrics payload with the given usage percentages
+func SampleMetrics(cpu, memory, disk float64) models.MetricData {
+	var data models.MetricData
+	data.Timestamp = time.Now()
+	data.CPU.Usage = cpu
+	data.CPU.Cores = 4
+	data.Memory.Total = 8 << 30
+	data.Memory.Used = uint64(float64(data.Memory.Total) * memory / 100)
+	data.Memory.Available = data.Memory.Total - data.Memory.Used
+	data.Memory.UsedPercent = memory
+	data.Disk.Total = 100 << 30
+	data.Disk.Used = uint64(float64(data.Disk.Total) * disk / 100)
+	data.Disk.Free = data.Disk.Total - data.Disk.Used
+	data.Disk.UsedPercent = disk
+	data.Uptime = 3600
+	return data
+}
+
+// SampleAlert builds an alert payload
+func SampleAlert(alertType, level string, value, threshold float64) models.AlertData {
+	return models.AlertData{
+		Type:      alertType,
+		Level:     level,
+		Message:   fmt.Sprintf("%s usage is %.1f%% (threshold: %.1f%%)", alertType, value, threshold),
+		Value:     value,
+		Threshold: threshold,
+		Timestamp: time.Now(),
+	}
+}
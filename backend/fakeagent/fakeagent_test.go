@@ -0,0 +1,198 @@
+package fakeagent_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/database"
+	"backend/fakeagent"
+	"backend/handlers"
+	"backend/models"
+	"backend/testdb"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// backend is a WebSocket handler served by httptest against the disposable
+// database in MONITAUR_TEST_DSN, with a single server to connect as
+type backend struct {
+	db     *database.Database
+	url    string
+	server *models.Server
+}
+
+func newBackend(t *testing.T) *backend {
+	t.Helper()
+	db := testdb.Open(t)
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Keep alerts from reaching a real mail server
+	cfg.SMTP.Username = ""
+
+	server := testdb.Server(t, db, testdb.User(t, db), "e2e")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/agent/connect", handlers.NewWebSocketHandler(db, cfg).HandleAgentConnection)
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	return &backend{db: db, url: srv.URL, server: server}
+}
+
+func (b *backend) dial(t *testing.T) *fakeagent.Agent {
+	t.Helper()
+	agent, err := fakeagent.Dial(b.url, b.server.Token, b.server.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return agent
+}
+
+// waitFor polls until condition holds or fails the test after a few seconds
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// readUntil reads messages pushed by the backend until one of messageType
+func readUntil(t *testing.T, agent *fakeagent.Agent, messageType string) map[string]interface{} {
+	t.Helper()
+	for {
+		message, err := agent.ReadMessage(5 * time.Second)
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", messageType, err)
+		}
+		if message["type"] == messageType {
+			return message
+		}
+	}
+}
+
+func (b *backend) status(t *testing.T) string {
+	t.Helper()
+	server, err := b.db.GetServerByID(b.server.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server.Status
+}
+
+func (b *backend) count(t *testing.T, model interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := b.db.DB.Model(model).Where("server_id = ?", b.server.ID).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestDialRejectsUnknownToken(t *testing.T) {
+	b := newBackend(t)
+
+	_, err := fakeagent.Dial(b.url, uuid.NewString(), "intruder")
+	var handshake *fakeagent.HandshakeError
+	if !errors.As(err, &handshake) || handshake.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got %v, want a 401 handshake error", err)
+	}
+}
+
+func TestDialRejectsDisabledServer(t *testing.T) {
+	b := newBackend(t)
+	if err := b.db.UpdateServer(b.server.ID, map[string]interface{}{"disabled": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := fakeagent.Dial(b.url, b.server.Token, b.server.Name)
+	var handshake *fakeagent.HandshakeError
+	if !errors.As(err, &handshake) || handshake.StatusCode != http.StatusForbidden {
+		t.Fatalf("got %v, want a 403 handshake error", err)
+	}
+}
+
+func TestConnectMetricsAlertDisconnect(t *testing.T) {
+	b := newBackend(t)
+	agent := b.dial(t)
+
+	waitFor(t, "server online", func() bool { return b.status(t) == "online" })
+
+	if err := agent.SendMetrics(fakeagent.SampleMetrics(42, 60, 70)); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, agent, "ack")
+	if n := b.count(t, &models.Metric{}); n != 1 {
+		t.Errorf("stored %d metrics, want 1", n)
+	}
+
+	if err := agent.SendAlert(fakeagent.SampleAlert("cpu", "warning", 95, 80)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "alert stored", func() bool { return b.count(t, &models.Alert{}) == 1 })
+
+	agent.Close()
+	waitFor(t, "server offline", func() bool { return b.status(t) == "offline" })
+}
+
+func TestReconnectTakesOver(t *testing.T) {
+	b := newBackend(t)
+	first := b.dial(t)
+	defer first.Close()
+	waitFor(t, "server online", func() bool { return b.status(t) == "online" })
+
+	second := b.dial(t)
+	defer second.Close()
+
+	// The backend closes the connection it replaced
+	for {
+		if _, err := first.ReadMessage(5 * time.Second); err != nil {
+			break
+		}
+	}
+
+	if err := second.SendMetrics(fakeagent.SampleMetrics(10, 20, 30)); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, second, "ack")
+	if n := b.count(t, &models.Metric{}); n != 1 {
+		t.Errorf("stored %d metrics, want 1", n)
+	}
+
+	// Closing the replaced connection must not mark the server offline
+	time.Sleep(100 * time.Millisecond)
+	if status := b.status(t); status != "online" {
+		t.Errorf("status = %q after takeover, want online", status)
+	}
+}
+
+func TestPausedIngestionStoresNothing(t *testing.T) {
+	b := newBackend(t)
+	agent := b.dial(t)
+	defer agent.Close()
+
+	if err := b.db.SetIngestionPaused(b.server.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Paused metrics are acknowledged, so the agent doesn't hold them
+	if err := agent.SendMetrics(fakeagent.SampleMetrics(42, 60, 70)); err != nil {
+		t.Fatal(err)
+	}
+	readUntil(t, agent, "ack")
+	if n := b.count(t, &models.Metric{}); n != 0 {
+		t.Errorf("stored %d metrics while paused, want none", n)
+	}
+}
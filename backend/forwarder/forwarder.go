@@ -0,0 +1,347 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/promread"
+)
+
+// pendingBatches is how many flushed batches, including retries, can wait for
+// the sender before further batches are dropped
+const pendingBatches = 16
+
+// retryBase is the delay before the first retry of a failed batch; it doubles
+// on every further attempt
+var retryBase = time.Second
+
+// Forwarder pushes ingested metrics to an external time-series database in
+// the background. Metrics are batched and retried; when the queue is full
+// new metrics are dropped so ingestion is never blocked.
+type Forwarder struct {
+	config *config.ForwarderConfig
+	client *http.Client
+	format format
+	queue  chan queuedMetric
+
+	// batches hands flushed batches to the sender, so a slow or failing
+	// remote never holds up batching. Failed batches are put back on it
+	// after their backoff instead of sleeping in the sender.
+	batches chan *batch
+	mutex   sync.Mutex
+	closed  bool
+
+	stop      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	// ctx is cancelled when Close gives up waiting, aborting sends in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// queuedMetric is a metric waiting to be batched, with the server labels it
+// is forwarded under
+type queuedMetric struct {
+	serverID   uint
+	serverName string
+	metric     models.Metric
+}
+
+// batch is an encoded request body and how often it has been tried
+type batch struct {
+	body    []byte
+	size    int
+	attempt int
+}
+
+// New creates a forwarder and starts its background sender. It returns nil
+// when forwarding is disabled; a nil Forwarder ignores all metrics.
+func New(cfg *config.ForwarderConfig) *Forwarder {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Forwarder{
+		config:  cfg,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		format:  formats[cfg.Format],
+		queue:   make(chan queuedMetric, cfg.QueueSize),
+		batches: make(chan *batch, pendingBatches),
+		stop:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	f.wg.Add(2)
+	go f.run()
+	go f.sendBatches()
+
+	log.Printf("Forwarding metrics to %s (%s)", cfg.URL, cfg.Format)
+	return f
+}
+
+// Forward queues a metric for delivery without blocking
+func (f *Forwarder) Forward(server *models.Server, metric *models.Metric) {
+	if f == nil {
+		return
+	}
+
+	select {
+	case f.queue <- queuedMetric{serverID: server.ID, serverName: server.Name, metric: *metric}:
+	default:
+		log.Printf("Forwarder queue full, dropping metric for server %d", server.ID)
+	}
+}
+
+// Close stops the forwarder, sending the metrics still queued. It waits for
+// batches in flight until ctx is done, then aborts them. Batches waiting for
+// a retry are dropped.
+func (f *Forwarder) Close(ctx context.Context) error {
+	if f == nil {
+		return nil
+	}
+	f.closeOnce.Do(func() { close(f.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		f.cancel()
+		return nil
+	case <-ctx.Done():
+		f.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// run batches queued metrics and flushes them by size or interval
+func (f *Forwarder) run() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(time.Duration(f.config.FlushInterval) * time.Second)
+	defer ticker.Stop()
+
+	pending := make([]queuedMetric, 0, f.config.BatchSize)
+	add := func(m queuedMetric) {
+		pending = append(pending, m)
+		if len(pending) >= f.config.BatchSize {
+			f.flush(pending)
+			pending = pending[:0]
+		}
+	}
+
+	for {
+		select {
+		case m := <-f.queue:
+			add(m)
+		case <-ticker.C:
+			if len(pending) > 0 {
+				f.flush(pending)
+				pending = pending[:0]
+			}
+		case <-f.stop:
+			// Only run receives from the queue, so it can't drain meanwhile
+			for len(f.queue) > 0 {
+				add(<-f.queue)
+			}
+			if len(pending) > 0 {
+				f.flush(pending)
+			}
+
+			f.mutex.Lock()
+			f.closed = true
+			close(f.batches)
+			f.mutex.Unlock()
+			return
+		}
+	}
+}
+
+// flush encodes a batch and hands it to the sender
+func (f *Forwarder) flush(metrics []queuedMetric) {
+	f.dispatch(&batch{body: f.format.encode(metrics), size: len(metrics)})
+}
+
+// dispatch queues a batch for the sender, dropping it when the sender is
+// backed up or the forwarder is closed
+func (f *Forwarder) dispatch(b *batch) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		log.Printf("Forwarder closed, dropping %d metrics", b.size)
+		return
+	}
+	select {
+	case f.batches <- b:
+	default:
+		log.Printf("Forwarder backed up, dropping %d metrics", b.size)
+	}
+}
+
+// sendBatches delivers batches one at a time until the forwarder is closed
+func (f *Forwarder) sendBatches() {
+	defer f.wg.Done()
+
+	for b := range f.batches {
+		f.deliver(b)
+	}
+}
+
+// deliver sends a batch, scheduling a retry with exponential backoff when it
+// fails
+func (f *Forwarder) deliver(b *batch) {
+	err := f.send(b.body)
+	if err == nil {
+		return
+	}
+
+	if b.attempt >= f.config.MaxRetries {
+		log.Printf("Failed to forward %d metrics after %d attempts: %v", b.size, b.attempt+1, err)
+		return
+	}
+
+	delay := retryBase << b.attempt
+	log.Printf("Forwarding metrics failed (attempt %d), retrying in %s: %v", b.attempt+1, delay, err)
+	b.attempt++
+	time.AfterFunc(delay, func() { f.dispatch(b) })
+}
+
+func (f *Forwarder) send(body []byte) error {
+	req, err := http.NewRequestWithContext(f.ctx, http.MethodPost, f.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range f.format.headers {
+		req.Header.Set(name, value)
+	}
+	if f.config.Token != "" {
+		req.Header.Set("Authorization", f.format.authScheme+" "+f.config.Token)
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("remote returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// format is how a batch is written for one kind of remote
+type format struct {
+	headers    map[string]string
+	authScheme string
+	encode     func(metrics []queuedMetric) []byte
+}
+
+var formats = map[string]format{
+	config.ForwardInfluxDB: {
+		headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+		authScheme: "Token",
+		encode:     encodeLineProtocol,
+	},
+	config.ForwardPrometheus: {
+		headers: map[string]string{
+			"Content-Type":                      "application/x-protobuf",
+			"Content-Encoding":                  "snappy",
+			"X-Prometheus-Remote-Write-Version": "0.1.0",
+		},
+		authScheme: "Bearer",
+		encode:     encodeRemoteWrite,
+	},
+}
+
+func encodeLineProtocol(metrics []queuedMetric) []byte {
+	lines := make([]string, len(metrics))
+	for i := range metrics {
+		lines[i] = formatLineProtocol(&metrics[i])
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// formatLineProtocol renders a metric in InfluxDB line protocol
+func formatLineProtocol(m *queuedMetric) string {
+	metric := &m.metric
+	return fmt.Sprintf("monitaur,server_id=%d,server=%s "+
+		"cpu_usage=%g,cpu_cores=%di,"+
+		"memory_total=%di,memory_used=%di,memory_available=%di,memory_percent=%g,"+
+		"disk_total=%di,disk_used=%di,disk_free=%di,disk_percent=%g,"+
+		"network_bytes_in=%di,network_bytes_out=%di,uptime=%di %d",
+		m.serverID, escapeTag(m.serverName),
+		metric.CPUUsage, metric.CPUCores,
+		metric.MemoryTotal, metric.MemoryUsed, metric.MemoryAvailable, metric.MemoryPercent,
+		metric.DiskTotal, metric.DiskUsed, metric.DiskFree, metric.DiskPercent,
+		metric.NetworkBytesIn, metric.NetworkBytesOut, metric.Uptime,
+		metric.Time.UnixNano(),
+	)
+}
+
+var tagEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+
+func escapeTag(value string) string {
+	return tagEscaper.Replace(value)
+}
+
+// remoteWriteSeries are the fields forwarded over remote write, named like
+// the series served by remote read
+var remoteWriteSeries = []struct {
+	name  string
+	value func(m *models.Metric) float64
+}{
+	{"monitaur_cpu_usage_percent", func(m *models.Metric) float64 { return m.CPUUsage }},
+	{"monitaur_cpu_cores", func(m *models.Metric) float64 { return float64(m.CPUCores) }},
+	{"monitaur_memory_total_bytes", func(m *models.Metric) float64 { return float64(m.MemoryTotal) }},
+	{"monitaur_memory_used_bytes", func(m *models.Metric) float64 { return float64(m.MemoryUsed) }},
+	{"monitaur_memory_available_bytes", func(m *models.Metric) float64 { return float64(m.MemoryAvailable) }},
+	{"monitaur_memory_usage_percent", func(m *models.Metric) float64 { return m.MemoryPercent }},
+	{"monitaur_disk_total_bytes", func(m *models.Metric) float64 { return float64(m.DiskTotal) }},
+	{"monitaur_disk_used_bytes", func(m *models.Metric) float64 { return float64(m.DiskUsed) }},
+	{"monitaur_disk_free_bytes", func(m *models.Metric) float64 { return float64(m.DiskFree) }},
+	{"monitaur_disk_usage_percent", func(m *models.Metric) float64 { return m.DiskPercent }},
+	{"monitaur_network_received_bytes_total", func(m *models.Metric) float64 { return float64(m.NetworkBytesIn) }},
+	{"monitaur_network_sent_bytes_total", func(m *models.Metric) float64 { return float64(m.NetworkBytesOut) }},
+	{"monitaur_uptime_seconds", func(m *models.Metric) float64 { return float64(m.Uptime) }},
+}
+
+// encodeRemoteWrite renders a batch as a Prometheus remote write request
+// with one series per field and server
+func encodeRemoteWrite(metrics []queuedMetric) []byte {
+	series := make([]promread.TimeSeries, 0, len(metrics)*len(remoteWriteSeries))
+	for i := range metrics {
+		m := &metrics[i]
+		serverID := strconv.FormatUint(uint64(m.serverID), 10)
+		for _, s := range remoteWriteSeries {
+			series = append(series, promread.TimeSeries{
+				Labels: []promread.Label{
+					{Name: "__name__", Value: s.name},
+					{Name: "server", Value: m.serverName},
+					{Name: "server_id", Value: serverID},
+				},
+				Samples: []promread.Sample{{Value: s.value(&m.metric), TimestampMs: m.metric.Time.UnixMilli()}},
+			})
+		}
+	}
+	return promread.EncodeWriteRequest(series)
+}
@@ -0,0 +1,157 @@
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/models"
+
+	"github.com/golang/snappy"
+)
+
+// receiver records the bodies of requests it accepted; the first failures
+// requests are answered with a server error
+type receiver struct {
+	mutex    sync.Mutex
+	failures int
+	headers  []http.Header
+	bodies   []string
+	received chan struct{}
+}
+
+func newReceiver(t *testing.T, failures int) (*receiver, string) {
+	r := &receiver{failures: failures, received: make(chan struct{}, 100)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		if r.failures > 0 {
+			r.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		r.headers = append(r.headers, req.Header.Clone())
+		r.bodies = append(r.bodies, string(body))
+		r.received <- struct{}{}
+	}))
+	t.Cleanup(srv.Close)
+	return r, srv.URL
+}
+
+func (r *receiver) wait(t *testing.T, n int) []string {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of %d requests", i, n)
+		}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.bodies...)
+}
+
+func testForwarder(t *testing.T, url, format string, batchSize int) *Forwarder {
+	f := New(&config.ForwarderConfig{
+		Enabled:       true,
+		Format:        format,
+		URL:           url,
+		Token:         "t0ken",
+		BatchSize:     batchSize,
+		FlushInterval: 60,
+		MaxRetries:    3,
+		QueueSize:     100,
+	})
+	t.Cleanup(func() { f.Close(context.Background()) })
+	return f
+}
+
+func testMetric(cpu float64) *models.Metric {
+	return &models.Metric{Time: time.Unix(1700000000, 0), CPUUsage: cpu}
+}
+
+func TestRetryDoesNotBlockLaterBatches(t *testing.T) {
+	defer func(base time.Duration) { retryBase = base }(retryBase)
+	retryBase = 200 * time.Millisecond
+
+	r, url := newReceiver(t, 1)
+	f := testForwarder(t, url, config.ForwardInfluxDB, 1)
+	server := &models.Server{ID: 1, Name: "web"}
+
+	f.Forward(server, testMetric(11))
+	time.Sleep(50 * time.Millisecond)
+	f.Forward(server, testMetric(22))
+
+	// The second batch goes out while the first waits for its retry
+	bodies := r.wait(t, 2)
+	if !strings.Contains(bodies[0], "cpu_usage=22,") || !strings.Contains(bodies[1], "cpu_usage=11,") {
+		t.Errorf("got bodies %q, want the retried batch last", bodies)
+	}
+}
+
+func TestCloseFlushesQueuedMetrics(t *testing.T) {
+	r, url := newReceiver(t, 0)
+	f := testForwarder(t, url, config.ForwardInfluxDB, 100)
+	server := &models.Server{ID: 1, Name: "web server"}
+
+	for i := 0; i < 3; i++ {
+		f.Forward(server, testMetric(float64(i)))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := f.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := r.wait(t, 1)
+	lines := strings.Split(bodies[0], "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %q", len(lines), bodies[0])
+	}
+	if !strings.HasPrefix(lines[0], `monitaur,server_id=1,server=web\ server cpu_usage=0,`) {
+		t.Errorf("unexpected line %q", lines[0])
+	}
+	if got := r.headers[0].Get("Authorization"); got != "Token t0ken" {
+		t.Errorf("Authorization = %q, want Token t0ken", got)
+	}
+}
+
+func TestPrometheusRemoteWriteHeaders(t *testing.T) {
+	r, url := newReceiver(t, 0)
+	f := testForwarder(t, url, config.ForwardPrometheus, 1)
+
+	f.Forward(&models.Server{ID: 1, Name: "web"}, testMetric(50))
+	bodies := r.wait(t, 1)
+
+	data, err := snappy.Decode(nil, []byte(bodies[0]))
+	if err != nil {
+		t.Fatalf("body is not a snappy block: %v", err)
+	}
+	for _, name := range []string{"monitaur_cpu_usage_percent", "monitaur_uptime_seconds", "server_id"} {
+		if !bytes.Contains(data, []byte(name)) {
+			t.Errorf("write request lacks %q", name)
+		}
+	}
+
+	headers := r.headers[0]
+	for name, want := range map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+		"Authorization":                     "Bearer t0ken",
+	} {
+		if got := headers.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
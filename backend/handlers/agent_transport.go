@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// agentReadTimeout is how long an agent connection may stay silent, pongs
+// included, before it is dropped
+const agentReadTimeout = 60 * time.Second
+
+// agentWriteTimeout bounds every write to an agent
+const agentWriteTimeout = 10 * time.Second
+
+// agentTransport is the connection an agent's messages travel over, a
+// WebSocket or a QUIC stream. Messages are JSON documents either way.
+type agentTransport interface {
+	// ReadMessage returns the next message from the agent
+	ReadMessage() ([]byte, error)
+	// WriteMessage sends a message to the agent
+	WriteMessage(message []byte) error
+	// Ping checks the agent is still there; proof arrives through OnPong
+	Ping() error
+	// OnPong sets the function called whenever the agent proves to be alive
+	OnPong(func())
+	// WriteClose tells the agent the connection is being closed
+	WriteClose()
+	Close() error
+	RemoteAddr() net.Addr
+}
+
+// wsTransport carries agent messages as WebSocket text messages
+type wsTransport struct {
+	conn *websocket.Conn
+}
+
+func (t wsTransport) ReadMessage() ([]byte, error) {
+	_, message, err := t.conn.ReadMessage()
+	return message, err
+}
+
+func (t wsTransport) WriteMessage(message []byte) error {
+	t.conn.SetWriteDeadline(time.Now().Add(agentWriteTimeout))
+	return t.conn.WriteMessage(websocket.TextMessage, message)
+}
+
+func (t wsTransport) Ping() error {
+	t.conn.SetWriteDeadline(time.Now().Add(agentWriteTimeout))
+	return t.conn.WriteMessage(websocket.PingMessage, nil)
+}
+
+// OnPong also sets the read deadline, which every pong extends
+func (t wsTransport) OnPong(pong func()) {
+	t.conn.SetReadDeadline(time.Now().Add(agentReadTimeout))
+	t.conn.SetPongHandler(func(string) error {
+		pong()
+		t.conn.SetReadDeadline(time.Now().Add(agentReadTimeout))
+		return nil
+	})
+}
+
+func (t wsTransport) WriteClose() {
+	t.conn.SetWriteDeadline(time.Now().Add(agentWriteTimeout))
+	t.conn.WriteMessage(websocket.CloseMessage, []byte{})
+}
+
+func (t wsTransport) Close() error {
+	return t.conn.Close()
+}
+
+func (t wsTransport) RemoteAddr() net.Addr {
+	return t.conn.RemoteAddr()
+}
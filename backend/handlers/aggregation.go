@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"time"
+
+	"backend/models"
+)
+
+// Bounds for a server's aggregation_seconds; 0 stores every sample
+const (
+	minAggregationSeconds = 10
+	maxAggregationSeconds = 3600
+)
+
+func validateAggregation(seconds int) error {
+	return validateSeconds("aggregation_seconds", seconds, minAggregationSeconds, maxAggregationSeconds)
+}
+
+// metricAccumulator folds a connection's samples into fixed time buckets.
+// Usage percentages (including per core), load and kernel rates are
+// averaged over the bucket and CPU, memory and disk usage also keep their
+// maximum; everything else, such as totals and cumulative network counters,
+// comes from the bucket's latest sample. It is only used from the
+// connection's read loop.
+type metricAccumulator struct {
+	bucket time.Duration
+	start  time.Time
+
+	count  int
+	latest models.Metric
+
+	cpu, memory, swap, disk, contextSwitches, interrupts float64
+	load1, loadPerCore                                   float64
+	loadSamples                                          int
+	pressureSome, pressureFull                           float64
+	pressureSamples                                      int
+	diskRead, diskWrite                                  float64
+	throughputSamples                                    int
+	networkIn, networkOut                                float64
+	networkSamples                                       int
+	cpuMax, memoryMax, diskMax                           float64
+
+	// Per-core usage sums, kept while every sample reports the same cores
+	perCore        []float64
+	perCoreSamples int
+}
+
+// add folds a sample into its bucket. When the sample starts a new bucket,
+// the aggregate of the previous one is returned for storing.
+func (a *metricAccumulator) add(metric *models.Metric, bucket time.Duration) *models.Metric {
+	start := metric.Time.Truncate(bucket)
+
+	var flushed *models.Metric
+	if a.count > 0 && (start != a.start || bucket != a.bucket) {
+		flushed = a.flush()
+	}
+	if a.count == 0 {
+		a.bucket = bucket
+		a.start = start
+		a.cpuMax, a.memoryMax, a.diskMax = metric.CPUUsage, metric.MemoryPercent, metric.DiskPercent
+	}
+
+	a.count++
+	a.latest = *metric
+	a.cpu += metric.CPUUsage
+	a.memory += metric.MemoryPercent
+	a.swap += metric.SwapPercent
+	a.disk += metric.DiskPercent
+	a.contextSwitches += metric.ContextSwitchRate
+	a.interrupts += metric.InterruptRate
+	if metric.Load1 != nil && metric.LoadPerCore != nil {
+		a.load1 += *metric.Load1
+		a.loadPerCore += *metric.LoadPerCore
+		a.loadSamples++
+	}
+	if metric.NetworkRateIn != nil && metric.NetworkRateOut != nil {
+		a.networkIn += *metric.NetworkRateIn
+		a.networkOut += *metric.NetworkRateOut
+		a.networkSamples++
+	}
+	if metric.DiskReadBytes != nil && metric.DiskWriteBytes != nil {
+		a.diskRead += *metric.DiskReadBytes
+		a.diskWrite += *metric.DiskWriteBytes
+		a.throughputSamples++
+	}
+	if metric.MemoryPressureSome != nil && metric.MemoryPressureFull != nil {
+		a.pressureSome += *metric.MemoryPressureSome
+		a.pressureFull += *metric.MemoryPressureFull
+		a.pressureSamples++
+	}
+	if len(metric.CPUPerCore) > 0 && (a.perCoreSamples == 0 || len(metric.CPUPerCore) == len(a.perCore)) {
+		if a.perCoreSamples == 0 {
+			a.perCore = make([]float64, len(metric.CPUPerCore))
+		}
+		for i, usage := range metric.CPUPerCore {
+			a.perCore[i] += usage
+		}
+		a.perCoreSamples++
+	}
+	a.cpuMax = max(a.cpuMax, metric.CPUUsage)
+	a.memoryMax = max(a.memoryMax, metric.MemoryPercent)
+	a.diskMax = max(a.diskMax, metric.DiskPercent)
+
+	return flushed
+}
+
+// flush returns the aggregate of the pending bucket, stamped with the
+// bucket's start, and resets the accumulator. It returns nil when empty.
+func (a *metricAccumulator) flush() *models.Metric {
+	if a.count == 0 {
+		return nil
+	}
+
+	n := float64(a.count)
+	metric := a.latest
+	metric.ID = 0
+	metric.Time = a.start
+	metric.SampleCount = a.count
+	metric.CPUUsage = a.cpu / n
+	metric.MemoryPercent = a.memory / n
+	metric.SwapPercent = a.swap / n
+	metric.DiskPercent = a.disk / n
+	metric.ContextSwitchRate = a.contextSwitches / n
+	metric.InterruptRate = a.interrupts / n
+	if a.loadSamples > 0 {
+		load1 := a.load1 / float64(a.loadSamples)
+		loadPerCore := a.loadPerCore / float64(a.loadSamples)
+		metric.Load1 = &load1
+		metric.LoadPerCore = &loadPerCore
+	}
+	if a.networkSamples > 0 {
+		in := a.networkIn / float64(a.networkSamples)
+		out := a.networkOut / float64(a.networkSamples)
+		metric.NetworkRateIn = &in
+		metric.NetworkRateOut = &out
+	}
+	if a.throughputSamples > 0 {
+		read := a.diskRead / float64(a.throughputSamples)
+		write := a.diskWrite / float64(a.throughputSamples)
+		metric.DiskReadBytes = &read
+		metric.DiskWriteBytes = &write
+	}
+	if a.pressureSamples > 0 {
+		some := a.pressureSome / float64(a.pressureSamples)
+		full := a.pressureFull / float64(a.pressureSamples)
+		metric.MemoryPressureSome = &some
+		metric.MemoryPressureFull = &full
+	}
+	if a.perCoreSamples > 0 {
+		perCore := make(models.FloatList, len(a.perCore))
+		for i, sum := range a.perCore {
+			perCore[i] = sum / float64(a.perCoreSamples)
+		}
+		metric.CPUPerCore = perCore
+	}
+	cpuMax, memoryMax, diskMax := a.cpuMax, a.memoryMax, a.diskMax
+	metric.CPUUsageMax = &cpuMax
+	metric.MemoryPercentMax = &memoryMax
+	metric.DiskPercentMax = &diskMax
+
+	*a = metricAccumulator{}
+	return &metric
+}
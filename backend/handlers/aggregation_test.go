@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"backend/models"
+)
+
+func TestValidateAggregation(t *testing.T) {
+	tests := []struct {
+		seconds int
+		ok      bool
+	}{
+		{0, true},
+		{minAggregationSeconds, true},
+		{maxAggregationSeconds, true},
+		{-10, false},
+		{minAggregationSeconds - 1, false},
+		{maxAggregationSeconds + 1, false},
+	}
+	for _, test := range tests {
+		if err := validateAggregation(test.seconds); (err == nil) != test.ok {
+			t.Errorf("validateAggregation(%d) = %v, want ok %v", test.seconds, err, test.ok)
+		}
+	}
+}
+
+func TestMetricAccumulatorBucketBoundaries(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		next    time.Time
+		bucket  time.Duration
+		flushed bool
+	}{
+		{"same bucket", start.Add(59 * time.Second), time.Minute, false},
+		{"last instant of the bucket", start.Add(time.Minute - time.Nanosecond), time.Minute, false},
+		{"start of the next bucket", start.Add(time.Minute), time.Minute, true},
+		{"bucket width changed", start.Add(time.Second), 30 * time.Second, true},
+	}
+	for _, test := range tests {
+		var a metricAccumulator
+		if flushed := a.add(&models.Metric{Time: start, CPUUsage: 10}, time.Minute); flushed != nil {
+			t.Fatalf("%s: first sample flushed a bucket", test.name)
+		}
+		flushed := a.add(&models.Metric{Time: test.next, CPUUsage: 30}, test.bucket)
+		if (flushed != nil) != test.flushed {
+			t.Errorf("%s: flushed = %v, want %v", test.name, flushed != nil, test.flushed)
+			continue
+		}
+		if flushed != nil && (!flushed.Time.Equal(start) || flushed.SampleCount != 1 || flushed.CPUUsage != 10) {
+			t.Errorf("%s: flushed %s with %d samples, CPU %v; want the first bucket alone",
+				test.name, flushed.Time, flushed.SampleCount, flushed.CPUUsage)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func alertFilterContext(query string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/alerts?"+query, nil)
+	return c
+}
+
+func TestParseAlertFilter(t *testing.T) {
+	filter, err := parseAlertFilter(alertFilterContext(
+		"type=cpu&level=critical&resolved=false&from=2026-10-01T00:00:00Z&to=2026-10-08T00:00:00Z&label=mount:/data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Type != "cpu" || filter.Level != "critical" || filter.Resolved == nil || *filter.Resolved {
+		t.Errorf("unexpected filter %+v", filter)
+	}
+	if filter.From.Day() != 1 || filter.To.Day() != 8 || filter.Labels["mount"] != "/data" {
+		t.Errorf("unexpected range or labels %+v", filter)
+	}
+
+	empty, err := parseAlertFilter(alertFilterContext(""))
+	if err != nil || empty.Type != "" || empty.Level != "" || empty.Resolved != nil || !empty.From.IsZero() {
+		t.Errorf("empty query gave %+v, %v", empty, err)
+	}
+}
+
+func TestParseAlertFilterRejectsInvalidValues(t *testing.T) {
+	for _, query := range []string{
+		"level=info",
+		"resolved=yes",
+		"type=Bad-Type",
+		"type=cpu_usage",
+		"from=yesterday",
+		"from=2026-10-08T00:00:00Z&to=2026-10-01T00:00:00Z",
+		"label=mount",
+	} {
+		if _, err := parseAlertFilter(alertFilterContext(query)); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
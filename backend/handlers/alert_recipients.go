@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backend/apierror"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAlertRecipients caps the extra recipients of a server's alerts
+const maxAlertRecipients = 50
+
+// GetAlertRecipients lists the extra recipients of a server's alert emails
+func (h *APIHandler) GetAlertRecipients(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	recipients, err := h.db.GetAlertRecipients(server.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get alert recipients")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recipients": recipients})
+}
+
+// AddAlertRecipient adds an address to a server's alert emails
+func (h *APIHandler) AddAlertRecipient(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	emails, err := normalizeEmails([]string{req.Email})
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+	email := emails[0]
+
+	existing, err := h.db.GetAlertRecipients(server.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get alert recipients")
+		return
+	}
+	for _, recipient := range existing {
+		if strings.EqualFold(recipient.Email, email) {
+			apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "Email already receives this server's alerts")
+			return
+		}
+	}
+	if len(existing) >= maxAlertRecipients {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Too many alert recipients")
+		return
+	}
+
+	recipient := &models.AlertRecipient{ServerID: server.ID, Email: email}
+	if err := h.db.CreateAlertRecipient(recipient); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to add alert recipient")
+		return
+	}
+
+	c.JSON(http.StatusCreated, recipient)
+}
+
+// RemoveAlertRecipient removes an address from a server's alert emails
+func (h *APIHandler) RemoveAlertRecipient(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	recipientID, err := strconv.ParseUint(c.Param("recipient_id"), 10, 32)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid recipient ID")
+		return
+	}
+
+	removed, err := h.db.DeleteAlertRecipient(uint(recipientID), server.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to remove alert recipient")
+		return
+	}
+	if !removed {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Alert recipient not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alert recipient removed successfully"})
+}
+
+// validateRecipients normalizes a full list of alert recipients, as set
+// through notification_emails
+func validateRecipients(emails []string) (models.StringList, error) {
+	recipients, err := normalizeEmails(emails)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) > maxAlertRecipients {
+		return nil, fmt.Errorf("at most %d alert recipients are allowed", maxAlertRecipients)
+	}
+	return recipients, nil
+}
+
+// mergeRecipients appends the extra recipients to the base addresses,
+// dropping addresses that differ only in case
+func mergeRecipients(base []string, extra []models.AlertRecipient) []string {
+	seen := make(map[string]bool, len(base)+len(extra))
+	merged := make([]string, 0, len(base)+len(extra))
+	add := func(email string) {
+		key := strings.ToLower(email)
+		if email == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		merged = append(merged, email)
+	}
+
+	for _, email := range base {
+		add(email)
+	}
+	for _, recipient := range extra {
+		add(recipient.Email)
+	}
+	return merged
+}
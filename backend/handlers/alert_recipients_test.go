@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"backend/models"
+)
+
+func TestMergeRecipients(t *testing.T) {
+	got := mergeRecipients(
+		[]string{"owner@example.com"},
+		[]models.AlertRecipient{
+			{Email: "ops@example.com"},
+			{Email: "Owner@Example.com"},
+			{Email: "oncall@example.com"},
+			{Email: "OPS@example.com"},
+		},
+	)
+	want := []string{"owner@example.com", "ops@example.com", "oncall@example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeRecipients = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"backend/models"
+)
+
+// recoveryValue returns the current value of the metric an alert was raised
+// on, read from a sample, or false when the alert type isn't recovered from
+// metrics or the sample doesn't carry it
+func recoveryValue(alert *models.Alert, metricData *models.MetricData) (float64, bool) {
+	switch alert.Type {
+	case "cpu":
+		return metricData.CPU.Usage, true
+	case "memory":
+		return metricData.Memory.UsedPercent, true
+	case "swap":
+		return metricData.Swap.UsedPercent, true
+	case "load":
+		if metricData.Load == nil {
+			return 0, false
+		}
+		return metricData.Load.LoadPerCore, true
+	case "disk":
+		// Disk alerts of agents watching several mounts name their mount
+		mount, ok := alert.Labels["mount"]
+		if !ok {
+			return metricData.Disk.UsedPercent, true
+		}
+		for _, disk := range metricData.Disks {
+			if disk.Path == mount {
+				return disk.UsedPercent, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// resolveRecoveredAlerts resolves the server's open threshold alerts whose
+// metric is back under the alert's threshold in this sample, and notifies
+// their recovery. Open alerts are only looked up while the connection may
+// have some, so healthy servers don't cost a query per sample. server is
+// the server's current row.
+func (h *WebSocketHandler) resolveRecoveredAlerts(agentConn *AgentConnection, server *models.Server, metricData *models.MetricData) {
+	if agentConn.noOpenAlerts {
+		return
+	}
+
+	alerts, err := h.db.GetUnresolvedAlerts(agentConn.server.ID)
+	if err != nil {
+		log.Printf("Error loading open alerts of %s: %v", agentConn.server.Name, err)
+		return
+	}
+
+	var recovered []models.Alert
+	pending := false
+	for _, alert := range alerts {
+		if alert.Test || alert.Threshold == 0 {
+			continue
+		}
+		value, ok := recoveryValue(&alert, metricData)
+		if !ok {
+			continue
+		}
+		if value >= alert.Threshold {
+			pending = true
+			continue
+		}
+		alert.Value = value
+		recovered = append(recovered, alert)
+	}
+	agentConn.noOpenAlerts = !pending
+
+	if len(recovered) == 0 {
+		return
+	}
+	ids := make([]uint, len(recovered))
+	for i := range recovered {
+		ids[i] = recovered[i].ID
+	}
+	if _, err := h.db.ResolveAlerts(ids); err != nil {
+		log.Printf("Error resolving recovered alerts of %s: %v", agentConn.server.Name, err)
+		agentConn.noOpenAlerts = false
+		return
+	}
+	h.InvalidateDashboard(agentConn.server.UserID)
+
+	now := time.Now()
+	for i := range recovered {
+		alert := &recovered[i]
+		alert.Resolved = true
+		alert.ResolvedAt = &now
+		alert.Message = fmt.Sprintf("%s recovered: now %s, below the threshold of %s",
+			alert.Type, formatAlertValue(alert.Type, alert.Value), formatAlertValue(alert.Type, alert.Threshold))
+
+		log.Printf("Resolved %s alert %d of %s: %s", alert.Type, alert.ID, agentConn.server.Name, alert.Message)
+		if !server.MaintenanceMode {
+			go h.dispatchAlert(server, alert)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"testing"
+
+	"backend/models"
+)
+
+func TestRecoveryValue(t *testing.T) {
+	var sample models.MetricData
+	sample.CPU.Usage = 42
+	sample.Disk.UsedPercent = 70
+	sample.Disks = models.DiskUsageList{{Path: "/"}, {Path: "/data", UsedPercent: 55}}
+
+	tests := []struct {
+		alert models.Alert
+		value float64
+		ok    bool
+	}{
+		{models.Alert{Type: "cpu"}, 42, true},
+		{models.Alert{Type: "disk"}, 70, true},
+		{models.Alert{Type: "disk", Labels: models.Dimensions{"mount": "/data"}}, 55, true},
+		{models.Alert{Type: "disk", Labels: models.Dimensions{"mount": "/missing"}}, 0, false},
+		{models.Alert{Type: "load"}, 0, false},
+		{models.Alert{Type: "port_down"}, 0, false},
+	}
+	for _, test := range tests {
+		value, ok := recoveryValue(&test.alert, &sample)
+		if value != test.value || ok != test.ok {
+			t.Errorf("recoveryValue(%s %v) = %v, %v; want %v, %v",
+				test.alert.Type, test.alert.Labels, value, ok, test.value, test.ok)
+		}
+	}
+}
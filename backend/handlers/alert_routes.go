@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"backend/apierror"
+	"backend/auth"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// alertRouteRequest is the body accepted when creating or replacing a route
+type alertRouteRequest struct {
+	Position int               `json:"position"`
+	ServerID *uint             `json:"server_id"`
+	Type     string            `json:"type"`
+	Level    string            `json:"level"`
+	Channels []string          `json:"channels"`
+	Labels   map[string]string `json:"labels"`
+	Enabled  *bool             `json:"enabled"`
+}
+
+// maxAlertLabels bounds the labels of an alert or alert route
+const maxAlertLabels = 10
+
+// validateAlertLabels checks label keys and values with the same rules as
+// custom metric dimensions
+func validateAlertLabels(labels map[string]string) error {
+	if len(labels) > maxAlertLabels {
+		return fmt.Errorf("more than %d labels", maxAlertLabels)
+	}
+	for key, value := range labels {
+		if len(key) > maxCustomMetricLabel || !customMetricNamePattern.MatchString(key) {
+			return fmt.Errorf("invalid label %q", key)
+		}
+		if len(value) > maxCustomMetricLabel {
+			return fmt.Errorf("label %q value too long", key)
+		}
+	}
+	return nil
+}
+
+// GetAlertRoutes lists the current user's alert routing rules
+func (h *APIHandler) GetAlertRoutes(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	routes, err := h.db.GetUserAlertRoutes(user.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get alert routes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"routes":           routes,
+		"default_channels": h.ws.DefaultAlertChannels(),
+		"channels":         h.ws.SupportedAlertChannels(),
+	})
+}
+
+// CreateAlertRoute adds an alert routing rule
+func (h *APIHandler) CreateAlertRoute(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	route := &models.AlertRoute{UserID: user.ID}
+	if !h.bindAlertRoute(c, user, route) {
+		return
+	}
+
+	if err := h.db.CreateAlertRoute(route); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to create alert route")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"route": route})
+}
+
+// UpdateAlertRoute replaces an alert routing rule
+func (h *APIHandler) UpdateAlertRoute(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	route, ok := h.ownedAlertRoute(c, user)
+	if !ok {
+		return
+	}
+
+	if !h.bindAlertRoute(c, user, route) {
+		return
+	}
+
+	if err := h.db.SaveAlertRoute(route); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update alert route")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"route": route})
+}
+
+// DeleteAlertRoute removes an alert routing rule
+func (h *APIHandler) DeleteAlertRoute(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	route, ok := h.ownedAlertRoute(c, user)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteAlertRoute(route.ID, user.ID); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to delete alert route")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alert route deleted successfully"})
+}
+
+// currentUser loads the authenticated user, writing the error response if that fails
+func (h *APIHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	userClaims, exists := auth.GetUserFromContext(c)
+	if !exists {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
+		return nil, false
+	}
+
+	user, err := h.db.GetUserByUID(userClaims.UID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to load user")
+		return nil, false
+	}
+	return user, true
+}
+
+// ownedAlertRoute resolves the :id route param to one of the user's alert routes
+func (h *APIHandler) ownedAlertRoute(c *gin.Context, user *models.User) (*models.AlertRoute, bool) {
+	routeID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid alert route ID")
+		return nil, false
+	}
+
+	route, err := h.db.GetAlertRoute(uint(routeID), user.ID)
+	if err == gorm.ErrRecordNotFound {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Alert route not found")
+		return nil, false
+	} else if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Database error")
+		return nil, false
+	}
+	return route, true
+}
+
+// bindAlertRoute validates the request body and copies it onto route
+func (h *APIHandler) bindAlertRoute(c *gin.Context, user *models.User, route *models.AlertRoute) bool {
+	var req alertRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body", err.Error())
+		return false
+	}
+
+	if err := h.validateAlertRoute(req, user); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return false
+	}
+
+	route.Position = req.Position
+	route.ServerID = req.ServerID
+	route.Type = req.Type
+	route.Level = req.Level
+	route.Channels = models.StringList(req.Channels)
+	route.Labels = models.Dimensions(req.Labels)
+	route.Enabled = req.Enabled == nil || *req.Enabled
+	return true
+}
+
+func (h *APIHandler) validateAlertRoute(req alertRouteRequest, user *models.User) error {
+	if req.Level != "" && req.Level != "warning" && req.Level != "critical" {
+		return fmt.Errorf("level must be empty, 'warning' or 'critical'")
+	}
+
+	supported := make(map[string]bool)
+	for _, channel := range h.ws.SupportedAlertChannels() {
+		supported[channel] = true
+	}
+	for _, channel := range req.Channels {
+		if !supported[channel] {
+			return fmt.Errorf("unsupported channel %q", channel)
+		}
+	}
+
+	if err := validateAlertLabels(req.Labels); err != nil {
+		return err
+	}
+
+	if req.ServerID != nil {
+		server, err := h.db.GetServerByID(*req.ServerID)
+		if err != nil || server.UserID != user.ID {
+			return fmt.Errorf("server %d not found", *req.ServerID)
+		}
+	}
+
+	return nil
+}
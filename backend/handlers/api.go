@@ -1,10 +1,16 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/mail"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
+	"backend/apierror"
 	"backend/auth"
 	"backend/database"
 	"backend/models"
@@ -32,13 +38,13 @@ func NewAPIHandler(db *database.Database, firebaseAuth *auth.FirebaseAuth, ws *W
 func (h *APIHandler) GetUserProfile(c *gin.Context) {
 	userClaims, exists := auth.GetUserFromContext(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
 		return
 	}
 
 	user, err := h.db.GetOrCreateUser(userClaims.UID, userClaims.Email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user profile"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get user profile")
 		return
 	}
 
@@ -49,18 +55,21 @@ func (h *APIHandler) GetUserProfile(c *gin.Context) {
 func (h *APIHandler) GetUserServers(c *gin.Context) {
 	userClaims, exists := auth.GetUserFromContext(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
 		return
 	}
 
 	servers, err := h.db.GetUserServers(userClaims.UID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get servers"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get servers")
 		return
 	}
 
 	// Add connection status
 	for i := range servers {
+		if servers[i].MaintenanceMode {
+			continue
+		}
 		servers[i].Status = "offline"
 		if h.ws.IsAgentConnected(servers[i].ID) {
 			servers[i].Status = "online"
@@ -74,7 +83,7 @@ func (h *APIHandler) GetUserServers(c *gin.Context) {
 func (h *APIHandler) CreateServer(c *gin.Context) {
 	userClaims, exists := auth.GetUserFromContext(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
 		return
 	}
 
@@ -83,14 +92,18 @@ func (h *APIHandler) CreateServer(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body", err.Error())
 		return
 	}
 
 	// Get or create user to get the internal ID
 	user, err := h.db.GetOrCreateUser(userClaims.UID, userClaims.Email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get user")
+		return
+	}
+
+	if !h.checkServerQuota(c, user) {
 		return
 	}
 
@@ -105,9 +118,10 @@ func (h *APIHandler) CreateServer(c *gin.Context) {
 	}
 
 	if err := h.db.CreateServer(server); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create server"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to create server")
 		return
 	}
+	h.ws.InvalidateDashboard(user.ID)
 
 	c.JSON(http.StatusCreated, gin.H{"server": server})
 }
@@ -116,20 +130,20 @@ func (h *APIHandler) CreateServer(c *gin.Context) {
 func (h *APIHandler) DeleteServer(c *gin.Context) {
 	userClaims, exists := auth.GetUserFromContext(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
 		return
 	}
 
 	serverID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid server ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid server ID")
 		return
 	}
 
 	// Get user to get internal ID
 	user, err := h.db.GetUserByUID(userClaims.UID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to load user")
 		return
 	}
 
@@ -137,53 +151,323 @@ func (h *APIHandler) DeleteServer(c *gin.Context) {
 	var server models.Server
 	err = h.db.DB.Where("id = ? AND user_id = ?", serverID, user.ID).First(&server).Error
 	if err == gorm.ErrRecordNotFound {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Server not found")
 		return
 	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Database error")
 		return
 	}
 
 	// Delete server and related data
-	tx := h.db.DB.Begin()
-	if err := tx.Where("server_id = ?", serverID).Delete(&models.Metric{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete metrics"})
+	if err := h.db.DeleteServer(&server); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to delete server")
 		return
 	}
-	if err := tx.Where("server_id = ?", serverID).Delete(&models.Alert{}).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete alerts"})
+	h.ws.logs.remove(server.ID)
+	h.ws.statuses.forget(server.ID)
+	h.ws.InvalidateDashboard(user.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Server deleted successfully"})
+}
+
+// RegenerateServerToken replaces a server's agent token, e.g. after it
+// leaked. The agent must be reconfigured with the new token.
+func (h *APIHandler) RegenerateServerToken(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
 		return
 	}
-	if err := tx.Delete(&server).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete server"})
+
+	token := uuid.New().String()
+	if err := h.db.UpdateServer(server.ID, map[string]interface{}{"token": token}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
 		return
 	}
-	tx.Commit()
+	server.Token = token
 
-	c.JSON(http.StatusOK, gin.H{"message": "Server deleted successfully"})
+	// Drop the agent connected with the old token; it can't reconnect with it
+	h.ws.DisconnectAgent(server.ID)
+	h.ws.InvalidateDashboard(server.UserID)
+
+	c.JSON(http.StatusOK, gin.H{"server": server})
 }
 
+// UpdateServer updates editable settings of a server
+func (h *APIHandler) UpdateServer(c *gin.Context) {
+	userClaims, exists := auth.GetUserFromContext(c)
+	if !exists {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
+		return
+	}
+
+	serverID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid server ID")
+		return
+	}
+
+	var req struct {
+		Name               *string               `json:"name"`
+		NotificationEmails *[]string             `json:"notification_emails"`
+		NameLocked         *bool                 `json:"name_locked"`
+		EmailBranding      *models.EmailBranding `json:"email_branding"`
+		AggregationSeconds *int                  `json:"aggregation_seconds"`
+		ResolutionSeconds  *int                  `json:"resolution_seconds"`
+
+		// Transitions that raise a status_change alert; null restores the defaults
+		StatusNotifications optionalStringList `json:"status_notifications"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Get user to get internal ID
+	user, err := h.db.GetUserByUID(userClaims.UID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to load user")
+		return
+	}
+
+	// Check if server belongs to user
+	var server models.Server
+	err = h.db.DB.Where("id = ? AND user_id = ?", serverID, user.ID).First(&server).Error
+	if err == gorm.ErrRecordNotFound {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Server not found")
+		return
+	} else if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Database error")
+		return
+	}
+
+	updates := map[string]interface{}{}
+
+	// notification_emails replaces the server's alert recipients
+	var recipients models.StringList
+	if req.NotificationEmails != nil {
+		recipients, err = validateRecipients(*req.NotificationEmails)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+			return
+		}
+	}
+
+	// A name set here locks it, so the agent's server_name doesn't overwrite
+	// it on the next reconnect, unless the request unlocks it explicitly
+	if req.Name != nil {
+		name, err := sanitizeServerName(*req.Name)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+			return
+		}
+		updates["name"] = name
+		updates["name_locked"] = true
+	}
+
+	if req.NameLocked != nil {
+		updates["name_locked"] = *req.NameLocked
+	}
+
+	if seconds := req.AggregationSeconds; seconds != nil {
+		if err := validateAggregation(*seconds); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+			return
+		}
+		updates["aggregation_seconds"] = *seconds
+	}
+
+	if seconds := req.ResolutionSeconds; seconds != nil {
+		if err := validateResolution(*seconds); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+			return
+		}
+		updates["resolution_seconds"] = *seconds
+	}
+
+	if req.StatusNotifications.Set {
+		if req.StatusNotifications.Value == nil {
+			updates["status_notifications"] = gorm.Expr("NULL")
+		} else {
+			if err := validateStatusNotifications(*req.StatusNotifications.Value); err != nil {
+				apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+				return
+			}
+			updates["status_notifications"] = *req.StatusNotifications.Value
+		}
+	}
+
+	if req.EmailBranding != nil {
+		branding, err := validateEmailBranding(*req.EmailBranding, h.ws.config.SMTP)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+			return
+		}
+		addEmailBrandingUpdates(updates, branding)
+	}
+
+	if len(updates) > 0 {
+		if err := h.db.UpdateServer(server.ID, updates); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
+			return
+		}
+		h.ws.InvalidateDashboard(user.ID)
+	}
+
+	if req.NotificationEmails != nil {
+		if err := h.db.ReplaceAlertRecipients(server.ID, recipients); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update alert recipients")
+			return
+		}
+	}
+
+	updated, err := h.db.GetServerByID(server.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Database error")
+		return
+	}
+
+	if updated.ResolutionSeconds != server.ResolutionSeconds {
+		h.ws.pushCollectionInterval(server.ID, updated.ResolutionSeconds)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"server": updated})
+}
+
+// PauseIngestion stops storing metrics for a server while keeping the agent connected
+func (h *APIHandler) PauseIngestion(c *gin.Context) {
+	h.setIngestionPaused(c, true)
+}
+
+// ResumeIngestion resumes storing metrics for a server
+func (h *APIHandler) ResumeIngestion(c *gin.Context) {
+	h.setIngestionPaused(c, false)
+}
+
+func (h *APIHandler) setIngestionPaused(c *gin.Context, paused bool) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.SetIngestionPaused(server.ID, paused); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":        server.ID,
+		"paused_ingestion": paused,
+	})
+}
+
+// EnableMaintenance marks a server as down for maintenance: its status stays
+// "maintenance" while the agent keeps sending metrics, and agent alerts are
+// suppressed
+func (h *APIHandler) EnableMaintenance(c *gin.Context) {
+	h.setMaintenanceMode(c, true)
+}
+
+// DisableMaintenance ends maintenance, restoring the live status
+func (h *APIHandler) DisableMaintenance(c *gin.Context) {
+	h.setMaintenanceMode(c, false)
+}
+
+func (h *APIHandler) setMaintenanceMode(c *gin.Context, enabled bool) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.SetMaintenanceMode(server.ID, enabled, h.ws.IsAgentConnected(server.ID)); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
+		return
+	}
+	h.ws.InvalidateDashboard(server.UserID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":        server.ID,
+		"maintenance_mode": enabled,
+	})
+}
+
+// DisableServer stops accepting data from a server's agent, closing any
+// live connection. The server and its history are kept.
+func (h *APIHandler) DisableServer(c *gin.Context) {
+	h.setServerDisabled(c, true)
+}
+
+// EnableServer allows a disabled server's agent to connect again
+func (h *APIHandler) EnableServer(c *gin.Context) {
+	h.setServerDisabled(c, false)
+}
+
+func (h *APIHandler) setServerDisabled(c *gin.Context, disabled bool) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.UpdateServer(server.ID, map[string]interface{}{"disabled": disabled}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
+		return
+	}
+
+	if disabled {
+		h.ws.DisconnectAgent(server.ID)
+	}
+	h.ws.InvalidateDashboard(server.UserID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id": server.ID,
+		"disabled":  disabled,
+	})
+}
+
+// GetAgentConfig returns the effective configuration last reported by a
+// server's agent
+func (h *APIHandler) GetAgentConfig(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	if server.AgentConfig == nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Agent has not reported its configuration yet")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":   server.ID,
+		"reported_at": server.AgentConfigReportedAt,
+		"config":      json.RawMessage(*server.AgentConfig),
+	})
+}
+
+// Page sizes of the server metrics API
+const (
+	defaultMetricsPageSize = 500
+	maxMetricsPageSize     = 5000
+)
+
 // GetServerMetrics returns metrics for a specific server
 func (h *APIHandler) GetServerMetrics(c *gin.Context) {
 	userClaims, exists := auth.GetUserFromContext(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
 		return
 	}
 
 	serverID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid server ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid server ID")
 		return
 	}
 
 	// Get user to get internal ID
 	user, err := h.db.GetUserByUID(userClaims.UID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to load user")
 		return
 	}
 
@@ -191,10 +475,10 @@ func (h *APIHandler) GetServerMetrics(c *gin.Context) {
 	var server models.Server
 	err = h.db.DB.Where("id = ? AND user_id = ?", serverID, user.ID).First(&server).Error
 	if err == gorm.ErrRecordNotFound {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Server not found")
 		return
 	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Database error")
 		return
 	}
 
@@ -205,17 +489,154 @@ func (h *APIHandler) GetServerMetrics(c *gin.Context) {
 		hours = 24
 	}
 
-	since := time.Now().Add(-time.Duration(hours) * time.Hour)
-	metrics, err := h.db.GetServerMetrics(uint(serverID), since)
+	since, until, err := parseMetricsRange(c, hours)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get metrics"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
 		return
 	}
 
+	// Without any paging parameter the whole window is returned, as the
+	// dashboard charts expect
+	if c.Query("limit") == "" && c.Query("offset") == "" && c.Query("before") == "" {
+		metrics, err := h.db.GetServerMetricsBetween(uint(serverID), since, until)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get metrics")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"server":  server,
+			"metrics": metrics,
+			"since":   since,
+			"until":   until,
+		})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultMetricsPageSize)))
+	if err != nil || limit < 1 {
+		limit = defaultMetricsPageSize
+	}
+	if limit > maxMetricsPageSize {
+		limit = maxMetricsPageSize
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	// before pages by cursor: only metrics older than the last one seen
+	rangeEnd := until
+	if beforeParam := c.Query("before"); beforeParam != "" {
+		before, err := time.Parse(time.RFC3339Nano, beforeParam)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid 'before' timestamp, expected RFC3339")
+			return
+		}
+		if before.Before(rangeEnd) {
+			rangeEnd = before
+		}
+	}
+
+	metrics, total, err := h.db.GetServerMetricsPage(uint(serverID), since, rangeEnd, limit, offset)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get metrics")
+		return
+	}
+
+	hasMore := int64(offset+len(metrics)) < total
+	pagination := gin.H{
+		"limit":    limit,
+		"offset":   offset,
+		"has_more": hasMore,
+	}
+	if hasMore && len(metrics) > 0 {
+		pagination["next_before"] = metrics[len(metrics)-1].Time
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"server":  server,
-		"metrics": metrics,
-		"since":   since,
+		"server":     server,
+		"metrics":    metrics,
+		"total":      total,
+		"pagination": pagination,
+		"since":      since,
+		"until":      until,
+	})
+}
+
+// GetLatestServerMetrics returns the latest metric for each of the user's servers
+func (h *APIHandler) GetLatestServerMetrics(c *gin.Context) {
+	userClaims, exists := auth.GetUserFromContext(c)
+	if !exists {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
+		return
+	}
+
+	user, err := h.db.GetUserByUID(userClaims.UID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to load user")
+		return
+	}
+
+	latest, err := h.db.GetLatestMetricsForUser(user.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get metrics")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"metrics": latest})
+}
+
+// AcknowledgeServerAlerts acknowledges all open alerts of a server at once,
+// muting them while someone works on the incident
+func (h *APIHandler) AcknowledgeServerAlerts(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	count, err := h.db.AcknowledgeServerAlerts(server.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to acknowledge alerts")
+		return
+	}
+	h.ws.InvalidateDashboard(server.UserID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Alerts acknowledged successfully",
+		"acknowledged": count,
+	})
+}
+
+// DeleteServerAlerts deletes a server's resolved alerts created before the
+// `before` timestamp. Only resolved alerts can be deleted, so the request must
+// say so with resolved=true.
+func (h *APIHandler) DeleteServerAlerts(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	if c.Query("resolved") != "true" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Only resolved alerts can be deleted; pass resolved=true")
+		return
+	}
+	before, err := time.Parse(time.RFC3339, c.Query("before"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "before must be an RFC3339 timestamp")
+		return
+	}
+
+	count, err := h.db.DeleteResolvedAlerts(server.ID, before)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to delete alerts")
+		return
+	}
+	h.ws.InvalidateDashboard(server.UserID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Alerts deleted successfully",
+		"deleted": count,
 	})
 }
 
@@ -223,20 +644,20 @@ func (h *APIHandler) GetServerMetrics(c *gin.Context) {
 func (h *APIHandler) GetServerAlerts(c *gin.Context) {
 	userClaims, exists := auth.GetUserFromContext(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
 		return
 	}
 
 	serverID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid server ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid server ID")
 		return
 	}
 
 	// Get user to get internal ID
 	user, err := h.db.GetUserByUID(userClaims.UID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to load user")
 		return
 	}
 
@@ -244,10 +665,10 @@ func (h *APIHandler) GetServerAlerts(c *gin.Context) {
 	var server models.Server
 	err = h.db.DB.Where("id = ? AND user_id = ?", serverID, user.ID).First(&server).Error
 	if err == gorm.ErrRecordNotFound {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Server not found")
 		return
 	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Database error")
 		return
 	}
 
@@ -257,36 +678,138 @@ func (h *APIHandler) GetServerAlerts(c *gin.Context) {
 		limit = 50
 	}
 
-	alerts, err := h.db.GetServerAlerts(uint(serverID), limit)
+	filter, err := parseAlertFilter(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	alerts, err := h.db.FilterServerAlerts(uint(serverID), filter, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get alerts"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get alerts")
 		return
 	}
 
+	// Echo the filters in effect so the UI can reflect them
+	filters := gin.H{}
+	if filter.Type != "" {
+		filters["type"] = filter.Type
+	}
+	if filter.Level != "" {
+		filters["level"] = filter.Level
+	}
+	if filter.Resolved != nil {
+		filters["resolved"] = *filter.Resolved
+	}
+	if !filter.From.IsZero() {
+		filters["from"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		filters["to"] = filter.To
+	}
+	if len(filter.Labels) > 0 {
+		filters["labels"] = filter.Labels
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"server": server,
-		"alerts": alerts,
+		"server":  server,
+		"alerts":  alerts,
+		"limit":   limit,
+		"filters": filters,
 	})
 }
 
+// alertTypes are the alert types the agent's collector raises, plus the ones
+// the backend raises itself and the default of test alerts
+var alertTypes = map[string]bool{
+	"cpu":             true,
+	"load":            true,
+	"swap":            true,
+	"memory":          true,
+	"disk":            true,
+	"clock_drift":     true,
+	"disk_latency":    true,
+	"memory_pressure": true,
+	"port_down":       true,
+	"offline":         true,
+	"status_change":   true,
+	"test":            true,
+}
+
+// parseAlertFilter reads the type, level, resolved, from, to and repeated
+// label=key:value query filters of the alerts API
+func parseAlertFilter(c *gin.Context) (database.AlertFilter, error) {
+	var filter database.AlertFilter
+
+	if alertType := c.Query("type"); alertType != "" {
+		if !alertTypes[alertType] {
+			return filter, fmt.Errorf("unknown alert type %q", alertType)
+		}
+		filter.Type = alertType
+	}
+
+	switch level := c.Query("level"); level {
+	case "", "warning", "critical":
+		filter.Level = level
+	default:
+		return filter, fmt.Errorf("level must be 'warning' or 'critical'")
+	}
+
+	switch resolved := c.Query("resolved"); resolved {
+	case "":
+	case "true", "false":
+		value := resolved == "true"
+		filter.Resolved = &value
+	default:
+		return filter, fmt.Errorf("resolved must be 'true' or 'false'")
+	}
+
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if param := c.Query(name); param != "" {
+			parsed, err := time.Parse(time.RFC3339, param)
+			if err != nil {
+				return filter, fmt.Errorf("invalid '%s' timestamp, expected RFC3339", name)
+			}
+			*target = parsed
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("'from' must be before 'to'")
+	}
+
+	// Alerts must carry all of the labels
+	for _, param := range c.QueryArray("label") {
+		key, value, found := strings.Cut(param, ":")
+		if !found || key == "" {
+			return filter, fmt.Errorf("label filters must be key:value")
+		}
+		if filter.Labels == nil {
+			filter.Labels = models.Dimensions{}
+		}
+		filter.Labels[key] = value
+	}
+
+	return filter, nil
+}
+
 // ResolveAlert marks an alert as resolved
 func (h *APIHandler) ResolveAlert(c *gin.Context) {
 	userClaims, exists := auth.GetUserFromContext(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
 		return
 	}
 
 	alertID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid alert ID")
 		return
 	}
 
 	// Get user to get internal ID
 	user, err := h.db.GetUserByUID(userClaims.UID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to load user")
 		return
 	}
 
@@ -296,17 +819,18 @@ func (h *APIHandler) ResolveAlert(c *gin.Context) {
 		Where("alerts.id = ? AND servers.user_id = ?", alertID, user.ID).
 		First(&alert).Error
 	if err == gorm.ErrRecordNotFound {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Alert not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Alert not found")
 		return
 	} else if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Database error")
 		return
 	}
 
 	if err := h.db.ResolveAlert(uint(alertID)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve alert"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to resolve alert")
 		return
 	}
+	h.ws.InvalidateDashboard(user.ID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Alert resolved successfully"})
 }
@@ -319,11 +843,94 @@ func (h *APIHandler) GetDashboardData(c *gin.Context) {
 	dashboardHandler.GetDashboardData(c)
 }
 
+// ownedServer resolves the :id route param to a server owned by the current
+// user, writing the error response and returning false if that fails
+func (h *APIHandler) ownedServer(c *gin.Context) (*models.Server, bool) {
+	userClaims, exists := auth.GetUserFromContext(c)
+	if !exists {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
+		return nil, false
+	}
+
+	serverID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid server ID")
+		return nil, false
+	}
+
+	// Get user to get internal ID
+	user, err := h.db.GetUserByUID(userClaims.UID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to load user")
+		return nil, false
+	}
+
+	// Check if server belongs to user
+	var server models.Server
+	err = h.db.DB.Where("id = ? AND user_id = ?", serverID, user.ID).First(&server).Error
+	if err == gorm.ErrRecordNotFound {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Server not found")
+		return nil, false
+	} else if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Database error")
+		return nil, false
+	}
+
+	return &server, true
+}
+
+// normalizeEmails validates a list of email addresses, trimming whitespace
+// and dropping duplicates
+func normalizeEmails(emails []string) (models.StringList, error) {
+	seen := make(map[string]bool, len(emails))
+	result := make(models.StringList, 0, len(emails))
+
+	for _, email := range emails {
+		email = strings.TrimSpace(email)
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email {
+			return nil, fmt.Errorf("invalid email address: %q", email)
+		}
+
+		key := strings.ToLower(email)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, email)
+	}
+
+	return result, nil
+}
+
+// maxServerNameLength caps server names, which end up in emails and the UI
+const maxServerNameLength = 64
+
+var serverNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ._-]*$`)
+
+// sanitizeServerName trims and validates a server name
+func sanitizeServerName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("server name must not be empty")
+	}
+	if len(name) > maxServerNameLength {
+		return "", fmt.Errorf("server name must be at most %d characters", maxServerNameLength)
+	}
+	if !serverNamePattern.MatchString(name) {
+		return "", fmt.Errorf("server name may only contain letters, digits, spaces, '.', '_' and '-'")
+	}
+	return name, nil
+}
+
 // Health check endpoint
 func (h *APIHandler) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":    "ok",
 		"timestamp": time.Now(),
 		"version":   "1.0.0",
+
+		"dropped_metrics":          h.db.DroppedMetrics(),
+		"notification_queue_depth": h.ws.NotificationQueueDepth(),
 	})
 }
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/apierror"
+	"backend/auth"
+	"backend/models"
+	"backend/testdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiErrorCode serves a request and returns the status and error code of the
+// response
+func apiErrorCode(t *testing.T, router *gin.Engine, method, path string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+
+	var body apierror.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	if body.Message == "" || body.Error != body.Message {
+		t.Errorf("%s %s: message %q, error %q", method, path, body.Message, body.Error)
+	}
+	return w.Code, body.Code
+}
+
+func TestAPIErrorCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := &APIHandler{}
+
+	router := gin.New()
+	router.GET("/anonymous/servers/:id/recipients", h.GetAlertRecipients)
+	signedIn := router.Group("/", func(c *gin.Context) {
+		c.Set("user_uid", "uid")
+		c.Set("user_email", "user@example.com")
+	})
+	signedIn.GET("/servers/:id/recipients", h.GetAlertRecipients)
+	signedIn.GET("/servers/:id/alerts", h.GetServerAlerts)
+	router.GET("/protected", (&auth.FirebaseAuth{}).AuthMiddleware(), func(c *gin.Context) {})
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/protected", http.StatusUnauthorized, apierror.CodeUnauthenticated},
+		{"/anonymous/servers/1/recipients", http.StatusUnauthorized, apierror.CodeUnauthenticated},
+		{"/servers/abc/recipients", http.StatusBadRequest, apierror.CodeInvalidRequest},
+		{"/servers/-1/alerts", http.StatusBadRequest, apierror.CodeInvalidRequest},
+	} {
+		status, code := apiErrorCode(t, router, http.MethodGet, tc.path)
+		if status != tc.status || code != tc.code {
+			t.Errorf("GET %s: %d %q, want %d %q", tc.path, status, code, tc.status, tc.code)
+		}
+	}
+}
+
+// Without paging parameters the metrics API returns the whole window, which
+// the dashboard charts rely on
+func TestGetServerMetricsPagesOnlyWhenAsked(t *testing.T) {
+	d := testdb.Open(t)
+	user := testdb.User(t, d)
+	server := testdb.Server(t, d, user, "metrics")
+	for i := 1; i <= 3; i++ {
+		metric := &models.Metric{ServerID: server.ID, Time: time.Now().Add(-time.Duration(i) * time.Minute)}
+		if _, err := d.CreateMetric(metric); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	signedIn := router.Group("/", func(c *gin.Context) { c.Set("user_uid", user.FirebaseUID) })
+	signedIn.GET("/servers/:id/metrics", NewAPIHandler(d, nil, nil).GetServerMetrics)
+
+	tests := []struct {
+		query   string
+		metrics int
+		paged   bool
+	}{
+		{"", 3, false},
+		{"?limit=2", 2, true},
+		{"?offset=1", 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			path := fmt.Sprintf("/servers/%d/metrics%s", server.ID, tt.query)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+			var body struct {
+				Metrics    []models.Metric        `json:"metrics"`
+				Pagination map[string]interface{} `json:"pagination"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || w.Code != http.StatusOK {
+				t.Fatalf("GET %s: %d %s", path, w.Code, w.Body)
+			}
+			if len(body.Metrics) != tt.metrics {
+				t.Errorf("got %d metrics, want %d", len(body.Metrics), tt.metrics)
+			}
+			if paged := body.Pagination != nil; paged != tt.paged {
+				t.Errorf("paged = %v, want %v", paged, tt.paged)
+			}
+		})
+	}
+}
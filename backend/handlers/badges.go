@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/apierror"
+	"backend/config"
+	"backend/database"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// badgePeriods are the windows an uptime badge can cover
+var badgePeriods = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+}
+
+// BadgeHandler serves public uptime badges for servers shared with a badge token
+type BadgeHandler struct {
+	db     *database.Database
+	config *config.BadgesConfig
+
+	mutex sync.Mutex
+	cache map[string]badgeCacheEntry
+}
+
+type badgeCacheEntry struct {
+	uptime  float64
+	expires time.Time
+}
+
+func NewBadgeHandler(db *database.Database, cfg *config.BadgesConfig) *BadgeHandler {
+	return &BadgeHandler{
+		db:     db,
+		config: cfg,
+		cache:  make(map[string]badgeCacheEntry),
+	}
+}
+
+// GetUptimeBadge returns a server's uptime over a period as an SVG badge or,
+// with format=json, as a shields.io endpoint response, e.g.
+// /badges/:token/uptime?period=30d&format=json
+func (h *BadgeHandler) GetUptimeBadge(c *gin.Context) {
+	periodName := c.DefaultQuery("period", "30d")
+	period, ok := badgePeriods[periodName]
+	if !ok {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "period must be one of 24h, 7d, 30d, 90d")
+		return
+	}
+
+	format := c.DefaultQuery("format", "svg")
+	if format != "svg" && format != "json" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "format must be svg or json")
+		return
+	}
+
+	uptime, err := h.uptime(c.Param("token"), period)
+	if err == gorm.ErrRecordNotFound {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Badge not found")
+		return
+	} else if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to compute uptime")
+		return
+	}
+
+	label := "uptime " + periodName
+	message := formatUptime(uptime)
+	color := uptimeColor(uptime)
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", h.config.CacheTTL))
+	if format == "json" {
+		c.JSON(http.StatusOK, gin.H{
+			"schemaVersion": 1,
+			"label":         label,
+			"message":       message,
+			"color":         color,
+		})
+		return
+	}
+	c.Data(http.StatusOK, "image/svg+xml; charset=utf-8", []byte(renderBadgeSVG(label, message, badgeColors[color])))
+}
+
+// uptime returns the cached or freshly computed uptime percentage of the
+// server shared under token
+func (h *BadgeHandler) uptime(token string, period time.Duration) (float64, error) {
+	key := token + "/" + period.String()
+	now := time.Now()
+
+	h.mutex.Lock()
+	entry, ok := h.cache[key]
+	h.mutex.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.uptime, nil
+	}
+
+	server, err := h.db.GetServerByBadgeToken(token)
+	if err != nil {
+		return 0, err
+	}
+
+	// Time before the server was added doesn't count against it
+	since := now.Add(-period)
+	if server.CreatedAt.After(since) {
+		since = server.CreatedAt
+	}
+
+	uptime := 100.0
+	if window := now.Sub(since); window > 0 {
+		downtime, err := h.db.GetDowntime(server.ID, since, now, time.Duration(h.config.MaxGap)*time.Second)
+		if err != nil {
+			return 0, err
+		}
+		uptime = math.Max(0, 100*(1-downtime.Seconds()/window.Seconds()))
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for k, e := range h.cache {
+		if now.After(e.expires) {
+			delete(h.cache, k)
+		}
+	}
+	h.cache[key] = badgeCacheEntry{
+		uptime:  uptime,
+		expires: now.Add(time.Duration(h.config.CacheTTL) * time.Second),
+	}
+	return uptime, nil
+}
+
+// formatUptime rounds down to two decimals so near-perfect uptime isn't
+// shown as 100%
+func formatUptime(uptime float64) string {
+	return strconv.FormatFloat(math.Floor(uptime*100)/100, 'f', -1, 64) + "%"
+}
+
+// uptimeColor picks a shields.io color name for an uptime percentage
+func uptimeColor(uptime float64) string {
+	switch {
+	case uptime >= 99.9:
+		return "brightgreen"
+	case uptime >= 99:
+		return "green"
+	case uptime >= 95:
+		return "yellow"
+	case uptime >= 90:
+		return "orange"
+	default:
+		return "red"
+	}
+}
+
+// badgeColors maps shields.io color names to their hex values
+var badgeColors = map[string]string{
+	"brightgreen": "#4c1",
+	"green":       "#97ca00",
+	"yellow":      "#dfb317",
+	"orange":      "#fe7d37",
+	"red":         "#e05d44",
+}
+
+// renderBadgeSVG draws a flat shields.io-style badge
+func renderBadgeSVG(label, message, color string) string {
+	// Approximate Verdana 11px text width
+	labelWidth := len(label)*7 + 10
+	messageWidth := len(message)*7 + 10
+	width := labelWidth + messageWidth
+	label = html.EscapeString(label)
+	message = html.EscapeString(message)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>
+<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>
+</g>
+</svg>`,
+		width, label, message,
+		width,
+		labelWidth, labelWidth, messageWidth, color, width,
+		labelWidth/2, label, labelWidth/2, label,
+		labelWidth+messageWidth/2, message, labelWidth+messageWidth/2, message)
+}
+
+// CreateBadgeToken shares a server's uptime badge under a new token,
+// replacing any previous one
+func (h *APIHandler) CreateBadgeToken(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	token := uuid.New().String()
+	if err := h.db.UpdateServer(server.ID, map[string]interface{}{"badge_token": token}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":   server.ID,
+		"badge_token": token,
+		"badge_url":   "/badges/" + token + "/uptime",
+	})
+}
+
+// DeleteBadgeToken stops sharing a server's uptime badge
+func (h *APIHandler) DeleteBadgeToken(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.UpdateServer(server.ID, map[string]interface{}{"badge_token": nil}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Badge sharing disabled"})
+}
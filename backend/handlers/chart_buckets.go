@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// maxChartPoints is the number of points an automatically bucketed chart
+// aims to stay under
+const maxChartPoints = 1000
+
+// maxChartBucket bounds an explicit chart resolution
+const maxChartBucket = 24 * time.Hour
+
+// chartBucketSteps are the bucket widths picked automatically, so buckets
+// line up with round times
+var chartBucketSteps = []time.Duration{
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute,
+	30 * time.Minute, time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour,
+}
+
+// rawChartTypes hold per-core, per-device or per-mount lists that can't be
+// averaged in SQL, so they are always charted from raw samples
+var rawChartTypes = map[string]bool{
+	"cpu_core":     true,
+	"disk_latency": true,
+	"disk_mounts":  true,
+}
+
+// chartBucket returns the width of the buckets chart data over span is
+// averaged into, 0 for raw samples. The resolution query param is "auto"
+// (the default), "raw", or a bucket width in seconds. Auto picks the
+// smallest step keeping the chart under maxChartPoints, and raw samples when
+// they already are, given the server's stored resolution of stored.
+func chartBucket(resolution string, span, stored time.Duration) (time.Duration, error) {
+	switch resolution {
+	case "", "auto":
+		target := span / maxChartPoints
+		if target <= stored || target < chartBucketSteps[0]/2 {
+			return 0, nil
+		}
+		for _, step := range chartBucketSteps {
+			if step >= target {
+				return step, nil
+			}
+		}
+		return chartBucketSteps[len(chartBucketSteps)-1], nil
+	case "raw":
+		return 0, nil
+	}
+
+	seconds, err := strconv.Atoi(resolution)
+	if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > maxChartBucket {
+		return 0, fmt.Errorf("resolution must be \"auto\", \"raw\" or a number of seconds up to %d", int(maxChartBucket.Seconds()))
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
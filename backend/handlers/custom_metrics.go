@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"backend/apierror"
+	"backend/auth"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCustomMetricLabel bounds custom metric names and dimension keys and values
+const maxCustomMetricLabel = 100
+
+var customMetricNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+// acceptCustomMetrics validates a sample's custom metrics and returns the
+// records to store. Invalid values and new series beyond the configured
+// cardinality limit are dropped and logged.
+func (h *WebSocketHandler) acceptCustomMetrics(agentConn *AgentConnection, at time.Time, data []models.CustomMetricData) []models.CustomMetric {
+	var accepted []models.CustomMetric
+	for _, item := range data {
+		if err := h.validateCustomMetric(item); err != nil {
+			log.Printf("Dropping custom metric %q from %s: %v", item.Name, agentConn.server.Name, err)
+			continue
+		}
+
+		dimensions := models.Dimensions(item.Dimensions)
+		if !h.allowCustomSeries(agentConn, item.Name, dimensions) {
+			log.Printf("Dropping custom metric %q from %s: more than %d series",
+				item.Name, agentConn.server.Name, h.config.CustomMetrics.MaxSeries)
+			continue
+		}
+
+		accepted = append(accepted, models.CustomMetric{
+			Time:       at,
+			ServerID:   agentConn.server.ID,
+			Name:       item.Name,
+			Value:      item.Value,
+			Dimensions: dimensions,
+		})
+	}
+	return accepted
+}
+
+func (h *WebSocketHandler) validateCustomMetric(item models.CustomMetricData) error {
+	if len(item.Name) > maxCustomMetricLabel || !customMetricNamePattern.MatchString(item.Name) {
+		return fmt.Errorf("invalid name")
+	}
+	if len(item.Dimensions) > h.config.CustomMetrics.MaxDimensions {
+		return fmt.Errorf("more than %d dimensions", h.config.CustomMetrics.MaxDimensions)
+	}
+	for key, value := range item.Dimensions {
+		if len(key) > maxCustomMetricLabel || !customMetricNamePattern.MatchString(key) {
+			return fmt.Errorf("invalid dimension %q", key)
+		}
+		if len(value) > maxCustomMetricLabel {
+			return fmt.Errorf("dimension %q value too long", key)
+		}
+	}
+	return nil
+}
+
+// allowCustomSeries reports whether a series may be stored: either it already
+// exists or the metric has fewer than MaxSeries series. Existing series are
+// loaded from the database the first time a connection reports a name.
+func (h *WebSocketHandler) allowCustomSeries(agentConn *AgentConnection, name string, dimensions models.Dimensions) bool {
+	key, err := dimensions.Value()
+	if err != nil {
+		return false
+	}
+
+	if agentConn.customSeries == nil {
+		agentConn.customSeries = make(map[string]map[string]bool)
+	}
+	known, ok := agentConn.customSeries[name]
+	if !ok {
+		series, err := h.db.GetCustomMetricSeries(agentConn.server.ID, name, h.config.CustomMetrics.MaxSeries)
+		if err != nil {
+			log.Printf("Error loading custom metric series for %s: %v", agentConn.server.Name, err)
+			return false
+		}
+
+		known = make(map[string]bool, len(series))
+		for _, existing := range series {
+			if existingKey, err := existing.Value(); err == nil {
+				known[existingKey.(string)] = true
+			}
+		}
+		agentConn.customSeries[name] = known
+	}
+
+	if known[key.(string)] {
+		return true
+	}
+	if len(known) >= h.config.CustomMetrics.MaxSeries {
+		return false
+	}
+	known[key.(string)] = true
+	return true
+}
+
+// GetCustomMetrics lists the custom metric names a server reported in the
+// last ?hours (default 24)
+func (h *DashboardHandler) GetCustomMetrics(c *gin.Context) {
+	serverID, ok := h.customMetricServer(c)
+	if !ok {
+		return
+	}
+
+	hours := parseHours(c.DefaultQuery("hours", "24"))
+	names, err := h.db.GetCustomMetricNames(serverID, time.Now().Add(-time.Duration(hours)*time.Hour))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get custom metrics")
+		return
+	}
+	if names == nil {
+		names = []string{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"names": names})
+}
+
+// GetCustomMetricChart returns a custom metric as one series per value of the
+// ?group_by dimension, e.g. /custom-metrics/queue_depth?group_by=queue.
+// Without group_by all series are summed.
+func (h *DashboardHandler) GetCustomMetricChart(c *gin.Context) {
+	serverID, ok := h.customMetricServer(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("name")
+	groupBy := c.Query("group_by")
+	if groupBy != "" && !customMetricNamePattern.MatchString(groupBy) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid group_by dimension")
+		return
+	}
+
+	hours := parseHours(c.DefaultQuery("hours", "24"))
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	points, err := h.db.GetCustomMetricPoints(serverID, name, groupBy, since)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get custom metric")
+		return
+	}
+
+	// Points arrive ordered by group, then time
+	type series struct {
+		Group string        `json:"group"`
+		Data  []interface{} `json:"data"`
+	}
+	groups := []series{}
+	for _, point := range points {
+		if len(groups) == 0 || groups[len(groups)-1].Group != point.Group {
+			groups = append(groups, series{Group: point.Group})
+		}
+		last := &groups[len(groups)-1]
+		last.Data = append(last.Data, gin.H{"time": point.Time, "value": point.Value})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":     name,
+		"group_by": groupBy,
+		"series":   groups,
+		"time_range": gin.H{
+			"since": since,
+			"hours": hours,
+		},
+	})
+}
+
+// customMetricServer resolves and checks ownership of the :id server
+func (h *DashboardHandler) customMetricServer(c *gin.Context) (uint, bool) {
+	userClaims, exists := auth.GetUserFromContext(c)
+	if !exists {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
+		return 0, false
+	}
+
+	serverID, err := parseServerID(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid server ID")
+		return 0, false
+	}
+
+	if _, err := h.validateServerOwnership(serverID, userClaims.UID); err != nil {
+		respondOwnershipError(c, err)
+		return 0, false
+	}
+	return serverID, true
+}
@@ -1,15 +1,23 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"backend/apierror"
 	"backend/auth"
 	"backend/database"
 	"backend/models"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
 )
 
 type DashboardHandler struct {
@@ -58,17 +66,153 @@ func (h *DashboardHandler) GetDashboardData(c *gin.Context) {
 	userClaims, exists := auth.GetUserFromContext(c)
 
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
 		return
 	}
 
-	// Get user's servers
-	servers, err := h.db.GetUserServers(userClaims.UID)
+	// Responses are cached by internal user ID; users without a record yet
+	// have no servers and are simply not cached
+	var userID uint
+	if user, err := h.db.GetUserByUID(userClaims.UID); err == nil {
+		userID = user.ID
+	}
+
+	statuses, err := parseStatusFilter(c.Query("status"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Serve a recent response unless the client forces a refresh
+	if userID != 0 && c.GetHeader("Cache-Control") != "no-cache" {
+		if cached, ok := h.ws.dashboardCache.get(userID); ok {
+			c.Header("X-Cache", "HIT")
+			c.JSON(http.StatusOK, filterDashboardServers(cached, statuses))
+			return
+		}
+	}
+	c.Header("X-Cache", "MISS")
+
+	response, err := h.buildDashboardResponse(userClaims.UID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get servers"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get servers")
 		return
 	}
 
+	// The cache holds the unfiltered dashboard so any filter can be served from it
+	if userID != 0 {
+		h.ws.dashboardCache.set(userID, *response)
+	}
+	c.JSON(http.StatusOK, filterDashboardServers(*response, statuses))
+}
+
+// Dashboard statuses a server can be filtered by. A warning server is also online.
+const (
+	dashboardStatusOnline  = "online"
+	dashboardStatusOffline = "offline"
+	dashboardStatusWarning = "warning"
+)
+
+// parseStatusFilter parses a comma separated status filter such as
+// "offline,warning". An empty filter returns nil, matching every server.
+func parseStatusFilter(param string) (map[string]bool, error) {
+	if param == "" {
+		return nil, nil
+	}
+
+	statuses := make(map[string]bool)
+	for _, status := range strings.Split(param, ",") {
+		status = strings.TrimSpace(status)
+		switch status {
+		case dashboardStatusOnline, dashboardStatusOffline, dashboardStatusWarning:
+			statuses[status] = true
+		default:
+			return nil, fmt.Errorf("invalid status %q (expected online, offline or warning)", status)
+		}
+	}
+	return statuses, nil
+}
+
+// filterDashboardServers returns the dashboard with only the servers matching
+// one of the statuses. Summary counts and system health still cover all
+// servers. The servers slice is copied so a cached response is left intact.
+func filterDashboardServers(response DashboardResponse, statuses map[string]bool) DashboardResponse {
+	if len(statuses) == 0 {
+		return response
+	}
+
+	servers := make([]ServerSummary, 0, len(response.Servers))
+	for _, server := range response.Servers {
+		if (statuses[dashboardStatusOnline] && server.IsConnected) ||
+			(statuses[dashboardStatusOffline] && !server.IsConnected) ||
+			(statuses[dashboardStatusWarning] && server.isWarning()) {
+			servers = append(servers, server)
+		}
+	}
+	response.Servers = servers
+	return response
+}
+
+// isWarning reports whether the server's latest metrics are over the
+// dashboard's warning levels
+func (s ServerSummary) isWarning() bool {
+	m := s.LatestMetrics
+	return m != nil && (m.CPUUsage > 80 || m.MemoryPercent > 85 || m.DiskPercent > 90)
+}
+
+// dashboardFetchConcurrency bounds the per-server queries run in parallel
+// while building a dashboard
+const dashboardFetchConcurrency = 8
+
+// serverFetch holds the per-server data loaded for the dashboard
+type serverFetch struct {
+	connected        bool
+	latestMetrics    *models.Metric
+	unresolvedAlerts []models.Alert
+}
+
+// fetchServerSummary loads a server's latest metrics (when its agent is
+// connected) and unresolved alerts. Failed queries leave the field empty.
+func (h *DashboardHandler) fetchServerSummary(server *models.Server) serverFetch {
+	fetch := serverFetch{connected: h.ws.IsAgentConnected(server.ID)}
+
+	if fetch.connected {
+		if latestMetrics, err := h.db.GetLatestMetrics(server.ID); err == nil {
+			fetch.latestMetrics = latestMetrics
+		}
+	}
+
+	if unresolvedAlerts, err := h.db.GetUnresolvedAlerts(server.ID); err == nil {
+		fetch.unresolvedAlerts = unresolvedAlerts
+	}
+	return fetch
+}
+
+// fetchServerSummaries runs fetchServerSummary for every server, at most
+// concurrency at a time. Results go into per-server slots so they keep
+// server order.
+func (h *DashboardHandler) fetchServerSummaries(servers []models.Server, concurrency int) []serverFetch {
+	fetches := make([]serverFetch, len(servers))
+	var group errgroup.Group
+	group.SetLimit(concurrency)
+	for i := range servers {
+		group.Go(func() error {
+			fetches[i] = h.fetchServerSummary(&servers[i])
+			return nil
+		})
+	}
+	group.Wait()
+	return fetches
+}
+
+// buildDashboardResponse assembles the dashboard for a user
+func (h *DashboardHandler) buildDashboardResponse(userUID string) (*DashboardResponse, error) {
+	// Get user's servers
+	servers, err := h.db.GetUserServers(userUID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize response
 	response := DashboardResponse{
 		Summary: DashboardSummary{
@@ -80,19 +224,50 @@ func (h *DashboardHandler) GetDashboardData(c *gin.Context) {
 	}
 
 	if len(servers) == 0 {
-		c.JSON(http.StatusOK, response)
-		return
+		return &response, nil
+	}
+
+	// Fetch each server's latest metrics and unresolved alerts concurrently
+	var fetches []serverFetch
+	var group errgroup.Group
+	group.Go(func() error {
+		fetches = h.fetchServerSummaries(servers, dashboardFetchConcurrency)
+		return nil
+	})
+
+	// Get recent alerts across all servers (last 24 hours) meanwhile
+	serverIDs := make([]uint, len(servers))
+	for i, server := range servers {
+		serverIDs[i] = server.ID
 	}
 
+	var recentAlerts []models.Alert
+	var recentErr error
+	var recent errgroup.Group
+	recent.Go(func() error {
+		recentErr = h.db.DB.Where("server_id IN ? AND created_at > ?", serverIDs, time.Now().Add(-24*time.Hour)).
+			Order("created_at DESC").
+			Limit(10).
+			Preload("Server").
+			Find(&recentAlerts).Error
+		return nil
+	})
+
+	group.Wait()
+	recent.Wait()
+
 	// Process each server
 	var totalCPU, totalMemory, totalDisk float64
 	var totalUptime int64
 	var metricsCount int
 
-	for _, server := range servers {
+	for i := range servers {
+		fetch := fetches[i]
 		serverSummary := ServerSummary{
-			Server:      &server,
-			IsConnected: h.ws.IsAgentConnected(server.ID),
+			Server:           &servers[i],
+			IsConnected:      fetch.connected,
+			LatestMetrics:    fetch.latestMetrics,
+			UnresolvedAlerts: fetch.unresolvedAlerts,
 		}
 
 		// Count online/offline servers
@@ -102,36 +277,24 @@ func (h *DashboardHandler) GetDashboardData(c *gin.Context) {
 			response.Summary.OfflineServers++
 		}
 
-		// Get latest metrics for connected servers
-		if serverSummary.IsConnected {
-			latestMetrics, err := h.db.GetLatestMetrics(server.ID)
-			if err == nil {
-				serverSummary.LatestMetrics = latestMetrics
-
-				// Add to system health calculations
-				totalCPU += latestMetrics.CPUUsage
-				totalMemory += latestMetrics.MemoryPercent
-				totalDisk += latestMetrics.DiskPercent
-				totalUptime += latestMetrics.Uptime
-				metricsCount++
-
-				// Check for warning status
-				if latestMetrics.CPUUsage > 80 || latestMetrics.MemoryPercent > 85 || latestMetrics.DiskPercent > 90 {
-					response.Summary.WarningServers++
-				}
-			}
+		if latestMetrics := fetch.latestMetrics; latestMetrics != nil {
+			// Add to system health calculations
+			totalCPU += latestMetrics.CPUUsage
+			totalMemory += latestMetrics.MemoryPercent
+			totalDisk += latestMetrics.DiskPercent
+			totalUptime += latestMetrics.Uptime
+			metricsCount++
 		}
 
-		// Get unresolved alerts
-		unresolvedAlerts, err := h.db.GetUnresolvedAlerts(server.ID)
-		if err == nil {
-			serverSummary.UnresolvedAlerts = unresolvedAlerts
+		// Check for warning status
+		if serverSummary.isWarning() {
+			response.Summary.WarningServers++
+		}
 
-			// Count critical alerts
-			for _, alert := range unresolvedAlerts {
-				if alert.Level == "critical" {
-					response.Summary.CriticalAlerts++
-				}
+		// Count critical alerts
+		for _, alert := range fetch.unresolvedAlerts {
+			if alert.Level == "critical" && !alert.Test {
+				response.Summary.CriticalAlerts++
 			}
 		}
 
@@ -148,43 +311,31 @@ func (h *DashboardHandler) GetDashboardData(c *gin.Context) {
 		}
 	}
 
-	// Get recent alerts across all servers (last 24 hours)
-	serverIDs := make([]uint, len(servers))
-	for i, server := range servers {
-		serverIDs[i] = server.ID
-	}
-
-	var recentAlerts []models.Alert
-	err = h.db.DB.Where("server_id IN ? AND created_at > ?", serverIDs, time.Now().Add(-24*time.Hour)).
-		Order("created_at DESC").
-		Limit(10).
-		Preload("Server").
-		Find(&recentAlerts).Error
-	if err == nil {
+	if recentErr == nil {
 		response.RecentAlerts = recentAlerts
 	}
 
-	c.JSON(http.StatusOK, response)
+	return &response, nil
 }
 
 // GetServerDashboard returns detailed dashboard data for a specific server
 func (h *DashboardHandler) GetServerDashboard(c *gin.Context) {
 	userClaims, exists := auth.GetUserFromContext(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
 		return
 	}
 
 	serverID, err := parseServerID(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid server ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid server ID")
 		return
 	}
 
 	// Verify server ownership
 	server, err := h.validateServerOwnership(serverID, userClaims.UID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+		respondOwnershipError(c, err)
 		return
 	}
 
@@ -195,31 +346,59 @@ func (h *DashboardHandler) GetServerDashboard(c *gin.Context) {
 	// Get metrics
 	metrics, err := h.db.GetServerMetrics(serverID, since)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get metrics"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get metrics")
 		return
 	}
 
 	// Get alerts
-	alerts, err := h.db.GetServerAlerts(serverID, 50)
+	alerts, err := h.db.GetServerAlerts(serverID, 50, nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get alerts"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get alerts")
+		return
+	}
+
+	// Collection warnings explain metrics missing from a degraded agent
+	warnings, err := h.db.GetRecentAgentEvents(serverID, since, 50)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get collection warnings")
+		return
+	}
+
+	prunedAlerts, err := h.db.GetAlertPruneCount(serverID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get alerts")
 		return
 	}
 
 	// Calculate statistics
 	stats := calculateMetricsStatistics(metrics)
 
+	// Disk trend is optional; a server without samples yet has none
+	var trend *models.ServerTrend
+	if t, err := h.db.GetServerTrend(serverID); err == nil {
+		trend = t
+	}
+
 	response := gin.H{
 		"server": gin.H{
-			"id":           server.ID,
-			"name":         server.Name,
-			"status":       server.Status,
-			"last_seen":    server.LastSeen,
-			"is_connected": h.ws.IsAgentConnected(serverID),
+			"id":                 server.ID,
+			"name":               server.Name,
+			"status":             server.Status,
+			"last_seen":          server.LastSeen,
+			"is_connected":       h.ws.IsAgentConnected(serverID),
+			"clock_skew_seconds": server.ClockSkewSeconds,
+
+			"agent_version":        server.AgentVersion,
+			"agent_capabilities":   server.AgentCapabilities,
+			"agent_schema_version": server.AgentSchemaVersion,
 		},
 		"metrics":    metrics,
 		"alerts":     alerts,
 		"statistics": stats,
+		"trend":      trend,
+
+		"pruned_alerts":       prunedAlerts,
+		"collection_warnings": warnings,
 		"time_range": gin.H{
 			"since": since,
 			"hours": hours,
@@ -233,47 +412,340 @@ func (h *DashboardHandler) GetServerDashboard(c *gin.Context) {
 func (h *DashboardHandler) GetMetricsChart(c *gin.Context) {
 	userClaims, exists := auth.GetUserFromContext(c)
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
 		return
 	}
 
 	serverID, err := parseServerID(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid server ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid server ID")
 		return
 	}
 
 	// Verify server ownership
-	_, err = h.validateServerOwnership(serverID, userClaims.UID)
+	server, err := h.validateServerOwnership(serverID, userClaims.UID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+		respondOwnershipError(c, err)
 		return
 	}
 
 	// Get parameters
 	hours := parseHours(c.DefaultQuery("hours", "24"))
-	metricType := c.DefaultQuery("type", "cpu") // cpu, memory, disk, network
+	metricType := c.DefaultQuery("type", "cpu")
+	if !chartTypes[metricType] {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest,
+			fmt.Sprintf("invalid chart type %q (expected one of %s)", metricType, strings.Join(chartTypeNames(), ", ")))
+		return
+	}
 
-	since := time.Now().Add(-time.Duration(hours) * time.Hour)
-	metrics, err := h.db.GetServerMetrics(serverID, since)
+	since, until, err := parseMetricsRange(c, hours)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Long ranges are averaged into buckets so charts stay small
+	bucket, err := chartBucket(c.Query("resolution"), until.Sub(since), ingestionBucket(server))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get metrics"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+	if rawChartTypes[metricType] {
+		bucket = 0
+	}
+
+	var metrics []models.Metric
+	if bucket > 0 {
+		metrics, err = h.db.GetMetricBuckets(serverID, since, until, bucket)
+	} else {
+		metrics, err = h.db.GetServerMetricsBetween(serverID, since, until)
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get metrics")
 		return
 	}
 
+	// Optional moving average over this many points; 0 returns raw values
+	smooth := 0
+	if param := c.Query("smooth"); param != "" {
+		if _, err := fmt.Sscanf(param, "%d", &smooth); err != nil || smooth < 0 || smooth > maxSmoothWindow {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest,
+				fmt.Sprintf("smooth must be between 0 and %d", maxSmoothWindow))
+			return
+		}
+	}
+
+	// Optional gap detection: gaps longer than this many expected sample
+	// intervals are broken with a null point; 0 connects across all gaps
+	gapThreshold := 0.0
+	if param := c.Query("gap_threshold"); param != "" {
+		if _, err := fmt.Sscanf(param, "%g", &gapThreshold); err != nil || gapThreshold < 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "gap_threshold must be a non-negative number")
+			return
+		}
+	}
+
 	// Format data for charts
 	chartData := formatChartData(metrics, metricType)
+	if smooth > 1 {
+		chartData = smoothChartData(chartData, smooth)
+	}
+	if gapThreshold > 0 {
+		interval := ingestionBucket(server)
+		if bucket > 0 {
+			interval = bucket
+		}
+		chartData = breakChartGaps(chartData, gapThreshold, interval)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"type": metricType,
-		"data": chartData,
+		"type":               metricType,
+		"smooth":             smooth,
+		"gap_threshold":      gapThreshold,
+		"resolution_seconds": ingestionBucket(server).Seconds(),
+		"bucket_seconds":     bucket.Seconds(),
+		"data":               chartData,
 		"time_range": gin.H{
 			"since": since,
-			"hours": hours,
+			"until": until,
+			"hours": until.Sub(since).Hours(),
 		},
 	})
 }
 
+// rankingColumns maps ranking metric names to metrics table columns
+var rankingColumns = map[string]string{
+	"cpu":    "cpu_usage",
+	"memory": "memory_percent",
+	"disk":   "disk_percent",
+}
+
+const (
+	defaultRankingLimit = 10
+	maxRankingLimit     = 50
+	maxRankingWindow    = 7 * 24 * time.Hour
+)
+
+// GetServerRankings ranks the user's servers by a metric aggregated over a
+// recent window, e.g. ?metric=cpu&stat=p95&order=desc&window=1h
+func (h *DashboardHandler) GetServerRankings(c *gin.Context) {
+	userClaims, exists := auth.GetUserFromContext(c)
+	if !exists {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
+		return
+	}
+
+	metric := c.DefaultQuery("metric", "cpu") // cpu, memory, disk, alerts
+	stat := c.DefaultQuery("stat", "avg")     // avg, p95
+	order := c.DefaultQuery("order", "desc")  // desc, asc
+
+	column, isMetric := rankingColumns[metric]
+	if !isMetric && metric != "alerts" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "metric must be one of cpu, memory, disk, alerts")
+		return
+	}
+	if stat != "avg" && stat != "p95" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "stat must be avg or p95")
+		return
+	}
+	if order != "desc" && order != "asc" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "order must be desc or asc")
+		return
+	}
+
+	window, err := time.ParseDuration(c.DefaultQuery("window", "1h"))
+	if err != nil || window <= 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid window")
+		return
+	}
+	if window > maxRankingWindow {
+		window = maxRankingWindow
+	}
+
+	limit := defaultRankingLimit
+	if param := c.Query("limit"); param != "" {
+		if _, err := fmt.Sscanf(param, "%d", &limit); err != nil || limit < 1 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid limit")
+			return
+		}
+		if limit > maxRankingLimit {
+			limit = maxRankingLimit
+		}
+	}
+
+	user, err := h.db.GetUserByUID(userClaims.UID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to load user")
+		return
+	}
+
+	since := time.Now().Add(-window)
+	ascending := order == "asc"
+
+	var rankings []models.ServerRanking
+	if isMetric {
+		rankings, err = h.db.GetServerRankings(user.ID, column, stat, since, ascending, limit)
+	} else {
+		stat = "count"
+		rankings, err = h.db.GetAlertCountRankings(user.ID, since, ascending, limit)
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to rank servers")
+		return
+	}
+	if rankings == nil {
+		rankings = []models.ServerRanking{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"metric":   metric,
+		"stat":     stat,
+		"order":    order,
+		"window":   window.String(),
+		"since":    since,
+		"rankings": rankings,
+	})
+}
+
+const (
+	defaultAlertStatsDays = 30
+	maxAlertStatsDays     = 365
+	alertStatsTopServers  = 5
+)
+
+// GetAlertStats aggregates the user's alerts over the last ?days (default
+// 30): totals, counts by level and type, mean time to resolve, the servers
+// raising the most alerts and a daily count series
+func (h *DashboardHandler) GetAlertStats(c *gin.Context) {
+	userClaims, exists := auth.GetUserFromContext(c)
+	if !exists {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
+		return
+	}
+
+	days := defaultAlertStatsDays
+	if param := c.Query("days"); param != "" {
+		if _, err := fmt.Sscanf(param, "%d", &days); err != nil || days < 1 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid days")
+			return
+		}
+		if days > maxAlertStatsDays {
+			days = maxAlertStatsDays
+		}
+	}
+
+	user, err := h.db.GetUserByUID(userClaims.UID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to load user")
+		return
+	}
+
+	// Whole UTC days, including today
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	since := today.AddDate(0, 0, -(days - 1))
+
+	stats, err := h.db.GetAlertStats(user.ID, since, alertStatsTopServers)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get alert statistics")
+		return
+	}
+	if stats.TopServers == nil {
+		stats.TopServers = []models.ServerRanking{}
+	}
+	stats.Daily = fillDailyCounts(stats.Daily, since, days)
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":  days,
+		"since": since,
+		"stats": stats,
+	})
+}
+
+// fillDailyCounts returns one entry per day starting at since, with zero
+// counts for days missing from counts
+func fillDailyCounts(counts []models.DailyCount, since time.Time, days int) []models.DailyCount {
+	byDay := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		byDay[count.Day.Format("2006-01-02")] = count.Count
+	}
+
+	filled := make([]models.DailyCount, days)
+	for i := range filled {
+		day := since.AddDate(0, 0, i)
+		filled[i] = models.DailyCount{Day: day, Count: byDay[day.Format("2006-01-02")]}
+	}
+	return filled
+}
+
+// GetMetricsDelta compares a server's metrics at two points in time
+func (h *DashboardHandler) GetMetricsDelta(c *gin.Context) {
+	userClaims, exists := auth.GetUserFromContext(c)
+	if !exists {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
+		return
+	}
+
+	serverID, err := parseServerID(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid server ID")
+		return
+	}
+
+	// Verify server ownership
+	_, err = h.validateServerOwnership(serverID, userClaims.UID)
+	if err != nil {
+		respondOwnershipError(c, err)
+		return
+	}
+
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid 'from' timestamp, expected RFC3339")
+		return
+	}
+	to, err := time.Parse(time.RFC3339, c.DefaultQuery("to", time.Now().Format(time.RFC3339)))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid 'to' timestamp, expected RFC3339")
+		return
+	}
+	if !from.Before(to) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "'from' must be before 'to'")
+		return
+	}
+
+	// Only match samples reasonably close to the requested points
+	tolerance := to.Sub(from) / 4
+	if tolerance > 6*time.Hour {
+		tolerance = 6 * time.Hour
+	}
+
+	fromMetric, err := h.db.GetMetricNearest(serverID, from, tolerance)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get metrics")
+		return
+	}
+	toMetric, err := h.db.GetMetricNearest(serverID, to, tolerance)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get metrics")
+		return
+	}
+
+	response := gin.H{
+		"from":   gin.H{"requested": from, "metric": fromMetric},
+		"to":     gin.H{"requested": to, "metric": toMetric},
+		"deltas": nil,
+	}
+
+	if fromMetric == nil || toMetric == nil {
+		response["message"] = "No metrics found near one or both time points"
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	response["deltas"] = calculateMetricDeltas(fromMetric, toMetric)
+	c.JSON(http.StatusOK, response)
+}
+
 // Helper functions
 
 func parseServerID(param string) (uint, error) {
@@ -297,6 +769,47 @@ func parseHours(param string) int {
 	return hours
 }
 
+// maxMetricsRange caps an explicit from/to range, like the 1 week cap on hours
+const maxMetricsRange = 168 * time.Hour
+
+// parseMetricsRange returns the window of metrics to query. The RFC3339
+// "from" and "to" query params override hours when either is given: a
+// missing "to" means now and a missing "from" means hours before "to".
+// Otherwise the window is the last hours up to now.
+func parseMetricsRange(c *gin.Context, hours int) (time.Time, time.Time, error) {
+	now := time.Now()
+	fromParam, toParam := c.Query("from"), c.Query("to")
+	if fromParam == "" && toParam == "" {
+		return now.Add(-time.Duration(hours) * time.Hour), now, nil
+	}
+
+	to := now
+	if toParam != "" {
+		parsed, err := time.Parse(time.RFC3339, toParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid 'to' timestamp, expected RFC3339")
+		}
+		to = parsed
+	}
+
+	from := to.Add(-time.Duration(hours) * time.Hour)
+	if fromParam != "" {
+		parsed, err := time.Parse(time.RFC3339, fromParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid 'from' timestamp, expected RFC3339")
+		}
+		from = parsed
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("'from' must be before 'to'")
+	}
+	if to.Sub(from) > maxMetricsRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("time range must not exceed %d hours", int(maxMetricsRange.Hours()))
+	}
+	return from, to, nil
+}
+
 func (h *DashboardHandler) validateServerOwnership(serverID uint, userUID string) (*models.Server, error) {
 	// Get user to get internal ID
 	user, err := h.db.GetUserByUID(userUID)
@@ -312,64 +825,278 @@ func (h *DashboardHandler) validateServerOwnership(serverID uint, userUID string
 	return &server, nil
 }
 
+// respondOwnershipError maps a validateServerOwnership failure to a response
+func respondOwnershipError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Server not found")
+		return
+	}
+	apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Database error")
+}
+
+// calculateMetricsStatistics summarises CPU, memory and disk usage and the
+// combined network rate in bytes per second over metrics, which are newest
+// first. Percentiles sort a copy of each series, so statistics over long
+// ranges cost O(n log n) in the number of samples.
 func calculateMetricsStatistics(metrics []models.Metric) map[string]interface{} {
 	if len(metrics) == 0 {
 		return map[string]interface{}{}
 	}
 
-	var totalCPU, totalMemory, totalDisk float64
-	var maxCPU, maxMemory, maxDisk float64
-	var minCPU, minMemory, minDisk float64 = 100, 100, 100
-
-	for _, metric := range metrics {
-		// CPU
-		totalCPU += metric.CPUUsage
-		if metric.CPUUsage > maxCPU {
-			maxCPU = metric.CPUUsage
+	cpu := make([]float64, 0, len(metrics))
+	memory := make([]float64, 0, len(metrics))
+	disk := make([]float64, 0, len(metrics))
+	network := make([]float64, 0, len(metrics))
+	for i, metric := range metrics {
+		cpu = append(cpu, metric.CPUUsage)
+		memory = append(memory, metric.MemoryPercent)
+		disk = append(disk, metric.DiskPercent)
+		if rate, ok := networkTotalRate(metrics, i).(float64); ok {
+			network = append(network, rate)
+		}
+	}
+
+	stats := map[string]interface{}{
+		"cpu":    seriesStatistics(cpu),
+		"memory": seriesStatistics(memory),
+		"disk":   seriesStatistics(disk),
+	}
+	if len(network) > 0 {
+		stats["network"] = seriesStatistics(network)
+	}
+	return stats
+}
+
+// seriesStatistics returns the average, minimum, maximum and 50th, 95th and
+// 99th percentiles of a non-empty series. Percentiles interpolate between
+// the closest ranks, like PostgreSQL's percentile_cont.
+func seriesStatistics(values []float64) map[string]float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	var total float64
+	for _, v := range sorted {
+		total += v
+	}
+
+	return map[string]float64{
+		"average": total / float64(len(sorted)),
+		"min":     sorted[0],
+		"max":     sorted[len(sorted)-1],
+		"p50":     percentile(sorted, 0.50),
+		"p95":     percentile(sorted, 0.95),
+		"p99":     percentile(sorted, 0.99),
+	}
+}
+
+// percentile returns the p-th percentile (0 to 1) of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	if lower+1 >= len(sorted) {
+		return sorted[lower]
+	}
+	return sorted[lower] + (rank-float64(lower))*(sorted[lower+1]-sorted[lower])
+}
+
+// calculateMetricDeltas returns the change of each resource between two
+// samples along with the growth rate per hour
+func calculateMetricDeltas(from, to *models.Metric) map[string]map[string]float64 {
+	hours := to.Time.Sub(from.Time).Hours()
+
+	delta := func(start, end float64) map[string]float64 {
+		d := map[string]float64{
+			"from":  start,
+			"to":    end,
+			"delta": end - start,
 		}
-		if metric.CPUUsage < minCPU {
-			minCPU = metric.CPUUsage
+		if hours > 0 {
+			d["per_hour"] = (end - start) / hours
 		}
+		return d
+	}
+
+	return map[string]map[string]float64{
+		"cpu_usage":         delta(from.CPUUsage, to.CPUUsage),
+		"memory_percent":    delta(from.MemoryPercent, to.MemoryPercent),
+		"memory_used":       delta(float64(from.MemoryUsed), float64(to.MemoryUsed)),
+		"disk_percent":      delta(from.DiskPercent, to.DiskPercent),
+		"disk_used":         delta(float64(from.DiskUsed), float64(to.DiskUsed)),
+		"network_bytes_in":  delta(float64(from.NetworkBytesIn), float64(to.NetworkBytesIn)),
+		"network_bytes_out": delta(float64(from.NetworkBytesOut), float64(to.NetworkBytesOut)),
+	}
+}
+
+// maxSmoothWindow caps the moving average window of chart data
+const maxSmoothWindow = 100
+
+// smoothChartData replaces each numeric series in the chart points with its
+// trailing moving average over window points. Points near the start average
+// over the points available so far.
+func smoothChartData(data []map[string]interface{}, window int) []map[string]interface{} {
+	smoothed := make([]map[string]interface{}, len(data))
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
 
-		// Memory
-		totalMemory += metric.MemoryPercent
-		if metric.MemoryPercent > maxMemory {
-			maxMemory = metric.MemoryPercent
+	for i, point := range data {
+		out := make(map[string]interface{}, len(point))
+		for key, value := range point {
+			v, ok := chartValue(value)
+			if !ok {
+				out[key] = value
+				continue
+			}
+
+			sums[key] += v
+			counts[key]++
+			if i >= window {
+				if old, ok := chartValue(data[i-window][key]); ok {
+					sums[key] -= old
+					counts[key]--
+				}
+			}
+			out[key] = sums[key] / float64(counts[key])
 		}
-		if metric.MemoryPercent < minMemory {
-			minMemory = metric.MemoryPercent
+		smoothed[i] = out
+	}
+
+	return smoothed
+}
+
+// chartValue converts a numeric chart value to float64
+func chartValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case uint64:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// networkTotalRate returns the combined received and sent bytes per second
+// reported by the agent, or else between metrics[i] and the sample before it
+// (metrics are newest first), nil for the oldest sample and across counter
+// resets
+func networkTotalRate(metrics []models.Metric, i int) interface{} {
+	if in, out := metrics[i].NetworkRateIn, metrics[i].NetworkRateOut; in != nil && out != nil {
+		return *in + *out
+	}
+	if i+1 >= len(metrics) {
+		return nil
+	}
+	current, previous := metrics[i], metrics[i+1]
+
+	elapsed := current.Time.Sub(previous.Time).Seconds()
+	currentTotal := current.NetworkBytesIn + current.NetworkBytesOut
+	previousTotal := previous.NetworkBytesIn + previous.NetworkBytesOut
+	if elapsed <= 0 || currentTotal < previousTotal {
+		return nil
+	}
+	return float64(currentTotal-previousTotal) / elapsed
+}
+
+// breakChartGaps inserts a null point into every gap between consecutive
+// chart points longer than threshold times the expected sample interval, so
+// charts break the line instead of drawing across missing data. The expected
+// interval is the server's storage bucket when it has one, and otherwise the
+// median spacing of the points, which are newest first.
+func breakChartGaps(data []map[string]interface{}, threshold float64, bucket time.Duration) []map[string]interface{} {
+	interval := bucket
+	if interval <= 0 {
+		interval = medianChartInterval(data)
+	}
+	if interval <= 0 {
+		return data
+	}
+	maxGap := time.Duration(threshold * float64(interval))
+
+	broken := make([]map[string]interface{}, 0, len(data))
+	for i, point := range data {
+		broken = append(broken, point)
+		if i+1 == len(data) {
+			break
 		}
 
-		// Disk
-		totalDisk += metric.DiskPercent
-		if metric.DiskPercent > maxDisk {
-			maxDisk = metric.DiskPercent
+		newer, _ := point["timestamp"].(time.Time)
+		older, _ := data[i+1]["timestamp"].(time.Time)
+		if newer.Sub(older) <= maxGap {
+			continue
 		}
-		if metric.DiskPercent < minDisk {
-			minDisk = metric.DiskPercent
+
+		gap := make(map[string]interface{}, len(point))
+		for key := range point {
+			gap[key] = nil
 		}
+		gap["timestamp"] = older.Add(interval)
+		broken = append(broken, gap)
 	}
 
-	count := float64(len(metrics))
-	return map[string]interface{}{
-		"cpu": map[string]float64{
-			"average": totalCPU / count,
-			"max":     maxCPU,
-			"min":     minCPU,
-		},
-		"memory": map[string]float64{
-			"average": totalMemory / count,
-			"max":     maxMemory,
-			"min":     minMemory,
-		},
-		"disk": map[string]float64{
-			"average": totalDisk / count,
-			"max":     maxDisk,
-			"min":     minDisk,
-		},
+	return broken
+}
+
+// medianChartInterval returns the median spacing between consecutive chart
+// points, or 0 with fewer than two points
+func medianChartInterval(data []map[string]interface{}) time.Duration {
+	var intervals []time.Duration
+	for i := 0; i+1 < len(data); i++ {
+		newer, _ := data[i]["timestamp"].(time.Time)
+		older, _ := data[i+1]["timestamp"].(time.Time)
+		if d := newer.Sub(older); d > 0 {
+			intervals = append(intervals, d)
+		}
+	}
+	if len(intervals) == 0 {
+		return 0
 	}
+
+	sort.Slice(intervals, func(a, b int) bool { return intervals[a] < intervals[b] })
+	return intervals[len(intervals)/2]
 }
 
+// chartTypes are the selectable chart series. Besides the raw fields there
+// are derived series computed server-side, so clients don't each repeat the
+// unit math: memory and disk sizes in GB (1024³ bytes) and the combined
+// network rate in bytes per second. "all" returns CPU, memory and disk usage.
+var chartTypes = map[string]bool{
+	"cpu":              true,
+	"cpu_core":         true,
+	"memory":           true,
+	"swap":             true,
+	"disk":             true,
+	"network":          true,
+	"load":             true,
+	"context_switches": true,
+	"disk_latency":     true,
+	"disk_mounts":      true,
+	"disk_throughput":  true,
+	"memory_pressure":  true,
+	"all":              true,
+
+	"memory_used_gb":      true,
+	"memory_available_gb": true,
+	"disk_used_gb":        true,
+	"disk_free_gb":        true,
+	"network_total_rate":  true,
+}
+
+// chartTypeNames lists the chart types in sorted order
+func chartTypeNames() []string {
+	names := make([]string, 0, len(chartTypes))
+	for name := range chartTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// bytesPerGB converts byte counts to the GB of the derived chart series
+const bytesPerGB = 1 << 30
+
 func formatChartData(metrics []models.Metric, metricType string) []map[string]interface{} {
 	data := make([]map[string]any, len(metrics))
 
@@ -379,15 +1106,54 @@ func formatChartData(metrics []models.Metric, metricType string) []map[string]in
 		}
 
 		switch metricType {
+		case "memory_used_gb":
+			point["value"] = float64(metric.MemoryUsed) / bytesPerGB
+		case "memory_available_gb":
+			point["value"] = float64(metric.MemoryAvailable) / bytesPerGB
+		case "disk_used_gb":
+			point["value"] = float64(metric.DiskUsed) / bytesPerGB
+		case "disk_free_gb":
+			point["value"] = float64(metric.DiskFree) / bytesPerGB
+		case "network_total_rate":
+			point["value"] = networkTotalRate(metrics, i)
 		case "cpu":
 			point["value"] = metric.CPUUsage
+		case "cpu_core":
+			// One key per core, core_0 onwards, so each charts as its own
+			// series; points from agents without per-core usage have none
+			for core, usage := range metric.CPUPerCore {
+				point["core_"+strconv.Itoa(core)] = usage
+			}
 		case "memory":
 			point["value"] = metric.MemoryPercent
+		case "swap":
+			point["value"] = metric.SwapPercent
 		case "disk":
 			point["value"] = metric.DiskPercent
 		case "network":
 			point["bytes_in"] = metric.NetworkBytesIn
 			point["bytes_out"] = metric.NetworkBytesOut
+			point["rate_in"] = metric.NetworkRateIn
+			point["rate_out"] = metric.NetworkRateOut
+		case "load":
+			point["load1"] = metric.Load1
+			point["load5"] = metric.Load5
+			point["load15"] = metric.Load15
+			point["load_per_core"] = metric.LoadPerCore
+		case "context_switches":
+			point["context_switches"] = metric.ContextSwitchRate
+			point["interrupts"] = metric.InterruptRate
+		case "disk_latency":
+			point["devices"] = metric.DiskIO
+		case "disk_mounts":
+			point["mounts"] = metric.Disks
+		case "disk_throughput":
+			point["read_bytes"] = metric.DiskReadBytes
+			point["write_bytes"] = metric.DiskWriteBytes
+		case "memory_pressure":
+			point["some_avg10"] = metric.MemoryPressureSome
+			point["full_avg10"] = metric.MemoryPressureFull
+			point["oom_kills"] = metric.OOMKills
 		default:
 			point["cpu"] = metric.CPUUsage
 			point["memory"] = metric.MemoryPercent
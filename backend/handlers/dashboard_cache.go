@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"sync"
+	"time"
+)
+
+// dashboardCache holds recent dashboard responses per user so auto-refreshing
+// clients don't rebuild them on every request. Entries are keyed by internal
+// user ID, so users never see each other's data, and the number of entries
+// is bounded. A nil cache is disabled.
+type dashboardCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mutex   sync.Mutex
+	entries map[uint]dashboardCacheEntry
+}
+
+type dashboardCacheEntry struct {
+	response DashboardResponse
+	expires  time.Time
+}
+
+// newDashboardCache returns nil when ttl is not positive
+func newDashboardCache(ttl time.Duration, maxEntries int) *dashboardCache {
+	if ttl <= 0 || maxEntries < 1 {
+		return nil
+	}
+	return &dashboardCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[uint]dashboardCacheEntry),
+	}
+}
+
+// get returns the cached response for a user if it has not expired
+func (c *dashboardCache) get(userID uint) (DashboardResponse, bool) {
+	if c == nil {
+		return DashboardResponse{}, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[userID]
+	if !ok || time.Now().After(entry.expires) {
+		return DashboardResponse{}, false
+	}
+	return entry.response, true
+}
+
+// set stores a user's response, evicting expired entries and then the entry
+// closest to expiry when the cache is full
+func (c *dashboardCache) set(userID uint, response DashboardResponse) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if _, exists := c.entries[userID]; !exists && len(c.entries) >= c.maxEntries {
+		var oldestID uint
+		var oldest time.Time
+		for id, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, id)
+				continue
+			}
+			if oldest.IsZero() || entry.expires.Before(oldest) {
+				oldestID, oldest = id, entry.expires
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			delete(c.entries, oldestID)
+		}
+	}
+
+	c.entries[userID] = dashboardCacheEntry{
+		response: response,
+		expires:  now.Add(c.ttl),
+	}
+}
+
+// invalidate drops a user's cached response
+func (c *dashboardCache) invalidate(userID uint) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	delete(c.entries, userID)
+	c.mutex.Unlock()
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/models"
+	"backend/testdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSeriesStatistics(t *testing.T) {
+	values := make([]float64, 0, 101)
+	for i := 100; i >= 0; i-- {
+		values = append(values, float64(i))
+	}
+
+	stats := seriesStatistics(values)
+	want := map[string]float64{"average": 50, "min": 0, "max": 100, "p50": 50, "p95": 95, "p99": 99}
+	for key, expected := range want {
+		if math.Abs(stats[key]-expected) > 1e-9 {
+			t.Errorf("%s = %v, want %v", key, stats[key], expected)
+		}
+	}
+	if values[0] != 100 {
+		t.Errorf("seriesStatistics reordered its input")
+	}
+}
+
+func TestPercentileInterpolates(t *testing.T) {
+	if got := percentile([]float64{10, 20}, 0.95); math.Abs(got-19.5) > 1e-9 {
+		t.Errorf("percentile = %v, want 19.5", got)
+	}
+	if got := percentile([]float64{7}, 0.99); got != 7 {
+		t.Errorf("percentile of one value = %v, want 7", got)
+	}
+}
+
+func TestCalculateMetricsStatisticsNetwork(t *testing.T) {
+	now := time.Now()
+	metrics := []models.Metric{
+		{Time: now, CPUUsage: 30, NetworkBytesIn: 3000, NetworkBytesOut: 1000},
+		{Time: now.Add(-10 * time.Second), CPUUsage: 10, NetworkBytesIn: 1000, NetworkBytesOut: 1000},
+	}
+
+	stats := calculateMetricsStatistics(metrics)
+	network, ok := stats["network"].(map[string]float64)
+	if !ok {
+		t.Fatalf("statistics have no network block: %v", stats)
+	}
+	if network["average"] != 200 {
+		t.Errorf("network average = %v, want 200 bytes/s", network["average"])
+	}
+	if cpu := stats["cpu"].(map[string]float64); cpu["min"] != 10 || cpu["max"] != 30 {
+		t.Errorf("cpu stats = %v", cpu)
+	}
+}
+
+// dashboardBenchServers is the size of the fleet dashboard benchmarks build
+const dashboardBenchServers = 50
+
+// benchmarkDashboardHandler seeds the database in MONITAUR_TEST_DSN with a
+// user owning connected servers, each with a metric and an open alert, and
+// returns a handler for it and the user's UID
+func TestFilterDashboardServersKeepsSummary(t *testing.T) {
+	response := DashboardResponse{
+		Summary: DashboardSummary{TotalServers: 3, OnlineServers: 2, OfflineServers: 1, WarningServers: 1},
+		Servers: []ServerSummary{
+			{Server: &models.Server{Name: "healthy"}, IsConnected: true, LatestMetrics: &models.Metric{CPUUsage: 10}},
+			{Server: &models.Server{Name: "busy"}, IsConnected: true, LatestMetrics: &models.Metric{CPUUsage: 95}},
+			{Server: &models.Server{Name: "down"}},
+		},
+		SystemHealth: SystemHealth{AverageCPU: 52.5},
+	}
+
+	for _, tc := range []struct {
+		filter  string
+		servers []string
+	}{
+		{"", []string{"healthy", "busy", "down"}},
+		{"offline", []string{"down"}},
+		{"warning", []string{"busy"}},
+		{"offline,warning", []string{"busy", "down"}},
+		{"online", []string{"healthy", "busy"}},
+	} {
+		statuses, err := parseStatusFilter(tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filtered := filterDashboardServers(response, statuses)
+
+		var names []string
+		for _, server := range filtered.Servers {
+			names = append(names, server.Name)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(tc.servers) {
+			t.Errorf("status=%s: servers %v, want %v", tc.filter, names, tc.servers)
+		}
+		if filtered.Summary != response.Summary || filtered.SystemHealth != response.SystemHealth {
+			t.Errorf("status=%s: summary %+v, health %+v; want the totals over all servers",
+				tc.filter, filtered.Summary, filtered.SystemHealth)
+		}
+	}
+
+	// The (cached) response being filtered is left intact
+	if len(response.Servers) != 3 || response.Servers[0].Name != "healthy" {
+		t.Errorf("filtering changed the original servers: %v", response.Servers)
+	}
+}
+
+func benchmarkDashboardHandler(b *testing.B) (*DashboardHandler, string) {
+	b.Helper()
+	db := testdb.Open(b)
+	user := testdb.User(b, db)
+	ws := &WebSocketHandler{
+		db:             db,
+		config:         &config.Config{},
+		connections:    make(map[uint]*AgentConnection),
+		dashboardCache: newDashboardCache(time.Minute, 100),
+	}
+
+	for i := 0; i < dashboardBenchServers; i++ {
+		server := testdb.Server(b, db, user, fmt.Sprintf("bench-%d", i))
+		ws.connections[server.ID] = &AgentConnection{server: server}
+
+		if _, err := db.CreateMetric(&models.Metric{ServerID: server.ID, Time: time.Now(), CPUUsage: 50}); err != nil {
+			b.Fatal(err)
+		}
+		if err := db.CreateAlert(&models.Alert{ServerID: server.ID, Type: "cpu", Level: "warning", Message: "bench"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return NewDashboardHandler(db, ws), user.FirebaseUID
+}
+
+func BenchmarkGetDashboardData(b *testing.B) {
+	h, uid := benchmarkDashboardHandler(b)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/dashboard", func(c *gin.Context) {
+		c.Set("user_uid", uid)
+		c.Set("user_email", "bench@example.com")
+	}, h.GetDashboardData)
+
+	for _, bc := range []struct {
+		name         string
+		cacheControl string
+	}{
+		{"cached", ""},
+		{"uncached", "no-cache"},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+				if bc.cacheControl != "" {
+					req.Header.Set("Cache-Control", bc.cacheControl)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					b.Fatalf("status %d: %s", w.Code, w.Body)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFetchServerSummaries(b *testing.B) {
+	h, uid := benchmarkDashboardHandler(b)
+	servers, err := h.db.GetUserServers(uid)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bc := range []struct {
+		name        string
+		concurrency int
+	}{
+		{"serial", 1},
+		{"parallel", dashboardFetchConcurrency},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				h.fetchServerSummaries(servers, bc.concurrency)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"backend/config"
+	"backend/models"
+)
+
+// validateEmailBranding normalises a server's email branding, rejecting
+// sender addresses outside the allowed domains so servers can't spoof
+// arbitrary senders
+func validateEmailBranding(branding models.EmailBranding, smtpConfig config.SMTPConfig) (models.EmailBranding, error) {
+	branding.FromAddress = strings.TrimSpace(branding.FromAddress)
+	branding.FromName = strings.TrimSpace(branding.FromName)
+	branding.ProductName = strings.TrimSpace(branding.ProductName)
+	branding.LogoURL = strings.TrimSpace(branding.LogoURL)
+
+	if branding.FromAddress != "" {
+		addr, err := mail.ParseAddress(branding.FromAddress)
+		if err != nil || addr.Address != branding.FromAddress {
+			return branding, fmt.Errorf("invalid from address: %q", branding.FromAddress)
+		}
+		if !fromAddressAllowed(branding.FromAddress, smtpConfig) {
+			return branding, fmt.Errorf("from address %q is not in an allowed domain", branding.FromAddress)
+		}
+	}
+
+	// Names end up in mail headers
+	if strings.ContainsAny(branding.FromName, "\r\n") || strings.ContainsAny(branding.ProductName, "\r\n") {
+		return branding, fmt.Errorf("names must not contain line breaks")
+	}
+	if len(branding.FromName) > 100 || len(branding.ProductName) > 100 {
+		return branding, fmt.Errorf("names must be at most 100 characters")
+	}
+
+	if branding.LogoURL != "" {
+		u, err := url.Parse(branding.LogoURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return branding, fmt.Errorf("logo URL must be an absolute http(s) URL")
+		}
+	}
+
+	return branding, nil
+}
+
+// addEmailBrandingUpdates adds the column updates for a server's branding
+func addEmailBrandingUpdates(updates map[string]interface{}, branding models.EmailBranding) {
+	updates["email_from_address"] = branding.FromAddress
+	updates["email_from_name"] = branding.FromName
+	updates["email_product_name"] = branding.ProductName
+	updates["email_logo_url"] = branding.LogoURL
+}
+
+// fromAddressAllowed reports whether address is in one of the configured
+// sender domains, or the domain of the global sender when none are configured
+func fromAddressAllowed(address string, smtpConfig config.SMTPConfig) bool {
+	domains := smtpConfig.AllowedFromDomains
+	if len(domains) == 0 {
+		domains = []string{emailDomain(smtpConfig.From)}
+	}
+
+	domain := emailDomain(address)
+	for _, allowed := range domains {
+		if allowed != "" && strings.EqualFold(domain, strings.TrimSpace(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+func emailDomain(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return ""
+	}
+	return address[at+1:]
+}
+
+// emailBranding returns the effective branding of a server's alert emails,
+// filling unset fields from the global SMTP configuration
+func (h *WebSocketHandler) emailBranding(server *models.Server) models.EmailBranding {
+	smtpConfig := h.config.SMTP
+	branding := server.EmailBranding
+
+	// The allowed domains may have changed since the address was saved
+	if branding.FromAddress == "" || !fromAddressAllowed(branding.FromAddress, smtpConfig) {
+		branding.FromAddress = smtpConfig.From
+	}
+	if branding.FromName == "" {
+		branding.FromName = smtpConfig.FromName
+	}
+	if branding.ProductName == "" {
+		branding.ProductName = smtpConfig.ProductName
+	}
+	if branding.ProductName == "" {
+		branding.ProductName = "Monitaur"
+	}
+	if branding.LogoURL == "" {
+		branding.LogoURL = smtpConfig.LogoURL
+	}
+
+	return branding
+}
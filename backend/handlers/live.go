@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"backend/apierror"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// liveDeltaWindow is how far back the live view looks for the sample its
+// changes are measured against
+const liveDeltaWindow = time.Minute
+
+// Agent default alert thresholds, used for servers whose thresholds aren't
+// managed by the backend
+var defaultAlertThresholds = map[string]float64{
+	"cpu":           80,
+	"memory":        85,
+	"disk":          90,
+	"load_per_core": 1.5,
+}
+
+// LiveDeltas are short-term changes ending at the latest metric. Fields are
+// nil when there are too few samples to compute them.
+type LiveDeltas struct {
+	// Percentage point changes since the sample closest to a minute before
+	// the latest, OverSeconds apart
+	OverSeconds  *float64 `json:"over_seconds"`
+	CPUChange    *float64 `json:"cpu_change"`
+	MemoryChange *float64 `json:"memory_change"`
+	DiskChange   *float64 `json:"disk_change"`
+
+	// Network bytes per second since the previous sample
+	NetworkInRate  *float64 `json:"network_in_rate"`
+	NetworkOutRate *float64 `json:"network_out_rate"`
+}
+
+// LiveBreach compares a latest value with its alert threshold
+type LiveBreach struct {
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Breached  bool    `json:"breached"`
+}
+
+// GetServerLive returns the latest metric of a server with its short-term
+// changes and threshold breaches, for live status widgets
+func (h *APIHandler) GetServerLive(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	latest, err := h.db.GetLatestMetrics(server.ID)
+	if err == gorm.ErrRecordNotFound {
+		// Cold start: nothing reported yet
+		c.JSON(http.StatusOK, gin.H{
+			"server_id":    server.ID,
+			"is_connected": h.ws.IsAgentConnected(server.ID),
+			"latest":       nil,
+			"samples":      0,
+			"deltas":       LiveDeltas{},
+			"breaches":     gin.H{},
+		})
+		return
+	} else if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get metrics")
+		return
+	}
+
+	// Samples up to twice the window back, newest first, ending with latest
+	recent, err := h.db.GetServerMetricsBetween(server.ID, latest.Time.Add(-2*liveDeltaWindow), latest.Time.Add(time.Nanosecond))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get metrics")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":    server.ID,
+		"is_connected": h.ws.IsAgentConnected(server.ID),
+		"latest":       latest,
+		"samples":      len(recent),
+		"deltas":       liveDeltas(recent),
+		"breaches":     liveBreaches(latest, server.AlertThresholds),
+	})
+}
+
+// liveDeltas computes the changes ending at metrics[0]; metrics are newest first
+func liveDeltas(metrics []models.Metric) LiveDeltas {
+	var deltas LiveDeltas
+	if len(metrics) < 2 {
+		return deltas
+	}
+	latest, previous := metrics[0], metrics[1]
+
+	if elapsed := latest.Time.Sub(previous.Time).Seconds(); elapsed > 0 {
+		if latest.NetworkBytesIn >= previous.NetworkBytesIn {
+			rate := float64(latest.NetworkBytesIn-previous.NetworkBytesIn) / elapsed
+			deltas.NetworkInRate = &rate
+		}
+		if latest.NetworkBytesOut >= previous.NetworkBytesOut {
+			rate := float64(latest.NetworkBytesOut-previous.NetworkBytesOut) / elapsed
+			deltas.NetworkOutRate = &rate
+		}
+	}
+
+	// The sample closest to a minute before the latest
+	target := latest.Time.Add(-liveDeltaWindow)
+	baseline := metrics[1]
+	for _, metric := range metrics[2:] {
+		if absDuration(metric.Time.Sub(target)) < absDuration(baseline.Time.Sub(target)) {
+			baseline = metric
+		}
+	}
+
+	over := latest.Time.Sub(baseline.Time).Seconds()
+	cpu := latest.CPUUsage - baseline.CPUUsage
+	memory := latest.MemoryPercent - baseline.MemoryPercent
+	disk := latest.DiskPercent - baseline.DiskPercent
+	deltas.OverSeconds = &over
+	deltas.CPUChange = &cpu
+	deltas.MemoryChange = &memory
+	deltas.DiskChange = &disk
+	return deltas
+}
+
+// liveBreaches compares the latest metric with the server's managed alert
+// thresholds, or the agent defaults for thresholds that aren't managed
+func liveBreaches(latest *models.Metric, managed models.AlertThresholds) map[string]LiveBreach {
+	threshold := func(name string, value *float64) float64 {
+		if value != nil {
+			return *value
+		}
+		return defaultAlertThresholds[name]
+	}
+
+	values := map[string]float64{
+		"cpu":    latest.CPUUsage,
+		"memory": latest.MemoryPercent,
+		"disk":   latest.DiskPercent,
+	}
+	thresholds := map[string]float64{
+		"cpu":    threshold("cpu", managed.CPU),
+		"memory": threshold("memory", managed.Memory),
+		"disk":   threshold("disk", managed.Disk),
+	}
+	if latest.LoadPerCore != nil {
+		values["load_per_core"] = *latest.LoadPerCore
+		thresholds["load_per_core"] = threshold("load_per_core", managed.LoadPerCore)
+	}
+
+	breaches := make(map[string]LiveBreach, len(values))
+	for name, value := range values {
+		breaches[name] = LiveBreach{
+			Value:     value,
+			Threshold: thresholds[name],
+			Breached:  thresholds[name] > 0 && value > thresholds[name],
+		}
+	}
+	return breaches
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
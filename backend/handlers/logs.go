@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"backend/apierror"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logStore keeps the most recent log lines shipped by each server's agent in
+// memory. Lines are not persisted and are lost on restart.
+type logStore struct {
+	capacity     int
+	maxLineBytes int
+
+	mutex sync.Mutex
+	rings map[uint]*logRing
+}
+
+// logRing is a fixed size ring buffer of log lines
+type logRing struct {
+	lines []models.LogLine
+	next  int
+	full  bool
+
+	// dropped counts lines the agent reported skipping
+	dropped int
+}
+
+func newLogStore(capacity, maxLineBytes int) *logStore {
+	return &logStore{
+		capacity:     capacity,
+		maxLineBytes: maxLineBytes,
+		rings:        make(map[uint]*logRing),
+	}
+}
+
+// add appends a batch of lines for a server, truncating long lines
+func (s *logStore) add(serverID uint, batch models.LogsData) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ring, ok := s.rings[serverID]
+	if !ok {
+		ring = &logRing{lines: make([]models.LogLine, s.capacity)}
+		s.rings[serverID] = ring
+	}
+
+	ring.dropped += batch.Dropped
+	for _, line := range batch.Lines {
+		if len(line.Line) > s.maxLineBytes {
+			line.Line = line.Line[:s.maxLineBytes]
+		}
+		ring.lines[ring.next] = line
+		ring.next = (ring.next + 1) % len(ring.lines)
+		if ring.next == 0 {
+			ring.full = true
+		}
+	}
+}
+
+// recent returns up to limit of a server's latest lines, oldest first, and
+// how many lines the agent has dropped
+func (s *logStore) recent(serverID uint, limit int) ([]models.LogLine, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ring, ok := s.rings[serverID]
+	if !ok {
+		return []models.LogLine{}, 0
+	}
+
+	count := ring.next
+	if ring.full {
+		count = len(ring.lines)
+	}
+	if limit > count {
+		limit = count
+	}
+
+	lines := make([]models.LogLine, limit)
+	start := ring.next - limit
+	for i := range lines {
+		lines[i] = ring.lines[(start+i+len(ring.lines))%len(ring.lines)]
+	}
+	return lines, ring.dropped
+}
+
+// remove forgets a server's lines
+func (s *logStore) remove(serverID uint) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.rings, serverID)
+}
+
+// handleLogsMessage buffers log lines from an agent if the server accepts logs
+func (h *WebSocketHandler) handleLogsMessage(agentConn *AgentConnection, message models.AgentMessage) {
+	server, err := h.db.GetServerByID(agentConn.server.ID)
+	if err != nil {
+		log.Printf("Error fetching server %d: %v", agentConn.server.ID, err)
+		return
+	}
+	if !server.LogsEnabled {
+		return
+	}
+
+	jsonData, err := json.Marshal(message.Data)
+	if err != nil {
+		log.Printf("Error marshaling logs: %v", err)
+		return
+	}
+
+	var batch models.LogsData
+	if err := json.Unmarshal(jsonData, &batch); err != nil {
+		log.Printf("Error unmarshaling logs: %v", err)
+		return
+	}
+
+	h.logs.add(server.ID, batch)
+}
+
+const defaultLogLimit = 200
+
+// GetServerLogs returns the latest log lines shipped by a server's agent,
+// oldest first, e.g. ?limit=500
+func (h *APIHandler) GetServerLogs(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	maxLimit := h.ws.config.Logs.BufferLines
+	limit := defaultLogLimit
+	if param := c.Query("limit"); param != "" {
+		if _, err := fmt.Sscanf(param, "%d", &limit); err != nil || limit < 1 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid limit")
+			return
+		}
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+
+	lines, dropped := h.ws.logs.recent(server.ID, limit)
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":    server.ID,
+		"logs_enabled": server.LogsEnabled,
+		"lines":        lines,
+		"dropped":      dropped,
+	})
+}
+
+// EnableLogs starts accepting log lines shipped by a server's agent
+func (h *APIHandler) EnableLogs(c *gin.Context) {
+	h.setLogsEnabled(c, true)
+}
+
+// DisableLogs stops accepting log lines and discards those buffered
+func (h *APIHandler) DisableLogs(c *gin.Context) {
+	h.setLogsEnabled(c, false)
+}
+
+func (h *APIHandler) setLogsEnabled(c *gin.Context, enabled bool) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.SetLogsEnabled(server.ID, enabled); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
+		return
+	}
+	if !enabled {
+		h.ws.logs.remove(server.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":    server.ID,
+		"logs_enabled": enabled,
+	})
+}
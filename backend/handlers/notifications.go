@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"backend/config"
+	"backend/models"
+)
+
+// notifier delivers an alert over a single notification channel
+type notifier func(server *models.Server, alert *models.Alert)
+
+// webhookClient posts notifications to chat and webhook endpoints
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// notificationQueue bounds how many notifications are sent at once, so an
+// alert storm can't open thousands of SMTP connections. Sends beyond the
+// limit wait for a free slot.
+type notificationQueue struct {
+	slots  chan struct{}
+	queued atomic.Int64
+}
+
+func newNotificationQueue(limit int) *notificationQueue {
+	return &notificationQueue{slots: make(chan struct{}, limit)}
+}
+
+// run calls send once a slot is free
+func (q *notificationQueue) run(send func()) {
+	q.queued.Add(1)
+	q.slots <- struct{}{}
+	q.queued.Add(-1)
+	defer func() { <-q.slots }()
+
+	send()
+}
+
+// depth returns how many notifications are waiting for a slot
+func (q *notificationQueue) depth() int64 {
+	return q.queued.Load()
+}
+
+// NotificationQueueDepth returns how many notifications are waiting to be sent
+func (h *WebSocketHandler) NotificationQueueDepth() int64 {
+	return h.notifications.depth()
+}
+
+// registerNotifiers sets up the available notification channels
+func (h *WebSocketHandler) registerNotifiers() {
+	h.notifiers = map[string]notifier{
+		"email":   h.sendEmailAlert,
+		"slack":   h.sendSlackAlert,
+		"webhook": h.sendWebhookAlert,
+	}
+}
+
+// DefaultAlertChannels returns the channels used when no alert route
+// matches, acting as an implicit catch-all rule: email, plus Slack and the
+// webhook when they are configured
+func (h *WebSocketHandler) DefaultAlertChannels() []string {
+	channels := []string{"email"}
+	if h.config.Slack.WebhookURL != "" {
+		channels = append(channels, "slack")
+	}
+	if h.config.Webhook.URL != "" {
+		channels = append(channels, "webhook")
+	}
+	return channels
+}
+
+// SupportedAlertChannels returns the names of the notification channels
+// alert routes may use
+func (h *WebSocketHandler) SupportedAlertChannels() []string {
+	channels := make([]string, 0, len(h.notifiers))
+	for name := range h.notifiers {
+		channels = append(channels, name)
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// dispatchAlert sends an alert to every channel selected by the owner's routes
+func (h *WebSocketHandler) dispatchAlert(server *models.Server, alert *models.Alert) {
+	for _, channel := range h.resolveAlertChannels(server, alert) {
+		send, ok := h.notifiers[channel]
+		if !ok {
+			log.Printf("Unknown notification channel %q for server %s", channel, server.Name)
+			continue
+		}
+		h.notifications.run(func() { send(server, alert) })
+	}
+}
+
+// resolveAlertChannels evaluates the server owner's alert routes
+func (h *WebSocketHandler) resolveAlertChannels(server *models.Server, alert *models.Alert) []string {
+	routes, err := h.db.GetUserAlertRoutes(server.UserID)
+	if err != nil {
+		log.Printf("Error loading alert routes for user %d: %v", server.UserID, err)
+		return h.DefaultAlertChannels()
+	}
+	channels, matched := matchAlertRoutes(routes, server, alert, h.config.Notifications.RoutingMode)
+	if !matched {
+		return h.DefaultAlertChannels()
+	}
+	return channels
+}
+
+// matchAlertRoutes returns the de-duplicated channels of the matching routes
+// and whether any route matched. Routes must already be in evaluation order.
+func matchAlertRoutes(routes []models.AlertRoute, server *models.Server, alert *models.Alert, mode string) ([]string, bool) {
+	var channels []string
+	seen := make(map[string]bool)
+	matched := false
+
+	for i := range routes {
+		if !routes[i].Matches(server, alert) {
+			continue
+		}
+		matched = true
+
+		for _, channel := range routes[i].Channels {
+			if !seen[channel] {
+				seen[channel] = true
+				channels = append(channels, channel)
+			}
+		}
+
+		if mode == config.RoutingFirstMatch {
+			break
+		}
+	}
+
+	return channels, matched
+}
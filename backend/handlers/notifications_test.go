@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNotificationQueueBoundsConcurrency(t *testing.T) {
+	const limit = 3
+	q := newNotificationQueue(limit)
+
+	var active, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.run(func() {
+				n := active.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(2 * time.Millisecond)
+				active.Add(-1)
+			})
+		}()
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p > limit {
+		t.Errorf("%d notifications ran at once, limit is %d", p, limit)
+	}
+	if d := q.depth(); d != 0 {
+		t.Errorf("queue depth %d after all sends finished, want 0", d)
+	}
+}
+
+func TestNotificationQueueDepth(t *testing.T) {
+	q := newNotificationQueue(1)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go q.run(func() {
+		close(started)
+		<-release
+	})
+	<-started
+
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			q.run(func() {})
+			done <- struct{}{}
+		}()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for q.depth() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth %d, want 2 while the only slot is busy", q.depth())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	<-done
+	<-done
+	if d := q.depth(); d != 0 {
+		t.Errorf("queue depth %d after sends finished, want 0", d)
+	}
+}
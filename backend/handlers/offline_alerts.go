@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"backend/models"
+)
+
+// offlineCheckInterval is how often servers are checked for having stopped
+// reporting
+const offlineCheckInterval = 30 * time.Second
+
+// offlineAlertsEnabled reports whether servers that stop reporting raise
+// offline alerts
+func (h *WebSocketHandler) offlineAlertsEnabled() bool {
+	return h.config.Notifications.OfflineGrace > 0
+}
+
+// offlineRoutine periodically raises offline alerts for servers that stopped
+// reporting and resolves them for servers that are back
+func (h *WebSocketHandler) offlineRoutine() {
+	ticker := time.NewTicker(offlineCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.checkOfflineServers()
+	}
+}
+
+// checkOfflineServers runs a single offline check. Whether a server already
+// has an open offline alert is read from the database, so an outage raises
+// one alert even across backend restarts.
+func (h *WebSocketHandler) checkOfflineServers() {
+	grace := time.Duration(h.config.Notifications.OfflineGrace) * time.Second
+	cutoff := time.Now().Add(-grace)
+
+	servers, err := h.db.GetUnreportedServers(cutoff)
+	if err != nil {
+		log.Printf("Error checking for offline servers: %v", err)
+		return
+	}
+	for i := range servers {
+		h.raiseOfflineAlert(&servers[i], grace)
+	}
+
+	// A connected agent that went quiet and then resumed reporting
+	servers, err = h.db.GetReportingOfflineServers(cutoff)
+	if err != nil {
+		log.Printf("Error checking for servers back online: %v", err)
+		return
+	}
+	for i := range servers {
+		h.resolveOfflineAlert(&servers[i])
+	}
+}
+
+// raiseOfflineAlert records and notifies that a server hasn't reported
+// within the grace period, and marks it offline
+func (h *WebSocketHandler) raiseOfflineAlert(server *models.Server, grace time.Duration) {
+	silence := time.Since(*server.LastSeen)
+	alert := &models.Alert{
+		ServerID: server.ID,
+		Type:     "offline",
+		Level:    "critical",
+		Message: fmt.Sprintf("Server %s has not reported since %s",
+			server.Name, server.LastSeen.Format("2006-01-02 15:04:05 MST")),
+		Value:     silence.Round(time.Second).Seconds(),
+		Threshold: grace.Seconds(),
+	}
+	if err := h.db.CreateAlert(alert); err != nil {
+		log.Printf("Error saving offline alert: %v", err)
+		return
+	}
+
+	// The agent may still hold a connection that stopped sending, or the
+	// backend restarted while the server was marked online
+	h.setServerStatus(server.ID, "offline")
+
+	log.Printf("Server %s (ID: %d) is offline, last seen %s ago", server.Name, server.ID, silence.Round(time.Second))
+	h.InvalidateDashboard(server.UserID)
+	h.dispatchAlert(server, alert)
+}
+
+// resolveOfflineAlert resolves a server's open offline alert, if any, once
+// its agent reports again
+func (h *WebSocketHandler) resolveOfflineAlert(server *models.Server) {
+	if !h.offlineAlertsEnabled() {
+		return
+	}
+	if err := h.db.ResolveServerAlertsOfType(server.ID, "offline"); err != nil {
+		log.Printf("Error resolving offline alert of %s: %v", server.Name, err)
+		return
+	}
+	h.InvalidateDashboard(server.UserID)
+}
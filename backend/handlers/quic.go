@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// QUICProtocol is the ALPN protocol agents negotiate with the QUIC listener
+const QUICProtocol = "monitaur-agent"
+
+// quicHandshakeTimeout bounds how long a new QUIC connection may take to
+// open its stream and authenticate
+const quicHandshakeTimeout = 10 * time.Second
+
+// maxQUICMessageBytes bounds a single message read from a QUIC stream
+const maxQUICMessageBytes = 16 << 20
+
+// quicNormalClosure is the application error code of an orderly close
+const quicNormalClosure quic.ApplicationErrorCode = 0
+
+var quicConfig = &quic.Config{
+	MaxIdleTimeout:  agentReadTimeout,
+	KeepAlivePeriod: 15 * time.Second,
+}
+
+// quicHandshake is the first message an agent sends on its QUIC stream,
+// with what the WebSocket handshake passes as query parameters
+type quicHandshake struct {
+	Token        string `json:"token"`
+	ServerName   string `json:"server_name"`
+	AgentVersion string `json:"agent_version"`
+}
+
+// quicHandshakeReply accepts the agent with status 200, or rejects it with
+// the status and error code the WebSocket handshake would respond with
+type quicHandshakeReply struct {
+	Status int    `json:"status"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ListenQUIC opens the experimental QUIC listener for agents on lossy,
+// high-latency links. tlsConfig must carry the server certificate.
+func ListenQUIC(addr string, tlsConfig *tls.Config) (*quic.Listener, error) {
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.NextProtos = []string{QUICProtocol}
+	return quic.ListenAddr(addr, tlsConfig, quicConfig)
+}
+
+// ServeQUIC accepts agent connections on listener until it is closed. Each
+// connection carries one stream of newline-delimited JSON messages, framed
+// like WebSocket messages.
+func (h *WebSocketHandler) ServeQUIC(listener *quic.Listener) error {
+	for {
+		conn, err := listener.Accept(context.Background())
+		if err != nil {
+			if errors.Is(err, quic.ErrServerClosed) {
+				return nil
+			}
+			return err
+		}
+		go h.handleQUICConnection(conn)
+	}
+}
+
+// handleQUICConnection authenticates a QUIC connection from its handshake
+// message and hands it over like an upgraded WebSocket
+func (h *WebSocketHandler) handleQUICConnection(conn *quic.Conn) {
+	ctx, cancel := context.WithTimeout(conn.Context(), quicHandshakeTimeout)
+	defer cancel()
+
+	stream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		conn.CloseWithError(quicNormalClosure, "")
+		return
+	}
+	transport := newQUICTransport(conn, stream)
+
+	var handshake quicHandshake
+	stream.SetReadDeadline(time.Now().Add(quicHandshakeTimeout))
+	raw, err := transport.ReadMessage()
+	if err == nil {
+		err = json.Unmarshal(raw, &handshake)
+	}
+	if err != nil {
+		log.Printf("Invalid QUIC handshake from %s: %v", conn.RemoteAddr(), err)
+		transport.Close()
+		return
+	}
+	stream.SetReadDeadline(time.Time{})
+
+	clientIP, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	server, status, code, err := h.admitAgent(handshake.Token, handshake.ServerName, handshake.AgentVersion, clientIP)
+	reply := quicHandshakeReply{Status: status, Code: code}
+	if err != nil {
+		reply.Error = err.Error()
+	}
+	data, _ := json.Marshal(reply)
+	if writeErr := transport.WriteMessage(data); writeErr != nil || err != nil {
+		// Let the agent read the rejection before the connection goes away
+		transport.WriteClose()
+		select {
+		case <-conn.Context().Done():
+		case <-ctx.Done():
+		}
+		transport.Close()
+		return
+	}
+
+	h.startAgentConnection(transport, server, handshake.AgentVersion)
+}
+
+// quicTransport carries agent messages as lines of JSON on a QUIC stream
+type quicTransport struct {
+	conn    *quic.Conn
+	stream  *quic.Stream
+	scanner *bufio.Scanner
+
+	pongMutex sync.Mutex
+	pong      func()
+}
+
+func newQUICTransport(conn *quic.Conn, stream *quic.Stream) *quicTransport {
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxQUICMessageBytes)
+	return &quicTransport{conn: conn, stream: stream, scanner: scanner}
+}
+
+func (t *quicTransport) ReadMessage() ([]byte, error) {
+	if !t.scanner.Scan() {
+		if err := t.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return bytes.Clone(t.scanner.Bytes()), nil
+}
+
+func (t *quicTransport) WriteMessage(message []byte) error {
+	t.stream.SetWriteDeadline(time.Now().Add(agentWriteTimeout))
+	// Copy so the newline never lands in the caller's spare capacity
+	_, err := t.stream.Write(append(message[:len(message):len(message)], '\n'))
+	return err
+}
+
+// Ping reports whether the connection is still open. QUIC keep-alives probe
+// the agent, and the connection closes once it stays silent past the idle
+// timeout, so an open connection proves the agent is there.
+func (t *quicTransport) Ping() error {
+	if err := context.Cause(t.conn.Context()); err != nil {
+		return err
+	}
+
+	t.pongMutex.Lock()
+	pong := t.pong
+	t.pongMutex.Unlock()
+	if pong != nil {
+		pong()
+	}
+	return nil
+}
+
+func (t *quicTransport) OnPong(pong func()) {
+	t.pongMutex.Lock()
+	t.pong = pong
+	t.pongMutex.Unlock()
+}
+
+// WriteClose ends our side of the stream; the agent reads it as EOF
+func (t *quicTransport) WriteClose() {
+	t.stream.Close()
+}
+
+func (t *quicTransport) Close() error {
+	t.stream.Close()
+	return t.conn.CloseWithError(quicNormalClosure, "")
+}
+
+func (t *quicTransport) RemoteAddr() net.Addr {
+	return t.conn.RemoteAddr()
+}
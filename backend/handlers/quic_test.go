@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"backend/apierror"
+	"backend/config"
+
+	"github.com/quic-go/quic-go"
+)
+
+// testQUICListener listens on localhost with a self-signed certificate and
+// returns the client TLS config trusting it
+func testQUICListener(t *testing.T) (*quic.Listener, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := ListenQUIC("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return listener, &tls.Config{RootCAs: roots, ServerName: "localhost", NextProtos: []string{QUICProtocol}}
+}
+
+func dialTestQUIC(t *testing.T, listener *quic.Listener, clientTLS *tls.Config) (*quic.Conn, *quic.Stream) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, listener.Addr().String(), clientTLS, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.CloseWithError(0, "") })
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, stream
+}
+
+func TestQUICTransportFramesMessages(t *testing.T) {
+	listener, clientTLS := testQUICListener(t)
+	_, stream := dialTestQUIC(t, listener, clientTLS)
+
+	// The stream only reaches the listener once something is sent on it
+	if _, err := stream.Write([]byte(`{"type":"metrics"}` + "\n" + `{"type":"alert"}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverStream, err := conn.AcceptStream(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := newQUICTransport(conn, serverStream)
+
+	for _, want := range []string{`{"type":"metrics"}`, `{"type":"alert"}`} {
+		message, err := transport.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(message) != want {
+			t.Errorf("read %s, want %s", message, want)
+		}
+	}
+
+	pongs := 0
+	transport.OnPong(func() { pongs++ })
+	if err := transport.Ping(); err != nil || pongs != 1 {
+		t.Errorf("Ping on an open connection: err %v, %d pongs, want no error and 1 pong", err, pongs)
+	}
+
+	if err := transport.WriteMessage([]byte(`{"type":"ack"}`)); err != nil {
+		t.Fatal(err)
+	}
+	transport.WriteClose()
+
+	stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	received, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(received) != `{"type":"ack"}`+"\n" {
+		t.Errorf("agent received %q, want one ack line before EOF", received)
+	}
+
+	// Once closed, the agent is gone
+	transport.Close()
+	if err := transport.Ping(); err == nil {
+		t.Error("Ping on a closed connection succeeded")
+	}
+}
+
+func TestQUICHandshakeRejectsAgent(t *testing.T) {
+	listener, clientTLS := testQUICListener(t)
+	h := &WebSocketHandler{config: &config.Config{}}
+	go h.ServeQUIC(listener)
+
+	_, stream := dialTestQUIC(t, listener, clientTLS)
+	if err := json.NewEncoder(stream).Encode(quicHandshake{ServerName: "no-token"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(stream).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply quicHandshakeReply
+	if err := json.Unmarshal(line, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Status != http.StatusBadRequest || reply.Code != apierror.CodeInvalidRequest || reply.Error != "token required" {
+		t.Errorf("got %+v, want a 400 invalid_request for the missing token", reply)
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"backend/apierror"
+	"backend/config"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// userQuota resolves the quota of a user's plan. Users on an unknown plan get
+// the default plan; with no plans configured everything is unlimited.
+func (h *WebSocketHandler) userQuota(user *models.User) config.PlanQuota {
+	quotas := h.config.Quotas
+	if quota, ok := quotas.Plans[user.Plan]; ok && user.Plan != "" {
+		return quota
+	}
+	return quotas.Plans[quotas.DefaultPlan]
+}
+
+// checkServerQuota responds with 403 and returns false when the user already
+// has as many servers as their plan allows
+func (h *APIHandler) checkServerQuota(c *gin.Context, user *models.User) bool {
+	quota := h.ws.userQuota(user)
+	if quota.MaxServers == 0 {
+		return true
+	}
+
+	count, err := h.db.CountUserServers(user.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to count servers")
+		return false
+	}
+
+	if count >= int64(quota.MaxServers) {
+		apierror.RespondWithDetails(c, http.StatusForbidden, apierror.CodeQuotaExceeded,
+			fmt.Sprintf("Server quota exceeded: your plan allows %d servers", quota.MaxServers),
+			gin.H{"quota": "max_servers", "limit": quota.MaxServers, "used": count})
+		return false
+	}
+	return true
+}
+
+// ingestionLimiter enforces per-user metric ingestion rates with a token
+// bucket per user, shared by all of the user's agent connections
+type ingestionLimiter struct {
+	mutex   sync.Mutex
+	buckets map[uint]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newIngestionLimiter() *ingestionLimiter {
+	return &ingestionLimiter{buckets: make(map[uint]*tokenBucket)}
+}
+
+// allow takes a token from the user's bucket, which holds up to perMinute
+// tokens and refills continuously. perMinute 0 is unlimited.
+func (l *ingestionLimiter) allow(userID uint, perMinute int) bool {
+	if perMinute <= 0 {
+		return true
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	capacity := float64(perMinute)
+	bucket, ok := l.buckets[userID]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, last: now}
+		l.buckets[userID] = bucket
+	}
+
+	bucket.tokens += now.Sub(bucket.last).Minutes() * capacity
+	if bucket.tokens > capacity {
+		bucket.tokens = capacity
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// allowIngestion checks the owner's ingestion quota for a metrics message,
+// logging shed messages at most once a minute per connection
+func (h *WebSocketHandler) allowIngestion(agentConn *AgentConnection) bool {
+	if h.ingestion.allow(agentConn.server.UserID, agentConn.metricsPerMinute) {
+		return true
+	}
+
+	if time.Since(agentConn.lastShedLog) >= time.Minute {
+		agentConn.lastShedLog = time.Now()
+		log.Printf("Ingestion quota of %d metrics/minute exceeded for user %d, dropping metrics from %s",
+			agentConn.metricsPerMinute, agentConn.server.UserID, agentConn.server.Name)
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	var document map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"token": "abc",
+		"signing_secret": "",
+		"interval": 5,
+		"log_tail": {"path": "/var/log/syslog", "password": "pw"},
+		"fallbacks": [
+			{"host": "smtp-1", "password": "one"},
+			{"host": "smtp-2", "password_file": "/run/secrets/smtp"}
+		],
+		"api_tokens": ["t1", "t2", {"nested": "t3"}]
+	}`), &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redactSecrets(document)
+
+	var want map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"token": "[redacted]",
+		"signing_secret": "",
+		"interval": 5,
+		"log_tail": {"path": "/var/log/syslog", "password": "[redacted]"},
+		"fallbacks": [
+			{"host": "smtp-1", "password": "[redacted]"},
+			{"host": "smtp-2", "password_file": "[redacted]"}
+		],
+		"api_tokens": ["[redacted]", "[redacted]", {"nested": "[redacted]"}]
+	}`), &want)
+	if !reflect.DeepEqual(document, want) {
+		got, _ := json.MarshalIndent(document, "", "  ")
+		t.Errorf("redacted document:\n%s", got)
+	}
+}
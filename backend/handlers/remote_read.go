@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/apierror"
+	"backend/database"
+	"backend/models"
+	"backend/promread"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxRemoteReadSamples bounds the samples returned by one remote read request
+const maxRemoteReadSamples = 5_000_000
+
+// remoteReadSeries maps the metric columns to Prometheus series names. value
+// reports false for samples the agent didn't collect.
+var remoteReadSeries = []struct {
+	name  string
+	value func(m *models.Metric) (float64, bool)
+}{
+	{"monitaur_cpu_usage_percent", func(m *models.Metric) (float64, bool) { return m.CPUUsage, true }},
+	{"monitaur_cpu_cores", func(m *models.Metric) (float64, bool) { return float64(m.CPUCores), true }},
+	{"monitaur_memory_total_bytes", func(m *models.Metric) (float64, bool) { return float64(m.MemoryTotal), true }},
+	{"monitaur_memory_used_bytes", func(m *models.Metric) (float64, bool) { return float64(m.MemoryUsed), true }},
+	{"monitaur_memory_available_bytes", func(m *models.Metric) (float64, bool) { return float64(m.MemoryAvailable), true }},
+	{"monitaur_memory_usage_percent", func(m *models.Metric) (float64, bool) { return m.MemoryPercent, true }},
+	{"monitaur_swap_total_bytes", func(m *models.Metric) (float64, bool) { return float64(m.SwapTotal), true }},
+	{"monitaur_swap_used_bytes", func(m *models.Metric) (float64, bool) { return float64(m.SwapUsed), true }},
+	{"monitaur_swap_usage_percent", func(m *models.Metric) (float64, bool) { return m.SwapPercent, true }},
+	{"monitaur_disk_total_bytes", func(m *models.Metric) (float64, bool) { return float64(m.DiskTotal), true }},
+	{"monitaur_disk_used_bytes", func(m *models.Metric) (float64, bool) { return float64(m.DiskUsed), true }},
+	{"monitaur_disk_free_bytes", func(m *models.Metric) (float64, bool) { return float64(m.DiskFree), true }},
+	{"monitaur_disk_usage_percent", func(m *models.Metric) (float64, bool) { return m.DiskPercent, true }},
+	{"monitaur_disk_read_bytes_per_second", func(m *models.Metric) (float64, bool) { return optionalValue(m.DiskReadBytes) }},
+	{"monitaur_disk_written_bytes_per_second", func(m *models.Metric) (float64, bool) { return optionalValue(m.DiskWriteBytes) }},
+	{"monitaur_network_received_bytes_total", func(m *models.Metric) (float64, bool) { return float64(m.NetworkBytesIn), true }},
+	{"monitaur_network_sent_bytes_total", func(m *models.Metric) (float64, bool) { return float64(m.NetworkBytesOut), true }},
+	{"monitaur_memory_pressure_some_percent", func(m *models.Metric) (float64, bool) { return optionalValue(m.MemoryPressureSome) }},
+	{"monitaur_memory_pressure_full_percent", func(m *models.Metric) (float64, bool) { return optionalValue(m.MemoryPressureFull) }},
+	{"monitaur_oom_kills_total", func(m *models.Metric) (float64, bool) {
+		if m.OOMKills == nil {
+			return 0, false
+		}
+		return float64(*m.OOMKills), true
+	}},
+	{"monitaur_network_received_bytes_per_second", func(m *models.Metric) (float64, bool) { return optionalValue(m.NetworkRateIn) }},
+	{"monitaur_network_sent_bytes_per_second", func(m *models.Metric) (float64, bool) { return optionalValue(m.NetworkRateOut) }},
+	{"monitaur_load1", func(m *models.Metric) (float64, bool) { return optionalValue(m.Load1) }},
+	{"monitaur_load5", func(m *models.Metric) (float64, bool) { return optionalValue(m.Load5) }},
+	{"monitaur_load15", func(m *models.Metric) (float64, bool) { return optionalValue(m.Load15) }},
+	{"monitaur_uptime_seconds", func(m *models.Metric) (float64, bool) { return float64(m.Uptime), true }},
+}
+
+// errRemoteReadDatabase marks query failures that aren't the client's fault
+var errRemoteReadDatabase = errors.New("database error")
+
+func optionalValue(value *float64) (float64, bool) {
+	if value == nil {
+		return 0, false
+	}
+	return *value, true
+}
+
+// RemoteReadHandler serves the Prometheus remote read protocol, so Prometheus
+// and Grafana can query the stored metrics of the user owning the API key
+type RemoteReadHandler struct {
+	db *database.Database
+}
+
+func NewRemoteReadHandler(db *database.Database) *RemoteReadHandler {
+	return &RemoteReadHandler{db: db}
+}
+
+// Read answers a snappy compressed protobuf ReadRequest. Every server is a set
+// of series labeled server_id and server, one per metric column.
+func (h *RemoteReadHandler) Read(c *gin.Context) {
+	key := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if key == "" {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "Missing API key")
+		return
+	}
+	user, err := h.db.GetUserByReadAPIKey(key)
+	if err == gorm.ErrRecordNotFound {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "Invalid API key")
+		return
+	} else if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to load user")
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Failed to read request body")
+		return
+	}
+	queries, err := promread.DecodeReadRequest(body)
+	if err != nil {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid remote read request", err.Error())
+		return
+	}
+
+	servers, err := h.db.GetServersByUserID(user.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get servers")
+		return
+	}
+
+	results := make([]promread.QueryResult, len(queries))
+	budget := maxRemoteReadSamples
+	for i, query := range queries {
+		results[i], err = h.runQuery(query, servers, &budget)
+		if errors.Is(err, errRemoteReadDatabase) {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get metrics")
+			return
+		} else if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+			return
+		}
+	}
+
+	c.Header("Content-Encoding", "snappy")
+	c.Data(http.StatusOK, "application/x-protobuf", promread.EncodeReadResponse(results))
+}
+
+// runQuery returns the series of servers matching a query, taking their
+// samples out of budget
+func (h *RemoteReadHandler) runQuery(query promread.Query, servers []models.Server, budget *int) (promread.QueryResult, error) {
+	var result promread.QueryResult
+
+	matchers, err := compileMatchers(query.Matchers)
+	if err != nil {
+		return result, err
+	}
+
+	from := time.UnixMilli(query.StartMs)
+	to := time.UnixMilli(query.EndMs).Add(time.Millisecond)
+
+	for i := range servers {
+		server := &servers[i]
+
+		// Find the matching series before loading any metrics
+		var selected []int
+		for j, series := range remoteReadSeries {
+			if matchers.match(remoteReadLabels(series.name, server)) {
+				selected = append(selected, j)
+			}
+		}
+		if len(selected) == 0 {
+			continue
+		}
+
+		metrics, err := h.db.GetServerMetricsBetween(server.ID, from, to)
+		if err != nil {
+			return result, fmt.Errorf("%w: %v", errRemoteReadDatabase, err)
+		}
+
+		for _, j := range selected {
+			series := promread.TimeSeries{Labels: remoteReadLabels(remoteReadSeries[j].name, server)}
+			// Metrics are newest first; samples must be in ascending order
+			for k := len(metrics) - 1; k >= 0; k-- {
+				if value, ok := remoteReadSeries[j].value(&metrics[k]); ok {
+					series.Samples = append(series.Samples, promread.Sample{
+						Value:       value,
+						TimestampMs: metrics[k].Time.UnixMilli(),
+					})
+				}
+			}
+			if len(series.Samples) == 0 {
+				continue
+			}
+
+			*budget -= len(series.Samples)
+			if *budget < 0 {
+				return result, fmt.Errorf("query exceeds %d samples, narrow the time range or matchers", maxRemoteReadSamples)
+			}
+			result.Timeseries = append(result.Timeseries, series)
+		}
+	}
+
+	return result, nil
+}
+
+// remoteReadLabels are the labels of a server's series, sorted by name as
+// Prometheus expects
+func remoteReadLabels(name string, server *models.Server) []promread.Label {
+	return []promread.Label{
+		{Name: "__name__", Value: name},
+		{Name: "server", Value: server.Name},
+		{Name: "server_id", Value: strconv.FormatUint(uint64(server.ID), 10)},
+	}
+}
+
+type compiledMatcher struct {
+	promread.Matcher
+	re *regexp.Regexp
+}
+
+type matcherSet []compiledMatcher
+
+// compileMatchers compiles regexp matchers, which Prometheus anchors at both ends
+func compileMatchers(matchers []promread.Matcher) (matcherSet, error) {
+	set := make(matcherSet, len(matchers))
+	for i, matcher := range matchers {
+		set[i].Matcher = matcher
+		if matcher.Type == promread.MatchRegexp || matcher.Type == promread.MatchNotRegexp {
+			re, err := regexp.Compile("^(?:" + matcher.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid regexp for label %s: %v", matcher.Name, err)
+			}
+			set[i].re = re
+		}
+	}
+	return set, nil
+}
+
+// match reports whether labels satisfy every matcher; a missing label has
+// the empty value
+func (s matcherSet) match(labels []promread.Label) bool {
+	for _, matcher := range s {
+		value := ""
+		for _, label := range labels {
+			if label.Name == matcher.Name {
+				value = label.Value
+				break
+			}
+		}
+
+		var ok bool
+		switch matcher.Type {
+		case promread.MatchEqual:
+			ok = value == matcher.Value
+		case promread.MatchNotEqual:
+			ok = value != matcher.Value
+		case promread.MatchRegexp:
+			ok = matcher.re.MatchString(value)
+		case promread.MatchNotRegexp:
+			ok = !matcher.re.MatchString(value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateReadAPIKey generates (or rotates) the current user's remote read API
+// key. The key is only returned by this call.
+func (h *APIHandler) CreateReadAPIKey(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	key := uuid.New().String()
+	if err := h.db.SetReadAPIKey(user.ID, &key); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"read_api_key": key,
+		"read_url":     "/prometheus/api/v1/read",
+	})
+}
+
+// DeleteReadAPIKey revokes the current user's remote read API key
+func (h *APIHandler) DeleteReadAPIKey(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.SetReadAPIKey(user.ID, nil); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Remote read disabled"})
+}
@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"backend/apierror"
+	"backend/auth"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultReportDays = 30
+	maxReportDays     = 90
+
+	// reportChartPoints is roughly how many points each report chart has
+	reportChartPoints = 300
+	// reportRecentAlerts is how many of the latest alerts the report lists
+	reportRecentAlerts = 20
+)
+
+// reportData is what the report template renders
+type reportData struct {
+	Server      *models.Server
+	Days        int
+	Since       time.Time
+	GeneratedAt time.Time
+	Product     string
+
+	Samples int64
+	Stats   map[string]models.ResourceStats
+	Uptime  string
+	Charts  []reportChart
+
+	AlertTotal   int
+	AlertsLevel  map[string]int
+	AlertsType   map[string]int
+	RecentAlerts []models.Alert
+}
+
+// reportChart is a resource usage line chart drawn as inline SVG
+type reportChart struct {
+	Title  string
+	Color  string
+	Points string
+}
+
+// GetServerReport renders a downloadable HTML report of a server's usage,
+// uptime and alerts over the last ?days (default 30, max 90). Browsers can
+// print it to PDF.
+func (h *DashboardHandler) GetServerReport(c *gin.Context) {
+	userClaims, exists := auth.GetUserFromContext(c)
+	if !exists {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
+		return
+	}
+
+	serverID, err := parseServerID(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid server ID")
+		return
+	}
+
+	server, err := h.validateServerOwnership(serverID, userClaims.UID)
+	if err != nil {
+		respondOwnershipError(c, err)
+		return
+	}
+
+	days := defaultReportDays
+	if param := c.Query("days"); param != "" {
+		if _, err := fmt.Sscanf(param, "%d", &days); err != nil || days < 1 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid days")
+			return
+		}
+		if days > maxReportDays {
+			days = maxReportDays
+		}
+	}
+
+	data, err := h.buildReport(server, days)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to build report")
+		return
+	}
+
+	filename := fmt.Sprintf("%s-report-%s.html", reportFilename(server.Name), data.GeneratedAt.Format("2006-01-02"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := reportTemplate.Execute(c.Writer, data); err != nil {
+		// Headers are already sent, so the error can only be logged
+		c.Error(err)
+	}
+}
+
+func (h *DashboardHandler) buildReport(server *models.Server, days int) (*reportData, error) {
+	now := time.Now()
+	since := now.AddDate(0, 0, -days)
+
+	data := &reportData{
+		Server:      server,
+		Days:        days,
+		Since:       since,
+		GeneratedAt: now,
+		Product:     h.ws.emailBranding(server).ProductName,
+		AlertsLevel: make(map[string]int),
+		AlertsType:  make(map[string]int),
+	}
+
+	stats, samples, err := h.db.GetMetricStats(server.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	data.Stats = stats
+	data.Samples = samples
+
+	// Uptime from metric gaps, counted from when the server was added at most
+	uptimeSince := since
+	if server.CreatedAt.After(uptimeSince) {
+		uptimeSince = server.CreatedAt
+	}
+	data.Uptime = formatUptime(100)
+	if window := now.Sub(uptimeSince); window > 0 {
+		downtime, err := h.db.GetDowntime(server.ID, uptimeSince, now, time.Duration(h.ws.config.Badges.MaxGap)*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		data.Uptime = formatUptime(math.Max(0, 100*(1-downtime.Seconds()/window.Seconds())))
+	}
+
+	bucket := (now.Sub(since) / reportChartPoints).Truncate(time.Minute)
+	if bucket < time.Minute {
+		bucket = time.Minute
+	}
+	buckets, err := h.db.GetMetricBuckets(server.ID, since, now, bucket)
+	if err != nil {
+		return nil, err
+	}
+	for _, chart := range []struct{ metricType, title, color string }{
+		{"cpu", "CPU usage", "#3b82f6"},
+		{"memory", "Memory usage", "#8b5cf6"},
+		{"disk", "Disk usage", "#f59e0b"},
+	} {
+		data.Charts = append(data.Charts, reportChart{
+			Title:  chart.title,
+			Color:  chart.color,
+			Points: chartPolyline(formatChartData(buckets, chart.metricType), since, now),
+		})
+	}
+
+	alerts, err := h.db.GetServerAlertsSince(server.ID, since)
+	if err != nil {
+		return nil, err
+	}
+	data.AlertTotal = len(alerts)
+	for _, alert := range alerts {
+		data.AlertsLevel[alert.Level]++
+		data.AlertsType[alert.Type]++
+	}
+	if len(alerts) > reportRecentAlerts {
+		alerts = alerts[:reportRecentAlerts]
+	}
+	data.RecentAlerts = alerts
+
+	return data, nil
+}
+
+// chartPolyline maps percentage chart points onto a 600x120 SVG viewBox
+func chartPolyline(points []map[string]interface{}, since, until time.Time) string {
+	span := until.Sub(since).Seconds()
+	var b strings.Builder
+	for _, point := range points {
+		at, ok := point["timestamp"].(time.Time)
+		if !ok {
+			continue
+		}
+		value, ok := chartValue(point["value"])
+		if !ok {
+			continue
+		}
+		x := 600 * at.Sub(since).Seconds() / span
+		y := 120 - 120*math.Min(math.Max(value, 0), 100)/100
+		fmt.Fprintf(&b, "%.1f,%.1f ", x, y)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// reportFilename makes a server name safe to use in a download filename
+func reportFilename(name string) string {
+	name = strings.Trim(unsafeFilenameChars.ReplaceAllString(name, "-"), "-")
+	if name == "" {
+		return "server"
+	}
+	return name
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"pct": func(value float64) string { return fmt.Sprintf("%.1f%%", value) },
+	"date": func(t time.Time) string {
+		return t.Format("2006-01-02 15:04 MST")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>{{.Server.Name}} report | {{.Product}}</title>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.5; color: #333; max-width: 800px; margin: 0 auto; padding: 20px; }
+        h1 { margin-bottom: 0; }
+        .muted { color: #6b7280; }
+        table { border-collapse: collapse; width: 100%; margin: 10px 0 20px; }
+        th, td { text-align: left; padding: 6px 10px; border-bottom: 1px solid #e5e7eb; }
+        .uptime { font-size: 32px; font-weight: bold; }
+        svg { background: #f9fafb; border: 1px solid #e5e7eb; }
+    </style>
+</head>
+<body>
+    <h1>{{.Server.Name}}</h1>
+    <p class="muted">Last {{.Days}} days: {{date .Since}} to {{date .GeneratedAt}}</p>
+
+    <h2>Uptime</h2>
+    <p class="uptime">{{.Uptime}}</p>
+
+    <h2>Resource usage</h2>
+    {{if .Samples}}
+    <table>
+        <tr><th></th><th>Average</th><th>Min</th><th>Max</th></tr>
+        {{with index .Stats "cpu"}}<tr><td>CPU</td><td>{{pct .Average}}</td><td>{{pct .Min}}</td><td>{{pct .Max}}</td></tr>{{end}}
+        {{with index .Stats "memory"}}<tr><td>Memory</td><td>{{pct .Average}}</td><td>{{pct .Min}}</td><td>{{pct .Max}}</td></tr>{{end}}
+        {{with index .Stats "disk"}}<tr><td>Disk</td><td>{{pct .Average}}</td><td>{{pct .Min}}</td><td>{{pct .Max}}</td></tr>{{end}}
+    </table>
+    <p class="muted">{{.Samples}} samples</p>
+    {{range .Charts}}
+    <h3>{{.Title}}</h3>
+    <svg viewBox="0 0 600 120" width="600" height="120" xmlns="http://www.w3.org/2000/svg">
+        <polyline fill="none" stroke="{{.Color}}" stroke-width="1.5" points="{{.Points}}"/>
+    </svg>
+    {{end}}
+    {{else}}
+    <p>No metrics were recorded in this period.</p>
+    {{end}}
+
+    <h2>Alerts</h2>
+    <p>{{.AlertTotal}} alerts raised.</p>
+    {{if .AlertTotal}}
+    <table>
+        <tr><th>Level</th><th>Count</th></tr>
+        {{range $level, $count := .AlertsLevel}}<tr><td>{{$level}}</td><td>{{$count}}</td></tr>{{end}}
+    </table>
+    <table>
+        <tr><th>Type</th><th>Count</th></tr>
+        {{range $type, $count := .AlertsType}}<tr><td>{{$type}}</td><td>{{$count}}</td></tr>{{end}}
+    </table>
+    <h3>Latest alerts</h3>
+    <table>
+        <tr><th>Time</th><th>Level</th><th>Message</th><th>Resolved</th></tr>
+        {{range .RecentAlerts}}<tr><td>{{date .CreatedAt}}</td><td>{{.Level}}</td><td>{{.Message}}</td><td>{{if .Resolved}}yes{{else}}no{{end}}</td></tr>{{end}}
+    </table>
+    {{end}}
+
+    <p class="muted">Generated by {{.Product}}</p>
+</body>
+</html>
+`))
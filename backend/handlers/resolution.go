@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"backend/models"
+)
+
+// Bounds for a server's resolution_seconds; 0 leaves the collection interval
+// to the agent's config and aggregation to aggregation_seconds
+const (
+	minResolutionSeconds = 5
+	maxResolutionSeconds = 3600
+)
+
+func validateResolution(seconds int) error {
+	return validateSeconds("resolution_seconds", seconds, minResolutionSeconds, maxResolutionSeconds)
+}
+
+// validateSeconds checks a per-server interval setting is 0, which turns it
+// off, or within its bounds
+func validateSeconds(field string, seconds, min, max int) error {
+	if seconds != 0 && (seconds < min || seconds > max) {
+		return fmt.Errorf("%s must be 0 or between %d and %d", field, min, max)
+	}
+	return nil
+}
+
+// ingestionBucket is the width of the buckets a server's samples are
+// aggregated into, 0 to store every sample. A resolution is enforced here as
+// well as pushed to the agent, so agents that ignore the pushed interval
+// still don't store more than one row per resolution.
+func ingestionBucket(server *models.Server) time.Duration {
+	if server.ResolutionSeconds > 0 {
+		return time.Duration(server.ResolutionSeconds) * time.Second
+	}
+	return time.Duration(server.AggregationSeconds) * time.Second
+}
+
+// pushCollectionInterval sends a server's resolution to its agent as the
+// collection interval; 0 restores the agent's configured interval
+func (h *WebSocketHandler) pushCollectionInterval(serverID uint, seconds int) error {
+	err := h.SendMessageToAgent(serverID, "config_update", models.IntervalUpdateData{
+		CollectionInterval: seconds,
+	})
+	if err != nil && err != ErrAgentNotConnected {
+		log.Printf("Error pushing collection interval to server %d: %v", serverID, err)
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"backend/models"
+)
+
+func TestValidateResolution(t *testing.T) {
+	tests := []struct {
+		seconds int
+		ok      bool
+	}{
+		{0, true},
+		{minResolutionSeconds, true},
+		{60, true},
+		{maxResolutionSeconds, true},
+		{-1, false},
+		{minResolutionSeconds - 1, false},
+		{maxResolutionSeconds + 1, false},
+	}
+	for _, test := range tests {
+		if err := validateResolution(test.seconds); (err == nil) != test.ok {
+			t.Errorf("validateResolution(%d) = %v, want ok %v", test.seconds, err, test.ok)
+		}
+	}
+}
+
+func TestIngestionBucket(t *testing.T) {
+	tests := []struct {
+		resolution, aggregation int
+		bucket                  time.Duration
+	}{
+		{0, 0, 0},
+		{0, 60, time.Minute},
+		{30, 0, 30 * time.Second},
+		// A resolution takes over from aggregation
+		{30, 300, 30 * time.Second},
+	}
+	for _, test := range tests {
+		server := &models.Server{ResolutionSeconds: test.resolution, AggregationSeconds: test.aggregation}
+		if bucket := ingestionBucket(server); bucket != test.bucket {
+			t.Errorf("ingestionBucket(resolution %d, aggregation %d) = %s, want %s",
+				test.resolution, test.aggregation, bucket, test.bucket)
+		}
+	}
+}
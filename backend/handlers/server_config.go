@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"backend/apierror"
+	"backend/auth"
+	"backend/config"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// serverConfigVersion is the current schema version of exported server configs
+const serverConfigVersion = 1
+
+// ServerConfigDocument is the portable configuration of a server. It never
+// contains the agent token or any other secret. NotificationEmails are the
+// server's alert recipients.
+type ServerConfigDocument struct {
+	Version            int      `json:"version"`
+	Name               string   `json:"name"`
+	NotificationEmails []string `json:"notification_emails"`
+	NameLocked         bool     `json:"name_locked"`
+	PausedIngestion    bool     `json:"paused_ingestion"`
+
+	EmailBranding models.EmailBranding `json:"email_branding"`
+}
+
+// newServerConfigDocument builds the export document for a server
+func newServerConfigDocument(server *models.Server, recipients []models.AlertRecipient) ServerConfigDocument {
+	emails := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		emails[i] = recipient.Email
+	}
+
+	return ServerConfigDocument{
+		Version:            serverConfigVersion,
+		Name:               server.Name,
+		NotificationEmails: emails,
+		NameLocked:         server.NameLocked,
+		PausedIngestion:    server.PausedIngestion,
+		EmailBranding:      server.EmailBranding,
+	}
+}
+
+// updates validates the document and returns the column updates it implies
+// and the server's alert recipients
+func (doc ServerConfigDocument) updates(smtpConfig config.SMTPConfig) (map[string]interface{}, models.StringList, error) {
+	if doc.Version != serverConfigVersion {
+		return nil, nil, fmt.Errorf("unsupported config version %d (expected %d)", doc.Version, serverConfigVersion)
+	}
+
+	name, err := sanitizeServerName(doc.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recipients, err := validateRecipients(doc.NotificationEmails)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	branding, err := validateEmailBranding(doc.EmailBranding, smtpConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	updates := map[string]interface{}{
+		"name":             name,
+		"name_locked":      doc.NameLocked,
+		"paused_ingestion": doc.PausedIngestion,
+	}
+	addEmailBrandingUpdates(updates, branding)
+	return updates, recipients, nil
+}
+
+// bindServerConfigDocument strictly decodes and validates a config document
+// from the request body, returning the column updates and alert recipients
+// it implies
+func bindServerConfigDocument(c *gin.Context, smtpConfig config.SMTPConfig) (map[string]interface{}, models.StringList, bool) {
+	var doc ServerConfigDocument
+
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid server config document", err.Error())
+		return nil, nil, false
+	}
+
+	updates, recipients, err := doc.updates(smtpConfig)
+	if err != nil {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid server config document", err.Error())
+		return nil, nil, false
+	}
+
+	return updates, recipients, true
+}
+
+// ExportServerConfig returns a server's configuration as a JSON document
+func (h *APIHandler) ExportServerConfig(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	recipients, err := h.db.GetAlertRecipients(server.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get alert recipients")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="server-%d-config.json"`, server.ID))
+	c.JSON(http.StatusOK, newServerConfigDocument(server, recipients))
+}
+
+// ImportServerConfig applies a config document to an existing server
+func (h *APIHandler) ImportServerConfig(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	updates, recipients, ok := bindServerConfigDocument(c, h.ws.config.SMTP)
+	if !ok {
+		return
+	}
+
+	if err := h.db.UpdateServer(server.ID, updates); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
+		return
+	}
+	if err := h.db.ReplaceAlertRecipients(server.ID, recipients); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update alert recipients")
+		return
+	}
+	h.ws.InvalidateDashboard(server.UserID)
+
+	updated, err := h.db.GetServerByID(server.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Database error")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"server": updated})
+}
+
+// ImportNewServer creates a new server from a config document
+func (h *APIHandler) ImportNewServer(c *gin.Context) {
+	userClaims, exists := auth.GetUserFromContext(c)
+	if !exists {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "User not authenticated")
+		return
+	}
+
+	updates, recipients, ok := bindServerConfigDocument(c, h.ws.config.SMTP)
+	if !ok {
+		return
+	}
+
+	user, err := h.db.GetOrCreateUser(userClaims.UID, userClaims.Email)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to get user")
+		return
+	}
+
+	if !h.checkServerQuota(c, user) {
+		return
+	}
+
+	server := &models.Server{
+		UserID: user.ID,
+		Token:  uuid.New().String(),
+		Name:   updates["name"].(string),
+		Status: "offline",
+	}
+
+	if err := h.db.CreateServer(server); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to create server")
+		return
+	}
+	h.ws.InvalidateDashboard(user.ID)
+
+	// Apply the remaining settings through the same path as imports onto existing servers
+	if err := h.db.UpdateServer(server.ID, updates); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to apply server config")
+		return
+	}
+	if err := h.db.ReplaceAlertRecipients(server.ID, recipients); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to apply server config")
+		return
+	}
+
+	server, err = h.db.GetServerByID(server.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Database error")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"server": server})
+}
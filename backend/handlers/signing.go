@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+
+	"backend/apierror"
+	"backend/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RotateSigningSecret generates a new message signing secret for a server.
+// The secret is only ever returned by this call.
+func (h *APIHandler) RotateSigningSecret(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	secret, err := auth.GenerateSigningSecret()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate signing secret")
+		return
+	}
+
+	if err := h.db.UpdateServer(server.ID, map[string]interface{}{"signing_secret": secret}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
+		return
+	}
+
+	// Reconnect the agent so the old secret stops being accepted
+	h.ws.DisconnectAgent(server.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":         server.ID,
+		"signing_secret":    secret,
+		"require_signature": server.RequireSignature,
+	})
+}
+
+// DeleteSigningSecret removes a server's signing secret and turns off
+// signature enforcement
+func (h *APIHandler) DeleteSigningSecret(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	updates := map[string]interface{}{
+		"signing_secret":    "",
+		"require_signature": false,
+	}
+	if err := h.db.UpdateServer(server.ID, updates); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
+		return
+	}
+
+	h.ws.DisconnectAgent(server.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":         server.ID,
+		"require_signature": false,
+	})
+}
+
+// SetSignatureRequired toggles whether unsigned agent messages are rejected
+func (h *APIHandler) SetSignatureRequired(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Required bool `json:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	if req.Required && server.SigningSecret == "" {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "Generate a signing secret before requiring signatures")
+		return
+	}
+
+	if err := h.db.UpdateServer(server.ID, map[string]interface{}{"require_signature": req.Required}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
+		return
+	}
+
+	h.ws.DisconnectAgent(server.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":         server.ID,
+		"require_signature": req.Required,
+	})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"backend/models"
+)
+
+// slackMessage is the payload of a Slack incoming webhook. Text is the
+// fallback shown in notifications; blocks carry the formatted message.
+type slackMessage struct {
+	Channel string       `json:"channel,omitempty"`
+	Text    string       `json:"text"`
+	Blocks  []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// sendSlackAlert posts an alert to the configured Slack incoming webhook
+func (h *WebSocketHandler) sendSlackAlert(server *models.Server, alert *models.Alert) {
+	slackConfig := h.config.Slack
+	if slackConfig.WebhookURL == "" {
+		log.Printf("Slack webhook not configured, skipping alert for server %s", server.Name)
+		return
+	}
+
+	message := buildSlackMessage(server, alert)
+	message.Channel = slackConfig.Channel
+
+	if err := postSlackMessage(slackConfig.WebhookURL, message); err != nil {
+		log.Printf("Failed to send Slack alert for server %s: %v", server.Name, err)
+		return
+	}
+	log.Printf("Slack alert sent for server %s", server.Name)
+}
+
+// buildSlackMessage formats an alert as a title, its message and a field
+// per detail
+func buildSlackMessage(server *models.Server, alert *models.Alert) slackMessage {
+	subject := alertSubject(server, alert)
+
+	fields := []slackText{
+		{Type: "mrkdwn", Text: "*Server*\n" + slackEscape(server.Name)},
+		{Type: "mrkdwn", Text: "*Level*\n" + strings.ToUpper(alert.Level)},
+		{Type: "mrkdwn", Text: "*Value*\n" + formatAlertValue(alert.Type, alert.Value)},
+	}
+	if alert.Threshold != 0 {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: "*Threshold*\n" + formatAlertValue(alert.Type, alert.Threshold)})
+	}
+
+	return slackMessage{
+		Text: subject,
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: subject}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: slackEscape(alert.Message)}},
+			{Type: "section", Fields: fields},
+		},
+	}
+}
+
+// slackEscape escapes the characters Slack treats as markup
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func postSlackMessage(url string, message slackMessage) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("slack returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"backend/config"
+	"backend/models"
+)
+
+func TestSendSlackAlertPayload(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		var payload map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decoding payload: %v", err)
+		}
+		received <- payload
+	}))
+	defer server.Close()
+
+	h := &WebSocketHandler{config: &config.Config{
+		Slack: config.SlackConfig{WebhookURL: server.URL, Channel: "#ops"},
+	}}
+	h.sendSlackAlert(
+		&models.Server{Name: "web-<1>"},
+		&models.Alert{Type: "cpu", Level: "critical", Message: "CPU usage is 97.0%", Value: 97, Threshold: 95},
+	)
+
+	payload := <-received
+	if payload["channel"] != "#ops" {
+		t.Errorf("channel = %v, want #ops", payload["channel"])
+	}
+	if payload["text"] != "[ALERT] CRITICAL - CPU Alert on Server web-<1>" {
+		t.Errorf("text = %v", payload["text"])
+	}
+
+	blocks, _ := payload["blocks"].([]interface{})
+	if len(blocks) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(blocks))
+	}
+	for i, want := range []string{"header", "section", "section"} {
+		if typ := blocks[i].(map[string]interface{})["type"]; typ != want {
+			t.Errorf("block %d type = %v, want %s", i, typ, want)
+		}
+	}
+
+	fields, _ := blocks[2].(map[string]interface{})["fields"].([]interface{})
+	var texts []string
+	for _, field := range fields {
+		texts = append(texts, field.(map[string]interface{})["text"].(string))
+	}
+	want := []string{"*Server*\nweb-&lt;1&gt;", "*Level*\nCRITICAL", "*Value*\n97.0%", "*Threshold*\n95.0%"}
+	if len(texts) != len(want) {
+		t.Fatalf("fields = %q, want %q", texts, want)
+	}
+	for i := range want {
+		if texts[i] != want[i] {
+			t.Errorf("field %d = %q, want %q", i, texts[i], want[i])
+		}
+	}
+}
+
+func TestSendSlackAlertUnconfigured(t *testing.T) {
+	h := &WebSocketHandler{config: &config.Config{}}
+	// Must return without posting anywhere
+	h.sendSlackAlert(&models.Server{Name: "web"}, &models.Alert{Type: "cpu"})
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"backend/config"
+)
+
+// Backoff applied to an SMTP provider after consecutive failures, doubling
+// from smtpBackoffBase up to smtpBackoffMax
+const (
+	smtpBackoffBase = 30 * time.Second
+	smtpBackoffMax  = 10 * time.Minute
+)
+
+// smtpUnavailableError marks a failure to reach or log in to an SMTP
+// provider, after which the next provider is tried. Other failures, such as
+// a rejected recipient, would fail the same way on any provider.
+type smtpUnavailableError struct {
+	err error
+}
+
+func (e *smtpUnavailableError) Error() string { return e.err.Error() }
+func (e *smtpUnavailableError) Unwrap() error { return e.err }
+
+// smtpFailover tracks the health of the configured SMTP providers so a
+// failed provider is skipped while it backs off
+type smtpFailover struct {
+	mu       sync.Mutex
+	failures map[int]int
+	retryAt  map[int]time.Time
+}
+
+func newSMTPFailover() *smtpFailover {
+	return &smtpFailover{
+		failures: make(map[int]int),
+		retryAt:  make(map[int]time.Time),
+	}
+}
+
+// order returns provider indexes to try: healthy providers by priority,
+// then those backing off, so mail is still attempted when all have failed
+func (f *smtpFailover) order(count int) []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	healthy := make([]int, 0, count)
+	var backingOff []int
+	for i := 0; i < count; i++ {
+		if now.Before(f.retryAt[i]) {
+			backingOff = append(backingOff, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	return append(healthy, backingOff...)
+}
+
+func (f *smtpFailover) succeeded(i int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.failures, i)
+	delete(f.retryAt, i)
+}
+
+func (f *smtpFailover) failed(i int) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures[i]++
+	backoff := smtpBackoffBase << (f.failures[i] - 1)
+	if backoff > smtpBackoffMax || backoff <= 0 {
+		backoff = smtpBackoffMax
+	}
+	f.retryAt[i] = time.Now().Add(backoff)
+	return backoff
+}
+
+// deliverEmail sends a message through the first SMTP provider that accepts
+// it, failing over to the next one when a provider can't be reached or
+// rejects the login
+func (h *WebSocketHandler) deliverEmail(providers []config.SMTPProvider, send func(config.SMTPProvider) error) error {
+	var err error
+	for _, i := range h.smtpFailover.order(len(providers)) {
+		err = send(providers[i])
+		if err == nil {
+			h.smtpFailover.succeeded(i)
+			return nil
+		}
+
+		var unavailable *smtpUnavailableError
+		if !errors.As(err, &unavailable) {
+			return err
+		}
+		backoff := h.smtpFailover.failed(i)
+		log.Printf("SMTP provider %s unavailable, backing off for %s: %v", providers[i].Host, backoff, err)
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"backend/config"
+)
+
+func TestDeliverEmailFailsOverToSecondary(t *testing.T) {
+	h := &WebSocketHandler{smtpFailover: newSMTPFailover()}
+	providers := []config.SMTPProvider{{Host: "primary"}, {Host: "secondary"}}
+
+	var tried []string
+	send := func(p config.SMTPProvider) error {
+		tried = append(tried, p.Host)
+		if p.Host == "primary" {
+			return &smtpUnavailableError{errors.New("connection refused")}
+		}
+		return nil
+	}
+
+	if err := h.deliverEmail(providers, send); err != nil {
+		t.Fatalf("deliverEmail: %v", err)
+	}
+	if len(tried) != 2 || tried[0] != "primary" || tried[1] != "secondary" {
+		t.Fatalf("tried %v, want [primary secondary]", tried)
+	}
+
+	// The failed primary backs off, so the next message goes to the
+	// secondary first
+	tried = nil
+	if err := h.deliverEmail(providers, send); err != nil {
+		t.Fatalf("deliverEmail: %v", err)
+	}
+	if len(tried) != 1 || tried[0] != "secondary" {
+		t.Errorf("tried %v, want [secondary]", tried)
+	}
+}
+
+func TestDeliverEmailNoFailoverOnRejectedMessage(t *testing.T) {
+	h := &WebSocketHandler{smtpFailover: newSMTPFailover()}
+	providers := []config.SMTPProvider{{Host: "primary"}, {Host: "secondary"}}
+
+	rejected := errors.New("550 mailbox unavailable")
+	calls := 0
+	err := h.deliverEmail(providers, func(config.SMTPProvider) error {
+		calls++
+		return rejected
+	})
+	if !errors.Is(err, rejected) {
+		t.Errorf("got error %v, want %v", err, rejected)
+	}
+	if calls != 1 {
+		t.Errorf("sent %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/models"
+)
+
+// Server statuses that can be transitioned between
+var transitionStatuses = map[string]bool{"online": true, "offline": true, "warning": true}
+
+// defaultStatusNotifications are the transitions that raise a status_change
+// alert for servers that don't choose their own: going offline and coming
+// back
+var defaultStatusNotifications = []string{"*->offline", "offline->online"}
+
+// statusNotifier turns status changes into status_change alerts. A new
+// status must hold for the debounce period before it is notified, so a
+// server flapping between statuses, or an agent reconnecting right away,
+// doesn't notify at all.
+type statusNotifier struct {
+	debounce time.Duration
+	raise    func(serverID uint, from, to string)
+
+	mutex  sync.Mutex
+	states map[uint]*statusState
+}
+
+// statusState is the last notified (or first seen) status of a server and
+// the status waiting out the debounce period, if any
+type statusState struct {
+	stable  string
+	pending string
+	timer   *time.Timer
+}
+
+func newStatusNotifier(debounce time.Duration, raise func(serverID uint, from, to string)) *statusNotifier {
+	return &statusNotifier{
+		debounce: debounce,
+		raise:    raise,
+		states:   make(map[uint]*statusState),
+	}
+}
+
+// observe records that a server's status changed from previous to current.
+// previous only seeds the state of servers not seen before.
+func (n *statusNotifier) observe(serverID uint, previous, current string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	state, ok := n.states[serverID]
+	if !ok {
+		state = &statusState{stable: previous}
+		n.states[serverID] = state
+	}
+
+	if current == state.stable {
+		// Back to where it was before the debounce period ran out
+		if state.timer != nil {
+			state.timer.Stop()
+			state.timer = nil
+		}
+		state.pending = ""
+		return
+	}
+	if current == state.pending {
+		return
+	}
+
+	if state.timer != nil {
+		state.timer.Stop()
+	}
+	state.pending = current
+	state.timer = time.AfterFunc(n.debounce, func() { n.settle(serverID, current) })
+}
+
+// settle notifies a pending status that held for the debounce period
+func (n *statusNotifier) settle(serverID uint, status string) {
+	n.mutex.Lock()
+	state, ok := n.states[serverID]
+	if !ok || state.pending != status {
+		n.mutex.Unlock()
+		return
+	}
+	from := state.stable
+	state.stable = status
+	state.pending = ""
+	state.timer = nil
+	n.mutex.Unlock()
+
+	n.raise(serverID, from, status)
+}
+
+// forget drops a deleted server's state
+func (n *statusNotifier) forget(serverID uint) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if state, ok := n.states[serverID]; ok && state.timer != nil {
+		state.timer.Stop()
+	}
+	delete(n.states, serverID)
+}
+
+// validateStatusNotifications checks "from->to" transitions, where either
+// side is a status or "*"
+func validateStatusNotifications(transitions []string) error {
+	for _, transition := range transitions {
+		from, to, ok := strings.Cut(transition, "->")
+		if !ok {
+			return fmt.Errorf("status transition %q must be written from->to", transition)
+		}
+		for _, status := range []string{from, to} {
+			if status != "*" && !transitionStatuses[status] {
+				return fmt.Errorf("unknown status %q in %q (expected online, offline, warning or *)", status, transition)
+			}
+		}
+		if from == to && from != "*" {
+			return fmt.Errorf("status transition %q doesn't change the status", transition)
+		}
+	}
+	return nil
+}
+
+// optionalStringList tells a JSON null, which restores a default, apart from
+// a missing field, which keeps the current value
+type optionalStringList struct {
+	Set   bool
+	Value *models.StringList
+}
+
+func (o *optionalStringList) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		return nil
+	}
+	var list models.StringList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	if list == nil {
+		list = models.StringList{}
+	}
+	o.Value = &list
+	return nil
+}
+
+// notifiesTransition reports whether a server wants a status_change alert
+// when going from one status to another
+func notifiesTransition(server *models.Server, from, to string) bool {
+	transitions := defaultStatusNotifications
+	if server.StatusNotifications != nil {
+		transitions = *server.StatusNotifications
+	}
+	for _, transition := range transitions {
+		wantFrom, wantTo, _ := strings.Cut(transition, "->")
+		if (wantFrom == "*" || wantFrom == from) && (wantTo == "*" || wantTo == to) {
+			return true
+		}
+	}
+	return false
+}
+
+// setServerStatus stores a status derived from the agent's connection or
+// metrics and feeds any change to the status notifier
+func (h *WebSocketHandler) setServerStatus(serverID uint, status string) {
+	previous, err := h.db.UpdateServerStatus(serverID, status)
+	if err != nil {
+		log.Printf("Error updating status of server %d: %v", serverID, err)
+		return
+	}
+	// Servers in maintenance keep their status and aren't tracked
+	if previous == "" {
+		return
+	}
+	h.statuses.observe(serverID, previous, status)
+}
+
+// raiseStatusChange records and notifies a status transition that outlasted
+// the debounce period. Going offline is critical and any other change a
+// warning; coming back online resolves the server's open status_change
+// alerts and is recorded already resolved.
+func (h *WebSocketHandler) raiseStatusChange(serverID uint, from, to string) {
+	server, err := h.db.GetServerByID(serverID)
+	if err != nil {
+		log.Printf("Error fetching server %d: %v", serverID, err)
+		return
+	}
+	if server.MaintenanceMode || !notifiesTransition(server, from, to) {
+		return
+	}
+	// The default transitions are going offline and coming back, which
+	// offline alerts already cover
+	if server.StatusNotifications == nil && h.offlineAlertsEnabled() {
+		return
+	}
+
+	alert := &models.Alert{
+		ServerID: server.ID,
+		Type:     "status_change",
+		Level:    "warning",
+		Message:  fmt.Sprintf("Server %s went from %s to %s", server.Name, from, to),
+		Labels:   models.Dimensions{"from": from, "to": to},
+	}
+	if to == "offline" {
+		alert.Level = "critical"
+	}
+	if to == "online" {
+		if err := h.db.ResolveServerAlertsOfType(server.ID, "status_change"); err != nil {
+			log.Printf("Error resolving status alerts of %s: %v", server.Name, err)
+		}
+		now := time.Now()
+		alert.Resolved = true
+		alert.ResolvedAt = &now
+	}
+
+	if err := h.db.CreateAlert(alert); err != nil {
+		log.Printf("Error saving status alert: %v", err)
+		return
+	}
+
+	log.Printf("Status of %s changed from %s to %s", server.Name, from, to)
+	h.InvalidateDashboard(server.UserID)
+	h.dispatchAlert(server, alert)
+}
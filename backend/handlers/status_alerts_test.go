@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"backend/models"
+)
+
+type raisedTransition struct {
+	serverID uint
+	from, to string
+}
+
+func newTestStatusNotifier() (*statusNotifier, chan raisedTransition) {
+	raised := make(chan raisedTransition, 10)
+	n := newStatusNotifier(20*time.Millisecond, func(serverID uint, from, to string) {
+		raised <- raisedTransition{serverID, from, to}
+	})
+	return n, raised
+}
+
+func TestStatusNotifierRaisesTransitions(t *testing.T) {
+	transitions := [][2]string{
+		{"online", "offline"},
+		{"offline", "online"},
+		{"online", "warning"},
+		{"warning", "online"},
+		{"warning", "offline"},
+		{"offline", "warning"},
+	}
+	for _, tr := range transitions {
+		n, raised := newTestStatusNotifier()
+		n.observe(1, tr[0], tr[1])
+
+		select {
+		case got := <-raised:
+			if want := (raisedTransition{1, tr[0], tr[1]}); got != want {
+				t.Errorf("%s->%s: raised %+v, want %+v", tr[0], tr[1], got, want)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s->%s: no transition raised", tr[0], tr[1])
+		}
+	}
+}
+
+func TestStatusNotifierDebouncesFlapping(t *testing.T) {
+	n, raised := newTestStatusNotifier()
+
+	// Back online before the debounce period ran out
+	n.observe(1, "online", "offline")
+	n.observe(1, "offline", "online")
+
+	select {
+	case got := <-raised:
+		t.Fatalf("raised %+v for a flap", got)
+	case <-time.After(60 * time.Millisecond):
+	}
+
+	// Only the status that held is raised, from the last stable one
+	n.observe(1, "online", "warning")
+	n.observe(1, "warning", "offline")
+	select {
+	case got := <-raised:
+		if want := (raisedTransition{1, "online", "offline"}); got != want {
+			t.Errorf("raised %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no transition raised")
+	}
+}
+
+func TestStatusNotifierNotifiesOnceForFlappingConnection(t *testing.T) {
+	n, raised := newTestStatusNotifier()
+
+	// The agent drops and reconnects repeatedly within the debounce period,
+	// then stays away
+	for i := 0; i < 5; i++ {
+		n.observe(1, "online", "offline")
+		n.observe(1, "offline", "online")
+	}
+	n.observe(1, "online", "offline")
+
+	select {
+	case got := <-raised:
+		if want := (raisedTransition{1, "online", "offline"}); got != want {
+			t.Errorf("raised %+v, want %+v", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no transition raised")
+	}
+	select {
+	case got := <-raised:
+		t.Errorf("raised %+v after the first notification, want only one", got)
+	case <-time.After(60 * time.Millisecond):
+	}
+}
+
+func TestNotifiesTransition(t *testing.T) {
+	defaults := &models.Server{}
+	for _, tc := range []struct {
+		from, to string
+		want     bool
+	}{
+		{"online", "offline", true},
+		{"warning", "offline", true},
+		{"offline", "online", true},
+		{"online", "warning", false},
+		{"warning", "online", false},
+	} {
+		if got := notifiesTransition(defaults, tc.from, tc.to); got != tc.want {
+			t.Errorf("default %s->%s = %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+
+	custom := &models.Server{StatusNotifications: &models.StringList{"online->warning", "*->online"}}
+	for _, tc := range []struct {
+		from, to string
+		want     bool
+	}{
+		{"online", "warning", true},
+		{"warning", "online", true},
+		{"offline", "online", true},
+		{"online", "offline", false},
+	} {
+		if got := notifiesTransition(custom, tc.from, tc.to); got != tc.want {
+			t.Errorf("custom %s->%s = %v, want %v", tc.from, tc.to, got, tc.want)
+		}
+	}
+}
+
+func TestValidateStatusNotifications(t *testing.T) {
+	if err := validateStatusNotifications([]string{"*->offline", "warning->online", "*->*"}); err != nil {
+		t.Errorf("valid transitions rejected: %v", err)
+	}
+	for _, bad := range []string{"online", "online->down", "online->online"} {
+		if err := validateStatusNotifications([]string{bad}); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/apierror"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTestAlertResolveAfter bounds how long a test alert may stay open
+const maxTestAlertResolveAfter = 24 * 60 * 60
+
+// testAlertRequest is the optional body of a test alert request
+type testAlertRequest struct {
+	Type    string            `json:"type"`
+	Level   string            `json:"level"`
+	Message string            `json:"message"`
+	Labels  map[string]string `json:"labels"`
+	// ResolveAfter auto-resolves the alert after this many seconds, 0 leaves it open
+	ResolveAfter int `json:"resolve_after"`
+}
+
+// SendTestAlert raises a synthetic alert on a server and sends it through the
+// normal notification path, so users can check their alert routes and
+// channels without waiting for a real breach
+func (h *APIHandler) SendTestAlert(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	req := testAlertRequest{Type: "test", Level: "warning"}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body", err.Error())
+			return
+		}
+	}
+
+	if req.Level != "warning" && req.Level != "critical" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "level must be 'warning' or 'critical'")
+		return
+	}
+	if req.ResolveAfter < 0 || req.ResolveAfter > maxTestAlertResolveAfter {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest,
+			fmt.Sprintf("resolve_after must be between 0 and %d seconds", maxTestAlertResolveAfter))
+		return
+	}
+	if err := validateAlertLabels(req.Labels); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+	if req.Type == "" {
+		req.Type = "test"
+	}
+	if req.Message == "" {
+		req.Message = fmt.Sprintf("Test alert for server %s", server.Name)
+	}
+
+	alert := &models.Alert{
+		ServerID: server.ID,
+		Type:     req.Type,
+		Level:    req.Level,
+		Message:  req.Message,
+		Labels:   models.Dimensions(req.Labels),
+		Test:     true,
+	}
+	if err := h.db.CreateAlert(alert); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to create test alert")
+		return
+	}
+
+	log.Printf("Test alert raised for %s", server.Name)
+	h.ws.InvalidateDashboard(server.UserID)
+	go h.ws.dispatchAlert(server, alert)
+
+	if req.ResolveAfter > 0 {
+		time.AfterFunc(time.Duration(req.ResolveAfter)*time.Second, func() {
+			if err := h.db.ResolveAlert(alert.ID); err != nil {
+				log.Printf("Error resolving test alert %d: %v", alert.ID, err)
+				return
+			}
+			h.ws.InvalidateDashboard(server.UserID)
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"alert":    alert,
+		"channels": h.ws.resolveAlertChannels(server, alert),
+	})
+}
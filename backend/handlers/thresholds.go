@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"backend/apierror"
+	"backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAlertThresholds returns the thresholds managed for a server's agent and
+// whether the agent has applied the latest version
+func (h *APIHandler) GetAlertThresholds(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":        server.ID,
+		"alert_thresholds": server.AlertThresholds,
+		"version":          server.ThresholdsVersion,
+		"acked_version":    server.ThresholdsAckedVersion,
+	})
+}
+
+// UpdateAlertThresholds replaces a server's alert thresholds and pushes them
+// to its agent if connected. A disconnected agent receives them when it
+// next connects.
+func (h *APIHandler) UpdateAlertThresholds(c *gin.Context) {
+	server, ok := h.ownedServer(c)
+	if !ok {
+		return
+	}
+
+	var thresholds models.AlertThresholds
+	if err := c.ShouldBindJSON(&thresholds); err != nil {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+	if err := validateAlertThresholds(thresholds); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	version, err := h.db.SetAlertThresholds(server.ID, thresholds)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Failed to update server")
+		return
+	}
+
+	pushed := h.ws.pushAlertThresholds(server.ID, version, thresholds) == nil
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":        server.ID,
+		"alert_thresholds": thresholds,
+		"version":          version,
+		"pushed":           pushed,
+	})
+}
+
+// validateAlertThresholds checks that percentages are within (0, 100] and
+// that the other thresholds aren't negative
+func validateAlertThresholds(t models.AlertThresholds) error {
+	percentages := []struct {
+		name  string
+		value *float64
+	}{{"cpu", t.CPU}, {"memory", t.Memory}, {"disk", t.Disk}}
+	for _, p := range percentages {
+		if p.value != nil && (*p.value <= 0 || *p.value > 100) {
+			return fmt.Errorf("%s threshold must be between 0 and 100", p.name)
+		}
+	}
+
+	if t.LoadPerCore != nil && *t.LoadPerCore < 0 {
+		return fmt.Errorf("load_per_core threshold must not be negative")
+	}
+	if t.DiskLatency != nil && *t.DiskLatency < 0 {
+		return fmt.Errorf("disk_latency threshold must not be negative")
+	}
+	if t.ClockDrift != nil && *t.ClockDrift < 0 {
+		return fmt.Errorf("clock_drift threshold must not be negative")
+	}
+	if t.Swap != nil && (*t.Swap < 0 || *t.Swap > 100) {
+		return fmt.Errorf("swap threshold must be between 0 and 100")
+	}
+	if t.MemoryPressure != nil && (*t.MemoryPressure < 0 || *t.MemoryPressure > 100) {
+		return fmt.Errorf("memory_pressure threshold must be between 0 and 100")
+	}
+	return nil
+}
+
+// pushAlertThresholds sends thresholds to a server's agent as a config_update
+func (h *WebSocketHandler) pushAlertThresholds(serverID uint, version int, thresholds models.AlertThresholds) error {
+	err := h.SendMessageToAgent(serverID, "config_update", models.ThresholdsUpdateData{
+		Version:         version,
+		AlertThresholds: thresholds,
+	})
+	if err != nil && err != ErrAgentNotConnected {
+		log.Printf("Error pushing alert thresholds to server %d: %v", serverID, err)
+	}
+	return err
+}
+
+// handleConfigAckMessage records that the agent applied (or rejected) a
+// config update
+func (h *WebSocketHandler) handleConfigAckMessage(agentConn *AgentConnection, message models.AgentMessage) {
+	jsonData, err := json.Marshal(message.Data)
+	if err != nil {
+		log.Printf("Error marshaling config ack: %v", err)
+		return
+	}
+
+	var ack models.ConfigAckData
+	if err := json.Unmarshal(jsonData, &ack); err != nil {
+		log.Printf("Error unmarshaling config ack: %v", err)
+		return
+	}
+
+	if !ack.Applied {
+		log.Printf("Agent %s rejected alert thresholds v%d: %s", agentConn.server.Name, ack.Version, ack.Error)
+		return
+	}
+	if err := h.db.AckAlertThresholds(agentConn.server.ID, ack.Version); err != nil {
+		log.Printf("Error saving config ack for server %d: %v", agentConn.server.ID, err)
+		return
+	}
+
+	log.Printf("Agent %s applied alert thresholds v%d", agentConn.server.Name, ack.Version)
+}
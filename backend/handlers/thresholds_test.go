@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend/config"
+	"backend/models"
+	"backend/testdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Thresholds updated through the API are pushed to the agent, and its ack
+// shows up when they are read back
+func TestAlertThresholdsAckRoundTrip(t *testing.T) {
+	d := testdb.Open(t)
+	user := testdb.User(t, d)
+	server := testdb.Server(t, d, user, "thresholds")
+
+	agentConn := &AgentConnection{server: server, send: make(chan []byte, 4)}
+	ws := &WebSocketHandler{db: d, config: &config.Config{}, connections: map[uint]*AgentConnection{server.ID: agentConn}}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	signedIn := router.Group("/", func(c *gin.Context) { c.Set("user_uid", user.FirebaseUID) })
+	api := NewAPIHandler(d, nil, ws)
+	signedIn.GET("/servers/:id/thresholds", api.GetAlertThresholds)
+	signedIn.PUT("/servers/:id/thresholds", api.UpdateAlertThresholds)
+	path := fmt.Sprintf("/servers/%d/thresholds", server.ID)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, path, strings.NewReader(`{"cpu": 75}`)))
+	var updated struct {
+		Version int  `json:"version"`
+		Pushed  bool `json:"pushed"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("PUT %s: %d %s", path, w.Code, w.Body)
+	}
+	if !updated.Pushed {
+		t.Fatal("thresholds not pushed to the connected agent")
+	}
+
+	var pushed struct {
+		Type string                      `json:"type"`
+		Data models.ThresholdsUpdateData `json:"data"`
+	}
+	if err := json.Unmarshal(<-agentConn.send, &pushed); err != nil {
+		t.Fatal(err)
+	}
+	if pushed.Type != "config_update" || pushed.Data.Version != updated.Version {
+		t.Fatalf("agent received %+v, want a config_update of version %d", pushed, updated.Version)
+	}
+
+	// The agent applies them and acknowledges
+	ws.handleConfigAckMessage(agentConn, models.AgentMessage{
+		Type: "config_ack",
+		Data: map[string]interface{}{"version": pushed.Data.Version, "applied": true},
+	})
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var current struct {
+		AlertThresholds models.AlertThresholds `json:"alert_thresholds"`
+		Version         int                    `json:"version"`
+		AckedVersion    int                    `json:"acked_version"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &current); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET %s: %d %s", path, w.Code, w.Body)
+	}
+	if current.AlertThresholds.CPU == nil || *current.AlertThresholds.CPU != 75 {
+		t.Errorf("read back cpu threshold %v, want 75", current.AlertThresholds.CPU)
+	}
+	if current.Version != updated.Version || current.AckedVersion != updated.Version {
+		t.Errorf("read back version %d acked %d, want both %d", current.Version, current.AckedVersion, updated.Version)
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/models"
+)
+
+// webhookSignatureHeader carries the hex HMAC-SHA256 of the request body,
+// keyed with webhook.secret, as "sha256=<hex>"
+const webhookSignatureHeader = "X-Monitaur-Signature"
+
+// webhookRetryBase is the delay before the first retry of a failed webhook;
+// it doubles on every further attempt
+var webhookRetryBase = 2 * time.Second
+
+// webhookPayload is the alert as stored, plus the name of its server
+type webhookPayload struct {
+	*models.Alert
+	ServerName string `json:"server_name"`
+}
+
+// webhookRetryableError marks a failure worth retrying: a 5xx response or a
+// network error. Other responses would fail the same way again.
+type webhookRetryableError struct {
+	err error
+}
+
+func (e *webhookRetryableError) Error() string { return e.err.Error() }
+func (e *webhookRetryableError) Unwrap() error { return e.err }
+
+// sendWebhookAlert posts an alert to the configured webhook. Retries are
+// scheduled on the notification queue instead of sleeping, so a slow
+// receiver doesn't hold a notification slot while it backs off.
+func (h *WebSocketHandler) sendWebhookAlert(server *models.Server, alert *models.Alert) {
+	if h.config.Webhook.URL == "" {
+		log.Printf("Webhook not configured, skipping alert for server %s", server.Name)
+		return
+	}
+
+	body, err := json.Marshal(webhookPayload{Alert: alert, ServerName: server.Name})
+	if err != nil {
+		log.Printf("Failed to encode webhook alert for server %s: %v", server.Name, err)
+		return
+	}
+	h.deliverWebhook(server, body, 0)
+}
+
+func (h *WebSocketHandler) deliverWebhook(server *models.Server, body []byte, attempt int) {
+	err := postWebhook(h.config.Webhook.URL, h.config.Webhook.Secret, body)
+	if err == nil {
+		return
+	}
+
+	retryable, ok := err.(*webhookRetryableError)
+	if !ok || attempt >= h.config.Webhook.MaxRetries {
+		log.Printf("Failed to send webhook alert for server %s (attempt %d): %v", server.Name, attempt+1, err)
+		return
+	}
+
+	delay := webhookRetryBase << attempt
+	log.Printf("Webhook alert for server %s failed (attempt %d), retrying in %s: %v",
+		server.Name, attempt+1, delay, retryable.err)
+	time.AfterFunc(delay, func() {
+		h.notifications.run(func() { h.deliverWebhook(server, body, attempt+1) })
+	})
+}
+
+func postWebhook(url, secret string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+webhookSignature(secret, body))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return &webhookRetryableError{err}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 500 {
+		return &webhookRetryableError{fmt.Errorf("webhook returned status %d", resp.StatusCode)}
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// webhookSignature returns the hex HMAC-SHA256 of body keyed with secret
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
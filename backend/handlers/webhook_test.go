@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"backend/config"
+	"backend/models"
+)
+
+func TestSendWebhookAlertSignsAndRetries(t *testing.T) {
+	defer func(base time.Duration) { webhookRetryBase = base }(webhookRetryBase)
+	webhookRetryBase = time.Millisecond
+
+	var attempts atomic.Int32
+	delivered := make(chan []byte, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if got, want := r.Header.Get(webhookSignatureHeader), "sha256="+webhookSignature("s3cret", body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		delivered <- body
+	}))
+	defer receiver.Close()
+
+	h := &WebSocketHandler{
+		config: &config.Config{Webhook: config.WebhookConfig{
+			URL: receiver.URL, Secret: "s3cret", MaxRetries: 3,
+		}},
+		notifications: newNotificationQueue(1),
+	}
+	h.sendWebhookAlert(&models.Server{Name: "web"}, &models.Alert{ID: 7, Type: "disk", Level: "warning", Value: 91})
+
+	select {
+	case body := <-delivered:
+		var payload map[string]interface{}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload["server_name"] != "web" || payload["id"] != float64(7) || payload["type"] != "disk" {
+			t.Errorf("unexpected payload %v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("webhook not delivered after %d attempts", attempts.Load())
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("got %d attempts, want 3", n)
+	}
+}
+
+func TestSendWebhookAlertNoRetryOnClientError(t *testing.T) {
+	defer func(base time.Duration) { webhookRetryBase = base }(webhookRetryBase)
+	webhookRetryBase = time.Millisecond
+
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer receiver.Close()
+
+	h := &WebSocketHandler{
+		config:        &config.Config{Webhook: config.WebhookConfig{URL: receiver.URL, MaxRetries: 3}},
+		notifications: newNotificationQueue(1),
+	}
+	h.sendWebhookAlert(&models.Server{Name: "web"}, &models.Alert{Type: "cpu"})
+
+	time.Sleep(50 * time.Millisecond)
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("got %d attempts, want 1", n)
+	}
+}
@@ -1,19 +1,26 @@
 package handlers
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"log"
+	"math"
 	"net"
 	"net/http"
+	"net/mail"
 	"net/smtp"
 	"strings"
 	"sync"
 	"time"
 
+	"backend/agentversion"
+	"backend/apierror"
+	"backend/auth"
 	"backend/config"
 	"backend/database"
+	"backend/forwarder"
 	"backend/models"
 
 	"github.com/gin-gonic/gin"
@@ -22,6 +29,8 @@ import (
 )
 
 var upgrader = websocket.Upgrader{
+	// Offer permessage-deflate; agents that don't ask for it stay uncompressed
+	EnableCompression: true,
 	CheckOrigin: func(r *http.Request) bool {
 		// Allow connections from any origin in development
 		return true
@@ -29,10 +38,34 @@ var upgrader = websocket.Upgrader{
 }
 
 type AgentConnection struct {
-	conn     *websocket.Conn
+	conn     agentTransport
 	server   *models.Server
 	lastPing time.Time
 	send     chan []byte
+
+	// When the connection was established; older samples are replays from
+	// the agent's buffer
+	connectedAt time.Time
+
+	// Clock skew between agent and backend, measured on the first message
+	clockSkew    time.Duration
+	skewMeasured bool
+
+	// Owner's ingestion quota, resolved when the agent connects
+	metricsPerMinute int
+	lastShedLog      time.Time
+
+	// Known custom metric series per metric name, loaded on first use
+	customSeries map[string]map[string]bool
+
+	// Pending bucket when the server pre-aggregates metrics, and the agent
+	// timestamp of its latest sample, acked once the bucket is stored
+	aggregate    metricAccumulator
+	aggregateAck time.Time
+
+	// noOpenAlerts is set once the server has no open alerts left that a
+	// sample could resolve, until the agent raises another
+	noOpenAlerts bool
 }
 
 type WebSocketHandler struct {
@@ -40,6 +73,15 @@ type WebSocketHandler struct {
 	config      *config.Config
 	connections map[uint]*AgentConnection // serverID -> connection
 	mutex       sync.RWMutex
+	forwarder   *forwarder.Forwarder
+	notifiers   map[string]notifier
+
+	notifications  *notificationQueue
+	smtpFailover   *smtpFailover
+	logs           *logStore
+	dashboardCache *dashboardCache
+	ingestion      *ingestionLimiter
+	statuses       *statusNotifier
 }
 
 func NewWebSocketHandler(db *database.Database, cfg *config.Config) *WebSocketHandler {
@@ -47,10 +89,24 @@ func NewWebSocketHandler(db *database.Database, cfg *config.Config) *WebSocketHa
 		db:          db,
 		config:      cfg,
 		connections: make(map[uint]*AgentConnection),
+		forwarder:   forwarder.New(&cfg.Forwarder),
+
+		dashboardCache: newDashboardCache(
+			time.Duration(cfg.Dashboard.CacheTTL)*time.Second, cfg.Dashboard.CacheMaxEntries),
+		ingestion:     newIngestionLimiter(),
+		notifications: newNotificationQueue(cfg.Notifications.MaxConcurrent),
+		smtpFailover:  newSMTPFailover(),
+		logs:          newLogStore(cfg.Logs.BufferLines, cfg.Logs.MaxLineBytes),
 	}
+	handler.statuses = newStatusNotifier(
+		time.Duration(cfg.Notifications.StatusDebounce)*time.Second, handler.raiseStatusChange)
+	handler.registerNotifiers()
 
 	// Start cleanup routine for stale connections
 	go handler.cleanupRoutine()
+	if handler.offlineAlertsEnabled() {
+		go handler.offlineRoutine()
+	}
 
 	return handler
 }
@@ -60,80 +116,267 @@ func (h *WebSocketHandler) HandleAgentConnection(c *gin.Context) {
 	// Get authentication token from query params
 	token := c.Query("token")
 	serverName := c.Query("server_name")
+	agentVersion := c.Query("agent_version")
 
-	if token == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "token required"})
+	server, status, code, err := h.admitAgent(token, serverName, agentVersion, c.ClientIP())
+	if err != nil {
+		apierror.Respond(c, status, code, err.Error())
+		return
+	}
+
+	// Upgrade HTTP connection to WebSocket
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade connection: %v", err)
+		return
+	}
+
+	h.startAgentConnection(wsTransport{conn}, server, agentVersion)
+}
+
+// admitAgent authenticates an agent and checks it may connect, returning the
+// HTTP status and error code to reject it with otherwise
+func (h *WebSocketHandler) admitAgent(token, serverName, agentVersion, clientIP string) (*models.Server, int, string, error) {
+	server, status, err := h.authenticateAgent(token, serverName)
+	if err != nil {
+		return nil, status, apierror.CodeForStatus(status), err
+	}
+
+	if err := h.checkAgentVersion(server, agentVersion); err != nil {
+		return nil, http.StatusUpgradeRequired, apierror.CodeAgentOutdated, err
+	}
+
+	if h.config.Agents.DuplicatePolicy == config.DuplicatePolicyReject && h.IsAgentConnected(server.ID) {
+		log.Printf("Rejected duplicate agent connection for server: %s (ID: %d) from %s",
+			server.Name, server.ID, clientIP)
+		return nil, http.StatusConflict, apierror.CodeConflict, fmt.Errorf("agent already connected for this token")
+	}
+
+	return server, http.StatusOK, "", nil
+}
+
+// startAgentConnection registers an admitted agent's connection and starts
+// reading and writing its messages
+func (h *WebSocketHandler) startAgentConnection(conn agentTransport, server *models.Server, agentVersion string) {
+	if agentVersion != server.AgentVersion {
+		if err := h.db.UpdateServer(server.ID, map[string]interface{}{"agent_version": agentVersion}); err != nil {
+			log.Printf("Error saving agent version for server %d: %v", server.ID, err)
+		}
+		server.AgentVersion = agentVersion
+	}
+
+	agentConn := h.registerConnection(conn, server)
+	if owner, err := h.db.GetUserByID(server.UserID); err == nil {
+		agentConn.metricsPerMinute = h.userQuota(owner).MaxMetricsPerMinute
+	}
+
+	// Start goroutines for handling the connection
+	go h.handleAgentMessages(agentConn)
+	go h.handleAgentWrites(agentConn)
+}
+
+// verifyTokenMinDuration is how long every token verification takes at
+// least, so response times don't reveal whether a token exists
+const verifyTokenMinDuration = 250 * time.Millisecond
+
+// VerifyAgentToken checks an agent token without connecting, for install
+// scripts and setup wizards. Unknown and missing tokens get the same 401.
+func (h *WebSocketHandler) VerifyAgentToken(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		time.Sleep(verifyTokenMinDuration - time.Since(start))
+	}()
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	var server *models.Server
+	if req.Token != "" {
+		found, err := h.db.GetServerByToken(req.Token)
+		if err != nil && err != gorm.ErrRecordNotFound {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeDatabase, "Database error")
+			return
+		}
+		server = found
+	}
+	if server == nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthenticated, "invalid token")
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"valid":       true,
+		"server_name": server.Name,
+		"status":      server.Status,
+		"disabled":    server.Disabled,
+	})
+}
+
+// checkAgentVersion rejects agents older than agents.required_version and
+// logs a warning for those older than agents.min_version. Development builds
+// are let through; agents that report no version predate versioning and are
+// treated as outdated.
+func (h *WebSocketHandler) checkAgentVersion(server *models.Server, reported string) error {
+	if reported == agentversion.Dev {
+		return nil
+	}
+
+	outdated := func(minimum string) bool {
+		if minimum == "" {
+			return false
+		}
+		required, err := agentversion.Parse(minimum)
+		if err != nil {
+			return false
+		}
+		version, err := agentversion.Parse(reported)
+		return err != nil || version.Less(required)
+	}
+
+	shown := reported
+	if shown == "" {
+		shown = "unknown"
+	}
+
+	if required := h.config.Agents.RequiredVersion; outdated(required) {
+		log.Printf("Rejected agent for server %s (ID: %d): version %s is below required %s",
+			server.Name, server.ID, shown, required)
+		return fmt.Errorf("agent version %s is no longer supported, upgrade to %s or later", shown, required)
+	}
+	if minimum := h.config.Agents.MinVersion; outdated(minimum) {
+		log.Printf("WARNING: agent for server %s (ID: %d) runs version %s, below minimum %s",
+			server.Name, server.ID, shown, minimum)
+	}
+	return nil
+}
+
+// authenticateAgent resolves the server for an agent token, returning the
+// HTTP status to respond with when authentication fails
+func (h *WebSocketHandler) authenticateAgent(token, serverName string) (*models.Server, int, error) {
+	if token == "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("token required")
+	}
+
 	// Verify server token
 	server, err := h.db.GetServerByToken(token)
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+			return nil, http.StatusUnauthorized, fmt.Errorf("invalid token")
 		}
-		return
+		return nil, http.StatusInternalServerError, fmt.Errorf("database error")
+	}
+
+	if server.Disabled {
+		log.Printf("Rejected agent connection for disabled server: %s (ID: %d)", server.Name, server.ID)
+		return nil, http.StatusForbidden, fmt.Errorf("server is disabled")
 	}
 
 	// log server connection
 	log.Printf("Agent connecting for server: %s (ID: %d)", server.Name, server.ID)
 
-	// Update server name if provided and different
+	// Update server name if provided, different and permitted
 	if serverName != "" && server.Name != serverName {
-		server.Name = serverName
-		h.db.DB.Save(server)
+		h.applyAgentServerName(server, serverName)
 	}
 
-	// Upgrade HTTP connection to WebSocket
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	return server, http.StatusOK, nil
+}
+
+// applyAgentServerName renames a server to the name reported by its agent,
+// unless the name is locked or fails validation
+func (h *WebSocketHandler) applyAgentServerName(server *models.Server, serverName string) {
+	if server.NameLocked {
+		log.Printf("Rejected rename of server %s (ID: %d) to %q: name is locked", server.Name, server.ID, serverName)
+		return
+	}
+
+	name, err := sanitizeServerName(serverName)
 	if err != nil {
-		log.Printf("Failed to upgrade connection: %v", err)
+		log.Printf("Rejected rename of server %s (ID: %d) to %q: %v", server.Name, server.ID, serverName, err)
+		return
+	}
+	if name == server.Name {
+		return
+	}
+
+	if err := h.db.UpdateServer(server.ID, map[string]interface{}{"name": name}); err != nil {
+		log.Printf("Error renaming server %d: %v", server.ID, err)
 		return
 	}
+	server.Name = name
+}
 
-	// Create agent connection
+// registerConnection tracks an upgraded agent connection and marks the server online
+func (h *WebSocketHandler) registerConnection(conn agentTransport, server *models.Server) *AgentConnection {
 	agentConn := &AgentConnection{
 		conn:     conn,
 		server:   server,
 		lastPing: time.Now(),
 		send:     make(chan []byte, 256),
+
+		connectedAt: time.Now(),
 	}
 
-	// Register connection
+	// Register connection, taking over from any existing one for the same server
 	h.mutex.Lock()
+	previous, exists := h.connections[server.ID]
 	h.connections[server.ID] = agentConn
+	if exists {
+		close(previous.send)
+		previous.conn.Close()
+	}
 	h.mutex.Unlock()
 
+	if exists {
+		log.Printf("Agent connection for server %s (ID: %d) taken over by %s, closed previous connection from %s",
+			server.Name, server.ID, conn.RemoteAddr(), previous.conn.RemoteAddr())
+	}
+
 	// Update server status to online
 	h.db.UpdateServerLastSeen(server.ID)
+	if !server.MaintenanceMode {
+		h.statuses.observe(server.ID, server.Status, "online")
+	}
+	h.resolveOfflineAlert(server)
+	h.InvalidateDashboard(server.UserID)
 
 	log.Printf("Agent connected: %s (ID: %d)", server.Name, server.ID)
 
-	// Start goroutines for handling the connection
-	go h.handleAgentMessages(agentConn)
-	go h.handleAgentWrites(agentConn)
+	// Thresholds managed by the backend replace the agent's local ones on
+	// every connect, covering updates made while it was away
+	if server.AlertThresholds.IsSet() {
+		h.pushAlertThresholds(server.ID, server.ThresholdsVersion, server.AlertThresholds)
+	}
+	if server.ResolutionSeconds > 0 {
+		h.pushCollectionInterval(server.ID, server.ResolutionSeconds)
+	}
+
+	return agentConn
 }
 
 // handleAgentMessages processes incoming messages from agents
 func (h *WebSocketHandler) handleAgentMessages(agentConn *AgentConnection) {
 	defer func() {
+		// Store the partial bucket rather than lose it. Its samples were
+		// never acknowledged, so the agent resends them if this fails.
+		if err := h.storePendingBucket(agentConn); err != nil {
+			log.Printf("Pending metrics bucket from %s not stored: %v", agentConn.server.Name, err)
+		}
 		h.unregisterConnection(agentConn)
 		agentConn.conn.Close()
 	}()
 
-	// Set read deadline and pong handler
-	agentConn.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	agentConn.conn.SetPongHandler(func(string) error {
+	agentConn.conn.OnPong(func() {
 		agentConn.lastPing = time.Now()
-		agentConn.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		return nil
 	})
 
 	for {
-		var message models.AgentMessage
-		err := agentConn.conn.ReadJSON(&message)
+		raw, err := agentConn.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
@@ -141,18 +384,98 @@ func (h *WebSocketHandler) handleAgentMessages(agentConn *AgentConnection) {
 			break
 		}
 
+		var message models.AgentMessage
+		if err := json.Unmarshal(raw, &message); err != nil {
+			log.Printf("Invalid message from %s: %v", agentConn.server.Name, err)
+			continue
+		}
+
+		if !h.verifyAgentSignature(agentConn, raw, message) {
+			continue
+		}
+
+		if !agentConn.skewMeasured && !message.Timestamp.IsZero() {
+			h.measureClockSkew(agentConn, message.Timestamp, time.Now())
+		}
+
 		// Process message based on type
 		switch message.Type {
 		case "metrics":
 			h.handleMetricsMessage(agentConn, message)
+		case "metrics_batch":
+			h.handleMetricsBatchMessage(agentConn, message)
 		case "alert":
 			h.handleAlertMessage(agentConn, message)
+		case "agent_error":
+			h.handleAgentErrorMessage(agentConn, message)
+		case "config_report":
+			h.handleConfigReportMessage(agentConn, message)
+		case "command_result":
+			h.handleCommandResultMessage(agentConn, message)
+		case "capabilities":
+			h.handleCapabilitiesMessage(agentConn, message)
+		case "logs":
+			h.handleLogsMessage(agentConn, message)
+		case "config_ack":
+			h.handleConfigAckMessage(agentConn, message)
 		default:
 			log.Printf("Unknown message type: %s", message.Type)
 		}
 
-		// Update last seen
-		h.db.UpdateServerLastSeen(agentConn.server.ID)
+		// Update last seen, keeping any warning status set from metrics
+		h.db.TouchServerLastSeen(agentConn.server.ID)
+	}
+}
+
+// verifyAgentSignature checks the HMAC signature of a raw agent message. A
+// signature is verified whenever the server has a secret; unsigned messages
+// are only accepted while signing is not required.
+func (h *WebSocketHandler) verifyAgentSignature(agentConn *AgentConnection, raw []byte, message models.AgentMessage) bool {
+	server := agentConn.server
+	if message.Signature == "" {
+		if server.RequireSignature {
+			log.Printf("Rejected unsigned %s message from %s (ID: %d)", message.Type, server.Name, server.ID)
+			return false
+		}
+		return true
+	}
+
+	if server.SigningSecret == "" {
+		return !server.RequireSignature
+	}
+
+	// Sign over the data exactly as sent rather than a re-encoding of it
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return false
+	}
+
+	if !auth.VerifyAgentMessage(server.SigningSecret, message.Type, message.Timestamp, envelope.Data, message.Signature) {
+		log.Printf("Rejected %s message with invalid signature from %s (ID: %d)", message.Type, server.Name, server.ID)
+		return false
+	}
+	return true
+}
+
+// measureClockSkew records how far the agent's clock is from ours, based on
+// the timestamp of its first message. Positive skew means the agent is ahead.
+func (h *WebSocketHandler) measureClockSkew(agentConn *AgentConnection, sentAt, receivedAt time.Time) {
+	skew := sentAt.Sub(receivedAt)
+	agentConn.clockSkew = skew
+	agentConn.skewMeasured = true
+
+	threshold := time.Duration(h.config.Agents.ClockSkewWarning) * time.Second
+	if threshold > 0 && (skew > threshold || skew < -threshold) {
+		log.Printf("WARNING: Clock skew of %s detected for server %s (ID: %d)",
+			skew.Round(time.Millisecond), agentConn.server.Name, agentConn.server.ID)
+	}
+
+	if err := h.db.UpdateServer(agentConn.server.ID, map[string]interface{}{
+		"clock_skew_seconds": skew.Seconds(),
+	}); err != nil {
+		log.Printf("Error saving clock skew for server %d: %v", agentConn.server.ID, err)
 	}
 }
 
@@ -164,20 +487,18 @@ func (h *WebSocketHandler) handleAgentWrites(agentConn *AgentConnection) {
 	for {
 		select {
 		case message, ok := <-agentConn.send:
-			agentConn.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
-				agentConn.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				agentConn.conn.WriteClose()
 				return
 			}
 
-			if err := agentConn.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			if err := agentConn.conn.WriteMessage(message); err != nil {
 				log.Printf("Write error: %v", err)
 				return
 			}
 
 		case <-ticker.C:
-			agentConn.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := agentConn.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := agentConn.conn.Ping(); err != nil {
 				log.Printf("Ping error: %v", err)
 				return
 			}
@@ -207,45 +528,368 @@ func (h *WebSocketHandler) handleMetricsMessage(agentConn *AgentConnection, mess
 		return
 	}
 
+	// Handled, so the agent can drop the sample from its resend buffer
+	settings := h.loadIngestionSettings(agentConn)
+	if ack, ok := h.ingestMetrics(agentConn, &metricData, settings); ok && !ack.IsZero() {
+		h.ackMetrics(agentConn, ack)
+	}
+}
+
+// maxMetricsBatch bounds the samples in one metrics_batch message
+const maxMetricsBatch = 100
+
+// handleMetricsBatchMessage processes a batch of samples sent together by
+// agents with batch_size set, oldest first, acknowledging them at once
+func (h *WebSocketHandler) handleMetricsBatchMessage(agentConn *AgentConnection, message models.AgentMessage) {
+	jsonData, err := json.Marshal(message.Data)
+	if err != nil {
+		log.Printf("Error marshaling metrics batch: %v", err)
+		return
+	}
+
+	var batch []models.MetricData
+	if err := json.Unmarshal(jsonData, &batch); err != nil {
+		log.Printf("Error unmarshaling metrics batch: %v", err)
+		return
+	}
+	if len(batch) > maxMetricsBatch {
+		log.Printf("Dropping metrics batch of %d samples from %s (max %d)", len(batch), agentConn.server.Name, maxMetricsBatch)
+		return
+	}
+
+	if len(batch) == 0 {
+		return
+	}
+
+	// Aggregated servers store at most one row per bucket, so their samples
+	// go through the usual path one by one
+	settings := h.loadIngestionSettings(agentConn)
+	if !settings.paused && settings.bucket == 0 {
+		if h.bulkIngestMetrics(agentConn, batch, settings.server) {
+			h.ackMetrics(agentConn, batch[len(batch)-1].Timestamp)
+		}
+		return
+	}
+
+	// Acks cover every sample up to a time, so stop at the first failure
+	// and let the agent resend the rest
+	var ack time.Time
+	for i := range batch {
+		sampleAck, ok := h.ingestMetrics(agentConn, &batch[i], settings)
+		if !ok {
+			break
+		}
+		if !sampleAck.IsZero() {
+			ack = sampleAck
+		}
+	}
+	if !ack.IsZero() {
+		h.ackMetrics(agentConn, ack)
+	}
+}
+
+// bulkIngestMetrics stores a batch of samples with a single multi-row
+// insert. It reports false when nothing could be stored, so the agent
+// resends the batch.
+func (h *WebSocketHandler) bulkIngestMetrics(agentConn *AgentConnection, batch []models.MetricData, server *models.Server) bool {
+	metrics := make([]*models.Metric, 0, len(batch))
+	accepted := make([]*models.MetricData, 0, len(batch))
+	for i := range batch {
+		metric := h.newMetric(agentConn, &batch[i])
+		if h.storedReplay(agentConn, &batch[i], metric.Time) || !h.allowIngestion(agentConn) {
+			continue
+		}
+		metrics = append(metrics, metric)
+		accepted = append(accepted, &batch[i])
+	}
+
+	keys, err := h.db.CreateMetrics(metrics)
+	if err != nil {
+		log.Printf("Error storing metrics from %s: %v", agentConn.server.Name, err)
+		if len(keys) == 0 {
+			return false
+		}
+	}
+
+	// Only rows Postgres reports as inserted are new; the rest were already
+	// stored or dropped
+	inserted := make(map[metricKey]bool, len(keys))
+	for _, key := range keys {
+		inserted[newMetricKey(key.ServerID, key.Time)] = true
+	}
+	for i, metric := range metrics {
+		if !inserted[newMetricKey(metric.ServerID, metric.Time)] {
+			continue
+		}
+		h.metricStored(agentConn, metric)
+		h.storeCustomMetrics(agentConn, metric.Time, accepted[i].CustomMetrics)
+	}
+
+	last := &batch[len(batch)-1]
+	h.updateStatusFromMetrics(agentConn, last)
+	h.resolveRecoveredAlerts(agentConn, server, last)
+
+	log.Printf("Received %d metrics from %s: CPU=%.1f%%, Mem=%.1f%%, Disk=%.1f%%",
+		len(batch), agentConn.server.Name, last.CPU.Usage, last.Memory.UsedPercent, last.Disk.UsedPercent)
+	return true
+}
+
+// metricKey compares the (server_id, time) keys of stored metrics at the
+// microsecond precision Postgres keeps, whatever their time zone
+type metricKey struct {
+	serverID uint
+	micros   int64
+}
+
+func newMetricKey(serverID uint, t time.Time) metricKey {
+	return metricKey{serverID: serverID, micros: t.UnixMicro()}
+}
+
+// ingestMetrics stores one agent sample and updates the server's status. It
+// returns the agent timestamp up to which samples can be acknowledged, zero
+// while they wait in a pending bucket, and false when storing failed. A
+// sample that was dropped or already stored counts as handled.
+func (h *WebSocketHandler) ingestMetrics(agentConn *AgentConnection, metricData *models.MetricData, settings ingestionSettings) (time.Time, bool) {
+	metric := h.newMetric(agentConn, metricData)
+
+	// A pending bucket is stored once samples stop being folded into it,
+	// e.g. after aggregation was turned off
+	if agentConn.aggregate.count > 0 && (settings.paused || settings.bucket == 0) {
+		if err := h.storePendingBucket(agentConn); err != nil {
+			return time.Time{}, false
+		}
+	}
+
+	// Acks are cumulative, so none can be sent while a pending bucket holds
+	// unstored samples
+	ack := metricData.Timestamp
+	if agentConn.aggregate.count > 0 {
+		ack = time.Time{}
+	}
+	if h.storedReplay(agentConn, metricData, metric.Time) {
+		return ack, true
+	}
+
+	// Save to database unless ingestion is paused for this server or the
+	// owner is over their ingestion quota
+	if settings.paused {
+		log.Printf("Ingestion paused for %s, dropping metrics", agentConn.server.Name)
+	} else if h.allowIngestion(agentConn) {
+		if settings.bucket > 0 {
+			// Only a finished bucket is stored, so samples are only acked
+			// once the bucket they were folded into is written
+			ack = time.Time{}
+			pending := agentConn.aggregate
+			if flushed := agentConn.aggregate.add(metric, settings.bucket); flushed != nil {
+				// Keep the finished bucket so the next sample retries it
+				if _, err := h.storeMetric(agentConn, flushed); err != nil {
+					agentConn.aggregate = pending
+					return time.Time{}, false
+				}
+				ack = agentConn.aggregateAck
+			}
+			agentConn.aggregateAck = metricData.Timestamp
+		} else {
+			created, err := h.storeMetric(agentConn, metric)
+			if err != nil {
+				return time.Time{}, false
+			}
+			// A sample already stored at this time is a resend or double
+			// send; it was handled the first time around
+			if !created {
+				return ack, true
+			}
+		}
+
+		h.storeCustomMetrics(agentConn, metric.Time, metricData.CustomMetrics)
+	}
+
+	h.updateStatusFromMetrics(agentConn, metricData)
+	h.resolveRecoveredAlerts(agentConn, settings.server, metricData)
+
+	log.Printf("Received metrics from %s: CPU=%.1f%%, Mem=%.1f%%, Disk=%.1f%%",
+		agentConn.server.Name, metricData.CPU.Usage, metricData.Memory.UsedPercent, metricData.Disk.UsedPercent)
+	return ack, true
+}
+
+// storePendingBucket stores the aggregate of the connection's pending
+// bucket. When that fails the bucket stays pending, so it is retried rather
+// than acknowledged without being stored.
+func (h *WebSocketHandler) storePendingBucket(agentConn *AgentConnection) error {
+	pending := agentConn.aggregate
+	metric := agentConn.aggregate.flush()
+	if metric == nil {
+		return nil
+	}
+	if _, err := h.storeMetric(agentConn, metric); err != nil {
+		agentConn.aggregate = pending
+		return err
+	}
+	return nil
+}
+
+// newMetric builds the metric row of an agent sample, at the sample's time
+// corrected for the agent's clock skew when enabled
+func (h *WebSocketHandler) newMetric(agentConn *AgentConnection, metricData *models.MetricData) *models.Metric {
+	// An NTP-measured offset is more precise than the skew estimated from
+	// message arrival, which includes network latency
+	if metricData.ClockOffset != nil {
+		agentConn.clockSkew = time.Duration(*metricData.ClockOffset * float64(time.Second))
+		agentConn.skewMeasured = true
+	}
+
+	// Shift agent timestamps by the measured skew if correction is enabled
+	metricTime := metricData.Timestamp
+	if h.config.Agents.CorrectClockSkew && agentConn.skewMeasured {
+		metricTime = metricTime.Add(-agentConn.clockSkew)
+	}
+
 	// Create metric record
 	metric := &models.Metric{
-		Time:     metricData.Timestamp,
+		Time:     metricTime,
 		ServerID: agentConn.server.ID,
 
-		CPUUsage: metricData.CPU.Usage,
-		CPUCores: metricData.CPU.Cores,
+		CPUUsage:   metricData.CPU.Usage,
+		CPUCores:   metricData.CPU.Cores,
+		CPUPerCore: models.FloatList(metricData.CPU.PerCore),
 
 		MemoryTotal:     metricData.Memory.Total,
 		MemoryUsed:      metricData.Memory.Used,
 		MemoryAvailable: metricData.Memory.Available,
 		MemoryPercent:   metricData.Memory.UsedPercent,
 
+		SwapTotal:   metricData.Swap.Total,
+		SwapUsed:    metricData.Swap.Used,
+		SwapPercent: metricData.Swap.UsedPercent,
+
 		DiskTotal:   metricData.Disk.Total,
 		DiskUsed:    metricData.Disk.Used,
 		DiskFree:    metricData.Disk.Free,
 		DiskPercent: metricData.Disk.UsedPercent,
+		Disks:       metricData.Disks,
 
-		NetworkBytesIn:  metricData.Network.BytesRecv,
-		NetworkBytesOut: metricData.Network.BytesSent,
+		NetworkInterface: metricData.Network.Interface,
+		NetworkBytesIn:   metricData.Network.BytesRecv,
+		NetworkBytesOut:  metricData.Network.BytesSent,
+		NetworkRateIn:    metricData.Network.RecvBytesPerSec,
+		NetworkRateOut:   metricData.Network.SentBytesPerSec,
 
 		Uptime: metricData.Uptime,
 	}
 
-	// Save to database
-	if err := h.db.CreateMetric(metric); err != nil {
-		log.Printf("Error saving metric: %v", err)
-		return
+	if load := metricData.Load; load != nil {
+		metric.Load1 = &load.Load1
+		metric.Load5 = &load.Load5
+		metric.Load15 = &load.Load15
+		metric.LoadPerCore = &load.LoadPerCore
+	}
+	if metricData.Kernel != nil {
+		metric.ContextSwitchRate = metricData.Kernel.ContextSwitchesPerSec
+		metric.InterruptRate = metricData.Kernel.InterruptsPerSec
+	}
+	metric.DiskIO = metricData.DiskIO
+	if throughput := metricData.DiskThroughput; throughput != nil {
+		metric.DiskReadBytes = &throughput.ReadBytesPerSec
+		metric.DiskWriteBytes = &throughput.WriteBytesPerSec
 	}
+	if pressure := metricData.MemoryPressure; pressure != nil {
+		metric.MemoryPressureSome = pressure.SomeAvg10
+		metric.MemoryPressureFull = pressure.FullAvg10
+		metric.OOMKills = &pressure.OOMKills
+	}
+	metric.ClockOffset = metricData.ClockOffset
+
+	return metric
+}
+
+// storedReplay reports whether a sample collected before this connection,
+// resent from the agent's buffer, was already stored before the ack reached
+// the agent
+func (h *WebSocketHandler) storedReplay(agentConn *AgentConnection, metricData *models.MetricData, metricTime time.Time) bool {
+	if !metricData.Timestamp.Add(-agentConn.clockSkew).Before(agentConn.connectedAt) {
+		return false
+	}
+	exists, err := h.db.MetricExists(agentConn.server.ID, metricTime)
+	return err == nil && exists
+}
 
-	// Update server status based on metrics
+// storeCustomMetrics saves the custom metric values of a sample that are
+// within the cardinality limits
+func (h *WebSocketHandler) storeCustomMetrics(agentConn *AgentConnection, at time.Time, values []models.CustomMetricData) {
+	if customMetrics := h.acceptCustomMetrics(agentConn, at, values); len(customMetrics) > 0 {
+		if err := h.db.CreateCustomMetrics(customMetrics); err != nil {
+			log.Printf("Error saving custom metrics: %v", err)
+		}
+	}
+}
+
+// updateStatusFromMetrics marks the server online, or warning when a sample
+// shows it under heavy load
+func (h *WebSocketHandler) updateStatusFromMetrics(agentConn *AgentConnection, metricData *models.MetricData) {
 	status := "online"
 	if metricData.CPU.Usage > 90 || metricData.Memory.UsedPercent > 95 || metricData.Disk.UsedPercent > 95 {
 		status = "warning"
 	}
-	h.db.UpdateServerStatus(agentConn.server.ID, status)
+	h.setServerStatus(agentConn.server.ID, status)
+}
 
-	log.Printf("Received metrics from %s: CPU=%.1f%%, Mem=%.1f%%, Disk=%.1f%%",
-		agentConn.server.Name, metricData.CPU.Usage, metricData.Memory.UsedPercent, metricData.Disk.UsedPercent)
+// ackMetrics acknowledges every sample up to timestamp (the agent's own
+// sample time), so the agent stops holding them for resending
+func (h *WebSocketHandler) ackMetrics(agentConn *AgentConnection, timestamp time.Time) {
+	if err := h.SendMessageToAgent(agentConn.server.ID, "ack", map[string]interface{}{"timestamp": timestamp}); err != nil {
+		log.Printf("Error acknowledging metrics from %s: %v", agentConn.server.Name, err)
+	}
+}
+
+// storeMetric saves a metric, forwards it and folds it into the disk trend.
+// It reports false for a metric already stored at the same time.
+func (h *WebSocketHandler) storeMetric(agentConn *AgentConnection, metric *models.Metric) (bool, error) {
+	created, err := h.db.CreateMetric(metric)
+	if err != nil {
+		log.Printf("Error saving metric: %v", err)
+		return false, err
+	}
+	if !created {
+		log.Printf("Ignoring duplicate metric from %s at %s", agentConn.server.Name, metric.Time.Format(time.RFC3339))
+		return false, nil
+	}
+
+	h.metricStored(agentConn, metric)
+	return true, nil
+}
+
+// metricStored forwards a newly stored metric and folds it into the disk trend
+func (h *WebSocketHandler) metricStored(agentConn *AgentConnection, metric *models.Metric) {
+	h.forwarder.Forward(agentConn.server, metric)
+
+	if err := h.db.UpdateServerTrend(agentConn.server.ID, metric.Time, metric.DiskPercent); err != nil {
+		log.Printf("Error updating trend for server %d: %v", agentConn.server.ID, err)
+	}
+}
+
+// ingestionSettings are a server's current row and the pause flag and
+// ingestion bucket it sets, read once per metrics message or batch
+type ingestionSettings struct {
+	server *models.Server
+	paused bool
+	bucket time.Duration
+}
+
+func (h *WebSocketHandler) loadIngestionSettings(agentConn *AgentConnection) ingestionSettings {
+	server := h.currentServer(agentConn)
+	return ingestionSettings{server: server, paused: server.PausedIngestion, bucket: ingestionBucket(server)}
+}
+
+// currentServer reads the server's row once per agent message, so setting
+// changes such as maintenance take effect without the agent reconnecting.
+// It falls back to the row loaded when the agent connected.
+func (h *WebSocketHandler) currentServer(agentConn *AgentConnection) *models.Server {
+	server, err := h.db.GetServerByID(agentConn.server.ID)
+	if err != nil {
+		log.Printf("Error fetching server %d: %v", agentConn.server.ID, err)
+		return agentConn.server
+	}
+	return server
 }
 
 // handleAlertMessage processes alert data from agents
@@ -281,16 +925,220 @@ func (h *WebSocketHandler) handleAlertMessage(agentConn *AgentConnection, messag
 		Resolved:  false,
 	}
 
+	// Labels are only used for routing and filtering, so an alert with
+	// invalid ones is still recorded, just without them
+	if err := validateAlertLabels(alertDataStruct.Labels); err != nil {
+		log.Printf("Dropping labels of alert from %s: %v", agentConn.server.Name, err)
+	} else if len(alertDataStruct.Labels) > 0 {
+		alert.Labels = models.Dimensions(alertDataStruct.Labels)
+	}
+
+	// A server in maintenance is expected to misbehave; don't record or notify
+	server := h.currentServer(agentConn)
+	if server.MaintenanceMode {
+		log.Printf("Server %s in maintenance, suppressing alert: %s", agentConn.server.Name, alertDataStruct.Message)
+		return
+	}
+
+	// A condition that persists is reported on every sample; within the
+	// cooldown the open alert is updated rather than raised and notified again
+	if h.repeatAlert(alert) {
+		return
+	}
+
 	// Save to database
 	if err := h.db.CreateAlert(alert); err != nil {
 		log.Printf("Error saving alert: %v", err)
 		return
 	}
 
+	agentConn.noOpenAlerts = false
+
 	log.Printf("Received alert from %s: %s", agentConn.server.Name, alertDataStruct.Message)
+	h.InvalidateDashboard(agentConn.server.UserID)
+
+	// Notify through the channels selected by the owner's alert routes
+	go h.dispatchAlert(server, alert)
+}
+
+// repeatAlert folds an alert into the matching open alert raised within the
+// cooldown, if there is one, and reports whether it did
+func (h *WebSocketHandler) repeatAlert(alert *models.Alert) bool {
+	cooldown := time.Duration(h.config.Notifications.AlertCooldown) * time.Second
+	if cooldown <= 0 {
+		return false
+	}
+
+	existing, err := h.db.GetRepeatedAlert(alert, time.Now().Add(-cooldown))
+	if err != nil {
+		log.Printf("Error looking up open %s alert for server %d: %v", alert.Type, alert.ServerID, err)
+		return false
+	}
+	if existing == nil {
+		return false
+	}
+
+	if err := h.db.RepeatAlert(existing.ID, alert); err != nil {
+		log.Printf("Error updating alert %d: %v", existing.ID, err)
+	}
+	return true
+}
+
+// handleAgentErrorMessage records a non-fatal collection failure reported by
+// an agent. These are shown on the dashboard rather than raised as alerts.
+func (h *WebSocketHandler) handleAgentErrorMessage(agentConn *AgentConnection, message models.AgentMessage) {
+	jsonData, err := json.Marshal(message.Data)
+	if err != nil {
+		log.Printf("Error marshaling agent error data: %v", err)
+		return
+	}
+
+	var errorData models.AgentErrorData
+	if err := json.Unmarshal(jsonData, &errorData); err != nil {
+		log.Printf("Error unmarshaling agent error data: %v", err)
+		return
+	}
+
+	event := &models.AgentEvent{
+		ServerID:  agentConn.server.ID,
+		Subsystem: errorData.Subsystem,
+		Message:   errorData.Message,
+	}
+	if err := h.db.CreateAgentEvent(event); err != nil {
+		log.Printf("Error saving agent event: %v", err)
+		return
+	}
+
+	log.Printf("Collection error from %s (%s): %s", agentConn.server.Name, errorData.Subsystem, errorData.Message)
+}
+
+// handleCapabilitiesMessage stores what the agent announced it can do
+func (h *WebSocketHandler) handleCapabilitiesMessage(agentConn *AgentConnection, message models.AgentMessage) {
+	jsonData, err := json.Marshal(message.Data)
+	if err != nil {
+		log.Printf("Error marshaling capabilities: %v", err)
+		return
+	}
+
+	var capabilities models.CapabilitiesData
+	if err := json.Unmarshal(jsonData, &capabilities); err != nil {
+		log.Printf("Error unmarshaling capabilities: %v", err)
+		return
+	}
+
+	collectors := models.StringList(capabilities.Collectors)
+	if collectors == nil {
+		collectors = models.StringList{}
+	}
+	updates := map[string]interface{}{
+		"agent_capabilities":   collectors,
+		"agent_schema_version": capabilities.SchemaVersion,
+	}
+	if err := h.db.UpdateServer(agentConn.server.ID, updates); err != nil {
+		log.Printf("Error saving capabilities for server %d: %v", agentConn.server.ID, err)
+		return
+	}
+	agentConn.server.AgentCapabilities = collectors
+	agentConn.server.AgentSchemaVersion = capabilities.SchemaVersion
+
+	log.Printf("Agent %s announced schema v%d with %v", agentConn.server.Name, capabilities.SchemaVersion, capabilities.Collectors)
+}
+
+// handleCommandResultMessage logs the outcome of an alert action the agent
+// ran locally
+func (h *WebSocketHandler) handleCommandResultMessage(agentConn *AgentConnection, message models.AgentMessage) {
+	jsonData, err := json.Marshal(message.Data)
+	if err != nil {
+		log.Printf("Error marshaling command result: %v", err)
+		return
+	}
+
+	var result models.CommandResultData
+	if err := json.Unmarshal(jsonData, &result); err != nil {
+		log.Printf("Error unmarshaling command result: %v", err)
+		return
+	}
 
-	// Send email alert
-	go h.sendEmailAlert(agentConn.server, alert)
+	if result.Error != "" {
+		log.Printf("Alert action %s on %s for %s alert failed (exit %d): %s\n%s",
+			result.Script, agentConn.server.Name, result.AlertType, result.ExitCode, result.Error, result.Output)
+		return
+	}
+	log.Printf("Alert action %s on %s for %s alert finished in %.1fs\n%s",
+		result.Script, agentConn.server.Name, result.AlertType, result.Duration, result.Output)
+}
+
+// handleConfigReportMessage stores the agent's effective configuration
+func (h *WebSocketHandler) handleConfigReportMessage(agentConn *AgentConnection, message models.AgentMessage) {
+	report, ok := message.Data.(map[string]interface{})
+	if !ok {
+		log.Printf("Invalid config report format")
+		return
+	}
+
+	// Agents redact secrets themselves; never store them even if one doesn't
+	redactSecrets(report)
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		log.Printf("Error marshaling config report: %v", err)
+		return
+	}
+
+	document := string(jsonData)
+	now := time.Now()
+	updates := map[string]interface{}{
+		"agent_config":             &document,
+		"agent_config_reported_at": &now,
+	}
+	if err := h.db.UpdateServer(agentConn.server.ID, updates); err != nil {
+		log.Printf("Error saving config report for server %d: %v", agentConn.server.ID, err)
+	}
+}
+
+// redactSecrets masks values of keys that look like credentials, in nested
+// objects and arrays too
+func redactSecrets(document map[string]interface{}) {
+	redactValue(document, false)
+}
+
+// redactValue masks every non-empty string in value when it belongs to a
+// secret key, and looks for secret keys below it otherwise
+func redactValue(value interface{}, secret bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		if secret && v != "" {
+			return "[redacted]"
+		}
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = redactValue(nested, secret || isSecretKey(key))
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = redactValue(nested, secret)
+		}
+	}
+	return value
+}
+
+func isSecretKey(key string) bool {
+	lower := strings.ToLower(key)
+	return strings.Contains(lower, "token") || strings.Contains(lower, "secret") || strings.Contains(lower, "password")
+}
+
+// alertSubject is the one-line summary of an alert used as the email
+// subject and Slack message title
+func alertSubject(server *models.Server, alert *models.Alert) string {
+	subject := fmt.Sprintf("[ALERT] %s - %s Alert on Server %s",
+		strings.ToUpper(alert.Level), strings.ToUpper(alert.Type), server.Name)
+	if alert.Resolved {
+		subject = fmt.Sprintf("[RECOVERED] %s Alert on Server %s", strings.ToUpper(alert.Type), server.Name)
+	}
+	if alert.Test {
+		subject = "[TEST] " + subject
+	}
+	return subject
 }
 
 // sendEmailAlert sends an email notification for alerts
@@ -299,27 +1147,33 @@ func (h *WebSocketHandler) sendEmailAlert(server *models.Server, alert *models.A
 	smtpConfig := h.config.SMTP
 
 	// Validate required SMTP configuration
-	if smtpConfig.Username == "" || smtpConfig.Password == "" {
-		log.Printf("SMTP configuration incomplete: missing username or password")
+	providers := smtpConfig.Providers()
+	if len(providers) == 0 {
+		log.Printf("SMTP configuration incomplete: no server with a username and password")
 		return
 	}
 
 	// Get recipients
-	recipients := h.getAlertRecipients(server.ID)
+	recipients := h.getAlertRecipients(server)
 	if len(recipients) == 0 {
 		log.Printf("No recipients found for server %s alerts", server.Name)
 		return
 	}
 
-	// Create email content
-	subject := fmt.Sprintf("[ALERT] %s - %s Alert on Server %s",
-		strings.ToUpper(alert.Level), strings.ToUpper(alert.Type), server.Name)
+	// Send as the server's sender, if it has one
+	branding := h.emailBranding(server)
+	from := &mail.Address{Name: branding.FromName, Address: branding.FromAddress}
 
-	body := h.buildEmailBody(server, alert)
+	// Create email content
+	subject := alertSubject(server, alert)
+	body := h.buildEmailBody(server, alert, branding)
 
 	// Send email to each recipient
 	for _, recipient := range recipients {
-		if err := h.sendEmail(smtpConfig, recipient, subject, body); err != nil {
+		err := h.deliverEmail(providers, func(provider config.SMTPProvider) error {
+			return h.sendEmail(provider, from, recipient, subject, body)
+		})
+		if err != nil {
 			log.Printf("Failed to send alert email to %s: %v", recipient, err)
 		} else {
 			log.Printf("Alert email sent to %s for server %s", recipient, server.Name)
@@ -327,14 +1181,15 @@ func (h *WebSocketHandler) sendEmailAlert(server *models.Server, alert *models.A
 	}
 }
 
-// sendEmail sends an email using SMTP
-func (h *WebSocketHandler) sendEmail(smtpConfig config.SMTPConfig, to, subject, body string) error {
+// sendEmail sends an email through one SMTP provider. Failures to reach or
+// log in to the provider are returned as *smtpUnavailableError.
+func (h *WebSocketHandler) sendEmail(provider config.SMTPProvider, from *mail.Address, to, subject, body string) error {
 	// Set up authentication
-	auth := smtp.PlainAuth("", smtpConfig.Username, smtpConfig.Password, smtpConfig.Host)
+	auth := smtp.PlainAuth("", provider.Username, provider.Password, provider.Host)
 
 	// Create message
 	msg := []byte("To: " + to + "\r\n" +
-		"From: " + smtpConfig.From + "\r\n" +
+		"From: " + from.String() + "\r\n" +
 		"Subject: " + subject + "\r\n" +
 		"MIME-Version: 1.0\r\n" +
 		"Content-Type: text/html; charset=\"UTF-8\"\r\n" +
@@ -342,40 +1197,36 @@ func (h *WebSocketHandler) sendEmail(smtpConfig config.SMTPConfig, to, subject,
 		body + "\r\n")
 
 	// Connect to server
-	serverAddr := smtpConfig.Host + ":" + smtpConfig.Port
+	serverAddr := provider.Host + ":" + provider.Port
 
 	// Connect with plain TCP first
 	conn, err := net.Dial("tcp", serverAddr)
 	if err != nil {
-		return fmt.Errorf("failed to connect to SMTP server: %v", err)
+		return &smtpUnavailableError{fmt.Errorf("failed to connect to SMTP server: %v", err)}
 	}
 	defer conn.Close()
 
 	// Create SMTP client
-	client, err := smtp.NewClient(conn, smtpConfig.Host)
+	client, err := smtp.NewClient(conn, provider.Host)
 	if err != nil {
-		return fmt.Errorf("failed to create SMTP client: %v", err)
+		return &smtpUnavailableError{fmt.Errorf("failed to create SMTP client: %v", err)}
 	}
 	defer client.Quit()
 
 	// Start TLS if supported
 	if ok, _ := client.Extension("STARTTLS"); ok {
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: false,
-			ServerName:         smtpConfig.Host,
-		}
-		if err = client.StartTLS(tlsConfig); err != nil {
-			return fmt.Errorf("failed to start TLS: %v", err)
+		if err = client.StartTLS(h.config.TLS.ClientConfig(provider.Host)); err != nil {
+			return &smtpUnavailableError{fmt.Errorf("failed to start TLS: %v", err)}
 		}
 	}
 
 	// Authenticate
 	if err = client.Auth(auth); err != nil {
-		return fmt.Errorf("SMTP authentication failed: %v", err)
+		return &smtpUnavailableError{fmt.Errorf("SMTP authentication failed: %v", err)}
 	}
 
 	// Set sender
-	if err = client.Mail(smtpConfig.From); err != nil {
+	if err = client.Mail(from.Address); err != nil {
 		return fmt.Errorf("failed to set sender: %v", err)
 	}
 
@@ -400,7 +1251,7 @@ func (h *WebSocketHandler) sendEmail(smtpConfig config.SMTPConfig, to, subject,
 }
 
 // buildEmailBody creates the HTML email body for alerts
-func (h *WebSocketHandler) buildEmailBody(server *models.Server, alert *models.Alert) string {
+func (h *WebSocketHandler) buildEmailBody(server *models.Server, alert *models.Alert, branding models.EmailBranding) string {
 	timestamp := time.Now().Format("2006-01-02 15:04:05 MST")
 
 	// Determine alert color based on level
@@ -416,16 +1267,30 @@ func (h *WebSocketHandler) buildEmailBody(server *models.Server, alert *models.A
 		alertColor = "#3b82f6" // blue
 	}
 
+	product := html.EscapeString(branding.ProductName)
+	title := "Server Alert"
+	action := "<strong>Action Required:</strong> Please check your " + product + " dashboard for more details and take appropriate action to resolve this alert."
+	if alert.Resolved {
+		alertColor = "#22c55e" // green
+		title = "Alert Resolved"
+		action = "No action is needed: this alert has been resolved."
+	}
+	logo := ""
+	if branding.LogoURL != "" {
+		logo = fmt.Sprintf(`<img src="%s" alt="%s" style="max-height: 40px; margin-bottom: 10px;"><br>`,
+			html.EscapeString(branding.LogoURL), product)
+	}
+
 	return fmt.Sprintf(`
 <!DOCTYPE html>
 <html>
 <head>
     <meta charset="UTF-8">
-    <title>Server Alert | Monitaur</title>
+    <title>Server Alert | %s</title>
 </head>
 <body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
     <div style="background-color: %s; color: white; padding: 20px; border-radius: 8px 8px 0 0;">
-        <h1 style="margin: 0; font-size: 24px;">Server Alert</h1>
+        %s<h1 style="margin: 0; font-size: 24px;">%s</h1>
         <p style="margin: 5px 0 0 0; font-size: 18px; font-weight: bold;">%s</p>
     </div>
 
@@ -458,19 +1323,22 @@ func (h *WebSocketHandler) buildEmailBody(server *models.Server, alert *models.A
 
         <div style="margin-top: 20px; padding: 15px; background-color: #fff; border-left: 4px solid %s; border-radius: 4px;">
             <p style="margin: 0; color: #6c757d;">
-                <strong>Action Required:</strong> Please check your Monitaur dashboard for more details and take appropriate action to resolve this alert.
+                %s
             </p>
         </div>
 
         <hr style="margin: 20px 0; border: none; border-top: 1px solid #dee2e6;">
 
         <p style="font-size: 12px; color: #6c757d; margin: 0;">
-            This alert was automatically generated by Monitaur.
+            This alert was automatically generated by %s.
         </p>
     </div>
 </body>
 </html>`,
+		product,
 		alertColor,
+		logo,
+		title,
 		strings.ToUpper(alert.Level),
 		strings.ToUpper(server.Name),
 		strings.ToUpper(alert.Type),
@@ -480,6 +1348,8 @@ func (h *WebSocketHandler) buildEmailBody(server *models.Server, alert *models.A
 		h.buildValueThresholdRow(alert),
 		timestamp,
 		alertColor,
+		action,
+		product,
 	)
 }
 
@@ -492,8 +1362,8 @@ func (h *WebSocketHandler) buildValueThresholdRow(alert *models.Alert) string {
 		rows.WriteString(fmt.Sprintf(`
             <tr>
                 <td style="padding: 8px 0; font-weight: bold; color: #6c757d;">Current Value:</td>
-                <td style="padding: 8px 0;">%.2f</td>
-            </tr>`, alert.Value))
+                <td style="padding: 8px 0;">%s</td>
+            </tr>`, formatAlertValue(alert.Type, alert.Value)))
 	}
 
 	// Check if Threshold is not zero (assuming 0 means not set)
@@ -501,72 +1371,94 @@ func (h *WebSocketHandler) buildValueThresholdRow(alert *models.Alert) string {
 		rows.WriteString(fmt.Sprintf(`
             <tr>
                 <td style="padding: 8px 0; font-weight: bold; color: #6c757d;">Threshold:</td>
-                <td style="padding: 8px 0;">%.2f</td>
-            </tr>`, alert.Threshold))
+                <td style="padding: 8px 0;">%s</td>
+            </tr>`, formatAlertValue(alert.Type, alert.Threshold)))
 	}
 
 	return rows.String()
 }
 
-// getAlertRecipients returns email addresses that should receive alerts for a server
-func (h *WebSocketHandler) getAlertRecipients(serverID uint) []string {
-	// Get the server to find the owner (user_id)
-	server, err := h.db.GetServerByID(serverID)
-	if err != nil {
-		log.Printf("Error fetching server %d: %v", serverID, err)
-		return []string{}
+// formatAlertValue formats an alert value or threshold in the unit of its
+// alert type. Unknown types keep two decimals.
+func formatAlertValue(alertType string, value float64) string {
+	switch alertType {
+	case "cpu", "memory", "disk", "swap", "memory_pressure":
+		return fmt.Sprintf("%.1f%%", value)
+	case "network", "network_sent", "network_recv":
+		return formatBytes(value)
+	case "disk_latency":
+		return fmt.Sprintf("%.1fms", value)
+	case "clock_drift":
+		return fmt.Sprintf("%.3fs", value)
+	case "offline":
+		return (time.Duration(value) * time.Second).String()
+	case "load":
+		return fmt.Sprintf("%.2f per core", value)
+	case "port_down":
+		// The value is the port that stopped listening
+		return fmt.Sprintf("port %.0f", value)
+	default:
+		return fmt.Sprintf("%.2f", value)
+	}
+}
+
+// formatBytes humanizes a byte count with binary units, e.g. 16.0 GiB
+func formatBytes(value float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	i := 0
+	for math.Abs(value) >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f B", value)
 	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
 
+// getAlertRecipients returns email addresses that should receive alerts for
+// a server, from the server row the alert was dispatched with
+func (h *WebSocketHandler) getAlertRecipients(server *models.Server) []string {
 	// Get the user who owns this server
 	user, err := h.db.GetUserByID(server.UserID)
 	if err != nil {
-		log.Printf("Error fetching user %d for server %d: %v", server.UserID, serverID, err)
+		log.Printf("Error fetching user %d for server %d: %v", server.UserID, server.ID, err)
 		return []string{}
 	}
 
-	// Return the owner's email
-	recipients := []string{user.Email}
-
-	// Optional:
-
-	// 1. Admin users who should receive all alerts
-	// adminUsers, err := h.db.GetAdminUsers()
-	// if err == nil {
-	//     for _, admin := range adminUsers {
-	//         if admin.Email != user.Email { // Avoid duplicates
-	//             recipients = append(recipients, admin.Email)
-	//         }
-	//     }
-	// }
-
-	// 2. Users who have subscribed to this specific server's alerts
-	// subscribers, err := h.db.GetServerSubscribers(serverID)
-	// if err == nil {
-	//     for _, subscriber := range subscribers {
-	//         if subscriber.Email != user.Email { // Avoid duplicates
-	//             recipients = append(recipients, subscriber.Email)
-	//         }
-	//     }
-	// }
-
-	log.Printf("Alert recipients for server %s (ID: %d): %v", server.Name, serverID, recipients)
+	// The owner and every alert recipient get the alert, each address once
+	extra, err := h.db.GetAlertRecipients(server.ID)
+	if err != nil {
+		log.Printf("Error fetching alert recipients for server %d: %v", server.ID, err)
+	}
+	recipients := mergeRecipients([]string{user.Email}, extra)
+
+	log.Printf("Alert recipients for server %s (ID: %d): %v", server.Name, server.ID, recipients)
 	return recipients
 }
 
 // unregisterConnection removes a connection from the registry
 func (h *WebSocketHandler) unregisterConnection(agentConn *AgentConnection) {
 	h.mutex.Lock()
-	defer h.mutex.Unlock()
-
-	if _, exists := h.connections[agentConn.server.ID]; exists {
+	// Only unregister if this connection hasn't been replaced by a newer one
+	current, exists := h.connections[agentConn.server.ID]
+	removed := exists && current == agentConn
+	if removed {
 		delete(h.connections, agentConn.server.ID)
 		close(agentConn.send)
+	}
+	h.mutex.Unlock()
 
-		// Update server status to offline
-		h.db.UpdateServerStatus(agentConn.server.ID, "offline")
-
-		log.Printf("Agent disconnected: %s (ID: %d)", agentConn.server.Name, agentConn.server.ID)
+	if !removed {
+		return
 	}
+
+	// Update server status to offline outside the lock, since it queries the
+	// database and feeds the status notifier
+	h.setServerStatus(agentConn.server.ID, "offline")
+	h.InvalidateDashboard(agentConn.server.UserID)
+
+	log.Printf("Agent disconnected: %s (ID: %d)", agentConn.server.Name, agentConn.server.ID)
 }
 
 // cleanupRoutine periodically cleans up stale connections
@@ -584,30 +1476,28 @@ func (h *WebSocketHandler) cleanupRoutine() {
 
 // cleanupStaleConnections removes connections that haven't sent pings recently
 func (h *WebSocketHandler) cleanupStaleConnections() {
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
+	var stale []*AgentConnection
 
+	h.mutex.Lock()
 	now := time.Now()
 	for serverID, conn := range h.connections {
 		if now.Sub(conn.lastPing) > 2*time.Minute {
-			log.Printf("Cleaning up stale connection for server ID: %d", serverID)
-			conn.conn.Close()
+			close(conn.send)
 			delete(h.connections, serverID)
-			h.db.UpdateServerStatus(serverID, "offline")
+			stale = append(stale, conn)
 		}
 	}
+	h.mutex.Unlock()
+
+	for _, conn := range stale {
+		log.Printf("Cleaning up stale connection for server ID: %d", conn.server.ID)
+		conn.conn.Close()
+		h.setServerStatus(conn.server.ID, "offline")
+	}
 }
 
 // SendMessageToAgent sends a message to a specific agent
 func (h *WebSocketHandler) SendMessageToAgent(serverID uint, messageType string, data interface{}) error {
-	h.mutex.RLock()
-	conn, exists := h.connections[serverID]
-	h.mutex.RUnlock()
-
-	if !exists {
-		return ErrAgentNotConnected
-	}
-
 	message := map[string]interface{}{
 		"type":      messageType,
 		"data":      data,
@@ -619,6 +1509,16 @@ func (h *WebSocketHandler) SendMessageToAgent(serverID uint, messageType string,
 		return err
 	}
 
+	// send is only closed under the write lock, together with removing the
+	// connection, so it stays open while the read lock is held
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	conn, exists := h.connections[serverID]
+	if !exists {
+		return ErrAgentNotConnected
+	}
+
 	select {
 	case conn.send <- jsonData:
 		return nil
@@ -628,6 +1528,24 @@ func (h *WebSocketHandler) SendMessageToAgent(serverID uint, messageType string,
 	}
 }
 
+// InvalidateDashboard drops the cached dashboard of a user after their
+// servers or alerts changed
+func (h *WebSocketHandler) InvalidateDashboard(userID uint) {
+	h.dashboardCache.invalidate(userID)
+}
+
+// DisconnectAgent closes the agent connection for a server, if any, so the
+// agent reconnects and picks up changed server settings
+func (h *WebSocketHandler) DisconnectAgent(serverID uint) {
+	h.mutex.RLock()
+	agentConn, exists := h.connections[serverID]
+	h.mutex.RUnlock()
+
+	if exists {
+		agentConn.conn.Close()
+	}
+}
+
 // GetConnectedAgents returns a list of currently connected agents
 func (h *WebSocketHandler) GetConnectedAgents() []uint {
 	h.mutex.RLock()
@@ -640,6 +1558,11 @@ func (h *WebSocketHandler) GetConnectedAgents() []uint {
 	return agents
 }
 
+// Close flushes metrics waiting to be forwarded, giving up when ctx is done
+func (h *WebSocketHandler) Close(ctx context.Context) error {
+	return h.forwarder.Close(ctx)
+}
+
 // IsAgentConnected checks if an agent is currently connected
 func (h *WebSocketHandler) IsAgentConnected(serverID uint) bool {
 	h.mutex.RLock()
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/apierror"
+	"backend/config"
+	"backend/models"
+	"backend/testdb"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Connections are replaced and their send channel closed while messages are
+// being sent to the same server; a send must never hit a closed channel.
+// Run with -race to catch the interleaving reliably.
+func TestSendMessageToAgentDuringTakeover(t *testing.T) {
+	server := &models.Server{ID: 1}
+	h := &WebSocketHandler{connections: map[uint]*AgentConnection{
+		1: {server: server, send: make(chan []byte, 1)},
+	}}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					h.SendMessageToAgent(1, "ping", nil)
+				}
+			}
+		}()
+	}
+
+	// Take over the connection the way registerConnection does
+	for i := 0; i < 10000; i++ {
+		h.mutex.Lock()
+		previous := h.connections[1]
+		h.connections[1] = &AgentConnection{server: server, send: make(chan []byte, 1)}
+		close(previous.send)
+		h.mutex.Unlock()
+	}
+	close(stop)
+	wg.Wait()
+}
+
+// A finished bucket that fails to store stays pending and unacknowledged, so
+// no sample is acknowledged without being stored
+func TestAggregatedStoreFailureWithholdsAck(t *testing.T) {
+	h := &WebSocketHandler{db: testdb.Unreachable(t), config: &config.Config{}, ingestion: newIngestionLimiter()}
+	agentConn := &AgentConnection{server: &models.Server{ID: 1, Name: "test"}}
+	settings := ingestionSettings{server: agentConn.server, bucket: time.Minute}
+
+	start := time.Now().Truncate(time.Minute)
+	first := &models.MetricData{Timestamp: start.Add(10 * time.Second)}
+	if ack, ok := h.ingestMetrics(agentConn, first, settings); !ok || !ack.IsZero() {
+		t.Fatalf("first sample: ack %v, ok %v, want no ack while its bucket is pending", ack, ok)
+	}
+
+	// The next bucket's first sample flushes the first bucket, which fails
+	next := &models.MetricData{Timestamp: start.Add(70 * time.Second)}
+	if ack, ok := h.ingestMetrics(agentConn, next, settings); ok || !ack.IsZero() {
+		t.Errorf("store failure: ack %v, ok %v, want no ack and false", ack, ok)
+	}
+	if agentConn.aggregate.count != 1 || !agentConn.aggregate.start.Equal(start) {
+		t.Errorf("pending bucket has %d samples from %s, want the first bucket kept",
+			agentConn.aggregate.count, agentConn.aggregate.start)
+	}
+	if !agentConn.aggregateAck.Equal(first.Timestamp) {
+		t.Errorf("aggregateAck = %s, want it left at %s", agentConn.aggregateAck, first.Timestamp)
+	}
+}
+
+func TestFormatAlertValue(t *testing.T) {
+	tests := []struct {
+		alertType string
+		value     float64
+		want      string
+	}{
+		{"cpu", 91.25, "91.2%"},
+		{"memory", 95, "95.0%"},
+		{"swap", 50.55, "50.5%"},
+		{"disk", 88.8, "88.8%"},
+		{"memory_pressure", 12.34, "12.3%"},
+		{"network", 1536, "1.5 KiB"},
+		{"network_sent", 512, "512 B"},
+		{"network_recv", 3 << 30, "3.0 GiB"},
+		{"disk_latency", 25.06, "25.1ms"},
+		{"clock_drift", 1.5, "1.500s"},
+		{"offline", 300, "5m0s"},
+		{"load", 1.234, "1.23 per core"},
+		{"port_down", 5432, "port 5432"},
+		{"status_change", 1, "1.00"},
+	}
+	for _, test := range tests {
+		if got := formatAlertValue(test.alertType, test.value); got != test.want {
+			t.Errorf("formatAlertValue(%q, %v) = %q, want %q", test.alertType, test.value, got, test.want)
+		}
+	}
+}
+
+func TestVerifyAgentToken(t *testing.T) {
+	d := testdb.Open(t)
+	server := testdb.Server(t, d, testdb.User(t, d), "verify")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/agent/verify-token", (&WebSocketHandler{db: d}).VerifyAgentToken)
+
+	for _, tc := range []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"valid", server.Token, http.StatusOK},
+		{"invalid", uuid.NewString(), http.StatusUnauthorized},
+		{"empty", "", http.StatusUnauthorized},
+	} {
+		body, _ := json.Marshal(map[string]string{"token": tc.token})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/agent/verify-token", strings.NewReader(string(body))))
+		if w.Code != tc.status {
+			t.Errorf("%s token: status %d, want %d", tc.name, w.Code, tc.status)
+			continue
+		}
+
+		if tc.status == http.StatusOK {
+			var verified struct {
+				Valid      bool   `json:"valid"`
+				ServerName string `json:"server_name"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &verified); err != nil || !verified.Valid || verified.ServerName != server.Name {
+				t.Errorf("%s token: got %s, want the server verified", tc.name, w.Body)
+			}
+			continue
+		}
+		// Unknown and missing tokens are indistinguishable
+		var rejected apierror.Response
+		if err := json.Unmarshal(w.Body.Bytes(), &rejected); err != nil || rejected.Code != apierror.CodeUnauthenticated || rejected.Message != "invalid token" {
+			t.Errorf("%s token: got %s, want the generic invalid token error", tc.name, w.Body)
+		}
+	}
+}
@@ -1,23 +1,37 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"backend/auth"
 	"backend/config"
 	"backend/database"
 	"backend/handlers"
+	"backend/middleware"
+	"backend/retention"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go"
 )
 
+// shutdownTimeout bounds how long shutdown waits for requests to finish and
+// forwarded metrics to be flushed
+const shutdownTimeout = 15 * time.Second
+
 func main() {
 	var (
 		createConfig = flag.Bool("init", false, "Create sample config.yaml file")
 		migrate      = flag.Bool("migrate", false, "Run database migrations")
+		dryRun       = flag.Bool("dry-run", false, "With -migrate, print the pending schema changes without applying them")
 	)
 	flag.Parse()
 
@@ -43,6 +57,15 @@ func main() {
 	}
 
 	// Run migrations if requested
+	if *migrate && *dryRun {
+		results, err := db.Migrate(true)
+		database.LogMigrationResults(results, true)
+		if err != nil {
+			log.Fatalf("Migration dry run failed: %v", err)
+		}
+		log.Println("Dry run complete, no changes were applied")
+		return
+	}
 	if *migrate {
 		if err := db.AutoMigrate(); err != nil {
 			log.Fatalf("Failed to run migrations: %v", err)
@@ -57,10 +80,17 @@ func main() {
 		log.Fatalf("Failed to initialize Firebase Auth: %v", err)
 	}
 
+	// Start background metric and alert pruning
+	retention.NewMetricPruner(db, &cfg.Database)
+	retention.NewAlertPruner(db, &cfg.AlertRetention)
+	retention.NewStaleServerPruner(db, &cfg.StaleServers)
+
 	// Initialize handlers
 	wsHandler := handlers.NewWebSocketHandler(db, cfg)
 	apiHandler := handlers.NewAPIHandler(db, firebaseAuth, wsHandler)
 	dashboardHandler := handlers.NewDashboardHandler(db, wsHandler)
+	badgeHandler := handlers.NewBadgeHandler(db, &cfg.Badges)
+	remoteReadHandler := handlers.NewRemoteReadHandler(db)
 
 	// Initialize Gin router
 	if gin.Mode() == gin.ReleaseMode {
@@ -71,7 +101,7 @@ func main() {
 	// CORS middleware
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowOrigins = []string{cfg.Server.AllowOrigins}
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Cache-Control"}
 	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
 	router.Use(cors.New(corsConfig))
 
@@ -80,43 +110,155 @@ func main() {
 
 	// Agent WebSocket endpoint (no auth required, uses token authentication)
 	router.GET("/agent/connect", wsHandler.HandleAgentConnection)
+	router.POST("/agent/verify-token", middleware.RateLimit(cfg.Agents.VerifyRateLimit), wsHandler.VerifyAgentToken)
+
+	// Public uptime badges (authorized by the server's badge token)
+	router.GET("/badges/:token/uptime", badgeHandler.GetUptimeBadge)
+
+	// Prometheus remote read (authorized by the user's read API key)
+	router.POST("/prometheus/api/v1/read", middleware.MaxBodySize(cfg.Server.MaxBodyBytes), remoteReadHandler.Read)
 
 	// API routes (require Firebase authentication)
 	api := router.Group("/api/v1")
+	api.Use(middleware.MaxBodySize(cfg.Server.MaxBodyBytes))
 	api.Use(firebaseAuth.AuthMiddleware())
 	api.Use(firebaseAuth.EnsureUserExists(db))
 	{
 		// User routes
 		api.GET("/profile", apiHandler.GetUserProfile)
+		api.POST("/read-api-key", apiHandler.CreateReadAPIKey)
+		api.DELETE("/read-api-key", apiHandler.DeleteReadAPIKey)
 
 		// Server management routes
 		api.GET("/servers", apiHandler.GetUserServers)
 		api.POST("/servers", apiHandler.CreateServer)
+		api.POST("/servers/import", apiHandler.ImportNewServer)
+		api.GET("/servers/latest", apiHandler.GetLatestServerMetrics)
+		api.PUT("/servers/:id", apiHandler.UpdateServer)
 		api.DELETE("/servers/:id", apiHandler.DeleteServer)
+		api.PUT("/servers/:id/token", apiHandler.RegenerateServerToken)
+		api.GET("/servers/:id/agent-config", apiHandler.GetAgentConfig)
+		api.GET("/servers/:id/config", apiHandler.ExportServerConfig)
+		api.PUT("/servers/:id/config", apiHandler.ImportServerConfig)
+		api.PUT("/servers/:id/ingestion/pause", apiHandler.PauseIngestion)
+		api.PUT("/servers/:id/ingestion/resume", apiHandler.ResumeIngestion)
+		api.GET("/servers/:id/thresholds", apiHandler.GetAlertThresholds)
+		api.PUT("/servers/:id/thresholds", apiHandler.UpdateAlertThresholds)
+		api.PUT("/servers/:id/maintenance/enable", apiHandler.EnableMaintenance)
+		api.PUT("/servers/:id/maintenance/disable", apiHandler.DisableMaintenance)
+		api.PUT("/servers/:id/disable", apiHandler.DisableServer)
+		api.PUT("/servers/:id/enable", apiHandler.EnableServer)
+		api.POST("/servers/:id/signing-secret", apiHandler.RotateSigningSecret)
+		api.DELETE("/servers/:id/signing-secret", apiHandler.DeleteSigningSecret)
+		api.PUT("/servers/:id/signing", apiHandler.SetSignatureRequired)
+		api.POST("/servers/:id/badge-token", apiHandler.CreateBadgeToken)
+		api.DELETE("/servers/:id/badge-token", apiHandler.DeleteBadgeToken)
 
 		// Metrics routes
 		api.GET("/servers/:id/metrics", apiHandler.GetServerMetrics)
+		api.GET("/servers/:id/live", apiHandler.GetServerLive)
+
+		// Agent log routes
+		api.GET("/servers/:id/logs", apiHandler.GetServerLogs)
+		api.PUT("/servers/:id/logs/enable", apiHandler.EnableLogs)
+		api.PUT("/servers/:id/logs/disable", apiHandler.DisableLogs)
 
 		// Alert routes
 		api.GET("/servers/:id/alerts", apiHandler.GetServerAlerts)
+		api.DELETE("/servers/:id/alerts", apiHandler.DeleteServerAlerts)
+		api.PUT("/servers/:id/alerts/ack-all", apiHandler.AcknowledgeServerAlerts)
+		api.POST("/servers/:id/test-alert", apiHandler.SendTestAlert)
+		api.GET("/servers/:id/recipients", apiHandler.GetAlertRecipients)
+		api.POST("/servers/:id/recipients", apiHandler.AddAlertRecipient)
+		api.DELETE("/servers/:id/recipients/:recipient_id", apiHandler.RemoveAlertRecipient)
 		api.PUT("/alerts/:id/resolve", apiHandler.ResolveAlert)
 
+		// Alert routing rules
+		api.GET("/alert-routes", apiHandler.GetAlertRoutes)
+		api.POST("/alert-routes", apiHandler.CreateAlertRoute)
+		api.PUT("/alert-routes/:id", apiHandler.UpdateAlertRoute)
+		api.DELETE("/alert-routes/:id", apiHandler.DeleteAlertRoute)
+
 		// Dashboard routes
 		api.GET("/dashboard", dashboardHandler.GetDashboardData)
+		api.GET("/dashboard/rankings", dashboardHandler.GetServerRankings)
+		api.GET("/dashboard/alert-stats", dashboardHandler.GetAlertStats)
 		api.GET("/servers/:id/dashboard", dashboardHandler.GetServerDashboard)
 		api.GET("/servers/:id/chart", dashboardHandler.GetMetricsChart)
+		api.GET("/servers/:id/report", dashboardHandler.GetServerReport)
+		api.GET("/servers/:id/custom-metrics", dashboardHandler.GetCustomMetrics)
+		api.GET("/servers/:id/custom-metrics/:name", dashboardHandler.GetCustomMetricChart)
+		api.GET("/servers/:id/delta", dashboardHandler.GetMetricsDelta)
 	}
 
 	// Start server
 	serverAddr := cfg.Server.Host + ":" + cfg.Server.Port
 	log.Printf("Starting server on %s", serverAddr)
 
+	// Agent connections and the streamed report are exempt from the request timeout
+	handler := middleware.Timeout(router,
+		time.Duration(cfg.Server.RequestTimeout)*time.Second,
+		cfg.Server.TimeoutExemptPaths)
+
 	srv := &http.Server{
-		Addr:    serverAddr,
-		Handler: router,
+		Addr:      serverAddr,
+		Handler:   handler,
+		TLSConfig: cfg.TLS.ServerConfig(),
 	}
 
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	// Experimental QUIC listener for agents on lossy links
+	var quicListener *quic.Listener
+	if cfg.QUIC.Enabled {
+		certFile, keyFile := cfg.QUIC.Certificate(cfg.Server)
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("Failed to load QUIC certificate: %v", err)
+		}
+		tlsConfig := cfg.TLS.ServerConfig()
+		tlsConfig.Certificates = []tls.Certificate{cert}
+
+		quicAddr := cfg.Server.Host + ":" + cfg.QUIC.Port
+		quicListener, err = handlers.ListenQUIC(quicAddr, tlsConfig)
+		if err != nil {
+			log.Fatalf("Failed to start QUIC listener: %v", err)
+		}
+		log.Printf("Accepting agents over QUIC on %s (udp)", quicAddr)
+		go func() {
+			if err := wsHandler.ServeQUIC(quicListener); err != nil {
+				log.Printf("QUIC listener stopped: %v", err)
+			}
+		}()
+	}
+
+	// Stop accepting requests on SIGINT/SIGTERM, then flush forwarded metrics
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+		<-stop
+
+		log.Println("Shutting down...")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Error stopping server: %v", err)
+		}
+		if quicListener != nil {
+			quicListener.Close()
+		}
+		if err := wsHandler.Close(ctx); err != nil {
+			log.Printf("Error flushing forwarded metrics: %v", err)
+		}
+	}()
+
+	if cfg.Server.TLSCertFile != "" {
+		err = srv.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+	<-shutdownDone
 }
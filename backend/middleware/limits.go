@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"backend/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxBodySize rejects request bodies larger than maxBytes with 413. Bodies
+// without a Content-Length are capped while being read.
+func MaxBodySize(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if maxBytes <= 0 {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			apierror.Abort(c, http.StatusRequestEntityTooLarge, apierror.CodeTooLarge,
+				fmt.Sprintf("request body exceeds %d bytes", maxBytes))
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
+var timeoutBody = func() string {
+	body, _ := json.Marshal(apierror.New(apierror.CodeTimeout, "request timed out"))
+	return string(body)
+}()
+
+// Timeout wraps a handler so requests that run longer than timeout are
+// answered with 503. Requests matching one of the exempt paths (WebSocket
+// upgrades, streaming exports) are passed through untouched, since
+// http.TimeoutHandler buffers responses and can't hijack. An exempt path is a
+// prefix, or a path.Match pattern when it contains a '*'.
+func Timeout(handler http.Handler, timeout time.Duration, exemptPaths []string) http.Handler {
+	if timeout <= 0 {
+		return handler
+	}
+
+	timeoutHandler := http.TimeoutHandler(handler, timeout, timeoutBody)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, exempt := range exemptPaths {
+			if matchesExemptPath(r.URL.Path, exempt) {
+				handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		timeoutHandler.ServeHTTP(jsonTimeoutWriter{w}, r)
+	})
+}
+
+func matchesExemptPath(requestPath, exempt string) bool {
+	if strings.Contains(exempt, "*") {
+		matched, _ := path.Match(exempt, requestPath)
+		return matched
+	}
+	return strings.HasPrefix(requestPath, exempt)
+}
+
+// jsonTimeoutWriter labels the timeout body as JSON, which
+// http.TimeoutHandler writes without a Content-Type
+type jsonTimeoutWriter struct {
+	http.ResponseWriter
+}
+
+func (w jsonTimeoutWriter) WriteHeader(code int) {
+	if code == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
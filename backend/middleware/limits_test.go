@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeoutExemptPaths(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := Timeout(slow, 10*time.Millisecond, []string{"/agent/", "/api/v1/servers/*/report"})
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/agent/connect", http.StatusOK},
+		{"/api/v1/servers/7/report", http.StatusOK},
+		{"/api/v1/servers/7/metrics", http.StatusServiceUnavailable},
+		{"/api/v1/servers/7/report/extra", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusServiceUnavailable {
+				if got := rec.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+					t.Errorf("Content-Type = %q, want JSON", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit allows each client IP at most limit requests per minute,
+// answering further requests with 429 until the minute is over. A limit of
+// 0 disables it.
+func RateLimit(limit int) gin.HandlerFunc {
+	if limit <= 0 {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	limiter := &ipLimiter{limit: limit, windows: make(map[string]*rateWindow)}
+	return func(c *gin.Context) {
+		if retryAfter, ok := limiter.allow(c.ClientIP(), time.Now()); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			apierror.Abort(c, http.StatusTooManyRequests, apierror.CodeRateLimited, "too many requests")
+			return
+		}
+		c.Next()
+	}
+}
+
+// ipLimiter counts requests per client IP in fixed one-minute windows
+type ipLimiter struct {
+	limit int
+
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// allow counts a request and reports whether it is within the limit, or how
+// long until the client's window resets
+func (l *ipLimiter) allow(ip string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget clients whose window has ended, so the map doesn't grow forever
+	if now.Sub(l.lastSweep) >= time.Minute {
+		for key, window := range l.windows {
+			if now.Sub(window.start) >= time.Minute {
+				delete(l.windows, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	window, ok := l.windows[ip]
+	if !ok || now.Sub(window.start) >= time.Minute {
+		window = &rateWindow{start: now}
+		l.windows[ip] = window
+	}
+	if window.count >= l.limit {
+		return window.start.Add(time.Minute).Sub(now), false
+	}
+	window.count++
+	return 0, true
+}
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
 	"time"
 )
 
@@ -12,6 +16,13 @@ type User struct {
 	CreatedAt   time.Time `json:"created_at" gorm:"default:CURRENT_TIMESTAMP"`
 	UpdatedAt   time.Time `json:"updated_at"`
 
+	// Plan selects the account's quotas; empty uses the default plan
+	Plan string `json:"plan"`
+
+	// ReadAPIKey authorizes Prometheus remote reads of the user's metrics;
+	// nil when not enabled
+	ReadAPIKey *string `json:"-" gorm:"uniqueIndex"`
+
 	// Relationships
 	Servers []Server `json:"servers,omitempty" gorm:"foreignKey:UserID"`
 }
@@ -23,25 +34,128 @@ type Server struct {
 	Token     string     `json:"token" gorm:"unique;not null"`
 	Name      string     `json:"name" gorm:"not null"`
 	LastSeen  *time.Time `json:"last_seen"`
-	Status    string     `json:"status" gorm:"default:'offline'"` // online, offline, warning
+	Status    string     `json:"status" gorm:"default:'offline'"` // online, offline, warning, maintenance
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 
+	// ClockSkewSeconds is how far the agent's clock was ahead (positive) or
+	// behind (negative) the backend when it last connected
+	ClockSkewSeconds float64 `json:"clock_skew_seconds"`
+
+	// EmailBranding overrides the sender and branding of this server's alert emails
+	EmailBranding EmailBranding `json:"email_branding" gorm:"embedded;embeddedPrefix:email_"`
+
+	// NameLocked prevents agents from renaming the server via server_name
+	NameLocked bool `json:"name_locked" gorm:"default:false"`
+
+	// PausedIngestion keeps the agent connected but discards its metrics
+	PausedIngestion bool `json:"paused_ingestion" gorm:"default:false"`
+
+	// AlertThresholds are pushed to the agent, replacing the thresholds in its
+	// local config. ThresholdsVersion counts updates; the agent acknowledges
+	// the version it applied as ThresholdsAckedVersion.
+	AlertThresholds        AlertThresholds `json:"alert_thresholds" gorm:"embedded;embeddedPrefix:threshold_"`
+	ThresholdsVersion      int             `json:"thresholds_version" gorm:"default:0"`
+	ThresholdsAckedVersion int             `json:"thresholds_acked_version" gorm:"default:0"`
+
+	// AggregationSeconds, when set, stores one row per bucket of that many
+	// seconds, averaging the agent's samples, instead of every sample
+	AggregationSeconds int `json:"aggregation_seconds" gorm:"default:0"`
+
+	// ResolutionSeconds, when set, is pushed to the agent as its collection
+	// interval and replaces AggregationSeconds as the ingestion bucket, so
+	// one setting decides how finely the server's metrics are kept
+	ResolutionSeconds int `json:"resolution_seconds" gorm:"default:0"`
+
+	// StatusNotifications lists the status transitions that raise a
+	// status_change alert, as "from->to" with "*" for any status; nil uses
+	// the default transitions
+	StatusNotifications *StringList `json:"status_notifications" gorm:"type:jsonb"`
+
+	// MaintenanceMode pins the status to "maintenance" and suppresses agent
+	// alerts while metrics keep being stored
+	MaintenanceMode bool `json:"maintenance_mode" gorm:"default:false"`
+
+	// LogsEnabled accepts log lines shipped by the agent; they are dropped otherwise
+	LogsEnabled bool `json:"logs_enabled" gorm:"default:false"`
+
+	// AgentConfig is the effective configuration last reported by the agent,
+	// served by its own endpoint
+	AgentConfig           *string    `json:"-" gorm:"type:jsonb"`
+	AgentConfigReportedAt *time.Time `json:"-"`
+
+	// AgentVersion is the release the agent reported when it last connected,
+	// empty for agents that predate version reporting
+	AgentVersion string `json:"agent_version"`
+
+	// AgentCapabilities lists the collectors and features the agent announced
+	// on its last connect, e.g. "disk_io"; AgentSchemaVersion is the version of
+	// its message formats, 0 for agents that don't announce capabilities
+	AgentCapabilities  StringList `json:"agent_capabilities" gorm:"type:jsonb"`
+	AgentSchemaVersion int        `json:"agent_schema_version" gorm:"default:0"`
+
+	// Disabled rejects all agent connections for the server while keeping its history
+	Disabled bool `json:"disabled" gorm:"default:false"`
+
+	// SigningSecret is the HMAC key agents sign messages with. It is only
+	// returned once, when generated.
+	SigningSecret string `json:"-"`
+
+	// RequireSignature rejects agent messages without a valid signature
+	RequireSignature bool `json:"require_signature" gorm:"default:false"`
+
+	// StaleSince is when the server was flagged for its agent never having
+	// connected; nil otherwise
+	StaleSince *time.Time `json:"stale_since,omitempty"`
+
+	// BadgeToken publicly shares the server's uptime badge; nil when not shared
+	BadgeToken *string `json:"badge_token,omitempty" gorm:"uniqueIndex"`
+
 	// Relationships
 	User    User     `json:"user,omitempty" gorm:"foreignKey:UserID"`
 	Metrics []Metric `json:"metrics,omitempty" gorm:"foreignKey:ServerID"`
 	Alerts  []Alert  `json:"alerts,omitempty" gorm:"foreignKey:ServerID"`
 }
 
+// EmailBranding customises the sender and look of alert emails. Empty fields
+// fall back to the global SMTP configuration.
+type EmailBranding struct {
+	FromAddress string `json:"from_address"`
+	FromName    string `json:"from_name"`
+	ProductName string `json:"product_name"`
+	LogoURL     string `json:"logo_url"`
+}
+
+// AlertThresholds are the alert thresholds enforced by a server's agent. A
+// nil field leaves the agent's locally configured value in place.
+type AlertThresholds struct {
+	CPU         *float64 `json:"cpu"`
+	LoadPerCore *float64 `json:"load_per_core"`
+	Memory      *float64 `json:"memory"`
+	Swap        *float64 `json:"swap"` // percent, 0 disables
+	Disk        *float64 `json:"disk"`
+	DiskLatency *float64 `json:"disk_latency"` // milliseconds
+	ClockDrift  *float64 `json:"clock_drift"`  // seconds
+
+	MemoryPressure *float64 `json:"memory_pressure"` // PSI "some" avg10 percentage
+}
+
+// IsSet reports whether any threshold is managed by the backend
+func (t AlertThresholds) IsSet() bool {
+	return t.CPU != nil || t.LoadPerCore != nil || t.Memory != nil || t.Swap != nil || t.Disk != nil || t.DiskLatency != nil || t.ClockDrift != nil ||
+		t.MemoryPressure != nil
+}
+
 // Metric represents system metrics at a point in time
 type Metric struct {
 	ID       uint      `json:"id" gorm:"primaryKey"`
-	Time     time.Time `json:"time" gorm:"not null;index"`
-	ServerID uint      `json:"server_id" gorm:"not null;index"`
+	Time     time.Time `json:"time" gorm:"not null;index;uniqueIndex:idx_metrics_server_time_unique,priority:2,sort:desc"`
+	ServerID uint      `json:"server_id" gorm:"not null;index;uniqueIndex:idx_metrics_server_time_unique,priority:1"`
 
-	// CPU metrics
-	CPUUsage float64 `json:"cpu_usage"`
-	CPUCores int     `json:"cpu_cores"`
+	// CPU metrics; CPUPerCore is empty for agents that don't report it
+	CPUUsage   float64   `json:"cpu_usage"`
+	CPUCores   int       `json:"cpu_cores"`
+	CPUPerCore FloatList `json:"cpu_per_core" gorm:"type:jsonb"`
 
 	// Memory metrics
 	MemoryTotal     uint64  `json:"memory_total"`
@@ -49,15 +163,63 @@ type Metric struct {
 	MemoryAvailable uint64  `json:"memory_available"`
 	MemoryPercent   float64 `json:"memory_percent"`
 
-	// Disk metrics
+	// Swap metrics, zero on servers without swap
+	SwapTotal   uint64  `json:"swap_total"`
+	SwapUsed    uint64  `json:"swap_used"`
+	SwapPercent float64 `json:"swap_percent"`
+
+	// Disk metrics, of the agent's first mount point
 	DiskTotal   uint64  `json:"disk_total"`
 	DiskUsed    uint64  `json:"disk_used"`
 	DiskFree    uint64  `json:"disk_free"`
 	DiskPercent float64 `json:"disk_percent"`
 
-	// Network metrics
-	NetworkBytesIn  uint64 `json:"network_bytes_in"`
-	NetworkBytesOut uint64 `json:"network_bytes_out"`
+	// Usage of every mount point the agent reports (optional)
+	Disks DiskUsageList `json:"disks" gorm:"type:jsonb"`
+
+	// Network metrics, of NetworkInterface or of all interfaces when empty
+	NetworkInterface string `json:"network_interface"`
+	NetworkBytesIn   uint64 `json:"network_bytes_in"`
+	NetworkBytesOut  uint64 `json:"network_bytes_out"`
+
+	// Bytes per second since the agent's previous sample; nil for the first
+	// sample after the agent starts and for agents that don't report them
+	NetworkRateIn  *float64 `json:"network_rate_in"`
+	NetworkRateOut *float64 `json:"network_rate_out"`
+
+	// Load averages and the 1-minute load per core (optional, not on Windows)
+	Load1       *float64 `json:"load1"`
+	Load5       *float64 `json:"load5"`
+	Load15      *float64 `json:"load15"`
+	LoadPerCore *float64 `json:"load_per_core"`
+
+	// Kernel metrics (optional, Linux only)
+	ContextSwitchRate float64 `json:"context_switch_rate"`
+	InterruptRate     float64 `json:"interrupt_rate"`
+
+	// Per-device I/O latency and queue depth (optional, Linux only)
+	DiskIO DiskIOList `json:"disk_io" gorm:"type:jsonb"`
+
+	// Bytes read and written per second across whole disks (optional, Linux only)
+	DiskReadBytes  *float64 `json:"disk_read_bytes"`
+	DiskWriteBytes *float64 `json:"disk_write_bytes"`
+
+	// Share of time tasks stalled on memory over 10 seconds (PSI) and OOM
+	// kills since boot (optional, Linux only; PSI needs Linux 4.20)
+	MemoryPressureSome *float64 `json:"memory_pressure_some"`
+	MemoryPressureFull *float64 `json:"memory_pressure_full"`
+	OOMKills           *uint64  `json:"oom_kills"`
+
+	// Agent clock offset against NTP in seconds (optional)
+	ClockOffset *float64 `json:"clock_offset"`
+
+	// SampleCount is the number of agent samples folded into this row when
+	// the server pre-aggregates metrics, 1 otherwise. Aggregated rows keep
+	// the averages above along with these maxima.
+	SampleCount      int      `json:"sample_count" gorm:"default:1"`
+	CPUUsageMax      *float64 `json:"cpu_usage_max,omitempty"`
+	MemoryPercentMax *float64 `json:"memory_percent_max,omitempty"`
+	DiskPercentMax   *float64 `json:"disk_percent_max,omitempty"`
 
 	// System info
 	Uptime int64 `json:"uptime"`
@@ -68,21 +230,262 @@ type Metric struct {
 
 // Alert represents system alerts
 type Alert struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	ServerID  uint      `json:"server_id" gorm:"not null;index"`
-	Type      string    `json:"type" gorm:"not null"`  // cpu, memory, disk, network
-	Level     string    `json:"level" gorm:"not null"` // warning, critical
-	Message   string    `json:"message" gorm:"not null"`
-	Value     float64   `json:"value"`
-	Threshold float64   `json:"threshold"`
-	Resolved  bool      `json:"resolved" gorm:"default:false"`
+	ID        uint    `json:"id" gorm:"primaryKey"`
+	ServerID  uint    `json:"server_id" gorm:"not null;index"`
+	Type      string  `json:"type" gorm:"not null"`  // cpu, memory, swap, disk, disk_latency, memory_pressure, clock_drift, network, port_down, status_change, offline
+	Level     string  `json:"level" gorm:"not null"` // warning, critical
+	Message   string  `json:"message" gorm:"not null"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Resolved  bool    `json:"resolved" gorm:"default:false"`
+	Test      bool    `json:"test" gorm:"default:false;index"` // synthetic alert, excluded from incident counts
+
+	// Labels identify what the alert is about, e.g. {"mount": "/data"}, for
+	// routing and filtering
+	Labels Dimensions `json:"labels" gorm:"type:jsonb;index:idx_alerts_labels,type:gin"`
+
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
+	// ResolvedAt is when the alert was resolved, nil while open and for
+	// alerts resolved before it was recorded
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+
+	// Acknowledged alerts stay open but are muted: someone is on it
+	Acknowledged   bool       `json:"acknowledged" gorm:"default:false"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+
 	// Relationships
 	Server Server `json:"server,omitempty" gorm:"foreignKey:ServerID"`
 }
 
+// CustomMetric is an application-level value reported by an agent. The same
+// name can be split into series by dimensions, e.g. queue=emails.
+type CustomMetric struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Time       time.Time  `json:"time" gorm:"not null;index:idx_custom_metrics_lookup,priority:3"`
+	ServerID   uint       `json:"server_id" gorm:"not null;index:idx_custom_metrics_lookup,priority:1"`
+	Name       string     `json:"name" gorm:"not null;index:idx_custom_metrics_lookup,priority:2"`
+	Value      float64    `json:"value"`
+	Dimensions Dimensions `json:"dimensions" gorm:"type:jsonb"`
+}
+
+// CustomMetricPoint is a custom metric value at a point in time, summed over
+// the series in its group
+type CustomMetricPoint struct {
+	Group string    `json:"group"`
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// AgentEvent records a non-fatal problem reported by an agent, such as a
+// collector subsystem failing, shown as a collection warning
+type AgentEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ServerID  uint      `json:"server_id" gorm:"not null;index"`
+	Subsystem string    `json:"subsystem"` // cpu, memory, disk, network, disk_io, kernel
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// AlertPruneCount is the running total of alerts pruned by retention for a
+// server, kept so incident counts can still be reported after pruning
+type AlertPruneCount struct {
+	ServerID     uint      `json:"server_id" gorm:"primaryKey;autoIncrement:false"`
+	Pruned       int64     `json:"pruned"`
+	LastPrunedAt time.Time `json:"last_pruned_at"`
+}
+
+// AlertRecipient is an extra address a server's alert emails go to, on top
+// of its owner. It also holds the notification_emails of older versions.
+type AlertRecipient struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ServerID  uint      `json:"server_id" gorm:"not null;uniqueIndex:idx_alert_recipients_server_email"`
+	Email     string    `json:"email" gorm:"not null;uniqueIndex:idx_alert_recipients_server_email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AlertRoute is a notification routing rule. Empty match fields match
+// anything; rules are evaluated in ascending Position order.
+type AlertRoute struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Position  int        `json:"position" gorm:"not null;default:0"`
+	ServerID  *uint      `json:"server_id"`
+	Type      string     `json:"type"`
+	Level     string     `json:"level"`
+	Channels  StringList `json:"channels" gorm:"type:jsonb"` // email, ...
+	Labels    Dimensions `json:"labels" gorm:"type:jsonb"`   // all must match the alert's labels
+	Enabled   bool       `json:"enabled" gorm:"default:true"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Matches reports whether the route applies to an alert on a server
+func (r *AlertRoute) Matches(server *Server, alert *Alert) bool {
+	if !r.Enabled {
+		return false
+	}
+	if r.ServerID != nil && *r.ServerID != server.ID {
+		return false
+	}
+	if r.Type != "" && r.Type != alert.Type {
+		return false
+	}
+	if r.Level != "" && r.Level != alert.Level {
+		return false
+	}
+	for key, value := range r.Labels {
+		if alert.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ServerTrend holds incrementally maintained usage trend state for a server,
+// so forecasts survive restarts without re-scanning raw metrics
+type ServerTrend struct {
+	ServerID        uint       `json:"server_id" gorm:"primaryKey;autoIncrement:false"`
+	LastTime        time.Time  `json:"last_time"`
+	LastDiskPercent float64    `json:"last_disk_percent"`
+	DiskSlope       float64    `json:"disk_slope"` // percentage points per hour
+	ProjectedFullAt *time.Time `json:"projected_full_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// trendWindow is the time constant of the exponentially weighted slope
+const trendWindow = time.Hour
+
+// Observe folds a new disk usage sample into the trend. The slope is an
+// exponentially weighted average of the instantaneous slope, weighted so
+// samples from roughly the last trendWindow dominate.
+func (t *ServerTrend) Observe(at time.Time, diskPercent float64) {
+	if t.LastTime.IsZero() {
+		t.LastTime = at
+		t.LastDiskPercent = diskPercent
+		return
+	}
+
+	elapsed := at.Sub(t.LastTime)
+	if elapsed <= 0 {
+		return
+	}
+
+	instant := (diskPercent - t.LastDiskPercent) / elapsed.Hours()
+	alpha := 1 - math.Exp(-elapsed.Seconds()/trendWindow.Seconds())
+	t.DiskSlope += alpha * (instant - t.DiskSlope)
+	t.LastTime = at
+	t.LastDiskPercent = diskPercent
+
+	t.ProjectedFullAt = nil
+	if t.DiskSlope > 0 && diskPercent < 100 {
+		hoursToFull := (100 - diskPercent) / t.DiskSlope
+		// Ignore projections too far out to be meaningful
+		if hoursToFull < 24*365 {
+			full := at.Add(time.Duration(hoursToFull * float64(time.Hour)))
+			t.ProjectedFullAt = &full
+		}
+	}
+}
+
+// AgentErrorData represents a collection error reported by an agent
+type AgentErrorData struct {
+	Subsystem string    `json:"subsystem"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// CapabilitiesData is what an agent announces it supports when it connects
+type CapabilitiesData struct {
+	SchemaVersion int      `json:"schema_version"`
+	Collectors    []string `json:"collectors"`
+}
+
+// LogLine is a line of a log file tailed by an agent
+type LogLine struct {
+	Time time.Time `json:"time"`
+	Line string    `json:"line"`
+}
+
+// LogsData is a batch of log lines shipped by an agent. Dropped counts lines
+// the agent skipped to stay within its rate limit.
+type LogsData struct {
+	File    string    `json:"file"`
+	Lines   []LogLine `json:"lines"`
+	Dropped int       `json:"dropped"`
+}
+
+// ThresholdsUpdateData is the config_update message pushing alert thresholds
+// to an agent
+type ThresholdsUpdateData struct {
+	Version         int             `json:"version"`
+	AlertThresholds AlertThresholds `json:"alert_thresholds"`
+}
+
+// IntervalUpdateData is the config_update message pushing a collection
+// interval to an agent; 0 restores the interval from its local config
+type IntervalUpdateData struct {
+	CollectionInterval int `json:"collection_interval"`
+}
+
+// ConfigAckData is an agent's answer to a config_update: whether it applied
+// the given version, and why not
+type ConfigAckData struct {
+	Version int    `json:"version"`
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+// CommandResultData is the outcome of a script an agent ran locally in
+// response to an alert
+type CommandResultData struct {
+	Script     string    `json:"script"`
+	AlertType  string    `json:"alert_type"`
+	AlertLevel string    `json:"alert_level"`
+	ExitCode   int       `json:"exit_code"`
+	Output     string    `json:"output"`
+	Error      string    `json:"error,omitempty"`
+	TimedOut   bool      `json:"timed_out"`
+	Duration   float64   `json:"duration"` // seconds
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// ServerRanking is a server's aggregated value for a ranked metric
+type ServerRanking struct {
+	ServerID   uint    `json:"server_id"`
+	ServerName string  `json:"server_name"`
+	Value      float64 `json:"value"`
+	Samples    int64   `json:"samples"`
+}
+
+// AlertStats aggregates a user's alerts over a window, excluding test alerts
+type AlertStats struct {
+	Total    int64            `json:"total"`
+	Resolved int64            `json:"resolved"`
+	ByLevel  map[string]int64 `json:"by_level"`
+	ByType   map[string]int64 `json:"by_type"`
+
+	// MeanTimeToResolve is in seconds, nil when no alert was resolved
+	MeanTimeToResolve *float64 `json:"mean_time_to_resolve"`
+
+	TopServers []ServerRanking `json:"top_servers"`
+	Daily      []DailyCount    `json:"daily"`
+}
+
+// ResourceStats summarises one resource's usage percentage over a period
+type ResourceStats struct {
+	Average float64 `json:"average"`
+	Max     float64 `json:"max"`
+	Min     float64 `json:"min"`
+}
+
+// DailyCount is a count for one UTC day
+type DailyCount struct {
+	Day   time.Time `json:"day"`
+	Count int64     `json:"count"`
+}
+
 // AgentMessage represents WebSocket messages from agents
 type AgentMessage struct {
 	Type       string      `json:"type"`
@@ -90,6 +493,7 @@ type AgentMessage struct {
 	ServerName string      `json:"server_name"`
 	Data       interface{} `json:"data"`
 	Timestamp  time.Time   `json:"timestamp"`
+	Signature  string      `json:"signature,omitempty"` // hex HMAC-SHA256, see auth.SignAgentMessage
 }
 
 // MetricData represents the metrics data structure from agents
@@ -97,8 +501,9 @@ type MetricData struct {
 	Timestamp  time.Time `json:"timestamp"`
 	ServerName string    `json:"server_name"`
 	CPU        struct {
-		Usage float64 `json:"usage"`
-		Cores int     `json:"cores"`
+		Usage   float64   `json:"usage"`
+		Cores   int       `json:"cores"`
+		PerCore []float64 `json:"per_core"`
 	} `json:"cpu"`
 	Memory struct {
 		Total       uint64  `json:"total"`
@@ -106,19 +511,59 @@ type MetricData struct {
 		Used        uint64  `json:"used"`
 		UsedPercent float64 `json:"used_percent"`
 	} `json:"memory"`
+	Swap struct {
+		Total       uint64  `json:"total"`
+		Used        uint64  `json:"used"`
+		UsedPercent float64 `json:"used_percent"`
+	} `json:"swap"`
 	Disk struct {
 		Total       uint64  `json:"total"`
 		Free        uint64  `json:"free"`
 		Used        uint64  `json:"used"`
 		UsedPercent float64 `json:"used_percent"`
 	} `json:"disk"`
+	Disks   DiskUsageList `json:"disks,omitempty"`
 	Network struct {
+		Interface   string `json:"interface,omitempty"`
 		BytesSent   uint64 `json:"bytes_sent"`
 		BytesRecv   uint64 `json:"bytes_recv"`
 		PacketsSent uint64 `json:"packets_sent"`
 		PacketsRecv uint64 `json:"packets_recv"`
+
+		SentBytesPerSec *float64 `json:"sent_bytes_per_sec"`
+		RecvBytesPerSec *float64 `json:"recv_bytes_per_sec"`
 	} `json:"network"`
-	Uptime int64 `json:"uptime"`
+	Load *struct {
+		Load1       float64 `json:"load1"`
+		Load5       float64 `json:"load5"`
+		Load15      float64 `json:"load15"`
+		LoadPerCore float64 `json:"load_per_core"`
+	} `json:"load,omitempty"`
+	Kernel *struct {
+		ContextSwitchesPerSec float64 `json:"context_switches_per_sec"`
+		InterruptsPerSec      float64 `json:"interrupts_per_sec"`
+	} `json:"kernel,omitempty"`
+	DiskIO         DiskIOList `json:"disk_io,omitempty"`
+	DiskThroughput *struct {
+		ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+		WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+	} `json:"disk_throughput,omitempty"`
+	MemoryPressure *struct {
+		SomeAvg10 *float64 `json:"some_avg10"`
+		FullAvg10 *float64 `json:"full_avg10"`
+		OOMKills  uint64   `json:"oom_kills"`
+	} `json:"memory_pressure,omitempty"`
+	ClockOffset *float64 `json:"clock_offset,omitempty"`
+	Uptime      int64    `json:"uptime"`
+
+	CustomMetrics []CustomMetricData `json:"custom_metrics,omitempty"`
+}
+
+// CustomMetricData is a custom metric value reported by an agent
+type CustomMetricData struct {
+	Name       string            `json:"name"`
+	Value      float64           `json:"value"`
+	Dimensions map[string]string `json:"dimensions,omitempty"`
 }
 
 // AlertData represents alert data from agents
@@ -129,6 +574,198 @@ type AlertData struct {
 	Value     float64   `json:"value"`
 	Threshold float64   `json:"threshold"`
 	Timestamp time.Time `json:"timestamp"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// StringList is a list of strings stored as a JSON array column
+type StringList []string
+
+// Value implements driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (l *StringList) Scan(value interface{}) error {
+	if value == nil {
+		*l = StringList{}
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", value)
+	}
+	return json.Unmarshal(data, l)
+}
+
+// DiskIOStat is the I/O latency, queue depth and throughput of a single
+// block device
+type DiskIOStat struct {
+	Device           string  `json:"device"`
+	AwaitMs          float64 `json:"await_ms"`
+	QueueDepth       float64 `json:"queue_depth"`
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+}
+
+// DiskUsage is the usage of the filesystem mounted at Path
+type DiskUsage struct {
+	Path        string  `json:"path"`
+	Total       uint64  `json:"total"`
+	Free        uint64  `json:"free"`
+	Used        uint64  `json:"used"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// DiskUsageList is a list of per-mount disk usage stored as a JSON array column
+type DiskUsageList []DiskUsage
+
+// Value implements driver.Valuer
+func (l DiskUsageList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (l *DiskUsageList) Scan(value interface{}) error {
+	if value == nil {
+		*l = DiskUsageList{}
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into DiskUsageList", value)
+	}
+	return json.Unmarshal(data, l)
+}
+
+// FloatList is a list of numbers stored as a JSON array column
+type FloatList []float64
+
+// Value implements driver.Valuer
+func (l FloatList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (l *FloatList) Scan(value interface{}) error {
+	if value == nil {
+		*l = FloatList{}
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into FloatList", value)
+	}
+	return json.Unmarshal(data, l)
+}
+
+// DiskIOList is a list of per-device I/O stats stored as a JSON array column
+type DiskIOList []DiskIOStat
+
+// Value implements driver.Valuer
+func (l DiskIOList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (l *DiskIOList) Scan(value interface{}) error {
+	if value == nil {
+		*l = DiskIOList{}
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into DiskIOList", value)
+	}
+	return json.Unmarshal(data, l)
+}
+
+// Dimensions are key/value labels, of a custom metric series or an alert
+type Dimensions map[string]string
+
+// Value implements driver.Valuer. Keys are marshaled in sorted order, so equal
+// dimensions always produce the same JSON.
+func (d Dimensions) Value() (driver.Value, error) {
+	if d == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (d *Dimensions) Scan(value interface{}) error {
+	if value == nil {
+		*d = Dimensions{}
+		return nil
+	}
+
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Dimensions", value)
+	}
+	return json.Unmarshal(data, d)
 }
 
 // TableName methods for custom table names
@@ -147,3 +784,23 @@ func (Metric) TableName() string {
 func (Alert) TableName() string {
 	return "alerts"
 }
+
+func (CustomMetric) TableName() string {
+	return "custom_metrics"
+}
+
+func (AgentEvent) TableName() string {
+	return "agent_events"
+}
+
+func (AlertPruneCount) TableName() string {
+	return "alert_prune_counts"
+}
+
+func (AlertRoute) TableName() string {
+	return "alert_routes"
+}
+
+func (ServerTrend) TableName() string {
+	return "server_trends"
+}
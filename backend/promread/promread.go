@@ -0,0 +1,201 @@
+// Package promread implements the wire format of the Prometheus remote read
+// protocol: snappy compressed protobuf requests and sampled responses. Only
+// the SAMPLES response type is supported, which is what Prometheus asks for
+// unless streamed chunks are configured. It also encodes remote write
+// requests, which carry the same time series.
+package promread
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Label matcher types
+const (
+	MatchEqual     = 0
+	MatchNotEqual  = 1
+	MatchRegexp    = 2
+	MatchNotRegexp = 3
+)
+
+// Query selects the series matching all Matchers between StartMs and EndMs,
+// both inclusive, in milliseconds since the epoch
+type Query struct {
+	StartMs  int64
+	EndMs    int64
+	Matchers []Matcher
+}
+
+// Matcher compares the value of the label Name with Value
+type Matcher struct {
+	Type  int
+	Name  string
+	Value string
+}
+
+// Label is a label name and value of a series
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one value of a series, at a time in milliseconds since the epoch
+type Sample struct {
+	Value       float64
+	TimestampMs int64
+}
+
+// TimeSeries is a labeled series of samples in ascending time order
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// QueryResult holds the series matching one query
+type QueryResult struct {
+	Timeseries []TimeSeries
+}
+
+// DecodeReadRequest decompresses and parses the queries of a ReadRequest body
+func DecodeReadRequest(body []byte) ([]Query, error) {
+	data, err := snappyDecode(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var queries []Query
+	err = eachField(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		query, err := decodeQuery(value)
+		if err != nil {
+			return err
+		}
+		queries = append(queries, query)
+		return nil
+	})
+	return queries, err
+}
+
+func decodeQuery(data []byte) (Query, error) {
+	var query Query
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(value)
+			query.StartMs = int64(v)
+		case num == 2 && typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(value)
+			query.EndMs = int64(v)
+		case num == 3 && typ == protowire.BytesType:
+			matcher, err := decodeMatcher(value)
+			if err != nil {
+				return err
+			}
+			query.Matchers = append(query.Matchers, matcher)
+		}
+		return nil
+	})
+	return query, err
+}
+
+func decodeMatcher(data []byte) (Matcher, error) {
+	var matcher Matcher
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(value)
+			matcher.Type = int(v)
+		case num == 2 && typ == protowire.BytesType:
+			matcher.Name = string(value)
+		case num == 3 && typ == protowire.BytesType:
+			matcher.Value = string(value)
+		}
+		return nil
+	})
+	if err == nil && (matcher.Type < MatchEqual || matcher.Type > MatchNotRegexp) {
+		err = fmt.Errorf("unknown matcher type %d", matcher.Type)
+	}
+	return matcher, err
+}
+
+// eachField calls fn with every field of a message. Varint values are passed
+// still encoded and length-delimited values without their length.
+func eachField(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		size := protowire.ConsumeFieldValue(num, typ, data)
+		if size < 0 {
+			return protowire.ParseError(size)
+		}
+		value := data[:size]
+		if typ == protowire.BytesType {
+			value, _ = protowire.ConsumeBytes(value)
+		}
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// EncodeReadResponse serializes and compresses a ReadResponse with one result
+// per query, in query order
+func EncodeReadResponse(results []QueryResult) []byte {
+	var data []byte
+	for _, result := range results {
+		var resultData []byte
+		for _, series := range result.Timeseries {
+			resultData = protowire.AppendTag(resultData, 1, protowire.BytesType)
+			resultData = protowire.AppendBytes(resultData, encodeTimeSeries(series))
+		}
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, resultData)
+	}
+	return snappy.Encode(nil, data)
+}
+
+// EncodeWriteRequest serializes and compresses a remote write WriteRequest
+func EncodeWriteRequest(series []TimeSeries) []byte {
+	var data []byte
+	for _, s := range series {
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, encodeTimeSeries(s))
+	}
+	return snappy.Encode(nil, data)
+}
+
+func encodeTimeSeries(series TimeSeries) []byte {
+	var data []byte
+	for _, label := range series.Labels {
+		var labelData []byte
+		labelData = protowire.AppendTag(labelData, 1, protowire.BytesType)
+		labelData = protowire.AppendString(labelData, label.Name)
+		labelData = protowire.AppendTag(labelData, 2, protowire.BytesType)
+		labelData = protowire.AppendString(labelData, label.Value)
+
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, labelData)
+	}
+	for _, sample := range series.Samples {
+		var sampleData []byte
+		sampleData = protowire.AppendTag(sampleData, 1, protowire.Fixed64Type)
+		sampleData = protowire.AppendFixed64(sampleData, math.Float64bits(sample.Value))
+		sampleData = protowire.AppendTag(sampleData, 2, protowire.VarintType)
+		sampleData = protowire.AppendVarint(sampleData, uint64(sample.TimestampMs))
+
+		data = protowire.AppendTag(data, 2, protowire.BytesType)
+		data = protowire.AppendBytes(data, sampleData)
+	}
+	return data
+}
@@ -0,0 +1,211 @@
+package promread
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// encodeReadRequest builds a compressed ReadRequest the way Prometheus does
+func encodeReadRequest(queries []Query) []byte {
+	var data []byte
+	for _, query := range queries {
+		var queryData []byte
+		queryData = protowire.AppendTag(queryData, 1, protowire.VarintType)
+		queryData = protowire.AppendVarint(queryData, uint64(query.StartMs))
+		queryData = protowire.AppendTag(queryData, 2, protowire.VarintType)
+		queryData = protowire.AppendVarint(queryData, uint64(query.EndMs))
+		for _, matcher := range query.Matchers {
+			var matcherData []byte
+			matcherData = protowire.AppendTag(matcherData, 1, protowire.VarintType)
+			matcherData = protowire.AppendVarint(matcherData, uint64(matcher.Type))
+			matcherData = protowire.AppendTag(matcherData, 2, protowire.BytesType)
+			matcherData = protowire.AppendString(matcherData, matcher.Name)
+			matcherData = protowire.AppendTag(matcherData, 3, protowire.BytesType)
+			matcherData = protowire.AppendString(matcherData, matcher.Value)
+
+			queryData = protowire.AppendTag(queryData, 3, protowire.BytesType)
+			queryData = protowire.AppendBytes(queryData, matcherData)
+		}
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, queryData)
+	}
+	return snappy.Encode(nil, data)
+}
+
+// decodeSeriesList parses the repeated time series in field 1 of a message,
+// as in a WriteRequest or a QueryResult
+func decodeSeriesList(t *testing.T, data []byte) []TimeSeries {
+	t.Helper()
+	var list []TimeSeries
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		var series TimeSeries
+		err := eachField(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+			switch num {
+			case 1:
+				var label Label
+				err := eachField(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+					if num == 1 {
+						label.Name = string(value)
+					} else {
+						label.Value = string(value)
+					}
+					return nil
+				})
+				series.Labels = append(series.Labels, label)
+				return err
+			case 2:
+				var sample Sample
+				err := eachField(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+					if num == 1 {
+						bits, _ := protowire.ConsumeFixed64(value)
+						sample.Value = math.Float64frombits(bits)
+					} else {
+						ts, _ := protowire.ConsumeVarint(value)
+						sample.TimestampMs = int64(ts)
+					}
+					return nil
+				})
+				series.Samples = append(series.Samples, sample)
+				return err
+			}
+			return nil
+		})
+		list = append(list, series)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func decompress(t *testing.T, body []byte) []byte {
+	t.Helper()
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+var testSeries = []TimeSeries{
+	{
+		Labels: []Label{{"__name__", "monitaur_cpu_usage_percent"}, {"server", "web"}, {"server_id", "1"}},
+		Samples: []Sample{
+			{Value: 12.5, TimestampMs: 1700000000000},
+			{Value: math.Inf(1), TimestampMs: 1700000015000},
+		},
+	},
+	{
+		Labels:  []Label{{"__name__", "monitaur_uptime_seconds"}, {"server", "db"}, {"server_id", "2"}},
+		Samples: []Sample{{Value: 3600, TimestampMs: 1700000000000}},
+	},
+}
+
+func TestDecodeReadRequestRoundTrip(t *testing.T) {
+	queries := []Query{
+		{StartMs: 1700000000000, EndMs: 1700003600000, Matchers: []Matcher{
+			{Type: MatchEqual, Name: "__name__", Value: "monitaur_cpu_usage_percent"},
+			{Type: MatchRegexp, Name: "server", Value: "web.*"},
+		}},
+		{StartMs: 0, EndMs: 1, Matchers: []Matcher{{Type: MatchNotEqual, Name: "server_id", Value: ""}}},
+	}
+
+	got, err := DecodeReadRequest(encodeReadRequest(queries))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, queries) {
+		t.Errorf("got %+v, want %+v", got, queries)
+	}
+}
+
+func TestEncodeReadResponseRoundTrip(t *testing.T) {
+	data := decompress(t, EncodeReadResponse([]QueryResult{{Timeseries: testSeries}, {}}))
+
+	var results [][]TimeSeries
+	err := eachField(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		results = append(results, decodeSeriesList(t, value))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || len(results[1]) != 0 {
+		t.Fatalf("got %d results, want 2 with the second empty", len(results))
+	}
+	if !reflect.DeepEqual(results[0], testSeries) {
+		t.Errorf("got %+v, want %+v", results[0], testSeries)
+	}
+}
+
+func TestEncodeWriteRequestRoundTrip(t *testing.T) {
+	got := decodeSeriesList(t, decompress(t, EncodeWriteRequest(testSeries)))
+	if !reflect.DeepEqual(got, testSeries) {
+		t.Errorf("got %+v, want %+v", got, testSeries)
+	}
+}
+
+func TestDecodeReadRequestRejectsMalformedInput(t *testing.T) {
+	valid := encodeReadRequest([]Query{{EndMs: 1, Matchers: []Matcher{{Name: "a", Value: "b"}}}})
+	raw := decompress(t, valid)
+
+	// A matcher with an unknown type
+	var badMatcher []byte
+	badMatcher = protowire.AppendTag(badMatcher, 1, protowire.VarintType)
+	badMatcher = protowire.AppendVarint(badMatcher, 7)
+	var badQuery []byte
+	badQuery = protowire.AppendTag(badQuery, 3, protowire.BytesType)
+	badQuery = protowire.AppendBytes(badQuery, badMatcher)
+	var badRequest []byte
+	badRequest = protowire.AppendTag(badRequest, 1, protowire.BytesType)
+	badRequest = protowire.AppendBytes(badRequest, badQuery)
+
+	// A snappy header declaring far more than maxDecodedSize
+	huge := protowire.AppendVarint(nil, 1<<40)
+
+	for name, body := range map[string][]byte{
+		"empty":                 {},
+		"not snappy":            []byte("\xff\xff\xff\xff\xff\xff\xff\xff\xff\xff"),
+		"truncated snappy":      valid[:len(valid)-1],
+		"oversized":             huge,
+		"truncated protobuf":    snappy.Encode(nil, raw[:len(raw)-1]),
+		"invalid wire type":     snappy.Encode(nil, []byte{0x0f}),
+		"unknown matcher type":  snappy.Encode(nil, badRequest),
+		"length past the end":   snappy.Encode(nil, []byte{0x0a, 0x7f, 0x01}),
+		"varint without an end": snappy.Encode(nil, []byte{0x08, 0xff, 0xff}),
+	} {
+		if _, err := DecodeReadRequest(body); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestDecodeReadRequestIgnoresUnknownFields(t *testing.T) {
+	var data []byte
+	data = protowire.AppendTag(data, 9, protowire.BytesType)
+	data = protowire.AppendString(data, "from a newer Prometheus")
+	data = append(data, decompress(t, encodeReadRequest([]Query{{EndMs: 5}}))...)
+
+	queries, err := DecodeReadRequest(snappy.Encode(nil, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 || queries[0].EndMs != 5 {
+		t.Errorf("got %+v, want one query ending at 5", queries)
+	}
+}
+
+func FuzzDecodeReadRequest(f *testing.F) {
+	f.Add(encodeReadRequest([]Query{{EndMs: 1, Matchers: []Matcher{{Type: MatchRegexp, Name: "a", Value: "b"}}}}))
+	f.Add([]byte{})
+	f.Add(snappy.Encode(nil, []byte{0x0a, 0x7f, 0x01}))
+	f.Fuzz(func(t *testing.T, body []byte) {
+		// Must never panic, whatever the client sends
+		DecodeReadRequest(body)
+	})
+}
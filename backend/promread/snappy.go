@@ -0,0 +1,26 @@
+package promread
+
+import (
+	"fmt"
+
+	"github.com/golang/snappy"
+)
+
+// Prometheus remote read and write bodies are compressed with the snappy
+// block format, not the framed stream format.
+
+// maxDecodedSize bounds a decompressed request body
+const maxDecodedSize = 32 << 20
+
+// snappyDecode decompresses a snappy block, checking the size it declares
+// before allocating for it
+func snappyDecode(src []byte) ([]byte, error) {
+	length, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxDecodedSize {
+		return nil, fmt.Errorf("snappy: decoded size %d exceeds %d bytes", length, maxDecodedSize)
+	}
+	return snappy.Decode(nil, src)
+}
@@ -0,0 +1,69 @@
+// Package retention prunes old data on a schedule
+package retention
+
+import (
+	"log"
+	"time"
+
+	"backend/config"
+	"backend/database"
+)
+
+// AlertPruner periodically deletes alerts past their retention window.
+// Resolved and open alerts have separate windows so recent incident history
+// is kept while flappy servers can't grow the alerts table forever.
+type AlertPruner struct {
+	db     *database.Database
+	config *config.AlertRetentionConfig
+}
+
+// NewAlertPruner starts pruning in the background. It returns nil when both
+// retention windows are disabled.
+func NewAlertPruner(db *database.Database, cfg *config.AlertRetentionConfig) *AlertPruner {
+	if cfg.ResolvedDays == 0 && cfg.OpenDays == 0 {
+		return nil
+	}
+
+	p := &AlertPruner{db: db, config: cfg}
+	go p.run()
+
+	log.Printf("Pruning resolved alerts after %d days and open alerts after %d days (0 = never)",
+		cfg.ResolvedDays, cfg.OpenDays)
+	return p
+}
+
+func (p *AlertPruner) run() {
+	ticker := time.NewTicker(time.Duration(p.config.PruneInterval) * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		p.Prune()
+		<-ticker.C
+	}
+}
+
+// Prune runs a single pruning pass
+func (p *AlertPruner) Prune() {
+	now := time.Now()
+	resolvedBefore := cutoff(now, p.config.ResolvedDays)
+	openBefore := cutoff(now, p.config.OpenDays)
+
+	pruned, err := p.db.PruneAlerts(resolvedBefore, openBefore)
+	if err != nil {
+		log.Printf("Error pruning alerts: %v", err)
+		return
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d alerts past retention", pruned)
+	}
+}
+
+// cutoff returns the time before which data older than days is pruned, or
+// nil when days is 0 (keep forever)
+func cutoff(now time.Time, days int) *time.Time {
+	if days <= 0 {
+		return nil
+	}
+	t := now.AddDate(0, 0, -days)
+	return &t
+}
@@ -0,0 +1,63 @@
+package retention
+
+import (
+	"log"
+	"time"
+
+	"backend/config"
+	"backend/database"
+)
+
+// MetricPruner periodically deletes metrics and custom metrics past the
+// database retention period, so the metrics table doesn't grow forever
+type MetricPruner struct {
+	db     *database.Database
+	config *config.DatabaseConfig
+}
+
+// NewMetricPruner starts pruning in the background. It returns nil when
+// metrics are kept forever.
+func NewMetricPruner(db *database.Database, cfg *config.DatabaseConfig) *MetricPruner {
+	if cfg.RetentionDays == 0 {
+		return nil
+	}
+
+	p := &MetricPruner{db: db, config: cfg}
+	go p.run()
+
+	log.Printf("Pruning metrics after %d days", cfg.RetentionDays)
+	return p
+}
+
+func (p *MetricPruner) run() {
+	ticker := time.NewTicker(time.Duration(p.config.PruneInterval) * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		p.Prune()
+		<-ticker.C
+	}
+}
+
+// Prune runs a single pruning pass
+func (p *MetricPruner) Prune() {
+	before := *cutoff(time.Now(), p.config.RetentionDays)
+
+	removed, chunks, err := p.db.PruneMetrics(before)
+	if err != nil {
+		log.Printf("Error pruning metrics: %v", err)
+	} else if removed > 0 {
+		if chunks {
+			log.Printf("Dropped %d metric chunks past retention", removed)
+		} else {
+			log.Printf("Pruned %d metrics past retention", removed)
+		}
+	}
+
+	removed, err = p.db.PruneCustomMetrics(before)
+	if err != nil {
+		log.Printf("Error pruning custom metrics: %v", err)
+	} else if removed > 0 {
+		log.Printf("Pruned %d custom metrics past retention", removed)
+	}
+}
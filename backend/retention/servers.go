@@ -0,0 +1,96 @@
+package retention
+
+import (
+	"log"
+	"time"
+
+	"backend/config"
+	"backend/database"
+)
+
+// StaleServerPruner periodically flags or deletes servers whose agent never
+// connected within a grace period after they were created. Servers nearing
+// the end of the grace period are logged first, as a dry run.
+type StaleServerPruner struct {
+	db     *database.Database
+	config *config.StaleServersConfig
+}
+
+// NewStaleServerPruner starts checking in the background. It returns nil
+// when stale server cleanup is disabled.
+func NewStaleServerPruner(db *database.Database, cfg *config.StaleServersConfig) *StaleServerPruner {
+	if cfg.Action == config.StaleServerActionNone {
+		return nil
+	}
+
+	p := &StaleServerPruner{db: db, config: cfg}
+	go p.run()
+
+	log.Printf("Servers whose agent never connected are handled with action %q after %d days",
+		cfg.Action, cfg.Days)
+	return p
+}
+
+func (p *StaleServerPruner) run() {
+	ticker := time.NewTicker(time.Duration(p.config.CheckInterval) * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		p.Prune()
+		<-ticker.C
+	}
+}
+
+// Prune runs a single pass: it logs servers inside the warning window and
+// acts on those past the grace period
+func (p *StaleServerPruner) Prune() {
+	now := time.Now()
+	graceEnd := now.AddDate(0, 0, -p.config.Days)
+	warnFrom := graceEnd.AddDate(0, 0, p.config.WarnDays)
+
+	servers, err := p.db.GetNeverSeenServers(warnFrom)
+	if err != nil {
+		log.Printf("Error loading never connected servers: %v", err)
+		return
+	}
+
+	var handled int
+	for i := range servers {
+		server := &servers[i]
+		if server.CreatedAt.After(graceEnd) {
+			due := server.CreatedAt.AddDate(0, 0, p.config.Days)
+			log.Printf("Dry run: server %s (ID: %d) has never connected and will be %s on %s",
+				server.Name, server.ID, p.actionVerb(), due.Format("2006-01-02"))
+			continue
+		}
+
+		switch p.config.Action {
+		case config.StaleServerActionDelete:
+			err = p.db.DeleteServer(server)
+		case config.StaleServerActionFlag:
+			if server.StaleSince != nil {
+				continue
+			}
+			err = p.db.FlagServerStale(server.ID, now)
+		}
+		if err != nil {
+			log.Printf("Error handling never connected server %s (ID: %d): %v", server.Name, server.ID, err)
+			continue
+		}
+		log.Printf("Server %s (ID: %d) never connected in %d days, %s",
+			server.Name, server.ID, p.config.Days, p.actionVerb())
+		handled++
+	}
+
+	if handled > 0 {
+		log.Printf("Handled %d never connected servers", handled)
+	}
+}
+
+// actionVerb describes the configured action for logs
+func (p *StaleServerPruner) actionVerb() string {
+	if p.config.Action == config.StaleServerActionDelete {
+		return "deleted"
+	}
+	return "flagged stale"
+}
@@ -0,0 +1,75 @@
+// Package testdb provides the database fixtures shared by the backend's
+// tests. Tests needing a real database run against the disposable one in
+// MONITAUR_TEST_DSN, e.g. "host=localhost user=postgres dbname=monitaur_test
+// sslmode=disable", and are skipped when it is unset.
+package testdb
+
+import (
+	"os"
+	"testing"
+
+	"backend/database"
+	"backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Open connects to the database in MONITAUR_TEST_DSN and migrates it
+func Open(tb testing.TB) *database.Database {
+	tb.Helper()
+	dsn := os.Getenv("MONITAUR_TEST_DSN")
+	if dsn == "" {
+		tb.Skip("MONITAUR_TEST_DSN not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	d := database.NewDatabaseFromGorm(db)
+	if err := d.AutoMigrate(); err != nil {
+		tb.Fatal(err)
+	}
+	return d
+}
+
+// Unreachable returns a database every query of which fails, for testing
+// how failures are handled without a real database
+func Unreachable(tb testing.TB) *database.Database {
+	tb.Helper()
+	dsn := "host=127.0.0.1 port=1 user=none dbname=none sslmode=disable connect_timeout=1"
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return database.NewDatabaseFromGorm(db)
+}
+
+// User creates a user, deleted when the test ends
+func User(tb testing.TB, d *database.Database) *models.User {
+	tb.Helper()
+	user := &models.User{FirebaseUID: uuid.NewString(), Email: "test@example.com"}
+	if err := d.CreateUser(user); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { d.DB.Delete(user) })
+	return user
+}
+
+// Server creates a server owned by user, deleted with its metrics and alerts
+// when the test ends
+func Server(tb testing.TB, d *database.Database, user *models.User, name string) *models.Server {
+	tb.Helper()
+	server := &models.Server{UserID: user.ID, Token: uuid.NewString(), Name: name}
+	if err := d.CreateServer(server); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { d.DeleteServer(server) })
+	return server
+}